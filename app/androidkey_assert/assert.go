@@ -0,0 +1,147 @@
+package androidkey_assert
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/walteh/webauthn/pkg/androidkey"
+	"github.com/walteh/webauthn/pkg/audit"
+	"github.com/walteh/webauthn/pkg/errd"
+	"github.com/walteh/webauthn/pkg/hex"
+	"github.com/walteh/webauthn/pkg/ratelimit"
+	"github.com/walteh/webauthn/pkg/relyingparty"
+	"github.com/walteh/webauthn/pkg/storage"
+	"github.com/walteh/webauthn/pkg/webauthn/types"
+	"github.com/walteh/webauthn/pkg/webauthnerr"
+)
+
+type AndroidKeyAssertionInput struct {
+	RawCredentialID hex.Hash
+	Challenge       hex.Hash
+
+	// Counter is the app's counter for the key, it must increase with every assertion
+	Counter uint64
+
+	// ClientDataToValidate is the request data the app signed, see androidkey.SignedData
+	ClientDataToValidate hex.Hash
+	RawSignature         hex.Hash
+
+	// PackageNames are the package names whose keys are accepted, defaults to the ones of the tenant's policy
+	PackageNames []string
+}
+
+type AndroidKeyAssertionOutput struct {
+	SuggestedStatusCode int
+	OK                  bool
+
+	// PackageName is the package the key was attested for
+	PackageName string
+}
+
+var (
+	ErrAndroidKeyAssertInvalidInput        = errors.New("ErrAndroidKeyAssertInvalidInput")
+	ErrAndroidKeyAssertInvalidCredentialID = errors.New("ErrAndroidKeyAssertInvalidCredentialID")
+	ErrAndroidKeyAssertInvalidChallenge    = errors.New("ErrAndroidKeyAssertInvalidChallenge")
+	ErrAndroidKeyAssertInvalidType         = errors.New("ErrAndroidKeyAssertInvalidType")
+	ErrAndroidKeyAssertInvalidPackage      = errors.New("ErrAndroidKeyAssertInvalidPackage")
+	ErrAndroidKeyAssertNoPackageNames      = errors.New("ErrAndroidKeyAssertNoPackageNames")
+)
+
+func Assert(ctx context.Context, dynamoClient storage.Provider, rp relyingparty.Provider, input AndroidKeyAssertionInput) (res AndroidKeyAssertionOutput, err error) {
+	ev := audit.Event{Type: audit.EventAuthentication, CeremonyType: types.AssertCeremony, CredentialID: audit.Hex(input.RawCredentialID), Format: androidkey.AttestationType}
+	defer func() { audit.Record(ctx, ev.WithError(err)) }()
+
+	limiter, credKey := ratelimit.Ctx(ctx), ratelimit.Credential(input.RawCredentialID.Hex())
+
+	if err := limiter.Allow(ctx, ratelimit.Keys(ctx, credKey)...); err != nil {
+		return fail(err)
+	}
+
+	if err := limiter.Check(ctx, credKey); err != nil {
+		return fail(err)
+	}
+
+	defer func() { limiter.Result(ctx, credKey, err) }()
+
+	if input.RawCredentialID.IsZero() || input.Challenge.IsZero() || input.ClientDataToValidate.IsZero() || input.RawSignature.IsZero() {
+		return fail(errd.Wrap(ctx, webauthnerr.New(webauthnerr.CodeInvalidInput, ErrAndroidKeyAssertInvalidInput)))
+	}
+
+	tenant, err := relyingparty.Resolve(ctx, rp, nil)
+	if err != nil {
+		return fail(errd.Wrap(ctx, err))
+	}
+
+	dynamoClient = tenant.Storage(dynamoClient)
+
+	cerem, cred, err := dynamoClient.GetExisting(ctx, input.Challenge.String(), input.RawCredentialID.String())
+	if err != nil {
+		return fail(errd.Wrap(ctx, webauthnerr.New(webauthnerr.CodeStorageUnavailable, err)))
+	}
+
+	if cerem != nil {
+		ev.Actor = audit.Hex(cerem.SessionID)
+
+		if err := limiter.Allow(ctx, ratelimit.Session(cerem.SessionID.Hex())); err != nil {
+			return fail(err)
+		}
+	}
+	ev = ev.WithCredential(cred)
+
+	if cerem == nil || !cerem.ChallengeID.Equals(input.Challenge) {
+		return fail(errd.Wrap(ctx, webauthnerr.New(webauthnerr.CodeChallengeMismatch, ErrAndroidKeyAssertInvalidChallenge)))
+	}
+
+	if cred == nil || cred.RawID.Hex() != cerem.CredentialID.Hex() {
+		return fail(errd.Wrap(ctx, webauthnerr.New(webauthnerr.CodeCredentialMismatch, ErrAndroidKeyAssertInvalidCredentialID)))
+	}
+
+	if cred.AttestationType != androidkey.AttestationType {
+		return fail(errd.Mismatch(ctx, webauthnerr.New(webauthnerr.CodeCredentialMismatch, ErrAndroidKeyAssertInvalidType), androidkey.AttestationType, cred.AttestationType))
+	}
+
+	packageNames := input.PackageNames
+	if len(packageNames) == 0 {
+		packageNames = tenant.PackageNames()
+	}
+
+	if len(packageNames) == 0 {
+		return fail(errd.Wrap(ctx, webauthnerr.New(webauthnerr.CodeInternal, ErrAndroidKeyAssertNoPackageNames), "no package names are configured"))
+	}
+
+	if !contains(packageNames, cred.AppID) {
+		return fail(errd.Mismatch(ctx, webauthnerr.New(webauthnerr.CodeAppIDMismatch, ErrAndroidKeyAssertInvalidPackage), strings.Join(packageNames, ","), cred.AppID))
+	}
+
+	signed := androidkey.SignedData(input.Counter, cerem.ChallengeID, input.ClientDataToValidate)
+
+	if err := androidkey.VerifySignature(cred.PublicKey, signed, input.RawSignature); err != nil {
+		return fail(errd.Wrap(ctx, webauthnerr.New(webauthnerr.CodeSignatureInvalid, err)))
+	}
+
+	if err := androidkey.VerifyCounter(cred.SignCount, input.Counter); err != nil {
+		return fail(errd.Wrap(ctx, webauthnerr.New(webauthnerr.CodeCounterRegression, err)))
+	}
+
+	// the key counts its own signatures, the received counter is stored so a replayed lower one is refused
+	err = dynamoClient.UpdateExistingCredentialCounter(ctx, cerem, input.RawCredentialID.String(), input.Counter)
+	if err != nil {
+		return fail(errd.Wrap(ctx, webauthnerr.New(webauthnerr.CodeStorageUnavailable, err)))
+	}
+
+	return AndroidKeyAssertionOutput{204, true, cred.AppID}, nil
+}
+
+func contains(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+func fail(err error) (AndroidKeyAssertionOutput, error) {
+	return AndroidKeyAssertionOutput{webauthnerr.HTTPStatus(err), false, ""}, err
+}
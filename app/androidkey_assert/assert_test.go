@@ -0,0 +1,168 @@
+package androidkey_assert_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/webauthn/app/androidkey_assert"
+	"github.com/walteh/webauthn/gen/mockery"
+	"github.com/walteh/webauthn/pkg/androidkey"
+	"github.com/walteh/webauthn/pkg/hex"
+	"github.com/walteh/webauthn/pkg/webauthn/types"
+)
+
+func TestAssert(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	spki, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+
+	credentialID := hex.HexToHash("0x71d091b418c1c76f2e5969a46a9c96a5665b90170bf8218e2e165e505e110489")
+	challenge := hex.HexToHash("0x1dd5d0ab4a2e1b06b4a7d7f2c3e4b9a1e8ee2b1cfb5a3c0a9d4a3bc2e5f60718")
+	data := hex.Hash(`{"amount":100}`)
+
+	sign := func(counter uint64, data []byte) hex.Hash {
+		digest := sha256.Sum256(androidkey.SignedData(counter, challenge, data))
+		sig, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+		require.NoError(t, err)
+		return sig
+	}
+
+	tests := []struct {
+		name        string
+		counter     uint64
+		signCounter uint64
+		signData    hex.Hash
+		edit        func(*types.Credential)
+		noPackages  bool
+		want        androidkey_assert.AndroidKeyAssertionOutput
+		wantErr     error
+	}{
+		{
+			name:        "valid",
+			counter:     3,
+			signCounter: 3,
+			want:        androidkey_assert.AndroidKeyAssertionOutput{SuggestedStatusCode: 204, OK: true, PackageName: "xyz.nugg.app"},
+		},
+		{
+			name:        "counter skipped ahead",
+			counter:     9,
+			signCounter: 9,
+			want:        androidkey_assert.AndroidKeyAssertionOutput{SuggestedStatusCode: 204, OK: true, PackageName: "xyz.nugg.app"},
+		},
+		{
+			name:        "data changed",
+			counter:     3,
+			signCounter: 3,
+			signData:    hex.Hash(`{"amount":1}`),
+			want:        androidkey_assert.AndroidKeyAssertionOutput{SuggestedStatusCode: 401},
+			wantErr:     androidkey.ErrInvalidSignature,
+		},
+		{
+			name:        "counter changed",
+			counter:     4,
+			signCounter: 3,
+			want:        androidkey_assert.AndroidKeyAssertionOutput{SuggestedStatusCode: 401},
+			wantErr:     androidkey.ErrInvalidSignature,
+		},
+		{
+			name:        "counter replayed",
+			counter:     2,
+			signCounter: 2,
+			want:        androidkey_assert.AndroidKeyAssertionOutput{SuggestedStatusCode: 401},
+			wantErr:     androidkey.ErrInvalidCounter,
+		},
+		{
+			name:        "app attest credential",
+			counter:     3,
+			signCounter: 3,
+			edit:        func(c *types.Credential) { c.AttestationType = "apple-appattest" },
+			want:        androidkey_assert.AndroidKeyAssertionOutput{SuggestedStatusCode: 401},
+			wantErr:     androidkey_assert.ErrAndroidKeyAssertInvalidType,
+		},
+		{
+			name:        "package not allowed",
+			counter:     3,
+			signCounter: 3,
+			edit:        func(c *types.Credential) { c.AppID = "com.example.other" },
+			want:        androidkey_assert.AndroidKeyAssertionOutput{SuggestedStatusCode: 401},
+			wantErr:     androidkey_assert.ErrAndroidKeyAssertInvalidPackage,
+		},
+		{
+			name:        "no package names configured",
+			counter:     3,
+			signCounter: 3,
+			noPackages:  true,
+			want:        androidkey_assert.AndroidKeyAssertionOutput{SuggestedStatusCode: 500},
+			wantErr:     androidkey_assert.ErrAndroidKeyAssertNoPackageNames,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := zerolog.New(zerolog.NewConsoleWriter()).With().Caller().Logger().WithContext(context.Background())
+
+			cerem := &types.Ceremony{
+				ChallengeID:  challenge,
+				CredentialID: credentialID,
+				CeremonyType: types.AssertCeremony,
+			}
+
+			cred := &types.Credential{
+				RawID:           credentialID,
+				Type:            types.PublicKeyCredentialType,
+				PublicKey:       spki,
+				AttestationType: androidkey.AttestationType,
+				AppID:           "xyz.nugg.app",
+				SignCount:       2,
+			}
+			if tt.edit != nil {
+				tt.edit(cred)
+			}
+
+			signData := tt.signData
+			if signData == nil {
+				signData = data
+			}
+
+			stgp := mockery.NewMockProvider_storage(t)
+			rpp := mockery.NewMockProvider_relyingparty(t)
+
+			stgp.EXPECT().GetExisting(ctx, challenge.String(), credentialID.String()).Return(cerem, cred, nil)
+			rpp.EXPECT().RPID().Return("xyz.nugg.app").Maybe()
+
+			if tt.wantErr == nil {
+				stgp.EXPECT().UpdateExistingCredentialCounter(ctx, cerem, credentialID.String(), tt.counter).Return(nil)
+			}
+
+			input := androidkey_assert.AndroidKeyAssertionInput{
+				RawCredentialID:      credentialID,
+				Challenge:            challenge,
+				Counter:              tt.counter,
+				ClientDataToValidate: data,
+				RawSignature:         sign(tt.signCounter, signData),
+				PackageNames:         []string{"xyz.nugg.app"},
+			}
+			if tt.noPackages {
+				input.PackageNames = nil
+			}
+
+			got, err := androidkey_assert.Assert(ctx, stgp, rpp, input)
+			if tt.wantErr == nil {
+				require.NoError(t, err)
+			} else {
+				require.ErrorIs(t, err, tt.wantErr)
+			}
+
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,207 @@
+package androidkey_attest
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/walteh/webauthn/pkg/androidkey"
+	"github.com/walteh/webauthn/pkg/audit"
+	"github.com/walteh/webauthn/pkg/errd"
+	"github.com/walteh/webauthn/pkg/hex"
+	"github.com/walteh/webauthn/pkg/playintegrity"
+	"github.com/walteh/webauthn/pkg/ratelimit"
+	"github.com/walteh/webauthn/pkg/relyingparty"
+	"github.com/walteh/webauthn/pkg/storage"
+	"github.com/walteh/webauthn/pkg/webauthn/types"
+	"github.com/walteh/webauthn/pkg/webauthnerr"
+)
+
+type AndroidKeyAttestationInput struct {
+	// CertificateChain is the DER encoded KeyStore chain of the key, leaf first
+	CertificateChain []hex.Hash
+
+	// Challenge is the ceremony challenge the app passed to setAttestationChallenge
+	Challenge       hex.Hash
+	RawCredentialID hex.Hash
+	RawSessionID    hex.Hash
+	Time            *time.Time
+	Roots           *x509.CertPool
+
+	// PackageNames are the package names whose keys are accepted, defaults to the ones of the policy
+	// and then to the relying party id
+	PackageNames []string
+
+	// SignatureDigests are the SHA-256 digests of the certificates the app is signed with
+	SignatureDigests []hex.Hash
+
+	// Policy is the device policy keys must satisfy, defaults to androidkey.DefaultPolicy.
+	// PackageNames and SignatureDigests replace the ones of the policy when set.
+	Policy *androidkey.Policy
+
+	// IntegrityToken is a play integrity token the app requested with playintegrity.Nonce of the ceremony,
+	// it is required when Integrity is set
+	IntegrityToken string
+	Integrity      *playintegrity.Verifier
+
+	// StatusList is a local copy of google's attestation status list, chains are not checked for revocation without one
+	StatusList *androidkey.StatusList
+}
+
+type AndroidKeyAttestationOutput struct {
+	SuggestedStatusCode int
+	OK                  bool
+
+	// PackageName is the allowed package the key was generated by
+	PackageName string
+
+	// IntegrityVerdict is the verdict of the integrity token, when one was verified
+	IntegrityVerdict *playintegrity.Verdict
+}
+
+var (
+	ErrAndroidKeyAttestInvalidInput = errors.New("ErrAndroidKeyAttestInvalidInput")
+
+	ErrAndroidKeyAttestInvalidSessionID = errors.New("ErrAndroidKeyAttestInvalidSessionID")
+
+	ErrAndroidKeyAttestInvalidCredentialID = errors.New("ErrAndroidKeyAttestInvalidCredentialID")
+
+	ErrAndroidKeyAttestInvalidChallenge = errors.New("ErrAndroidKeyAttestInvalidChallenge")
+
+	ErrAndroidKeyAttestDataRead = errors.New("ErrAndroidKeyAttestDataRead")
+
+	ErrAndroidKeyAttestDataWrite = errors.New("ErrAndroidKeyAttestDataWrite")
+
+	ErrAndroidKeyAttestNoPackageNames = errors.New("ErrAndroidKeyAttestNoPackageNames")
+)
+
+func Attest(ctx context.Context, dynamoClient storage.Provider, rp relyingparty.Provider, input AndroidKeyAttestationInput) (res AndroidKeyAttestationOutput, err error) {
+	ev := audit.Event{Type: audit.EventRegistration, CeremonyType: types.CreateCeremony, Actor: audit.Hex(input.RawSessionID), CredentialID: audit.Hex(input.RawCredentialID), Format: androidkey.AttestationType}
+	defer func() { audit.Record(ctx, ev.WithError(err)) }()
+
+	if err := ratelimit.Ctx(ctx).Allow(ctx, ratelimit.Keys(ctx, ratelimit.Session(input.RawSessionID.Hex()))...); err != nil {
+		return fail(err)
+	}
+
+	if len(input.CertificateChain) == 0 || input.Challenge.IsZero() || input.RawCredentialID.IsZero() {
+		return fail(errd.Wrap(ctx, webauthnerr.New(webauthnerr.CodeInvalidInput, ErrAndroidKeyAttestInvalidInput)))
+	}
+
+	tenant, err := relyingparty.Resolve(ctx, rp, nil)
+	if err != nil {
+		return fail(errd.Wrap(ctx, err))
+	}
+
+	dynamoClient = tenant.Storage(dynamoClient)
+
+	cer, _, err := dynamoClient.GetExisting(ctx, input.Challenge.String(), "")
+	if err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Msg("failed to transact get")
+		return fail(errd.Wrap(ctx, webauthnerr.New(webauthnerr.CodeStorageUnavailable, ErrAndroidKeyAttestDataRead)))
+	}
+
+	if cer == nil || !cer.ChallengeID.Equals(input.Challenge) {
+		return fail(errd.Wrap(ctx, webauthnerr.New(webauthnerr.CodeChallengeMismatch, ErrAndroidKeyAttestInvalidChallenge)))
+	}
+
+	if !cer.SessionID.Equals(input.RawSessionID) {
+		return fail(errd.Mismatch(ctx, webauthnerr.New(webauthnerr.CodeSessionMismatch, ErrAndroidKeyAttestInvalidSessionID), cer.SessionID.Hex(), input.RawSessionID.Hex()))
+	}
+
+	policy := androidkey.DefaultPolicy()
+	if input.Policy != nil {
+		policy = *input.Policy
+	}
+
+	if len(input.PackageNames) > 0 {
+		policy.PackageNames = input.PackageNames
+	}
+
+	// without allowed packages any app could register keys, so nothing is accepted
+	if len(policy.PackageNames) == 0 {
+		policy.PackageNames = tenant.PackageNames()
+	}
+
+	if len(policy.PackageNames) == 0 {
+		return fail(errd.Wrap(ctx, webauthnerr.New(webauthnerr.CodeInternal, ErrAndroidKeyAttestNoPackageNames), "no package names are configured"))
+	}
+
+	if len(input.SignatureDigests) > 0 {
+		policy.SignatureDigests = make([][]byte, 0, len(input.SignatureDigests))
+		for _, d := range input.SignatureDigests {
+			policy.SignatureDigests = append(policy.SignatureDigests, d)
+		}
+	}
+
+	verifier := androidkey.NewVerifier().WithPolicy(policy)
+
+	if input.StatusList != nil {
+		verifier = verifier.WithStatusList(input.StatusList)
+	}
+
+	if input.Roots != nil {
+		verifier = verifier.WithRoots(input.Roots)
+	}
+
+	if input.Time != nil {
+		verifier = verifier.WithTime(*input.Time)
+	}
+
+	chain := make([][]byte, 0, len(input.CertificateChain))
+	for _, c := range input.CertificateChain {
+		chain = append(chain, c)
+	}
+
+	att, err := verifier.Verify(ctx, chain, cer.ChallengeID)
+	if err != nil {
+		return fail(errd.Wrap(ctx, webauthnerr.Wrap(err, webauthnerr.CodeAttestationInvalid)))
+	}
+
+	var verdict *playintegrity.Verdict
+	if input.Integrity != nil {
+		verdict, err = input.Integrity.Verify(ctx, input.IntegrityToken, cer)
+		if err != nil {
+			return fail(errd.Wrap(ctx, webauthnerr.Wrap(err, webauthnerr.CodeAttestationInvalid)))
+		}
+	}
+
+	credentialID := hex.Hash(androidkey.CredentialID(att.Certificate))
+
+	ev.AppID = att.PackageName
+
+	if !input.RawCredentialID.Equals(credentialID) {
+		return fail(errd.Mismatch(ctx, webauthnerr.New(webauthnerr.CodeCredentialMismatch, ErrAndroidKeyAttestInvalidCredentialID), input.RawCredentialID.Hex(), credentialID.Hex()))
+	}
+
+	now := time.Now()
+	if input.Time != nil {
+		now = *input.Time
+	}
+
+	cred := &types.Credential{
+		RawID:           credentialID,
+		Type:            types.PublicKeyCredentialType,
+		PublicKey:       att.Certificate.RawSubjectPublicKeyInfo,
+		AttestationType: androidkey.AttestationType,
+		AppID:           att.PackageName,
+		SignCount:       0,
+		CloneWarning:    false,
+		CreatedAt:       uint64(now.Unix()),
+		UpdatedAt:       uint64(now.Unix()),
+		SessionId:       cer.SessionID,
+	}
+
+	err = dynamoClient.WriteNewCredential(ctx, cer, cred)
+	if err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Msg("failed to write new credential")
+		return fail(errd.Wrap(ctx, webauthnerr.New(webauthnerr.CodeStorageUnavailable, ErrAndroidKeyAttestDataWrite)))
+	}
+
+	return AndroidKeyAttestationOutput{204, true, att.PackageName, verdict}, nil
+}
+
+func fail(err error) (AndroidKeyAttestationOutput, error) {
+	return AndroidKeyAttestationOutput{webauthnerr.HTTPStatus(err), false, "", nil}, err
+}
@@ -0,0 +1,204 @@
+package androidkey_attest_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/webauthn/app/androidkey_attest"
+	"github.com/walteh/webauthn/gen/mockery"
+	"github.com/walteh/webauthn/pkg/androidkey"
+	"github.com/walteh/webauthn/pkg/androidkey/androidkeytest"
+	"github.com/walteh/webauthn/pkg/hex"
+	"github.com/walteh/webauthn/pkg/playintegrity"
+	"github.com/walteh/webauthn/pkg/playintegrity/playintegritytest"
+	"github.com/walteh/webauthn/pkg/webauthn/types"
+)
+
+func TestAttest(t *testing.T) {
+	authority := androidkeytest.NewAuthority(t)
+	integrity := playintegritytest.NewIssuer(t)
+	now := time.Now().Truncate(time.Second)
+
+	decryptionKey, err := playintegrity.ParseDecryptionKey(integrity.DecryptionKey())
+	require.NoError(t, err)
+
+	verificationKey, err := playintegrity.ParseVerificationKey(integrity.VerificationKey(t))
+	require.NoError(t, err)
+
+	ceremony := &types.Ceremony{
+		ChallengeID:  hex.HexToHash("0x1dd5d0ab4a2e1b06b4a7d7f2c3e4b9a1e8ee2b1cfb5a3c0a9d4a3bc2e5f60718"),
+		SessionID:    hex.HexToHash("0x3a298ca21194c5ee7920d2ffc5247d6fa0f330a038cf3933e138602660430b8d"),
+		CeremonyType: types.CreateCeremony,
+	}
+
+	tests := []struct {
+		name           string
+		opts           androidkeytest.KeyOptions
+		sessionID      hex.Hash
+		credentialID   func(t *testing.T, chain [][]byte) hex.Hash
+		noPackages     bool
+		want           androidkey_attest.AndroidKeyAttestationOutput
+		integrity      func(*playintegrity.Verdict)
+		wantErr        error
+		wantCredential bool
+	}{
+		{
+			name:           "valid",
+			opts:           androidkeytest.KeyOptions{Challenge: ceremony.ChallengeID},
+			want:           androidkey_attest.AndroidKeyAttestationOutput{SuggestedStatusCode: 204, OK: true, PackageName: androidkeytest.PackageName},
+			wantCredential: true,
+		},
+		{
+			name:           "valid with integrity token",
+			opts:           androidkeytest.KeyOptions{Challenge: ceremony.ChallengeID},
+			integrity:      func(*playintegrity.Verdict) {},
+			want:           androidkey_attest.AndroidKeyAttestationOutput{SuggestedStatusCode: 204, OK: true, PackageName: androidkeytest.PackageName},
+			wantCredential: true,
+		},
+		{
+			name: "unlicensed integrity verdict",
+			opts: androidkeytest.KeyOptions{Challenge: ceremony.ChallengeID},
+			integrity: func(v *playintegrity.Verdict) {
+				v.AccountDetails.AppLicensingVerdict = playintegrity.AppUnlicensed
+			},
+			want:    androidkey_attest.AndroidKeyAttestationOutput{SuggestedStatusCode: 401},
+			wantErr: playintegrity.ErrAppNotLicensed,
+		},
+		{
+			name:    "challenge of another ceremony",
+			opts:    androidkeytest.KeyOptions{Challenge: []byte("another")},
+			want:    androidkey_attest.AndroidKeyAttestationOutput{SuggestedStatusCode: 401},
+			wantErr: androidkey.ErrChallengeMismatch,
+		},
+		{
+			name:      "other session",
+			opts:      androidkeytest.KeyOptions{Challenge: ceremony.ChallengeID},
+			sessionID: hex.HexToHash("0x01"),
+			want:      androidkey_attest.AndroidKeyAttestationOutput{SuggestedStatusCode: 401},
+			wantErr:   androidkey_attest.ErrAndroidKeyAttestInvalidSessionID,
+		},
+		{
+			name:    "package not allowed",
+			opts:    androidkeytest.KeyOptions{Challenge: ceremony.ChallengeID, PackageNames: []string{"com.example.other"}},
+			want:    androidkey_attest.AndroidKeyAttestationOutput{SuggestedStatusCode: 401},
+			wantErr: androidkey.ErrPackageNotAllowed,
+		},
+		{
+			name:    "unlocked device",
+			opts:    androidkeytest.KeyOptions{Challenge: ceremony.ChallengeID, Unlocked: true},
+			want:    androidkey_attest.AndroidKeyAttestationOutput{SuggestedStatusCode: 401},
+			wantErr: androidkey.ErrPolicy,
+		},
+		{
+			name: "credential id of another key",
+			opts: androidkeytest.KeyOptions{Challenge: ceremony.ChallengeID},
+			credentialID: func(*testing.T, [][]byte) hex.Hash {
+				return hex.HexToHash("0x71d091b418c1c76f2e5969a46a9c96a5665b90170bf8218e2e165e505e110489")
+			},
+			want:    androidkey_attest.AndroidKeyAttestationOutput{SuggestedStatusCode: 401},
+			wantErr: androidkey_attest.ErrAndroidKeyAttestInvalidCredentialID,
+		},
+		{
+			name:       "no package names configured",
+			opts:       androidkeytest.KeyOptions{Challenge: ceremony.ChallengeID},
+			noPackages: true,
+			want:       androidkey_attest.AndroidKeyAttestationOutput{SuggestedStatusCode: 500},
+			wantErr:    androidkey_attest.ErrAndroidKeyAttestNoPackageNames,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := zerolog.New(zerolog.NewConsoleWriter()).With().Caller().Logger().WithContext(context.Background())
+
+			_, chain := authority.Issue(t, tt.opts)
+
+			credentialID := tt.credentialID
+			if credentialID == nil {
+				credentialID = leafCredentialID
+			}
+
+			sessionID := tt.sessionID
+			if sessionID == nil {
+				sessionID = ceremony.SessionID
+			}
+
+			input := androidkey_attest.AndroidKeyAttestationInput{
+				Challenge:        ceremony.ChallengeID,
+				RawCredentialID:  credentialID(t, chain),
+				RawSessionID:     sessionID,
+				Time:             &now,
+				Roots:            authority.Roots(),
+				PackageNames:     []string{androidkeytest.PackageName},
+				SignatureDigests: []hex.Hash{androidkeytest.SignatureDigest},
+			}
+			for _, c := range chain {
+				input.CertificateChain = append(input.CertificateChain, c)
+			}
+
+			if tt.noPackages {
+				input.PackageNames = nil
+			}
+
+			if tt.integrity != nil {
+				verdict := playintegritytest.Verdict(playintegrity.Nonce(ceremony))
+				tt.integrity(&verdict)
+
+				input.IntegrityToken = integrity.Token(t, verdict)
+				input.Integrity = playintegrity.NewVerifier(playintegritytest.PackageName, decryptionKey, verificationKey)
+			}
+
+			stgp := mockery.NewMockProvider_storage(t)
+			rpp := mockery.NewMockProvider_relyingparty(t)
+
+			stgp.EXPECT().GetExisting(ctx, ceremony.ChallengeID.String(), "").Return(ceremony, nil, nil)
+
+			if tt.wantCredential {
+				stgp.EXPECT().WriteNewCredential(ctx, ceremony, mock.MatchedBy(func(cred *types.Credential) bool {
+					return assert.Equal(t, &types.Credential{
+						RawID:           leafCredentialID(t, chain),
+						Type:            types.PublicKeyCredentialType,
+						PublicKey:       leafSPKI(t, chain),
+						AttestationType: androidkey.AttestationType,
+						AppID:           androidkeytest.PackageName,
+						CreatedAt:       uint64(now.Unix()),
+						UpdatedAt:       uint64(now.Unix()),
+						SessionId:       ceremony.SessionID,
+					}, cred)
+				})).Return(nil)
+			}
+
+			got, err := androidkey_attest.Attest(ctx, stgp, rpp, input)
+			if tt.wantErr == nil {
+				require.NoError(t, err)
+			} else {
+				require.ErrorIs(t, err, tt.wantErr)
+			}
+
+			if tt.integrity != nil && tt.wantErr == nil {
+				require.NotNil(t, got.IntegrityVerdict)
+				assert.Equal(t, playintegrity.AppLicensed, got.IntegrityVerdict.AccountDetails.AppLicensingVerdict)
+				got.IntegrityVerdict = nil
+			}
+
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func leafSPKI(t *testing.T, chain [][]byte) []byte {
+	cert, err := x509.ParseCertificate(chain[0])
+	require.NoError(t, err)
+	return cert.RawSubjectPublicKeyInfo
+}
+
+func leafCredentialID(t *testing.T, chain [][]byte) hex.Hash {
+	sum := sha256.Sum256(leafSPKI(t, chain))
+	return sum[:]
+}
@@ -0,0 +1,83 @@
+package ceremony_begin
+
+import (
+	"context"
+	"errors"
+
+	"github.com/rs/zerolog"
+	"github.com/walteh/webauthn/pkg/audit"
+	"github.com/walteh/webauthn/pkg/errd"
+	"github.com/walteh/webauthn/pkg/hex"
+	"github.com/walteh/webauthn/pkg/ratelimit"
+	"github.com/walteh/webauthn/pkg/relyingparty"
+	"github.com/walteh/webauthn/pkg/storage"
+	"github.com/walteh/webauthn/pkg/webauthn/types"
+	"github.com/walteh/webauthn/pkg/webauthnerr"
+)
+
+type BeginInput struct {
+	RawSessionID hex.Hash
+
+	// RawCredentialID is the credential the ceremony is for. Assertions are only accepted from it, it is
+	// optional for registrations.
+	RawCredentialID hex.Hash
+
+	CeremonyType types.CeremonyType
+}
+
+type BeginOutput struct {
+	SuggestedStatusCode int
+
+	// Challenge is the challenge the client signs over, it identifies the ceremony until ExpiresAt
+	Challenge hex.Hash
+	ExpiresAt uint64
+}
+
+var (
+	ErrBeginInvalidInput = errors.New("ErrBeginInvalidInput")
+
+	ErrBeginDataWrite = errors.New("ErrBeginDataWrite")
+)
+
+// Begin issues the challenge of a registration or an assertion and stores the ceremony the finishing
+// flows read back
+func Begin(ctx context.Context, dynamoClient storage.Provider, input BeginInput) (res BeginOutput, err error) {
+	ev := audit.Event{Type: audit.EventCeremonyBegin, CeremonyType: input.CeremonyType, Actor: audit.Hex(input.RawSessionID), CredentialID: audit.Hex(input.RawCredentialID)}
+	defer func() { audit.Record(ctx, ev.WithError(err)) }()
+
+	if err := ratelimit.Ctx(ctx).Allow(ctx, ratelimit.Keys(ctx, ratelimit.Session(input.RawSessionID.Hex()), ratelimit.Credential(input.RawCredentialID.Hex()))...); err != nil {
+		return fail(err)
+	}
+
+	if input.RawSessionID.IsZero() {
+		return fail(errd.Wrap(ctx, webauthnerr.New(webauthnerr.CodeInvalidInput, ErrBeginInvalidInput), "missing session id"))
+	}
+
+	switch input.CeremonyType {
+	case types.CreateCeremony:
+	case types.AssertCeremony:
+		if input.RawCredentialID.IsZero() {
+			return fail(errd.Wrap(ctx, webauthnerr.New(webauthnerr.CodeInvalidInput, ErrBeginInvalidInput), "missing credential id"))
+		}
+	default:
+		return fail(errd.Wrap(ctx, webauthnerr.New(webauthnerr.CodeInvalidInput, ErrBeginInvalidInput), "unknown ceremony type", string(input.CeremonyType)))
+	}
+
+	tenant, err := relyingparty.Resolve(ctx, nil, nil)
+	if err != nil {
+		return fail(errd.Wrap(ctx, err))
+	}
+
+	cer := types.NewCeremony(input.RawCredentialID, input.RawSessionID, input.CeremonyType)
+
+	if err := tenant.Storage(dynamoClient).WriteNewCeremony(ctx, cer); err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Msg("failed to write new ceremony")
+		return fail(errd.Wrap(ctx, webauthnerr.New(webauthnerr.CodeStorageUnavailable, ErrBeginDataWrite)))
+	}
+
+	return BeginOutput{200, cer.ChallengeID, cer.Ttl}, nil
+}
+
+func fail(err error) (BeginOutput, error) {
+	return BeginOutput{webauthnerr.HTTPStatus(err), nil, 0}, err
+}
@@ -0,0 +1,165 @@
+package ceremony_begin_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/webauthn/app/ceremony_begin"
+	"github.com/walteh/webauthn/gen/mockery"
+	"github.com/walteh/webauthn/pkg/audit"
+	"github.com/walteh/webauthn/pkg/hex"
+	"github.com/walteh/webauthn/pkg/ratelimit"
+	"github.com/walteh/webauthn/pkg/relyingparty"
+	"github.com/walteh/webauthn/pkg/webauthn/types"
+	"github.com/walteh/webauthn/pkg/webauthnerr"
+)
+
+func TestBegin(t *testing.T) {
+	sessionID := hex.HexToHash("0x3a298ca21194c5ee7920d2ffc5247d6fa0f330a038cf3933e138602660430b8d")
+	credentialID := hex.HexToHash("0xfb1fd0ac98dca2891761baf97a486c75726900d3a94105afa598575f89c47295")
+
+	tests := []struct {
+		name       string
+		input      ceremony_begin.BeginInput
+		writeErr   error
+		wantStatus int
+		wantErr    error
+	}{
+		{
+			name:       "registration",
+			input:      ceremony_begin.BeginInput{RawSessionID: sessionID, CeremonyType: types.CreateCeremony},
+			wantStatus: 200,
+		},
+		{
+			name:       "assertion",
+			input:      ceremony_begin.BeginInput{RawSessionID: sessionID, RawCredentialID: credentialID, CeremonyType: types.AssertCeremony},
+			wantStatus: 200,
+		},
+		{
+			name:       "assertion without credential",
+			input:      ceremony_begin.BeginInput{RawSessionID: sessionID, CeremonyType: types.AssertCeremony},
+			wantStatus: 400,
+			wantErr:    ceremony_begin.ErrBeginInvalidInput,
+		},
+		{
+			name:       "without session",
+			input:      ceremony_begin.BeginInput{CeremonyType: types.CreateCeremony},
+			wantStatus: 400,
+			wantErr:    ceremony_begin.ErrBeginInvalidInput,
+		},
+		{
+			name:       "unknown ceremony type",
+			input:      ceremony_begin.BeginInput{RawSessionID: sessionID, CeremonyType: "webauthn.other"},
+			wantStatus: 400,
+			wantErr:    ceremony_begin.ErrBeginInvalidInput,
+		},
+		{
+			name:       "storage failure",
+			input:      ceremony_begin.BeginInput{RawSessionID: sessionID, CeremonyType: types.CreateCeremony},
+			writeErr:   errors.New("throttled"),
+			wantStatus: 502,
+			wantErr:    ceremony_begin.ErrBeginDataWrite,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := zerolog.New(zerolog.NewConsoleWriter()).With().Caller().Logger().WithContext(context.Background())
+
+			events := audit.NewMemory()
+			ctx = audit.WithSink(ctx, events)
+
+			stgp := mockery.NewMockProvider_storage(t)
+
+			var written *types.Ceremony
+			if tt.wantErr == nil || tt.writeErr != nil {
+				stgp.EXPECT().WriteNewCeremony(ctx, mock.Anything).RunAndReturn(func(_ context.Context, c *types.Ceremony) error {
+					written = c
+					return tt.writeErr
+				})
+			}
+
+			got, err := ceremony_begin.Begin(ctx, stgp, tt.input)
+			assert.Equal(t, tt.wantStatus, got.SuggestedStatusCode)
+
+			recorded := events.Events()
+			require.Len(t, recorded, 1)
+			assert.Equal(t, audit.EventCeremonyBegin, recorded[0].Type)
+			assert.Equal(t, tt.input.CeremonyType, recorded[0].CeremonyType)
+
+			if tt.wantErr != nil {
+				assert.Equal(t, audit.OutcomeFailure, recorded[0].Outcome)
+				assert.Equal(t, webauthnerr.CodeOf(err), recorded[0].Reason)
+				require.ErrorIs(t, err, tt.wantErr)
+				assert.Nil(t, got.Challenge)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, audit.OutcomeSuccess, recorded[0].Outcome)
+			assert.Equal(t, tt.input.RawSessionID.Hex(), recorded[0].Actor)
+			assert.Len(t, got.Challenge, 32)
+			assert.Equal(t, written.ChallengeID, got.Challenge)
+			assert.Equal(t, written.Ttl, got.ExpiresAt)
+			assert.Equal(t, tt.input.RawSessionID, written.SessionID)
+			assert.Equal(t, tt.input.RawCredentialID, written.CredentialID)
+			assert.Equal(t, tt.input.CeremonyType, written.CeremonyType)
+		})
+	}
+}
+
+func TestBeginRateLimited(t *testing.T) {
+	sessionID := hex.HexToHash("0x3a298ca21194c5ee7920d2ffc5247d6fa0f330a038cf3933e138602660430b8d")
+
+	limiter := ratelimit.NewLimiter(ratelimit.NewMemory()).WithRate(ratelimit.ScopeSession, ratelimit.Rate{Burst: 1, Every: time.Hour})
+
+	ctx := zerolog.New(zerolog.NewConsoleWriter()).With().Caller().Logger().WithContext(context.Background())
+	ctx = ratelimit.WithLimiter(ctx, limiter)
+
+	stgp := mockery.NewMockProvider_storage(t)
+	stgp.EXPECT().WriteNewCeremony(ctx, mock.Anything).Return(nil).Once()
+
+	input := ceremony_begin.BeginInput{RawSessionID: sessionID, CeremonyType: types.CreateCeremony}
+
+	_, err := ceremony_begin.Begin(ctx, stgp, input)
+	require.NoError(t, err)
+
+	got, err := ceremony_begin.Begin(ctx, stgp, input)
+	require.ErrorIs(t, err, ratelimit.ErrRateLimited)
+	assert.Equal(t, 429, got.SuggestedStatusCode)
+	assert.Equal(t, webauthnerr.CodeRateLimited, webauthnerr.CodeOf(err))
+}
+
+func TestBeginTenant(t *testing.T) {
+	sessionID := hex.HexToHash("0x3a298ca21194c5ee7920d2ffc5247d6fa0f330a038cf3933e138602660430b8d")
+
+	acmeStorage := mockery.NewMockProvider_storage(t)
+	globexStorage := mockery.NewMockProvider_storage(t)
+	defaultStorage := mockery.NewMockProvider_storage(t)
+
+	reg, err := relyingparty.NewRegistry(nil,
+		relyingparty.NewTenant("acme", relyingparty.NewSimpleRelyingParty("Acme", "acme.com", "https://acme.com")).WithStorage(acmeStorage),
+		relyingparty.NewTenant("globex", relyingparty.NewSimpleRelyingParty("Globex", "globex.io", "https://globex.io")).WithStorage(globexStorage),
+	)
+	require.NoError(t, err)
+
+	ctx := zerolog.New(zerolog.NewConsoleWriter()).With().Caller().Logger().WithContext(context.Background())
+	ctx = relyingparty.WithResolver(ctx, reg)
+
+	input := ceremony_begin.BeginInput{RawSessionID: sessionID, CeremonyType: types.CreateCeremony}
+
+	globexCtx := relyingparty.WithHint(ctx, relyingparty.Hint{Host: "globex.io"})
+	globexStorage.EXPECT().WriteNewCeremony(globexCtx, mock.Anything).Return(nil).Once()
+
+	_, err = ceremony_begin.Begin(globexCtx, defaultStorage, input)
+	require.NoError(t, err)
+
+	got, err := ceremony_begin.Begin(relyingparty.WithHint(ctx, relyingparty.Hint{Host: "initech.com"}), defaultStorage, input)
+	require.ErrorIs(t, err, relyingparty.ErrUnknownTenant)
+	assert.Equal(t, 404, got.SuggestedStatusCode)
+}
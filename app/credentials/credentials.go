@@ -0,0 +1,165 @@
+package credentials
+
+import (
+	"context"
+	"errors"
+
+	"github.com/rs/zerolog"
+	"github.com/walteh/webauthn/pkg/accesstoken"
+	"github.com/walteh/webauthn/pkg/audit"
+	"github.com/walteh/webauthn/pkg/errd"
+	"github.com/walteh/webauthn/pkg/hex"
+	"github.com/walteh/webauthn/pkg/relyingparty"
+	"github.com/walteh/webauthn/pkg/storage"
+	"github.com/walteh/webauthn/pkg/webauthn/types"
+	"github.com/walteh/webauthn/pkg/webauthnerr"
+)
+
+// ListInput and DeleteInput carry the access token a ceremony issued, the session is the one that
+// registered the credential the token was issued for. A session id sent by the client is never trusted.
+type ListInput struct {
+	AccessToken string
+}
+
+type ListOutput struct {
+	SuggestedStatusCode int
+	Credentials         []*types.Credential
+}
+
+type DeleteInput struct {
+	AccessToken     string
+	RawCredentialID hex.Hash
+}
+
+type DeleteOutput struct {
+	SuggestedStatusCode int
+	OK                  bool
+}
+
+var (
+	ErrCredentialsInvalidInput = errors.New("ErrCredentialsInvalidInput")
+
+	ErrCredentialsNotFound = errors.New("ErrCredentialsNotFound")
+
+	ErrCredentialsInvalidSessionID = errors.New("ErrCredentialsInvalidSessionID")
+
+	ErrCredentialsInvalidAccessToken = errors.New("ErrCredentialsInvalidAccessToken")
+
+	ErrCredentialsDataRead = errors.New("ErrCredentialsDataRead")
+
+	ErrCredentialsDataWrite = errors.New("ErrCredentialsDataWrite")
+)
+
+// List returns the credentials registered by the session of the access token
+func List(ctx context.Context, dynamoClient storage.Provider, tokens accesstoken.Validator, input ListInput) (res ListOutput, err error) {
+	ev := audit.Event{Type: audit.EventCredentialList}
+	defer func() { audit.Record(ctx, ev.WithError(err)) }()
+
+	if input.AccessToken == "" {
+		return failList(errd.Wrap(ctx, webauthnerr.New(webauthnerr.CodeInvalidInput, ErrCredentialsInvalidInput), "missing access token"))
+	}
+
+	tenant, err := relyingparty.Resolve(ctx, nil, nil)
+	if err != nil {
+		return failList(errd.Wrap(ctx, err))
+	}
+
+	dynamoClient = tenant.Storage(dynamoClient)
+
+	sessionID, err := sessionOf(ctx, dynamoClient, tokens, input.AccessToken)
+	if err != nil {
+		return failList(err)
+	}
+
+	ev.Actor = audit.Hex(sessionID)
+
+	creds, err := dynamoClient.ListCredentials(ctx, sessionID.Hex())
+	if err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Msg("failed to list credentials")
+		return failList(errd.Wrap(ctx, webauthnerr.New(webauthnerr.CodeStorageUnavailable, ErrCredentialsDataRead)))
+	}
+
+	return ListOutput{200, creds}, nil
+}
+
+// Delete removes a credential, only the session that registered it may remove it
+func Delete(ctx context.Context, dynamoClient storage.Provider, tokens accesstoken.Validator, input DeleteInput) (res DeleteOutput, err error) {
+	ev := audit.Event{Type: audit.EventCredentialDelete, CredentialID: audit.Hex(input.RawCredentialID)}
+	defer func() { audit.Record(ctx, ev.WithError(err)) }()
+
+	if input.AccessToken == "" || input.RawCredentialID.IsZero() {
+		return failDelete(errd.Wrap(ctx, webauthnerr.New(webauthnerr.CodeInvalidInput, ErrCredentialsInvalidInput)))
+	}
+
+	tenant, err := relyingparty.Resolve(ctx, nil, nil)
+	if err != nil {
+		return failDelete(errd.Wrap(ctx, err))
+	}
+
+	dynamoClient = tenant.Storage(dynamoClient)
+
+	sessionID, err := sessionOf(ctx, dynamoClient, tokens, input.AccessToken)
+	if err != nil {
+		return failDelete(err)
+	}
+
+	ev.Actor = audit.Hex(sessionID)
+
+	cred, err := dynamoClient.GetExistingCredential(ctx, input.RawCredentialID.Hex())
+	if errors.Is(err, storage.ErrNotFound) {
+		return failDelete(errd.Wrap(ctx, webauthnerr.New(webauthnerr.CodeCredentialNotFound, ErrCredentialsNotFound), input.RawCredentialID.Hex()))
+	}
+	if err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Msg("failed to get credential")
+		return failDelete(errd.Wrap(ctx, webauthnerr.New(webauthnerr.CodeStorageUnavailable, ErrCredentialsDataRead)))
+	}
+
+	ev = ev.WithCredential(cred)
+
+	if !cred.SessionId.Equals(sessionID) {
+		return failDelete(errd.Mismatch(ctx, webauthnerr.New(webauthnerr.CodeCredentialNotOwned, ErrCredentialsInvalidSessionID), cred.SessionId.Hex(), sessionID.Hex()))
+	}
+
+	if err := dynamoClient.DeleteCredential(ctx, input.RawCredentialID.Hex()); err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Msg("failed to delete credential")
+		return failDelete(errd.Wrap(ctx, webauthnerr.New(webauthnerr.CodeStorageUnavailable, ErrCredentialsDataWrite)))
+	}
+
+	return DeleteOutput{204, true}, nil
+}
+
+// sessionOf verifies the access token and returns the session that registered the credential it was issued for
+func sessionOf(ctx context.Context, dynamoClient storage.Provider, tokens accesstoken.Validator, token string) (hex.Hash, error) {
+	if tokens == nil {
+		return nil, errd.Wrap(ctx, webauthnerr.New(webauthnerr.CodeAccessTokenInvalid, ErrCredentialsInvalidAccessToken), "no access token validator")
+	}
+
+	userID, err := tokens.UserIDForAccessToken(ctx, token)
+	if err != nil || userID == "" {
+		return nil, errd.Wrap(ctx, webauthnerr.New(webauthnerr.CodeAccessTokenInvalid, ErrCredentialsInvalidAccessToken))
+	}
+
+	owner, err := dynamoClient.GetExistingCredential(ctx, hex.HexToHash(userID).Hex())
+	if errors.Is(err, storage.ErrNotFound) {
+		// the credential the token was issued for was deleted since
+		return nil, errd.Wrap(ctx, webauthnerr.New(webauthnerr.CodeAccessTokenInvalid, ErrCredentialsInvalidAccessToken), userID)
+	}
+	if err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Msg("failed to get credential of access token")
+		return nil, errd.Wrap(ctx, webauthnerr.New(webauthnerr.CodeStorageUnavailable, ErrCredentialsDataRead))
+	}
+
+	if owner.SessionId.IsZero() {
+		return nil, errd.Wrap(ctx, webauthnerr.New(webauthnerr.CodeAccessTokenInvalid, ErrCredentialsInvalidAccessToken), "credential has no session")
+	}
+
+	return owner.SessionId, nil
+}
+
+func failList(err error) (ListOutput, error) {
+	return ListOutput{webauthnerr.HTTPStatus(err), nil}, err
+}
+
+func failDelete(err error) (DeleteOutput, error) {
+	return DeleteOutput{webauthnerr.HTTPStatus(err), false}, err
+}
@@ -0,0 +1,162 @@
+package credentials_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/webauthn/app/credentials"
+	"github.com/walteh/webauthn/gen/mockery"
+	"github.com/walteh/webauthn/pkg/hex"
+	"github.com/walteh/webauthn/pkg/storage"
+	"github.com/walteh/webauthn/pkg/webauthn/types"
+)
+
+var (
+	sessionID    = hex.HexToHash("0x3a298ca21194c5ee7920d2ffc5247d6fa0f330a038cf3933e138602660430b8d")
+	credentialID = hex.HexToHash("0xfb1fd0ac98dca2891761baf97a486c75726900d3a94105afa598575f89c47295")
+	tokenCredID  = hex.HexToHash("0x8d1b3ee6c2f8a1fe93e0f4c1a8d54ab6b2b3fe1f0d0b96a1cf02a6b0a2c7b1d4")
+
+	existingCredential = &types.Credential{
+		RawID:           credentialID,
+		SessionId:       sessionID,
+		AttestationType: "apple-appattest",
+	}
+
+	// tokenCredential is the credential the access token of the tests was issued for
+	tokenCredential = &types.Credential{
+		RawID:           tokenCredID,
+		SessionId:       sessionID,
+		AttestationType: "none",
+	}
+)
+
+// staticTokens maps access tokens to the user id they were issued for
+type staticTokens map[string]string
+
+func (me staticTokens) UserIDForAccessToken(_ context.Context, token string) (string, error) {
+	id, ok := me[token]
+	if !ok {
+		return "", errors.New("unknown token")
+	}
+	return id, nil
+}
+
+var tokens = staticTokens{"token": tokenCredID.Hex()}
+
+func testContext() context.Context {
+	return zerolog.New(zerolog.NewConsoleWriter()).With().Caller().Logger().WithContext(context.Background())
+}
+
+func TestList(t *testing.T) {
+	ctx := testContext()
+
+	stgp := mockery.NewMockProvider_storage(t)
+	stgp.EXPECT().GetExistingCredential(ctx, tokenCredID.Hex()).Return(tokenCredential, nil)
+	stgp.EXPECT().ListCredentials(ctx, sessionID.Hex()).Return([]*types.Credential{existingCredential}, nil).Once()
+
+	got, err := credentials.List(ctx, stgp, tokens, credentials.ListInput{AccessToken: "token"})
+	require.NoError(t, err)
+	assert.Equal(t, credentials.ListOutput{SuggestedStatusCode: 200, Credentials: []*types.Credential{existingCredential}}, got)
+
+	stgp.EXPECT().ListCredentials(ctx, sessionID.Hex()).Return(nil, errors.New("throttled")).Once()
+
+	got, err = credentials.List(ctx, stgp, tokens, credentials.ListInput{AccessToken: "token"})
+	require.ErrorIs(t, err, credentials.ErrCredentialsDataRead)
+	assert.Equal(t, 502, got.SuggestedStatusCode)
+
+	got, err = credentials.List(ctx, stgp, tokens, credentials.ListInput{})
+	require.ErrorIs(t, err, credentials.ErrCredentialsInvalidInput)
+	assert.Equal(t, 400, got.SuggestedStatusCode)
+
+	got, err = credentials.List(ctx, stgp, tokens, credentials.ListInput{AccessToken: "forged"})
+	require.ErrorIs(t, err, credentials.ErrCredentialsInvalidAccessToken)
+	assert.Equal(t, 401, got.SuggestedStatusCode)
+
+	got, err = credentials.List(ctx, stgp, nil, credentials.ListInput{AccessToken: "token"})
+	require.ErrorIs(t, err, credentials.ErrCredentialsInvalidAccessToken)
+	assert.Equal(t, 401, got.SuggestedStatusCode)
+}
+
+func TestDelete(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      credentials.DeleteInput
+		stored     *types.Credential
+		getErr     error
+		deleteErr  error
+		want       credentials.DeleteOutput
+		wantErr    error
+		wantDelete bool
+	}{
+		{
+			name:       "own credential",
+			input:      credentials.DeleteInput{AccessToken: "token", RawCredentialID: credentialID},
+			stored:     existingCredential,
+			want:       credentials.DeleteOutput{SuggestedStatusCode: 204, OK: true},
+			wantDelete: true,
+		},
+		{
+			name:    "credential of other session",
+			input:   credentials.DeleteInput{AccessToken: "token", RawCredentialID: credentialID},
+			stored:  &types.Credential{RawID: credentialID, SessionId: hex.HexToHash("0x01")},
+			want:    credentials.DeleteOutput{SuggestedStatusCode: 403},
+			wantErr: credentials.ErrCredentialsInvalidSessionID,
+		},
+		{
+			name:    "forged access token",
+			input:   credentials.DeleteInput{AccessToken: "forged", RawCredentialID: credentialID},
+			want:    credentials.DeleteOutput{SuggestedStatusCode: 401},
+			wantErr: credentials.ErrCredentialsInvalidAccessToken,
+		},
+		{
+			name:    "unknown credential",
+			input:   credentials.DeleteInput{AccessToken: "token", RawCredentialID: credentialID},
+			getErr:  storage.ErrNotFound,
+			want:    credentials.DeleteOutput{SuggestedStatusCode: 404},
+			wantErr: credentials.ErrCredentialsNotFound,
+		},
+		{
+			name:       "delete failure",
+			input:      credentials.DeleteInput{AccessToken: "token", RawCredentialID: credentialID},
+			stored:     existingCredential,
+			deleteErr:  errors.New("throttled"),
+			want:       credentials.DeleteOutput{SuggestedStatusCode: 502},
+			wantErr:    credentials.ErrCredentialsDataWrite,
+			wantDelete: true,
+		},
+		{
+			name:    "missing credential id",
+			input:   credentials.DeleteInput{AccessToken: "token"},
+			want:    credentials.DeleteOutput{SuggestedStatusCode: 400},
+			wantErr: credentials.ErrCredentialsInvalidInput,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := testContext()
+
+			stgp := mockery.NewMockProvider_storage(t)
+
+			if tt.stored != nil || tt.getErr != nil {
+				stgp.EXPECT().GetExistingCredential(ctx, tokenCredID.Hex()).Return(tokenCredential, nil)
+				stgp.EXPECT().GetExistingCredential(ctx, credentialID.Hex()).Return(tt.stored, tt.getErr)
+			}
+			if tt.wantDelete {
+				stgp.EXPECT().DeleteCredential(ctx, credentialID.Hex()).Return(tt.deleteErr)
+			}
+
+			got, err := credentials.Delete(ctx, stgp, tokens, tt.input)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+			} else {
+				require.NoError(t, err)
+			}
+
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -2,96 +2,211 @@ package devicecheck_assert
 
 import (
 	"context"
+	"errors"
+	"strings"
 
+	"github.com/walteh/webauthn/pkg/audit"
+	"github.com/walteh/webauthn/pkg/errd"
+	"github.com/walteh/webauthn/pkg/ratelimit"
 	"github.com/walteh/webauthn/pkg/relyingparty"
 	"github.com/walteh/webauthn/pkg/storage"
 
 	"github.com/walteh/webauthn/pkg/hex"
 	"github.com/walteh/webauthn/pkg/webauthn/assertion"
+	"github.com/walteh/webauthn/pkg/webauthn/authdata"
 	"github.com/walteh/webauthn/pkg/webauthn/clientdata"
 	"github.com/walteh/webauthn/pkg/webauthn/extensions"
 	"github.com/walteh/webauthn/pkg/webauthn/providers"
 	"github.com/walteh/webauthn/pkg/webauthn/types"
-
-	"github.com/walteh/terrors"
+	"github.com/walteh/webauthn/pkg/webauthnerr"
 )
 
 type DeviceCheckAssertionInput struct {
 	RawAssertionObject   hex.Hash
 	ClientDataToValidate hex.Hash
+
+	// AppIDs are the "TEAMID.bundle.id" app ids whose credentials are accepted, defaults to the relying party id
+	AppIDs []string
 }
 
 type DeviceCheckAssertionOutput struct {
 	SuggestedStatusCode int
 	OK                  bool
+
+	// AppID is the allowed app id the assertion was made for
+	AppID string
 }
 
-func Assert(ctx context.Context, dynamoClient storage.Provider, rp relyingparty.Provider, input DeviceCheckAssertionInput) (DeviceCheckAssertionOutput, error) {
-	var err error
+var (
+	ErrDeviceCheckAssertInvalidInput        = errors.New("ErrDeviceCheckAssertInvalidInput")
+	ErrDeviceCheckAssertInvalidCredentialID = errors.New("ErrDeviceCheckAssertInvalidCredentialID")
+	ErrDeviceCheckAssertInvalidChallenge    = errors.New("ErrDeviceCheckAssertInvalidChallenge")
+	ErrDeviceCheckAssertInvalidType         = errors.New("ErrDeviceCheckAssertInvalidType")
+	ErrDeviceCheckAssertInvalidEnvironment  = errors.New("ErrDeviceCheckAssertInvalidEnvironment")
+	ErrDeviceCheckAssertInvalidAppID        = errors.New("ErrDeviceCheckAssertInvalidAppID")
+)
+
+func Assert(ctx context.Context, dynamoClient storage.Provider, rp relyingparty.Provider, input DeviceCheckAssertionInput) (res DeviceCheckAssertionOutput, err error) {
+	ev := audit.Event{Type: audit.EventAuthentication, CeremonyType: types.AssertCeremony}
+	defer func() { audit.Record(ctx, ev.WithError(err)) }()
+
+	limiter := ratelimit.Ctx(ctx)
+
+	if err := limiter.Allow(ctx, ratelimit.Keys(ctx)...); err != nil {
+		return fail(err)
+	}
 
 	if input.RawAssertionObject.IsZero() || input.ClientDataToValidate.IsZero() {
-		return DeviceCheckAssertionOutput{400, false}, err
+		return fail(errd.Wrap(ctx, webauthnerr.New(webauthnerr.CodeInvalidInput, ErrDeviceCheckAssertInvalidInput)))
 	}
 
 	parsed, err := assertion.ParseFidoAssertionInput(ctx, input.RawAssertionObject)
 	if err != nil {
-		return DeviceCheckAssertionOutput{400, false}, err
+		return fail(errd.Wrap(ctx, webauthnerr.New(webauthnerr.CodeMalformedAssertion, err)))
+	}
+
+	ev.CredentialID = audit.Hex(parsed.CredentialID)
+
+	credKey := ratelimit.Credential(parsed.CredentialID.Hex())
+
+	if err := limiter.Allow(ctx, credKey); err != nil {
+		return fail(err)
 	}
 
+	if err := limiter.Check(ctx, credKey); err != nil {
+		return fail(err)
+	}
+
+	defer func() { limiter.Result(ctx, credKey, err) }()
+
 	cd, err := clientdata.ParseClientData(parsed.RawClientDataJSON)
 	if err != nil {
-		return DeviceCheckAssertionOutput{400, false}, err
+		return fail(errd.Wrap(ctx, webauthnerr.Wrap(err, webauthnerr.CodeMalformedClientData)))
+	}
+
+	tenant, err := relyingparty.Resolve(ctx, rp, nil)
+	if err != nil {
+		return fail(errd.Wrap(ctx, err))
 	}
 
+	dynamoClient = tenant.Storage(dynamoClient)
+
 	cerem, cred, err := dynamoClient.GetExisting(ctx, cd.Challenge.String(), parsed.CredentialID.String())
 	if err != nil {
-		return DeviceCheckAssertionOutput{502, false}, err
+		return fail(errd.Wrap(ctx, webauthnerr.New(webauthnerr.CodeStorageUnavailable, err)))
 	}
 
+	ev.Actor = audit.Hex(cerem.SessionID)
+
+	if err := limiter.Allow(ctx, ratelimit.Session(cerem.SessionID.Hex())); err != nil {
+		return fail(err)
+	}
+	ev = ev.WithCredential(cred)
+
 	// cerem, err := dynamoClient.GetExistingCeremony(ctx, cd.Challenge.String())
 	// if err != nil {
-	// 	return DeviceCheckAssertionOutput{502, false}, err
+	// 	return DeviceCheckAssertionOutput{502, false, ""}, err
 	// }
 
 	if cred.RawID.Hex() != cerem.CredentialID.Hex() {
-
-		return DeviceCheckAssertionOutput{401, false}, terrors.Errorf("credential id does not match ceremony id")
+		return fail(errd.Mismatch(ctx, webauthnerr.New(webauthnerr.CodeCredentialMismatch, ErrDeviceCheckAssertInvalidCredentialID), cerem.CredentialID.Hex(), cred.RawID.Hex()))
 	}
 
 	if !cerem.ChallengeID.Equals(cd.Challenge) {
 		// err :=
 		// zerolog.Ctx(ctx).Error().Err(err).Msg("assertion failed")
-		return DeviceCheckAssertionOutput{401, false}, terrors.Errorf("challenge ids do not match")
+		return fail(errd.Mismatch(ctx, webauthnerr.New(webauthnerr.CodeChallengeMismatch, ErrDeviceCheckAssertInvalidChallenge).WithStep(webauthnerr.AuthenticationStep(8)), cerem.ChallengeID.Hex(), cd.Challenge.Hex()))
 	}
 
-	attestationProvider := providers.NewAppAttestSandbox()
+	// credentials attested before the environment was recorded still carry it in their aaguid
+	environment := cred.Environment
+	if environment == "" {
+		environment = providers.AppAttestEnvironmentFromAAGUID(cred.AAGUID)
+	}
+
+	if environment != providers.AppAttestEnvironmentFromAAGUID(cred.AAGUID) {
+		return fail(errd.Mismatch(ctx, webauthnerr.New(webauthnerr.CodeCredentialMismatch, ErrDeviceCheckAssertInvalidEnvironment), providers.AppAttestEnvironmentFromAAGUID(cred.AAGUID), environment))
+	}
+
+	attestationProvider, err := providers.NewAppAttest(environment)
+	if err != nil {
+		return fail(errd.Wrap(ctx, webauthnerr.New(webauthnerr.CodeCredentialMismatch, ErrDeviceCheckAssertInvalidEnvironment), err.Error()))
+	}
 
 	if attestationProvider.ID() != cred.AttestationType {
-		return DeviceCheckAssertionOutput{401, false}, terrors.Errorf("attestation type does not match")
+		return fail(errd.Mismatch(ctx, webauthnerr.New(webauthnerr.CodeCredentialMismatch, ErrDeviceCheckAssertInvalidType), attestationProvider.ID(), cred.AttestationType))
+	}
+
+	appIDs := input.AppIDs
+	if len(appIDs) == 0 {
+		appIDs = tenant.AppIDs()
+	}
+
+	if cred.AppID != "" {
+		if !contains(appIDs, cred.AppID) {
+			return fail(errd.Mismatch(ctx, webauthnerr.New(webauthnerr.CodeAppIDMismatch, ErrDeviceCheckAssertInvalidAppID), strings.Join(appIDs, ","), cred.AppID))
+		}
+		// a key only ever signs for the app it was attested for
+		appIDs = []string{cred.AppID}
+	}
+
+	attestationProvider = attestationProvider.WithAppIDs(appIDs...)
+
+	asserter, err := assertion.ParseAssertionObject(ctx, parsed.RawAssertionObject)
+	if err != nil {
+		return fail(errd.Wrap(ctx, webauthnerr.New(webauthnerr.CodeMalformedAssertion, err)))
 	}
+	parsed.AssertionObject = &asserter
+
+	authData, err := authdata.ParseAuthenticatorDataSavedAttestedCredential(ctx, asserter.RawAuthenticatorData, true)
+	if err != nil {
+		return fail(errd.Wrap(ctx, webauthnerr.New(webauthnerr.CodeMalformedAssertion, err)))
+	}
+
+	appID, err := attestationProvider.MatchAppID(authData.RPIDHash)
+	if err != nil {
+		return fail(errd.Wrap(ctx, webauthnerr.New(webauthnerr.CodeAppIDMismatch, ErrDeviceCheckAssertInvalidAppID).WithStep(webauthnerr.AuthenticationStep(11)), err.Error()))
+	}
+
+	ev.AppID = appID
 
 	// Handle steps 4 through 16
 	if validError := assertion.VerifyAssertionInput(ctx, types.VerifyAssertionInputArgs{
 		Input:                          parsed,
 		StoredChallenge:                cerem.ChallengeID,
-		RelyingPartyID:                 rp.RPID(),
-		RelyingPartyOrigin:             rp.RPOrigin(),
+		RelyingPartyID:                 appID,
+		RelyingPartyOrigin:             tenant.RPOrigin(),
+		Origins:                        tenant.OriginMatcher(),
 		AAGUID:                         cred.AAGUID,
 		CredentialAttestationType:      types.FidoAttestationType,
 		AttestationProvider:            attestationProvider,
-		VerifyUser:                     false,
+		VerifyUser:                     tenant.Policy().UserVerification,
 		CredentialPublicKey:            cred.PublicKey,
+		LastSignCount:                  cred.SignCount,
 		Extensions:                     extensions.ClientInputs{},
 		DataSignedByClient:             append(input.ClientDataToValidate, cerem.ChallengeID...),
 		UseSavedAttestedCredentialData: true,
 	}); validError != nil {
-		return DeviceCheckAssertionOutput{401, false}, validError
+		return fail(webauthnerr.Wrap(validError, webauthnerr.CodeMalformedAssertion))
 	}
 
 	err = dynamoClient.IncrementExistingCredential(ctx, cerem, parsed.CredentialID.String())
 	if err != nil {
-		return DeviceCheckAssertionOutput{502, false}, err
+		return fail(errd.Wrap(ctx, webauthnerr.New(webauthnerr.CodeStorageUnavailable, err)))
+	}
+
+	return DeviceCheckAssertionOutput{204, true, appID}, nil
+}
+
+func contains(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
 	}
+	return false
+}
 
-	return DeviceCheckAssertionOutput{204, true}, nil
+func fail(err error) (DeviceCheckAssertionOutput, error) {
+	return DeviceCheckAssertionOutput{webauthnerr.HTTPStatus(err), false, ""}, err
 }
@@ -11,6 +11,7 @@ import (
 	"github.com/stretchr/testify/require"
 	"github.com/walteh/webauthn/gen/mockery"
 	"github.com/walteh/webauthn/pkg/hex"
+	"github.com/walteh/webauthn/pkg/webauthn/providers"
 	"github.com/walteh/webauthn/pkg/webauthn/types"
 
 	"github.com/walteh/webauthn/app/devicecheck_assert"
@@ -25,7 +26,7 @@ type TestObject struct {
 	existingCeremony    *types.Ceremony
 	endingCeremony      *types.Ceremony
 	endingCredentials   *types.Credential
-	wantErr             bool
+	wantErr             error
 }
 
 var testA = TestObject{
@@ -37,6 +38,7 @@ var testA = TestObject{
 	want: devicecheck_assert.DeviceCheckAssertionOutput{
 		SuggestedStatusCode: 204,
 		OK:                  true,
+		AppID:               "4497QJSAD3.xyz.nugg.app",
 	},
 	existingCredentials: &types.Credential{
 		CreatedAt:       1669414368,
@@ -66,9 +68,70 @@ var testA = TestObject{
 	endingCeremony: &types.Ceremony{
 		ChallengeID: hex.MustBase64ToHash("7fR9jktPydRpkGevqZIls_ff2VN_oLSK4HNBWzrIrTk"),
 	},
-	wantErr: false,
+	wantErr: nil,
 }
 
+// withCredential returns a copy of test with the stored credential changed
+func withCredential(test TestObject, name string, edit func(*types.Credential)) TestObject {
+	cred := *test.existingCredentials
+	edit(&cred)
+	test.name = name
+	test.existingCredentials = &cred
+	return test
+}
+
+var testRecorded = withCredential(testA, "recorded environment and app id", func(c *types.Credential) {
+	c.Environment = "appattestdevelop"
+	c.AppID = "4497QJSAD3.xyz.nugg.app"
+})
+
+var testOtherAppID = func() TestObject {
+	test := withCredential(testA, "app id not accepted", func(c *types.Credential) {
+		c.Environment = "appattestdevelop"
+		c.AppID = "4497QJSAD3.xyz.nugg.other"
+	})
+	test.want = devicecheck_assert.DeviceCheckAssertionOutput{SuggestedStatusCode: 401}
+	test.wantErr = devicecheck_assert.ErrDeviceCheckAssertInvalidAppID
+	return test
+}()
+
+var testExplicitAppIDs = func() TestObject {
+	test := withCredential(testA, "app id in accepted list", func(c *types.Credential) {
+		c.Environment = "appattestdevelop"
+		c.AppID = "4497QJSAD3.xyz.nugg.app"
+	})
+	test.input.AppIDs = []string{"4497QJSAD3.xyz.nugg.other", "4497QJSAD3.xyz.nugg.app"}
+	return test
+}()
+
+var testLegacyOtherAppID = func() TestObject {
+	test := testA
+	test.name = "rpIdHash of an app id not accepted"
+	test.input.AppIDs = []string{"4497QJSAD3.xyz.nugg.other"}
+	test.want = devicecheck_assert.DeviceCheckAssertionOutput{SuggestedStatusCode: 401}
+	test.wantErr = devicecheck_assert.ErrDeviceCheckAssertInvalidAppID
+	return test
+}()
+
+var testReplayedCounter = func() TestObject {
+	test := withCredential(testA, "counter not greater than stored", func(c *types.Credential) {
+		c.SignCount = 1
+	})
+	test.want = devicecheck_assert.DeviceCheckAssertionOutput{SuggestedStatusCode: 401}
+	test.wantErr = providers.ErrAssertionCounter
+	return test
+}()
+
+var testProductionEnvironment = func() TestObject {
+	test := withCredential(testA, "recorded environment does not match aaguid", func(c *types.Credential) {
+		c.Environment = "appattest"
+		c.AppID = "4497QJSAD3.xyz.nugg.app"
+	})
+	test.want = devicecheck_assert.DeviceCheckAssertionOutput{SuggestedStatusCode: 401}
+	test.wantErr = devicecheck_assert.ErrDeviceCheckAssertInvalidEnvironment
+	return test
+}()
+
 // var testB = TestObject{
 // 	name: "B",
 // 	input: DeviceCheckAssertionInput{
@@ -103,6 +166,12 @@ func TestHandler_Invoke(t *testing.T) {
 
 	tests := []TestObject{
 		testA,
+		testRecorded,
+		testOtherAppID,
+		testExplicitAppIDs,
+		testProductionEnvironment,
+		testLegacyOtherAppID,
+		testReplayedCounter,
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -119,8 +188,6 @@ func TestHandler_Invoke(t *testing.T) {
 				existingCeremonyString = tt.existingCeremony.ChallengeID.String()
 			}
 
-			endingCeremonyString := tt.endingCeremony.ChallengeID.String()
-
 			existingCredentialsString := ""
 			if tt.existingCredentials != nil {
 				existingCredentialsString = tt.existingCredentials.RawID.String()
@@ -129,20 +196,22 @@ func TestHandler_Invoke(t *testing.T) {
 			endingCredentialsString := tt.endingCredentials.RawID.String()
 
 			stgp.EXPECT().GetExisting(ctx, existingCeremonyString, existingCredentialsString).Return(tt.existingCeremony, tt.existingCredentials, nil)
-			stgp.EXPECT().IncrementExistingCredential(ctx, endingCeremonyString, endingCredentialsString).Return(nil)
+			rpp.EXPECT().RPID().Return("4497QJSAD3.xyz.nugg.app").Maybe()
+			rpp.EXPECT().RPOrigin().Return("https://nugg.xyz").Maybe()
 
-			rpp.EXPECT().RPID().Return("4497QJSAD3.xyz.nugg.app")
-			rpp.EXPECT().RPOrigin().Return("https://nugg.xyz")
+			if tt.wantErr == nil {
+				stgp.EXPECT().IncrementExistingCredential(ctx, tt.existingCeremony, endingCredentialsString).Return(nil)
+			}
 
 			got, err := devicecheck_assert.Assert(ctx, stgp, rpp, tt.input)
-			if err != nil && !tt.wantErr {
+			if tt.wantErr == nil {
 				require.NoError(t, err)
-				// t.Errorf("handler.Invoke() - error should always be nil - error = %v", err)
-				return
+			} else {
+				require.ErrorIs(t, err, tt.wantErr)
 			}
 
 			if got.SuggestedStatusCode != 204 {
-				if !tt.wantErr {
+				if tt.wantErr == nil {
 					t.Errorf("Handler.Invoke() error = %v, wantErr %v", err, tt.wantErr)
 				}
 
@@ -6,14 +6,17 @@ import (
 	"time"
 
 	"github.com/rs/zerolog"
+	"github.com/walteh/webauthn/pkg/audit"
 	"github.com/walteh/webauthn/pkg/errd"
 	"github.com/walteh/webauthn/pkg/hex"
+	"github.com/walteh/webauthn/pkg/ratelimit"
 	"github.com/walteh/webauthn/pkg/relyingparty"
 	"github.com/walteh/webauthn/pkg/storage"
 	"github.com/walteh/webauthn/pkg/webauthn/clientdata"
 	"github.com/walteh/webauthn/pkg/webauthn/credential"
 	"github.com/walteh/webauthn/pkg/webauthn/providers"
 	"github.com/walteh/webauthn/pkg/webauthn/types"
+	"github.com/walteh/webauthn/pkg/webauthnerr"
 )
 
 type DeviceCheckAttestationInput struct {
@@ -21,14 +24,23 @@ type DeviceCheckAttestationInput struct {
 	UTF8ClientDataJSON   string
 	RawCredentialID      hex.Hash
 	RawSessionID         hex.Hash
-	Production           bool
 	Time                 *time.Time
 	RootCert             string
+
+	// Production refuses keys attested in the development environment, the environment itself is read
+	// from the aaguid of the key
+	Production bool
+
+	// AppIDs are the "TEAMID.bundle.id" app ids whose keys are accepted, defaults to the relying party id
+	AppIDs []string
 }
 
 type DeviceCheckAttestationOutput struct {
 	SuggestedStatusCode int
 	OK                  bool
+
+	// AppID is the allowed app id the key was attested for
+	AppID string
 }
 
 var (
@@ -42,16 +54,25 @@ var (
 
 	ErrDeviceCheckAttestInvalidCounter = errors.New("ErrDeviceCheckAttestInvalidCounter")
 
+	ErrDeviceCheckAttestInvalidAppID = errors.New("ErrDeviceCheckAttestInvalidAppID")
+
+	ErrDeviceCheckAttestInvalidEnvironment = errors.New("ErrDeviceCheckAttestInvalidEnvironment")
+
 	ErrDeviceCheckAttestDataRead = errors.New("ErrDeviceCheckAttestDataRead")
 
 	ErrDeviceCheckAttestDataWrite = errors.New("ErrDeviceCheckAttestDataWrite")
 )
 
-func Attest(ctx context.Context, dynamoClient storage.Provider, rp relyingparty.Provider, input DeviceCheckAttestationInput) (DeviceCheckAttestationOutput, error) {
-	var err error
+func Attest(ctx context.Context, dynamoClient storage.Provider, rp relyingparty.Provider, input DeviceCheckAttestationInput) (res DeviceCheckAttestationOutput, err error) {
+	ev := audit.Event{Type: audit.EventRegistration, CeremonyType: types.CreateCeremony, Actor: audit.Hex(input.RawSessionID), CredentialID: audit.Hex(input.RawCredentialID)}
+	defer func() { audit.Record(ctx, ev.WithError(err)) }()
+
+	if err := ratelimit.Ctx(ctx).Allow(ctx, ratelimit.Keys(ctx, ratelimit.Session(input.RawSessionID.Hex()))...); err != nil {
+		return fail(err)
+	}
 
 	if input.RawAttestationObject.IsZero() || input.UTF8ClientDataJSON == "" || input.RawCredentialID.IsZero() {
-		return DeviceCheckAttestationOutput{400, false}, errd.Wrap(ctx, ErrDeviceCheckAttestInvalidInput)
+		return fail(errd.Wrap(ctx, webauthnerr.New(webauthnerr.CodeInvalidInput, ErrDeviceCheckAttestInvalidInput)))
 	}
 	parsedResponse := types.AttestationInput{
 		AttestationObject:  input.RawAttestationObject,
@@ -63,22 +84,41 @@ func Attest(ctx context.Context, dynamoClient storage.Provider, rp relyingparty.
 
 	cd, err := clientdata.ParseClientData(parsedResponse.UTF8ClientDataJSON)
 	if err != nil {
-		return DeviceCheckAttestationOutput{400, false}, errd.Wrap(ctx, ErrDeviceCheckAttestInvalidInput)
+		return fail(errd.Wrap(ctx, webauthnerr.New(webauthnerr.CodeMalformedClientData, ErrDeviceCheckAttestInvalidInput), err.Error()))
 	}
 
+	tenant, err := relyingparty.Resolve(ctx, rp, nil)
+	if err != nil {
+		return fail(errd.Wrap(ctx, err))
+	}
+
+	dynamoClient = tenant.Storage(dynamoClient)
+
 	cer, _, err := dynamoClient.GetExisting(ctx, cd.Challenge.String(), "")
 	if err != nil {
 		zerolog.Ctx(ctx).Error().Err(err).Msg("failed to transact get")
-		return DeviceCheckAttestationOutput{502, false}, errd.Wrap(ctx, ErrDeviceCheckAttestDataRead)
+		return fail(errd.Wrap(ctx, webauthnerr.New(webauthnerr.CodeStorageUnavailable, ErrDeviceCheckAttestDataRead)))
 	}
 
 	if !cer.SessionID.Equals(input.RawSessionID) {
-		return DeviceCheckAttestationOutput{401, false}, errd.Mismatch(ctx, ErrDeviceCheckAttestInvalidSessionID, cer.SessionID.Hex(), input.RawSessionID.Hex())
+		return fail(errd.Mismatch(ctx, webauthnerr.New(webauthnerr.CodeSessionMismatch, ErrDeviceCheckAttestInvalidSessionID), cer.SessionID.Hex(), input.RawSessionID.Hex()))
 	}
 
-	prov := providers.NewAppAttestSandbox()
-	if input.Production {
-		prov = providers.NewAppAttestProduction()
+	att, err := credential.ParseAttestationInput(ctx, parsedResponse)
+	if err != nil {
+		return fail(errd.Wrap(ctx, webauthnerr.New(webauthnerr.CodeMalformedAttestation, ErrDeviceCheckAttestInvalidInput), err.Error()))
+	}
+
+	// the key names the environment it was attested in, the same way the assert flow reads it back
+	environment := providers.AppAttestEnvironmentFromAAGUID(att.AuthData.AttData.AAGUID)
+
+	if (input.Production || tenant.Policy().Production) && environment != providers.AppAttestEnvironmentProduction {
+		return fail(errd.Mismatch(ctx, webauthnerr.New(webauthnerr.CodeAttestationInvalid, ErrDeviceCheckAttestInvalidEnvironment), providers.AppAttestEnvironmentProduction, environment))
+	}
+
+	prov, err := providers.NewAppAttest(environment)
+	if err != nil {
+		return fail(errd.Wrap(ctx, webauthnerr.New(webauthnerr.CodeAttestationInvalid, ErrDeviceCheckAttestInvalidEnvironment), err.Error()))
 	}
 
 	if input.Time != nil {
@@ -89,34 +129,51 @@ func Attest(ctx context.Context, dynamoClient storage.Provider, rp relyingparty.
 		prov = prov.WithRootCert(input.RootCert)
 	}
 
+	appIDs := input.AppIDs
+	if len(appIDs) == 0 {
+		appIDs = tenant.AppIDs()
+	}
+
+	prov = prov.WithAppIDs(appIDs...)
+
+	// the key is scoped to the app id the way a webauthn credential is scoped to the relying party id
+	appID, err := prov.MatchAppID(att.AuthData.RPIDHash)
+	ev.AppID = appID
+	if err != nil {
+		return fail(errd.Wrap(ctx, webauthnerr.New(webauthnerr.CodeAppIDMismatch, ErrDeviceCheckAttestInvalidAppID).WithStep(webauthnerr.RegistrationStep(9)), err.Error()))
+	}
+
 	pk, err := credential.VerifyAttestationInput(ctx, types.VerifyAttestationInputArgs{
 		Provider:           prov,
 		Input:              parsedResponse,
 		SessionId:          cer.SessionID,
 		StoredChallenge:    cer.ChallengeID,
-		VerifyUser:         false,
-		RelyingPartyID:     rp.RPID(),
-		RelyingPartyOrigin: rp.RPOrigin(),
+		VerifyUser:         tenant.Policy().UserVerification,
+		RelyingPartyID:     appID,
+		RelyingPartyOrigin: tenant.RPOrigin(),
+		Origins:            tenant.OriginMatcher(),
 	})
 
 	if err != nil {
-		return DeviceCheckAttestationOutput{401, false}, errd.Wrap(ctx, err)
+		return fail(errd.Wrap(ctx, webauthnerr.Wrap(err, webauthnerr.CodeAttestationInvalid)))
 	}
 
+	ev = ev.WithCredential(pk)
+
 	if !input.RawCredentialID.Equals(pk.RawID) {
-		return DeviceCheckAttestationOutput{401, false}, errd.Mismatch(ctx, ErrDeviceCheckAttestInvalidCredentialID, input.RawCredentialID.Hex(), pk.RawID.Hex())
+		return fail(errd.Mismatch(ctx, webauthnerr.New(webauthnerr.CodeCredentialMismatch, ErrDeviceCheckAttestInvalidCredentialID), input.RawCredentialID.Hex(), pk.RawID.Hex()))
 	}
 
 	err = dynamoClient.WriteNewCredential(ctx, cer, pk)
 	if err != nil {
 		zerolog.Ctx(ctx).Error().Err(err).Msg("failed to write new credential")
-		return DeviceCheckAttestationOutput{502, false}, errd.Wrap(ctx, ErrDeviceCheckAttestDataWrite)
+		return fail(errd.Wrap(ctx, webauthnerr.New(webauthnerr.CodeStorageUnavailable, ErrDeviceCheckAttestDataWrite)))
 	}
 
 	// del, err := dynamo.MakeDelete(dynamoClient.MustCeremonyTableName(), cer)
 	// if err != nil {
 	// 	zerolog.Ctx(ctx).Error().Err(err).Msg("failed to make delete")
-	// 	return DeviceCheckAttestationOutput{502, false}, errd.Wrap(ctx, ErrDeviceCheckAttestDataWrite)
+	// 	return DeviceCheckAttestationOutput{502, false, ""}, errd.Wrap(ctx, ErrDeviceCheckAttestDataWrite)
 	// }
 
 	// putter, err := dynamo.MakePut(dynamoClient.MustCredentialTableName(), pk)
@@ -128,8 +185,12 @@ func Attest(ctx context.Context, dynamoClient storage.Provider, rp relyingparty.
 	// err = dynamoClient.TransactWrite(ctx, *putter, *del)
 	// if err != nil {
 	// 	zerolog.Ctx(ctx).Error().Err(err).Msg("failed to transact write")
-	// 	return DeviceCheckAttestationOutput{502, false}, errd.Wrap(ctx, ErrDeviceCheckAttestDataWrite)
+	// 	return DeviceCheckAttestationOutput{502, false, ""}, errd.Wrap(ctx, ErrDeviceCheckAttestDataWrite)
 	// }
 
-	return DeviceCheckAttestationOutput{204, true}, nil
+	return DeviceCheckAttestationOutput{204, true, appID}, nil
+}
+
+func fail(err error) (DeviceCheckAttestationOutput, error) {
+	return DeviceCheckAttestationOutput{webauthnerr.HTTPStatus(err), false, ""}, err
 }
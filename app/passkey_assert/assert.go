@@ -2,10 +2,13 @@ package passkey_assert
 
 import (
 	"context"
+	"errors"
 
 	"github.com/walteh/webauthn/pkg/accesstoken/cognito"
+	"github.com/walteh/webauthn/pkg/audit"
 	"github.com/walteh/webauthn/pkg/errd"
 	"github.com/walteh/webauthn/pkg/hex"
+	"github.com/walteh/webauthn/pkg/ratelimit"
 	"github.com/walteh/webauthn/pkg/relyingparty"
 	"github.com/walteh/webauthn/pkg/storage"
 	"github.com/walteh/webauthn/pkg/webauthn/assertion"
@@ -13,6 +16,7 @@ import (
 	"github.com/walteh/webauthn/pkg/webauthn/extensions"
 	"github.com/walteh/webauthn/pkg/webauthn/providers"
 	"github.com/walteh/webauthn/pkg/webauthn/types"
+	"github.com/walteh/webauthn/pkg/webauthnerr"
 )
 
 type PasskeyAssertionInput struct {
@@ -21,17 +25,38 @@ type PasskeyAssertionInput struct {
 	UTF8ClientDataJSON   string   `json:"rawClientDataJSON"`
 	RawAuthenticatorData hex.Hash `json:"rawAuthenticatorData"`
 	RawSignature         hex.Hash `json:"signature"`
-	PublicKey            hex.Hash `json:"publicKey"`
-	AAGUID               hex.Hash `json:"aaguid"`
+
+	// PublicKey and AAGUID are optional, the signature is always verified with the stored credential
+	// and a client sending them must send the stored ones
+	PublicKey hex.Hash `json:"publicKey"`
+	AAGUID    hex.Hash `json:"aaguid"`
 }
 
+var (
+	ErrPasskeyAssertCredentialNotFound = errors.New("ErrPasskeyAssertCredentialNotFound")
+	ErrPasskeyAssertCredentialMismatch = errors.New("ErrPasskeyAssertCredentialMismatch")
+)
+
 type PasskeyAssertionOutput struct {
 	SuggestedStatusCode int
 	AccessToken         string
 }
 
-func Assert(ctx context.Context, dynamoClient storage.Provider, rp relyingparty.Provider, cognitoClient cognito.Client, assert PasskeyAssertionInput) (PasskeyAssertionOutput, error) {
-	var err error
+func Assert(ctx context.Context, dynamoClient storage.Provider, rp relyingparty.Provider, cognitoClient cognito.Client, assert PasskeyAssertionInput) (res PasskeyAssertionOutput, err error) {
+	ev := audit.Event{Type: audit.EventAuthentication, CeremonyType: types.AssertCeremony, Actor: audit.Hex(assert.SessionID), CredentialID: audit.Hex(assert.CredentialID)}
+	defer func() { audit.Record(ctx, ev.WithError(err)) }()
+
+	limiter, credKey := ratelimit.Ctx(ctx), ratelimit.Credential(assert.CredentialID.Hex())
+
+	if err := limiter.Allow(ctx, ratelimit.Keys(ctx, ratelimit.Session(assert.SessionID.Hex()), credKey)...); err != nil {
+		return fail(err)
+	}
+
+	if err := limiter.Check(ctx, credKey); err != nil {
+		return fail(err)
+	}
+
+	defer func() { limiter.Result(ctx, credKey, err) }()
 
 	input := types.AssertionInput{
 		CredentialID:       assert.CredentialID,
@@ -46,7 +71,7 @@ func Assert(ctx context.Context, dynamoClient storage.Provider, rp relyingparty.
 
 	cd, err := clientdata.ParseClientData(input.RawClientDataJSON)
 	if err != nil {
-		return PasskeyAssertionOutput{400, ""}, err
+		return fail(errd.Wrap(ctx, webauthnerr.Wrap(err, webauthnerr.CodeMalformedClientData)))
 	}
 
 	// cred := structure.NewCredentialQueryable(input.CredentialID.Hex())
@@ -61,35 +86,58 @@ func Assert(ctx context.Context, dynamoClient storage.Provider, rp relyingparty.
 	// 	return PasskeyAssertionOutput{401, ""}, errors.NewError(0x67).WithMessage("credential id does not match").WithCaller()
 	// }
 
+	tenant, err := relyingparty.Resolve(ctx, rp, relyingparty.RPIDHashOf(assert.RawAuthenticatorData))
+	if err != nil {
+		return fail(errd.Wrap(ctx, err))
+	}
+
+	dynamoClient = tenant.Storage(dynamoClient)
+
+	cred, err := dynamoClient.GetExistingCredential(ctx, input.CredentialID.Hex())
+	if errors.Is(err, storage.ErrNotFound) {
+		return fail(errd.Wrap(ctx, webauthnerr.New(webauthnerr.CodeCredentialNotFound, ErrPasskeyAssertCredentialNotFound), input.CredentialID.Hex()))
+	}
+	if err != nil {
+		return fail(errd.Wrap(ctx, webauthnerr.New(webauthnerr.CodeStorageUnavailable, err)))
+	}
+
+	ev = ev.WithCredential(cred)
+
+	if len(assert.PublicKey) > 0 && !assert.PublicKey.Equals(cred.PublicKey) {
+		return fail(errd.Mismatch(ctx, webauthnerr.New(webauthnerr.CodeCredentialMismatch, ErrPasskeyAssertCredentialMismatch), cred.PublicKey.Hex(), assert.PublicKey.Hex()))
+	}
+
+	if len(assert.AAGUID) > 0 && !assert.AAGUID.Equals(cred.AAGUID) {
+		return fail(errd.Mismatch(ctx, webauthnerr.New(webauthnerr.CodeCredentialMismatch, ErrPasskeyAssertCredentialMismatch), cred.AAGUID.Hex(), assert.AAGUID.Hex()))
+	}
+
 	z, err := cognitoClient.GetDevCreds(ctx, input.CredentialID)
 	if err != nil {
-		return PasskeyAssertionOutput{502, ""}, errd.Wrap(ctx, err)
+		return fail(errd.Wrap(ctx, webauthnerr.New(webauthnerr.CodeTokenIssuance, err)))
 	}
 
 	// Handle steps 4 through 16
 	if validError := assertion.VerifyAssertionInput(ctx, types.VerifyAssertionInputArgs{
 		Input:                          input,
 		StoredChallenge:                cd.Challenge,
-		RelyingPartyID:                 rp.RPID(),
-		RelyingPartyOrigin:             rp.RPOrigin(),
+		RelyingPartyID:                 tenant.RPID(),
+		RelyingPartyOrigin:             tenant.RPOrigin(),
+		Origins:                        tenant.OriginMatcher(),
 		CredentialAttestationType:      types.NotFidoAttestationType,
 		AttestationProvider:            providers.NewNoneAttestationProvider(),
-		AAGUID:                         assert.AAGUID,
-		VerifyUser:                     false,
-		CredentialPublicKey:            assert.PublicKey,
+		AAGUID:                         cred.AAGUID,
+		VerifyUser:                     tenant.Policy().UserVerification,
+		CredentialPublicKey:            cred.PublicKey,
 		Extensions:                     extensions.ClientInputs{},
 		DataSignedByClient:             hex.Hash([]byte(input.RawClientDataJSON)),
 		UseSavedAttestedCredentialData: false,
 	}); validError != nil {
-		return PasskeyAssertionOutput{401, ""}, validError
+		return fail(webauthnerr.Wrap(validError, webauthnerr.CodeMalformedAssertion))
 	}
 
-	// verify the aaguid matches
-	// verify the public key matches
-
-	err = dynamoClient.IncrementExistingCredential(ctx, cd.Challenge.Hex(), input.CredentialID.Hex())
+	err = dynamoClient.IncrementExistingCredential(ctx, types.NewUnsafeGettableCeremony(cd.Challenge), input.CredentialID.Hex())
 	if err != nil {
-		return PasskeyAssertionOutput{502, ""}, err
+		return fail(errd.Wrap(ctx, webauthnerr.New(webauthnerr.CodeStorageUnavailable, err)))
 	}
 
 	// // add session to list of sessions for this credential
@@ -117,3 +165,7 @@ func Assert(ctx context.Context, dynamoClient storage.Provider, rp relyingparty.
 
 	return PasskeyAssertionOutput{204, *z.Token}, nil
 }
+
+func fail(err error) (PasskeyAssertionOutput, error) {
+	return PasskeyAssertionOutput{webauthnerr.HTTPStatus(err), ""}, err
+}
@@ -5,14 +5,17 @@ import (
 	"errors"
 
 	"github.com/walteh/webauthn/pkg/accesstoken"
+	"github.com/walteh/webauthn/pkg/audit"
 	"github.com/walteh/webauthn/pkg/errd"
 	"github.com/walteh/webauthn/pkg/hex"
+	"github.com/walteh/webauthn/pkg/ratelimit"
 	"github.com/walteh/webauthn/pkg/relyingparty"
 	"github.com/walteh/webauthn/pkg/storage"
 	"github.com/walteh/webauthn/pkg/webauthn/clientdata"
 	"github.com/walteh/webauthn/pkg/webauthn/credential"
 	"github.com/walteh/webauthn/pkg/webauthn/providers"
 	"github.com/walteh/webauthn/pkg/webauthn/types"
+	"github.com/walteh/webauthn/pkg/webauthnerr"
 )
 
 type PasskeyAttestationInput struct {
@@ -42,8 +45,15 @@ var (
 	ErrPasskeyAttestDataWrite = errors.New("ErrPasskeyAttestDataWrite")
 )
 
-func Attest(ctx context.Context, dynamoClient storage.Provider, rp relyingparty.Provider, tknp accesstoken.Provider, assert PasskeyAttestationInput) (PasskeyAttestationOutput, error) {
-	var err error
+func Attest(ctx context.Context, dynamoClient storage.Provider, rp relyingparty.Provider, tknp accesstoken.Provider, assert PasskeyAttestationInput) (res PasskeyAttestationOutput, err error) {
+	ev := audit.Event{Type: audit.EventRegistration, CeremonyType: types.CreateCeremony, CredentialID: audit.Hex(assert.RawCredentialID)}
+	defer func() { audit.Record(ctx, ev.WithError(err)) }()
+
+	limiter := ratelimit.Ctx(ctx)
+
+	if err := limiter.Allow(ctx, ratelimit.Keys(ctx)...); err != nil {
+		return fail(err)
+	}
 
 	parsedResponse := types.AttestationInput{
 		AttestationObject:  assert.RawAttestationObject,
@@ -54,14 +64,32 @@ func Attest(ctx context.Context, dynamoClient storage.Provider, rp relyingparty.
 
 	cd, err := clientdata.ParseClientData(parsedResponse.UTF8ClientDataJSON)
 	if err != nil {
-		return PasskeyAttestationOutput{400, ""}, err
+		return fail(errd.Wrap(ctx, webauthnerr.Wrap(err, webauthnerr.CodeMalformedClientData)))
+	}
+
+	att, err := credential.ParseAttestationInput(ctx, parsedResponse)
+	if err != nil {
+		return fail(errd.Wrap(ctx, webauthnerr.Wrap(err, webauthnerr.CodeMalformedAttestation)))
+	}
+
+	tenant, err := relyingparty.Resolve(ctx, rp, att.AuthData.RPIDHash)
+	if err != nil {
+		return fail(errd.Wrap(ctx, err))
 	}
 
+	dynamoClient, tknp = tenant.Storage(dynamoClient), tenant.Tokens(tknp)
+
 	// cerem := types.NewUnsafeGettableCeremony(cd.Challenge)
 
 	cerem, err := dynamoClient.GetExistingCeremony(ctx, cd.Challenge.String())
 	if err != nil {
-		return PasskeyAttestationOutput{502, ""}, errd.Wrap(ctx, ErrPasskeyAttestDataRead)
+		return fail(errd.Wrap(ctx, webauthnerr.New(webauthnerr.CodeStorageUnavailable, ErrPasskeyAttestDataRead), err.Error()))
+	}
+
+	ev.Actor = audit.Hex(cerem.SessionID)
+
+	if err := limiter.Allow(ctx, ratelimit.Session(cerem.SessionID.Hex())); err != nil {
+		return fail(err)
 	}
 
 	cred, invalidErr := credential.VerifyAttestationInput(ctx, types.VerifyAttestationInputArgs{
@@ -69,18 +97,21 @@ func Attest(ctx context.Context, dynamoClient storage.Provider, rp relyingparty.
 		Input:              parsedResponse,
 		StoredChallenge:    cerem.ChallengeID,
 		SessionId:          cerem.SessionID,
-		VerifyUser:         false,
-		RelyingPartyID:     rp.RPID(),
-		RelyingPartyOrigin: rp.RPOrigin(),
+		VerifyUser:         tenant.Policy().UserVerification,
+		RelyingPartyID:     tenant.RPID(),
+		RelyingPartyOrigin: tenant.RPOrigin(),
+		Origins:            tenant.OriginMatcher(),
 	})
 
 	if invalidErr != nil {
-		return PasskeyAttestationOutput{401, ""}, invalidErr
+		return fail(webauthnerr.Wrap(invalidErr, webauthnerr.CodeAttestationInvalid))
 	}
 
+	ev = ev.WithCredential(cred)
+
 	tkn, err := tknp.AccessTokenForUserID(ctx, cerem.CredentialID.String())
 	if err != nil {
-		return PasskeyAttestationOutput{502, ""}, errd.Wrap(ctx, ErrPasskeyAttestJWTGeneration)
+		return fail(errd.Wrap(ctx, webauthnerr.New(webauthnerr.CodeTokenIssuance, ErrPasskeyAttestJWTGeneration), err.Error()))
 	}
 
 	// z, err := cognitoClient.GetDevCreds(ctx, cerem.CredentialID)
@@ -94,11 +125,15 @@ func Attest(ctx context.Context, dynamoClient storage.Provider, rp relyingparty.
 	// // should be a delete
 	// ceremput := indexable.IndexablePut(cerem, true)
 
-	err = dynamoClient.IncrementExistingCredential(ctx, string(cerem.ChallengeID), string(cred.RawID))
+	err = dynamoClient.WriteNewCredential(ctx, cerem, cred)
 
 	if err != nil {
-		return PasskeyAttestationOutput{502, ""}, errd.Wrap(ctx, ErrPasskeyAttestDataWrite)
+		return fail(errd.Wrap(ctx, webauthnerr.New(webauthnerr.CodeStorageUnavailable, ErrPasskeyAttestDataWrite), err.Error()))
 	}
 
 	return PasskeyAttestationOutput{204, tkn}, nil
 }
+
+func fail(err error) (PasskeyAttestationOutput, error) {
+	return PasskeyAttestationOutput{webauthnerr.HTTPStatus(err), ""}, err
+}
@@ -0,0 +1,238 @@
+package inspect
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/walteh/snake"
+	"github.com/walteh/webauthn/pkg/lambda"
+	"github.com/walteh/webauthn/pkg/webauthn/assertion"
+	"github.com/walteh/webauthn/pkg/webauthn/inspect"
+	"github.com/walteh/webauthn/pkg/webauthn/metadata"
+)
+
+var ErrUnknownOutput = errors.New("ErrUnknownOutput")
+
+type Handler struct {
+	Output   string
+	Metadata string
+
+	input string
+}
+
+var _ snake.Snakeable = (*Handler)(nil)
+
+func (me *Handler) BuildCommand(ctx context.Context) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "inspect [input]",
+		Short: "decode an attestation object, assertion, authenticator data or client data",
+		Long: `decode an attestation object, assertion object, authenticator data or client data json given as hex,
+base64 or base64url, or a whole X-Nugg-Webauthn-* or X-Nugg-DeviceCheck-* header value, optionally
+prefixed with the header name. The input is read from stdin when omitted or "-".`,
+		Args: cobra.MaximumNArgs(1),
+	}
+
+	cmd.Flags().StringVarP(&me.Output, "output", "o", "text", "output format, text or json")
+	cmd.Flags().StringVar(&me.Metadata, "mds", "", "url of a FIDO metadata blob used to name aaguids")
+
+	return cmd
+}
+
+func (me *Handler) ParseArguments(ctx context.Context, cmd *cobra.Command, args []string) error {
+	if me.Output != "text" && me.Output != "json" {
+		return fmt.Errorf("%w: %q", ErrUnknownOutput, me.Output)
+	}
+
+	if len(args) == 1 && args[0] != "-" {
+		me.input = args[0]
+		return nil
+	}
+
+	in, err := io.ReadAll(cmd.InOrStdin())
+	if err != nil {
+		return err
+	}
+
+	me.input = string(in)
+
+	return nil
+}
+
+func (me *Handler) Run(ctx context.Context, cmd *cobra.Command) error {
+	if me.Metadata != "" {
+		if err := metadata.PopulateMetadata(me.Metadata); err != nil {
+			return err
+		}
+	}
+
+	report, err := me.inspect(ctx)
+	if err != nil {
+		return err
+	}
+
+	if me.Output == "json" {
+		enc := json.NewEncoder(cmd.OutOrStdout())
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+
+	return report.WriteTree(cmd.OutOrStdout())
+}
+
+func (me *Handler) inspect(ctx context.Context) (*inspect.Report, error) {
+	header, value := splitHeader(me.input)
+
+	switch {
+	case strings.EqualFold(header, lambda.PasskeyAttestationHeader):
+		var hdr lambda.XNuggWebauthnCreation
+		if err := decodeHeader(value, &hdr); err != nil {
+			return nil, err
+		}
+		return attestation(ctx, header, hdr.RawAttestationObject, hdr.RawClientData, hdr.CredentialID)
+
+	case strings.EqualFold(header, lambda.DeviceCheckAttestationHeader):
+		var hdr lambda.XNuggDeviceCheckAttestation
+		if err := decodeHeader(value, &hdr); err != nil {
+			return nil, err
+		}
+		return attestation(ctx, header, hdr.RawAttestationObject, hdr.RawClientData, hdr.CredentialID)
+
+	case strings.EqualFold(header, lambda.PasskeyAssertionHeader):
+		var hdr lambda.XNuggWebauthnAssertion
+		if err := decodeHeader(value, &hdr); err != nil {
+			return nil, err
+		}
+		return passkeyAssertion(ctx, header, hdr)
+
+	case strings.EqualFold(header, lambda.DeviceCheckAssertionHeader):
+		raw, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, err
+		}
+		return deviceCheckAssertion(ctx, header, raw)
+
+	case header != "":
+		return nil, fmt.Errorf("%w: %s", lambda.ErrLambdaInvalidHeader, header)
+	}
+
+	raw, err := inspect.DecodeInput(value)
+	if err != nil {
+		return nil, err
+	}
+
+	// header values are recognized by their json even without the header name
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(raw, &fields) == nil {
+		switch {
+		case fields["rawAttestationObject"] != nil:
+			var hdr lambda.XNuggDeviceCheckAttestation
+			if err := json.Unmarshal(raw, &hdr); err != nil {
+				return nil, err
+			}
+			return attestation(ctx, "", hdr.RawAttestationObject, hdr.RawClientData, hdr.CredentialID)
+		case fields["rawAuthenticatorData"] != nil:
+			var hdr lambda.XNuggWebauthnAssertion
+			if err := json.Unmarshal(raw, &hdr); err != nil {
+				return nil, err
+			}
+			return passkeyAssertion(ctx, "", hdr)
+		case fields["assertion_object"] != nil:
+			return deviceCheckAssertion(ctx, "", raw)
+		}
+	}
+
+	return inspect.Inspect(ctx, raw)
+}
+
+// splitHeader splits "Name: value" into the header name and its value, inputs without a header name are
+// returned as the value
+func splitHeader(input string) (string, string) {
+	input = strings.TrimSpace(input)
+
+	name, value, ok := strings.Cut(input, ":")
+	if !ok || !strings.HasPrefix(strings.ToLower(name), "x-nugg-") {
+		return "", input
+	}
+
+	return strings.TrimSpace(name), strings.TrimSpace(value)
+}
+
+func decodeHeader(value string, out interface{}) error {
+	raw, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, out)
+}
+
+func attestation(ctx context.Context, source string, rawAttestationObject, rawClientData, credentialID []byte) (*inspect.Report, error) {
+	att, err := inspect.DecodeAttestationObject(ctx, rawAttestationObject)
+	if err != nil {
+		return nil, err
+	}
+
+	cd, err := inspect.DecodeClientData(rawClientData)
+	if err != nil {
+		return nil, err
+	}
+
+	return &inspect.Report{
+		Kind:              inspect.KindAttestationObject,
+		Source:            source,
+		CredentialID:      credentialID,
+		ClientData:        cd,
+		AttestationObject: att,
+	}, nil
+}
+
+func passkeyAssertion(ctx context.Context, source string, hdr lambda.XNuggWebauthnAssertion) (*inspect.Report, error) {
+	ad, err := inspect.DecodeAuthenticatorData(ctx, hdr.RawAuthenticatorData)
+	if err != nil {
+		return nil, err
+	}
+
+	cd, err := inspect.DecodeClientData(hdr.RawClientDataJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	return &inspect.Report{
+		Kind:            inspect.KindAssertionObject,
+		Source:          source,
+		CredentialID:    hdr.CredentialID,
+		ClientData:      cd,
+		AssertionObject: &inspect.AssertionObject{AuthenticatorData: ad, Signature: hdr.Signature},
+	}, nil
+}
+
+func deviceCheckAssertion(ctx context.Context, source string, raw []byte) (*inspect.Report, error) {
+	input, err := assertion.ParseFidoAssertionInput(ctx, raw)
+	if err != nil {
+		return nil, err
+	}
+
+	ass, err := inspect.DecodeAssertionObject(ctx, input.RawAssertionObject)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &inspect.Report{
+		Kind:            inspect.KindAssertionObject,
+		Source:          source,
+		CredentialID:    input.CredentialID,
+		AssertionObject: ass,
+	}
+
+	// app attest clients send the data they signed rather than a client data json
+	if cd, err := inspect.DecodeClientData([]byte(input.RawClientDataJSON)); err == nil {
+		report.ClientData = cd
+	}
+
+	return report, nil
+}
@@ -0,0 +1,77 @@
+package metadata
+
+import (
+	"context"
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/walteh/snake"
+	"github.com/walteh/webauthn/pkg/webauthn/metadata"
+)
+
+type Diff struct {
+	blobs
+
+	older string
+	newer string
+}
+
+var _ snake.Snakeable = (*Diff)(nil)
+
+func (me *Diff) BuildCommand(ctx context.Context) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "diff <older.jwt> <newer.jwt>",
+		Short: "list the authenticators added, removed, revoked or whose status changed between two metadata blobs",
+		Args:  cobra.ExactArgs(2),
+	}
+
+	me.flags(cmd, true)
+
+	return cmd
+}
+
+func (me *Diff) ParseArguments(ctx context.Context, cmd *cobra.Command, args []string) error {
+	me.older, me.newer = args[0], args[1]
+	return me.parse()
+}
+
+func (me *Diff) Run(ctx context.Context, cmd *cobra.Command) error {
+	cmd.SilenceUsage = true
+
+	older, err := me.load(me.older)
+	if err != nil {
+		return err
+	}
+
+	newer, err := me.load(me.newer)
+	if err != nil {
+		return err
+	}
+
+	changes := metadata.Diff(&older.Payload, &newer.Payload)
+
+	if me.Output == "json" {
+		return writeJSON(cmd.OutOrStdout(), changes)
+	}
+
+	w := cmd.OutOrStdout()
+	fmt.Fprintf(w, "blob %d -> %d, %d changes\n", older.Payload.Number, newer.Payload.Number, len(changes))
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, c := range changes {
+		fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\n", c.Kind, c.ID, status(c), c.Description)
+	}
+
+	return tw.Flush()
+}
+
+func status(c metadata.Change) string {
+	switch {
+	case c.From == "":
+		return string(c.To)
+	case c.To == "":
+		return string(c.From)
+	}
+	return fmt.Sprintf("%s -> %s", c.From, c.To)
+}
@@ -0,0 +1,108 @@
+package metadata
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/walteh/snake"
+	"github.com/walteh/webauthn/pkg/webauthn/metadata"
+)
+
+var ErrUnknownOutput = errors.New("ErrUnknownOutput")
+
+// NewCommand returns the metadata command holding the verify, search and diff subcommands
+func NewCommand(ctx context.Context) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "metadata",
+		Short: "verify, search and diff FIDO metadata (MDS3) blobs",
+	}
+
+	snake.MustNewCommand(ctx, cmd, "", &Verify{})
+	snake.MustNewCommand(ctx, cmd, "", &Search{})
+	snake.MustNewCommand(ctx, cmd, "", &Diff{})
+
+	return cmd
+}
+
+// blobs loads metadata blob files, verifying them against a trust anchor
+type blobs struct {
+	Root       string
+	Time       string
+	SkipVerify bool
+	Output     string
+
+	root *x509.Certificate
+	at   time.Time
+}
+
+func (me *blobs) flags(cmd *cobra.Command, skippable bool) {
+	cmd.Flags().StringVar(&me.Root, "root", "", "file of the PEM or DER trust anchor, defaults to the FIDO production root")
+	cmd.Flags().StringVar(&me.Time, "time", "", "RFC 3339 time the chain is checked at, defaults to now")
+	cmd.Flags().StringVarP(&me.Output, "output", "o", "text", "output format, text or json")
+	if skippable {
+		cmd.Flags().BoolVar(&me.SkipVerify, "skip-verify", false, "decode the blobs without checking their signature")
+	}
+}
+
+func (me *blobs) parse() error {
+	if me.Output != "text" && me.Output != "json" {
+		return fmt.Errorf("%w: %q", ErrUnknownOutput, me.Output)
+	}
+
+	me.at = time.Now()
+	if me.Time != "" {
+		at, err := time.Parse(time.RFC3339, me.Time)
+		if err != nil {
+			return err
+		}
+		me.at = at
+	}
+
+	data := []byte(metadata.ProductionMDSRoot)
+	if me.Root != "" {
+		var err error
+		if data, err = os.ReadFile(me.Root); err != nil {
+			return err
+		}
+	}
+
+	root, err := metadata.ParseRoot(data)
+	if err != nil {
+		return err
+	}
+
+	me.root = root
+
+	return nil
+}
+
+func (me *blobs) load(path string) (*metadata.BLOB, error) {
+	body, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if me.SkipVerify {
+		return metadata.DecodeBLOB(body)
+	}
+
+	blob, err := metadata.VerifyBLOB(body, me.root, me.at)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return blob, nil
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,71 @@
+package metadata
+
+import (
+	"context"
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/walteh/snake"
+	"github.com/walteh/webauthn/pkg/webauthn/metadata"
+)
+
+type Search struct {
+	blobs
+
+	AAGUID string
+	Name   string
+	Status string
+
+	path string
+}
+
+var _ snake.Snakeable = (*Search)(nil)
+
+func (me *Search) BuildCommand(ctx context.Context) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "search <blob.jwt>",
+		Short: "look up metadata blob entries by aaguid, name or certification status",
+		Args:  cobra.ExactArgs(1),
+	}
+
+	me.flags(cmd, true)
+
+	cmd.Flags().StringVar(&me.AAGUID, "aaguid", "", "aaguid, aaid or attestation certificate key identifier")
+	cmd.Flags().StringVar(&me.Name, "name", "", "part of the authenticator description, ignoring case")
+	cmd.Flags().StringVar(&me.Status, "status", "", "current status, such as FIDO_CERTIFIED_L1 or REVOKED")
+
+	return cmd
+}
+
+func (me *Search) ParseArguments(ctx context.Context, cmd *cobra.Command, args []string) error {
+	me.path = args[0]
+	return me.parse()
+}
+
+func (me *Search) Run(ctx context.Context, cmd *cobra.Command) error {
+	cmd.SilenceUsage = true
+
+	blob, err := me.load(me.path)
+	if err != nil {
+		return err
+	}
+
+	entries := blob.Payload.Search(metadata.Query{
+		AAGUID: me.AAGUID,
+		Name:   me.Name,
+		Status: metadata.AuthenticatorStatus(me.Status),
+	})
+
+	if me.Output == "json" {
+		return writeJSON(cmd.OutOrStdout(), entries)
+	}
+
+	tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tSTATUS\tDESCRIPTION")
+	for _, e := range entries {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", e.ID(), e.Status(), e.MetadataStatement.Description)
+	}
+
+	return tw.Flush()
+}
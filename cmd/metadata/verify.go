@@ -0,0 +1,77 @@
+package metadata
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/walteh/snake"
+)
+
+type Verify struct {
+	blobs
+
+	path string
+}
+
+var _ snake.Snakeable = (*Verify)(nil)
+
+func (me *Verify) BuildCommand(ctx context.Context) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "verify <blob.jwt>",
+		Short: "verify a local metadata blob chains to the root and is signed by its signing certificate",
+		Long: `verify a local metadata blob offline: the x5c of its header must chain to the root at the given time
+and the blob must be signed by the first certificate. Revocation of the chain is not checked.`,
+		Args: cobra.ExactArgs(1),
+	}
+
+	me.flags(cmd, false)
+
+	return cmd
+}
+
+func (me *Verify) ParseArguments(ctx context.Context, cmd *cobra.Command, args []string) error {
+	me.path = args[0]
+	return me.parse()
+}
+
+type verified struct {
+	Number     int      `json:"no"`
+	NextUpdate string   `json:"nextUpdate"`
+	Entries    int      `json:"entries"`
+	Algorithm  string   `json:"algorithm"`
+	Chain      []string `json:"chain"`
+}
+
+func (me *Verify) Run(ctx context.Context, cmd *cobra.Command) error {
+	cmd.SilenceUsage = true
+
+	blob, err := me.load(me.path)
+	if err != nil {
+		return err
+	}
+
+	res := verified{
+		Number:     blob.Payload.Number,
+		NextUpdate: blob.Payload.NextUpdate,
+		Entries:    len(blob.Payload.Entries),
+		Algorithm:  blob.Algorithm,
+	}
+	for _, c := range blob.Chain {
+		res.Chain = append(res.Chain, c.Subject.String())
+	}
+	res.Chain = append(res.Chain, me.root.Subject.String())
+
+	if me.Output == "json" {
+		return writeJSON(cmd.OutOrStdout(), res)
+	}
+
+	w := cmd.OutOrStdout()
+	fmt.Fprintf(w, "blob %d verified, %d entries, next update %s\n", res.Number, res.Entries, res.NextUpdate)
+	fmt.Fprintf(w, "  signed %s by\n", res.Algorithm)
+	for _, s := range res.Chain {
+		fmt.Fprintf(w, "    %s\n", s)
+	}
+
+	return nil
+}
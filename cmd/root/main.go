@@ -2,30 +2,53 @@ package root
 
 import (
 	"context"
+	"os"
 
 	"github.com/rs/zerolog"
 	"github.com/spf13/cobra"
 
 	"github.com/walteh/snake"
+	"github.com/walteh/webauthn/cmd/inspect"
+	"github.com/walteh/webauthn/cmd/metadata"
+	"github.com/walteh/webauthn/cmd/verify"
 	myversion "github.com/walteh/webauthn/version"
 )
 
-func Build(ctx context.Context) (*cobra.Command, error) {
+type Root struct {
+	Debug bool
+}
 
-	zerolog.SetGlobalLevel(zerolog.InfoLevel)
+var _ snake.Snakeable = (*Root)(nil)
 
+func (me *Root) BuildCommand(ctx context.Context) *cobra.Command {
 	// rootCmd represents the base command when called without any subcommands
 	rootCmd := &cobra.Command{
-		Use:   "webauthn",
-		Short: "Webauthn server",
-		Long:  "Webauthn server",
-		Run: func(cmd *cobra.Command, args []string) {
-			// Do Stuff Here
-		},
+		Use:     "webauthn",
+		Short:   "Webauthn server",
+		Long:    "Webauthn server",
+		Version: myversion.Version,
 	}
 
+	rootCmd.PersistentFlags().BoolVarP(&me.Debug, "debug", "d", false, "log the decoding and verification steps")
+
+	snake.MustNewCommand(ctx, rootCmd, "", &inspect.Handler{})
+	snake.MustNewCommand(ctx, rootCmd, "", &verify.Handler{})
+
+	rootCmd.AddCommand(metadata.NewCommand(ctx))
 	rootCmd.AddCommand(myversion.Build(ctx))
-	rootCmd.AddCommand(snake.Build(ctx))
 
-	return rootCmd, nil
+	return rootCmd
+}
+
+func (me *Root) ParseArguments(ctx context.Context, cmd *cobra.Command, args []string) error {
+	level := zerolog.InfoLevel
+	if me.Debug {
+		level = zerolog.DebugLevel
+	}
+
+	zerolog.SetGlobalLevel(level)
+
+	cmd.SetContext(zerolog.New(zerolog.ConsoleWriter{Out: os.Stderr}).With().Timestamp().Logger().WithContext(ctx))
+
+	return nil
 }
@@ -0,0 +1,103 @@
+package verify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/walteh/snake"
+	"github.com/walteh/webauthn/pkg/webauthn/replay"
+)
+
+var ErrUnknownOutput = errors.New("ErrUnknownOutput")
+
+type Handler struct {
+	Output string
+	Time   string
+
+	ceremony *replay.Ceremony
+}
+
+var _ snake.Snakeable = (*Handler)(nil)
+
+func (me *Handler) BuildCommand(ctx context.Context) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "verify <ceremony.json>",
+		Short: "replay a recorded registration or assertion offline",
+		Long: `replay a recorded registration or assertion offline and report every verification step: client data,
+rp id hash, flags, counter, signature, attestation statement and trust chain. The ceremony file holds the
+challenge, rp id, origin, the attestation or the assertion with the stored credential, and optionally the
+time of the ceremony and the trust anchors. Exits non zero naming the first failing step.`,
+		Args: cobra.ExactArgs(1),
+	}
+
+	cmd.Flags().StringVarP(&me.Output, "output", "o", "text", "output format, text or json")
+	cmd.Flags().StringVar(&me.Time, "time", "", "RFC 3339 time certificates are checked at, overriding the ceremony file")
+
+	return cmd
+}
+
+func (me *Handler) ParseArguments(ctx context.Context, cmd *cobra.Command, args []string) error {
+	if me.Output != "text" && me.Output != "json" {
+		return fmt.Errorf("%w: %q", ErrUnknownOutput, me.Output)
+	}
+
+	c, err := replay.Load(args[0])
+	if err != nil {
+		return err
+	}
+
+	if me.Time != "" {
+		at, err := time.Parse(time.RFC3339, me.Time)
+		if err != nil {
+			return err
+		}
+		c.Time = &at
+	}
+
+	me.ceremony = c
+
+	return nil
+}
+
+func (me *Handler) Run(ctx context.Context, cmd *cobra.Command) error {
+	report, err := replay.Replay(ctx, me.ceremony)
+	if err != nil {
+		return err
+	}
+
+	if me.Output == "json" {
+		enc := json.NewEncoder(cmd.OutOrStdout())
+		enc.SetIndent("", "  ")
+		err = enc.Encode(report)
+	} else {
+		err = writeText(cmd.OutOrStdout(), report)
+	}
+	if err != nil {
+		return err
+	}
+
+	// the report already explains the failure
+	cmd.SilenceUsage = true
+
+	return report.Err()
+}
+
+func writeText(w io.Writer, report *replay.Report) error {
+	fmt.Fprintf(w, "%s %s\n", report.Type, report.Format)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, s := range report.Steps {
+		fmt.Fprintf(tw, "  %s\t%s\t%s\n", s.Status, s.Name, s.Detail)
+		if s.Error != "" {
+			fmt.Fprintf(tw, "  \t\t%s\n", s.Error)
+		}
+	}
+
+	return tw.Flush()
+}
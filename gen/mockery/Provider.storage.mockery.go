@@ -23,6 +23,49 @@ func (_m *MockProvider_storage) EXPECT() *MockProvider_storage_Expecter {
 	return &MockProvider_storage_Expecter{mock: &_m.Mock}
 }
 
+// DeleteCredential provides a mock function with given fields: ctx, credid
+func (_m *MockProvider_storage) DeleteCredential(ctx context.Context, credid string) error {
+	ret := _m.Called(ctx, credid)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, credid)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// MockProvider_storage_DeleteCredential_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'DeleteCredential'
+type MockProvider_storage_DeleteCredential_Call struct {
+	*mock.Call
+}
+
+// DeleteCredential is a helper method to define mock.On call
+//   - ctx context.Context
+//   - credid string
+func (_e *MockProvider_storage_Expecter) DeleteCredential(ctx interface{}, credid interface{}) *MockProvider_storage_DeleteCredential_Call {
+	return &MockProvider_storage_DeleteCredential_Call{Call: _e.mock.On("DeleteCredential", ctx, credid)}
+}
+
+func (_c *MockProvider_storage_DeleteCredential_Call) Run(run func(ctx context.Context, credid string)) *MockProvider_storage_DeleteCredential_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string))
+	})
+	return _c
+}
+
+func (_c *MockProvider_storage_DeleteCredential_Call) Return(_a0 error) *MockProvider_storage_DeleteCredential_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *MockProvider_storage_DeleteCredential_Call) RunAndReturn(run func(context.Context, string) error) *MockProvider_storage_DeleteCredential_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // GetExisting provides a mock function with given fields: ctx, challenge, credid
 func (_m *MockProvider_storage) GetExisting(ctx context.Context, challenge string, credid string) (*types.Ceremony, *types.Credential, error) {
 	ret := _m.Called(ctx, challenge, credid)
@@ -242,6 +285,106 @@ func (_c *MockProvider_storage_IncrementExistingCredential_Call) RunAndReturn(ru
 	return _c
 }
 
+// ListCredentials provides a mock function with given fields: ctx, sessionid
+func (_m *MockProvider_storage) ListCredentials(ctx context.Context, sessionid string) ([]*types.Credential, error) {
+	ret := _m.Called(ctx, sessionid)
+
+	var r0 []*types.Credential
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) ([]*types.Credential, error)); ok {
+		return rf(ctx, sessionid)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) []*types.Credential); ok {
+		r0 = rf(ctx, sessionid)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*types.Credential)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, sessionid)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// MockProvider_storage_ListCredentials_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'ListCredentials'
+type MockProvider_storage_ListCredentials_Call struct {
+	*mock.Call
+}
+
+// ListCredentials is a helper method to define mock.On call
+//   - ctx context.Context
+//   - sessionid string
+func (_e *MockProvider_storage_Expecter) ListCredentials(ctx interface{}, sessionid interface{}) *MockProvider_storage_ListCredentials_Call {
+	return &MockProvider_storage_ListCredentials_Call{Call: _e.mock.On("ListCredentials", ctx, sessionid)}
+}
+
+func (_c *MockProvider_storage_ListCredentials_Call) Run(run func(ctx context.Context, sessionid string)) *MockProvider_storage_ListCredentials_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string))
+	})
+	return _c
+}
+
+func (_c *MockProvider_storage_ListCredentials_Call) Return(_a0 []*types.Credential, _a1 error) *MockProvider_storage_ListCredentials_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *MockProvider_storage_ListCredentials_Call) RunAndReturn(run func(context.Context, string) ([]*types.Credential, error)) *MockProvider_storage_ListCredentials_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// UpdateExistingCredentialCounter provides a mock function with given fields: ctx, crm, credid, signCount
+func (_m *MockProvider_storage) UpdateExistingCredentialCounter(ctx context.Context, crm *types.Ceremony, credid string, signCount uint64) error {
+	ret := _m.Called(ctx, crm, credid, signCount)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *types.Ceremony, string, uint64) error); ok {
+		r0 = rf(ctx, crm, credid, signCount)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// MockProvider_storage_UpdateExistingCredentialCounter_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'UpdateExistingCredentialCounter'
+type MockProvider_storage_UpdateExistingCredentialCounter_Call struct {
+	*mock.Call
+}
+
+// UpdateExistingCredentialCounter is a helper method to define mock.On call
+//   - ctx context.Context
+//   - crm *types.Ceremony
+//   - credid string
+//   - signCount uint64
+func (_e *MockProvider_storage_Expecter) UpdateExistingCredentialCounter(ctx interface{}, crm interface{}, credid interface{}, signCount interface{}) *MockProvider_storage_UpdateExistingCredentialCounter_Call {
+	return &MockProvider_storage_UpdateExistingCredentialCounter_Call{Call: _e.mock.On("UpdateExistingCredentialCounter", ctx, crm, credid, signCount)}
+}
+
+func (_c *MockProvider_storage_UpdateExistingCredentialCounter_Call) Run(run func(ctx context.Context, crm *types.Ceremony, credid string, signCount uint64)) *MockProvider_storage_UpdateExistingCredentialCounter_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(*types.Ceremony), args[2].(string), args[3].(uint64))
+	})
+	return _c
+}
+
+func (_c *MockProvider_storage_UpdateExistingCredentialCounter_Call) Return(_a0 error) *MockProvider_storage_UpdateExistingCredentialCounter_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *MockProvider_storage_UpdateExistingCredentialCounter_Call) RunAndReturn(run func(context.Context, *types.Ceremony, string, uint64) error) *MockProvider_storage_UpdateExistingCredentialCounter_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // WriteNewCeremony provides a mock function with given fields: ctx, crm
 func (_m *MockProvider_storage) WriteNewCeremony(ctx context.Context, crm *types.Ceremony) error {
 	ret := _m.Called(ctx, crm)
@@ -5,3 +5,9 @@ import "context"
 type Provider interface {
 	AccessTokenForUserID(ctx context.Context, userID string) (string, error)
 }
+
+// Validator resolves an access token issued by a Provider back to the user id it was issued for, the
+// ceremony flows issue their tokens for the id of the credential they verified
+type Validator interface {
+	UserIDForAccessToken(ctx context.Context, token string) (string, error)
+}
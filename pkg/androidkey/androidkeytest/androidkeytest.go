@@ -0,0 +1,217 @@
+// Package androidkeytest issues KeyStore style attestation chains from a throwaway root, for tests of
+// code verifying android keys.
+package androidkeytest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/webauthn/pkg/androidkey"
+)
+
+// SignatureDigest is the digest of the signing certificate of the test app
+var SignatureDigest = func() []byte {
+	sum := sha256.Sum256([]byte("androidkeytest signing certificate"))
+	return sum[:]
+}()
+
+const PackageName = "xyz.nugg.app"
+
+// OsPatchLevel is the patch level reported for keys unless KeyOptions sets one
+const OsPatchLevel = 202401
+
+// KeyOptions describes the key a chain is issued for, the zero value is a TEE key of PackageName signed with
+// SignatureDigest for the given challenge, on a locked device that booted a verified image
+type KeyOptions struct {
+	Challenge        []byte
+	PackageNames     []string
+	SignatureDigests [][]byte
+	AllApplications  bool
+	NotBefore        time.Time
+
+	// MissingOrigin leaves the origin tag out of the enforced list, ImportedOrigin reports an imported key
+	MissingOrigin  bool
+	ImportedOrigin bool
+
+	// Software and StrongBox set the attestation and keymaster security level
+	Software  bool
+	StrongBox bool
+
+	Unlocked          bool
+	VerifiedBootState asn1.Enumerated
+	OsPatchLevel      int
+}
+
+// Authority is a root and an intermediate standing in for google's attestation roots
+type Authority struct {
+	rootCert  *x509.Certificate
+	rootKey   *ecdsa.PrivateKey
+	interCert *x509.Certificate
+	interKey  *ecdsa.PrivateKey
+	serial    int64
+}
+
+func NewAuthority(t testing.TB) *Authority {
+	me := &Authority{}
+
+	me.rootKey = newKey(t)
+	me.rootCert = me.issue(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "androidkeytest root"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, &me.rootKey.PublicKey, nil, me.rootKey)
+
+	me.interKey = newKey(t)
+	me.interCert = me.issue(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "androidkeytest intermediate"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, &me.interKey.PublicKey, me.rootCert, me.rootKey)
+
+	return me
+}
+
+// Roots returns a pool holding the authority's root
+func (me *Authority) Roots() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(me.rootCert)
+	return pool
+}
+
+// Issue generates a key and returns it with its DER encoded chain, leaf first
+func (me *Authority) Issue(t testing.TB, opts KeyOptions) (*ecdsa.PrivateKey, [][]byte) {
+	key := newKey(t)
+
+	ext, err := asn1.Marshal(opts.keyDescription(t))
+	require.NoError(t, err)
+
+	leaf := me.issue(t, &x509.Certificate{
+		Subject:         pkix.Name{CommonName: "Android Keystore Key"},
+		NotBefore:       opts.NotBefore,
+		KeyUsage:        x509.KeyUsageDigitalSignature,
+		ExtraExtensions: []pkix.Extension{{Id: androidkey.KeyDescriptionOID, Value: ext}},
+	}, &key.PublicKey, me.interCert, me.interKey)
+
+	return key, [][]byte{leaf.Raw, me.interCert.Raw, me.rootCert.Raw}
+}
+
+func (me *Authority) issue(t testing.TB, tmpl *x509.Certificate, pub *ecdsa.PublicKey, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) *x509.Certificate {
+	me.serial++
+	tmpl.SerialNumber = big.NewInt(me.serial)
+	if tmpl.NotBefore.IsZero() {
+		tmpl.NotBefore = time.Now().Add(-time.Hour)
+	}
+	tmpl.NotAfter = tmpl.NotBefore.Add(10 * 365 * 24 * time.Hour)
+
+	if parent == nil {
+		parent = tmpl
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, pub, parentKey)
+	require.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return cert
+}
+
+func newKey(t testing.TB) *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	return key
+}
+
+func (me KeyOptions) keyDescription(t testing.TB) androidkey.KeyDescription {
+	packages := me.PackageNames
+	if packages == nil {
+		packages = []string{PackageName}
+	}
+
+	digests := me.SignatureDigests
+	if digests == nil {
+		digests = [][]byte{SignatureDigest}
+	}
+
+	appID := androidkey.AttestationApplicationID{SignatureDigests: digests}
+	for _, p := range packages {
+		appID.PackageInfos = append(appID.PackageInfos, androidkey.PackageInfo{PackageName: []byte(p), Version: 1})
+	}
+
+	rawAppID, err := asn1.Marshal(appID)
+	require.NoError(t, err)
+
+	level := asn1.Enumerated(androidkey.SecurityLevelTrustedEnvironment)
+	switch {
+	case me.Software:
+		level = androidkey.SecurityLevelSoftware
+	case me.StrongBox:
+		level = androidkey.SecurityLevelStrongBox
+	}
+
+	patchLevel := me.OsPatchLevel
+	if patchLevel == 0 {
+		patchLevel = OsPatchLevel
+	}
+
+	enforced := androidkey.AuthorizationList{
+		Purpose: []int{2},
+		RootOfTrust: androidkey.RootOfTrust{
+			VerifiedBootKey:   make([]byte, 32),
+			DeviceLocked:      !me.Unlocked,
+			VerifiedBootState: me.VerifiedBootState,
+		},
+		OsPatchLevel: patchLevel,
+	}
+
+	switch {
+	case me.MissingOrigin:
+	case me.ImportedOrigin:
+		enforced.Origin = asn1.RawValue{FullBytes: originTag(2)}
+	default:
+		enforced.Origin = asn1.RawValue{FullBytes: originTag(0)}
+	}
+
+	kd := androidkey.KeyDescription{
+		AttestationVersion:       4,
+		AttestationSecurityLevel: level,
+		KeymasterVersion:         41,
+		KeymasterSecurityLevel:   level,
+		AttestationChallenge:     me.Challenge,
+		SoftwareEnforced: androidkey.AuthorizationList{
+			AttestationApplicationID: rawAppID,
+		},
+		TeeEnforced: enforced,
+	}
+
+	if me.Software {
+		// software keymasters report every authorization in the software enforced list
+		enforced.AttestationApplicationID = rawAppID
+		kd.SoftwareEnforced, kd.TeeEnforced = enforced, androidkey.AuthorizationList{}
+	}
+
+	if me.AllApplications {
+		// encoding/asn1 writes the FullBytes of a RawValue as they are, so the explicit [600] tag around
+		// the NULL is spelled out
+		kd.TeeEnforced.AllApplications = asn1.RawValue{FullBytes: []byte{0xbf, 0x84, 0x58, 0x02, 0x05, 0x00}}
+	}
+
+	return kd
+}
+
+// originTag spells out the explicit [702] tag around the INTEGER origin, encoding/asn1 writes the FullBytes
+// of a RawValue as they are
+func originTag(origin byte) []byte {
+	return []byte{0xbf, 0x85, 0x3e, 0x03, 0x02, 0x01, origin}
+}
@@ -0,0 +1,56 @@
+package androidkey
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"fmt"
+)
+
+// CredentialID returns the id a KeyStore key is stored under, the SHA-256 hash of its DER encoded
+// SubjectPublicKeyInfo, which is what PublicKey.getEncoded() returns on android
+func CredentialID(cert *x509.Certificate) []byte {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return sum[:]
+}
+
+// SignedData returns the data an app signs with its KeyStore key for an assertion:
+//
+//	counter (8 bytes, big endian) || challenge || data
+//
+// KeyStore keys keep no counter, the app keeps one next to the key and increments it for every assertion.
+func SignedData(counter uint64, challenge []byte, data []byte) []byte {
+	signed := make([]byte, 8, 8+len(challenge)+len(data))
+	binary.BigEndian.PutUint64(signed, counter)
+	signed = append(signed, challenge...)
+	return append(signed, data...)
+}
+
+// VerifySignature checks a DER encoded SHA256withECDSA signature made by the DER encoded SubjectPublicKeyInfo
+func VerifySignature(publicKey []byte, signed []byte, signature []byte) error {
+	key, err := x509.ParsePKIXPublicKey(publicKey)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidKey, err)
+	}
+
+	pub, ok := key.(*ecdsa.PublicKey)
+	if !ok {
+		return fmt.Errorf("%w: expected an ecdsa key, got %T", ErrInvalidKey, key)
+	}
+
+	digest := sha256.Sum256(signed)
+	if !ecdsa.VerifyASN1(pub, digest[:], signature) {
+		return fmt.Errorf("%w: signature does not match", ErrInvalidSignature)
+	}
+
+	return nil
+}
+
+// VerifyCounter requires the counter of an assertion to be greater than the one stored with the key
+func VerifyCounter(stored uint64, received uint64) error {
+	if received <= stored {
+		return fmt.Errorf("%w: counter %d is not greater than stored %d", ErrInvalidCounter, received, stored)
+	}
+	return nil
+}
@@ -0,0 +1,18 @@
+package androidkey
+
+import "errors"
+
+var (
+	ErrInvalidChain          = errors.New("ErrInvalidChain")
+	ErrInvalidKeyDescription = errors.New("ErrInvalidKeyDescription")
+	ErrChallengeMismatch     = errors.New("ErrChallengeMismatch")
+	ErrInvalidKey            = errors.New("ErrInvalidKey")
+	ErrPackageNotAllowed     = errors.New("ErrPackageNotAllowed")
+	ErrSignatureNotAllowed   = errors.New("ErrSignatureNotAllowed")
+	ErrInvalidSignature      = errors.New("ErrInvalidSignature")
+	ErrInvalidCounter        = errors.New("ErrInvalidCounter")
+	ErrPolicy                = errors.New("ErrPolicy")
+	ErrInvalidStatusList     = errors.New("ErrInvalidStatusList")
+	ErrRevoked               = errors.New("ErrRevoked")
+	ErrNoRoots               = errors.New("ErrNoRoots")
+)
@@ -0,0 +1,154 @@
+package androidkey
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+)
+
+// KeyDescriptionOID identifies the key attestation extension of the leaf certificate of a KeyStore chain
+var KeyDescriptionOID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 1, 17}
+
+// security levels of the attestation and of the keymaster, https://source.android.com/docs/security/features/keystore/attestation#securitylevel-values
+const (
+	SecurityLevelSoftware           = 0
+	SecurityLevelTrustedEnvironment = 1
+	SecurityLevelStrongBox          = 2
+)
+
+// KeyDescription is the content of the key attestation extension,
+// https://source.android.com/docs/security/features/keystore/attestation#schema
+type KeyDescription struct {
+	AttestationVersion       int
+	AttestationSecurityLevel asn1.Enumerated
+	KeymasterVersion         int
+	KeymasterSecurityLevel   asn1.Enumerated
+	AttestationChallenge     []byte
+	UniqueID                 []byte
+	SoftwareEnforced         AuthorizationList
+	TeeEnforced              AuthorizationList
+}
+
+// AuthorizationList holds the tags of a key. Tags of NULL type, like AllApplications, are present when
+// their FullBytes are set, so is Origin whose zero value KM_ORIGIN_GENERATED could not be told apart from
+// a missing tag.
+type AuthorizationList struct {
+	Purpose                     []int         `asn1:"tag:1,explicit,set,optional"`
+	Algorithm                   int           `asn1:"tag:2,explicit,optional"`
+	KeySize                     int           `asn1:"tag:3,explicit,optional"`
+	Digest                      []int         `asn1:"tag:5,explicit,set,optional"`
+	Padding                     []int         `asn1:"tag:6,explicit,set,optional"`
+	EcCurve                     int           `asn1:"tag:10,explicit,optional"`
+	RsaPublicExponent           int           `asn1:"tag:200,explicit,optional"`
+	RollbackResistance          asn1.RawValue `asn1:"tag:303,explicit,optional"`
+	ActiveDateTime              int           `asn1:"tag:400,explicit,optional"`
+	OriginationExpireDateTime   int           `asn1:"tag:401,explicit,optional"`
+	UsageExpireDateTime         int           `asn1:"tag:402,explicit,optional"`
+	NoAuthRequired              asn1.RawValue `asn1:"tag:503,explicit,optional"`
+	UserAuthType                int           `asn1:"tag:504,explicit,optional"`
+	AuthTimeout                 int           `asn1:"tag:505,explicit,optional"`
+	AllowWhileOnBody            asn1.RawValue `asn1:"tag:506,explicit,optional"`
+	TrustedUserPresenceRequired asn1.RawValue `asn1:"tag:507,explicit,optional"`
+	TrustedConfirmationRequired asn1.RawValue `asn1:"tag:508,explicit,optional"`
+	UnlockedDeviceRequired      asn1.RawValue `asn1:"tag:509,explicit,optional"`
+	AllApplications             asn1.RawValue `asn1:"tag:600,explicit,optional"`
+	ApplicationID               asn1.RawValue `asn1:"tag:601,explicit,optional"`
+	CreationDateTime            int           `asn1:"tag:701,explicit,optional"`
+	Origin                      asn1.RawValue `asn1:"tag:702,explicit,optional"`
+	RootOfTrust                 RootOfTrust   `asn1:"tag:704,explicit,optional"`
+	OsVersion                   int           `asn1:"tag:705,explicit,optional"`
+	OsPatchLevel                int           `asn1:"tag:706,explicit,optional"`
+	AttestationApplicationID    []byte        `asn1:"tag:709,explicit,optional"`
+	AttestationIDBrand          []byte        `asn1:"tag:710,explicit,optional"`
+	AttestationIDDevice         []byte        `asn1:"tag:711,explicit,optional"`
+	AttestationIDProduct        []byte        `asn1:"tag:712,explicit,optional"`
+	AttestationIDSerial         []byte        `asn1:"tag:713,explicit,optional"`
+	AttestationIDImei           []byte        `asn1:"tag:714,explicit,optional"`
+	AttestationIDMeid           []byte        `asn1:"tag:715,explicit,optional"`
+	AttestationIDManufacturer   []byte        `asn1:"tag:716,explicit,optional"`
+	AttestationIDModel          []byte        `asn1:"tag:717,explicit,optional"`
+	VendorPatchLevel            int           `asn1:"tag:718,explicit,optional"`
+	BootPatchLevel              int           `asn1:"tag:719,explicit,optional"`
+}
+
+// OriginValue returns the origin of the key, false when the list has no origin tag
+func (me AuthorizationList) OriginValue() (int, bool) {
+	if len(me.Origin.FullBytes) == 0 {
+		return 0, false
+	}
+
+	var origin int
+	if rest, err := asn1.Unmarshal(me.Origin.Bytes, &origin); err != nil || len(rest) > 0 {
+		return 0, false
+	}
+
+	return origin, true
+}
+
+type RootOfTrust struct {
+	VerifiedBootKey   []byte
+	DeviceLocked      bool
+	VerifiedBootState asn1.Enumerated
+	VerifiedBootHash  []byte `asn1:"optional"`
+}
+
+// AttestationApplicationID identifies the app a key was generated by, the packages sharing its uid
+// and the digests of the certificates the app is signed with
+type AttestationApplicationID struct {
+	PackageInfos     []PackageInfo `asn1:"set"`
+	SignatureDigests [][]byte      `asn1:"set"`
+}
+
+type PackageInfo struct {
+	PackageName []byte
+	Version     int64
+}
+
+// ParseKeyDescription reads the key attestation extension of a KeyStore leaf certificate
+func ParseKeyDescription(cert *x509.Certificate) (*KeyDescription, error) {
+	var ext []byte
+	for _, e := range cert.Extensions {
+		if e.Id.Equal(KeyDescriptionOID) {
+			ext = e.Value
+		}
+	}
+
+	if len(ext) == 0 {
+		return nil, fmt.Errorf("%w: certificate is missing extension %s", ErrInvalidKeyDescription, KeyDescriptionOID)
+	}
+
+	var kd KeyDescription
+	if _, err := asn1.Unmarshal(ext, &kd); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKeyDescription, err)
+	}
+
+	return &kd, nil
+}
+
+// ApplicationID parses the attestation application id, which keymaster reports in the software enforced list
+func (me *KeyDescription) ApplicationID() (*AttestationApplicationID, error) {
+	raw := me.SoftwareEnforced.AttestationApplicationID
+	if len(raw) == 0 {
+		raw = me.TeeEnforced.AttestationApplicationID
+	}
+
+	if len(raw) == 0 {
+		return nil, fmt.Errorf("%w: missing attestation application id", ErrInvalidKeyDescription)
+	}
+
+	var id AttestationApplicationID
+	if _, err := asn1.Unmarshal(raw, &id); err != nil {
+		return nil, fmt.Errorf("%w: attestation application id: %v", ErrInvalidKeyDescription, err)
+	}
+
+	return &id, nil
+}
+
+// PackageNames returns the names of the packages in the attestation application id
+func (me *AttestationApplicationID) PackageNames() []string {
+	names := make([]string, 0, len(me.PackageInfos))
+	for _, p := range me.PackageInfos {
+		names = append(names, string(p.PackageName))
+	}
+	return names
+}
@@ -0,0 +1,117 @@
+package androidkey
+
+import (
+	"encoding/asn1"
+	"fmt"
+)
+
+// verified boot states of the root of trust, https://source.android.com/docs/security/features/keystore/attestation#verifiedbootstate-values
+const (
+	VerifiedBootStateVerified   asn1.Enumerated = 0
+	VerifiedBootStateSelfSigned asn1.Enumerated = 1
+	VerifiedBootStateUnverified asn1.Enumerated = 2
+	VerifiedBootStateFailed     asn1.Enumerated = 3
+)
+
+// Policy is what a KeyStore key and the device holding it must satisfy to be accepted
+type Policy struct {
+	// MinSecurityLevel is the lowest attestation and keymaster security level accepted,
+	// SecurityLevelStrongBox only accepts keys of a dedicated secure element
+	MinSecurityLevel int
+
+	// VerifiedBootStates are the accepted verified boot states of the device, any state is accepted when empty
+	VerifiedBootStates []asn1.Enumerated
+
+	// RequireDeviceLocked rejects devices with an unlocked bootloader
+	RequireDeviceLocked bool
+
+	// MinOsPatchLevel is the oldest accepted os patch level, as YYYYMM. Zero accepts any patch level.
+	MinOsPatchLevel int
+
+	// PackageNames are the packages whose keys are accepted, every package sharing the uid of the app
+	// must be one of them. An empty list accepts no key, Verifier.Verify refuses every key without one.
+	PackageNames []string
+
+	// SignatureDigests are the SHA-256 digests of the certificates the app may be signed with
+	SignatureDigests [][]byte
+}
+
+// DefaultPolicy accepts hardware backed keys of locked devices that booted a verified image
+func DefaultPolicy(packageNames ...string) Policy {
+	return Policy{
+		MinSecurityLevel:    SecurityLevelTrustedEnvironment,
+		VerifiedBootStates:  []asn1.Enumerated{VerifiedBootStateVerified},
+		RequireDeviceLocked: true,
+		PackageNames:        packageNames,
+	}
+}
+
+// Check verifies the security level, root of trust and patch level reported in a key description
+func (me Policy) Check(kd *KeyDescription) error {
+	if int(kd.AttestationSecurityLevel) < me.MinSecurityLevel || int(kd.KeymasterSecurityLevel) < me.MinSecurityLevel {
+		return fmt.Errorf("%w: security level %d/%d below %d", ErrPolicy, kd.AttestationSecurityLevel, kd.KeymasterSecurityLevel, me.MinSecurityLevel)
+	}
+
+	// the root of trust and the patch level are only meaningful when enforced by secure hardware,
+	// software keys report them in the software enforced list
+	list := kd.TeeEnforced
+	if me.MinSecurityLevel == SecurityLevelSoftware && len(list.RootOfTrust.VerifiedBootKey) == 0 {
+		list = kd.SoftwareEnforced
+	}
+
+	if len(me.VerifiedBootStates) > 0 || me.RequireDeviceLocked {
+		if len(list.RootOfTrust.VerifiedBootKey) == 0 {
+			return fmt.Errorf("%w: missing root of trust", ErrPolicy)
+		}
+
+		if len(me.VerifiedBootStates) > 0 && !containsEnumerated(me.VerifiedBootStates, list.RootOfTrust.VerifiedBootState) {
+			return fmt.Errorf("%w: verified boot state %d not allowed", ErrPolicy, list.RootOfTrust.VerifiedBootState)
+		}
+
+		if me.RequireDeviceLocked && !list.RootOfTrust.DeviceLocked {
+			return fmt.Errorf("%w: device is unlocked", ErrPolicy)
+		}
+	}
+
+	if me.MinOsPatchLevel > 0 && list.OsPatchLevel < me.MinOsPatchLevel {
+		return fmt.Errorf("%w: os patch level %d older than %d", ErrPolicy, list.OsPatchLevel, me.MinOsPatchLevel)
+	}
+
+	return nil
+}
+
+// CheckApplicationID requires every package sharing the key's uid to be allowed and every signer of the app
+// to be a known one, and returns the first package
+func (me Policy) CheckApplicationID(id *AttestationApplicationID) (string, error) {
+	names := id.PackageNames()
+	if len(names) == 0 {
+		return "", fmt.Errorf("%w: no packages", ErrPackageNotAllowed)
+	}
+
+	for _, name := range names {
+		if !containsString(me.PackageNames, name) {
+			return "", fmt.Errorf("%w: %q", ErrPackageNotAllowed, name)
+		}
+	}
+
+	if len(id.SignatureDigests) == 0 {
+		return "", fmt.Errorf("%w: no signature digests", ErrSignatureNotAllowed)
+	}
+
+	for _, digest := range id.SignatureDigests {
+		if !containsDigest(me.SignatureDigests, digest) {
+			return "", fmt.Errorf("%w: %x", ErrSignatureNotAllowed, digest)
+		}
+	}
+
+	return names[0], nil
+}
+
+func containsEnumerated(list []asn1.Enumerated, v asn1.Enumerated) bool {
+	for _, e := range list {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
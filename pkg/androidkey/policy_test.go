@@ -0,0 +1,112 @@
+package androidkey_test
+
+import (
+	"context"
+	"encoding/asn1"
+	"errors"
+	"testing"
+
+	"github.com/walteh/webauthn/pkg/androidkey"
+	"github.com/walteh/webauthn/pkg/androidkey/androidkeytest"
+)
+
+func TestPolicy(t *testing.T) {
+	authority := androidkeytest.NewAuthority(t)
+	challenge := []byte("server challenge")
+
+	policy := func(edit func(*androidkey.Policy)) androidkey.Policy {
+		p := androidkey.DefaultPolicy(androidkeytest.PackageName)
+		p.SignatureDigests = [][]byte{androidkeytest.SignatureDigest}
+		if edit != nil {
+			edit(&p)
+		}
+		return p
+	}
+
+	tests := []struct {
+		name    string
+		opts    androidkeytest.KeyOptions
+		policy  androidkey.Policy
+		wantErr error
+	}{
+		{
+			name:   "default",
+			opts:   androidkeytest.KeyOptions{},
+			policy: policy(nil),
+		},
+		{
+			name:    "software key",
+			opts:    androidkeytest.KeyOptions{Software: true},
+			policy:  policy(nil),
+			wantErr: androidkey.ErrPolicy,
+		},
+		{
+			name:   "software key allowed",
+			opts:   androidkeytest.KeyOptions{Software: true},
+			policy: policy(func(p *androidkey.Policy) { p.MinSecurityLevel = androidkey.SecurityLevelSoftware }),
+		},
+		{
+			name:    "tee key when strongbox is required",
+			opts:    androidkeytest.KeyOptions{},
+			policy:  policy(func(p *androidkey.Policy) { p.MinSecurityLevel = androidkey.SecurityLevelStrongBox }),
+			wantErr: androidkey.ErrPolicy,
+		},
+		{
+			name:   "strongbox key",
+			opts:   androidkeytest.KeyOptions{StrongBox: true},
+			policy: policy(func(p *androidkey.Policy) { p.MinSecurityLevel = androidkey.SecurityLevelStrongBox }),
+		},
+		{
+			name:    "unlocked device",
+			opts:    androidkeytest.KeyOptions{Unlocked: true},
+			policy:  policy(nil),
+			wantErr: androidkey.ErrPolicy,
+		},
+		{
+			name:    "self signed boot image",
+			opts:    androidkeytest.KeyOptions{VerifiedBootState: androidkey.VerifiedBootStateSelfSigned},
+			policy:  policy(nil),
+			wantErr: androidkey.ErrPolicy,
+		},
+		{
+			name: "self signed boot image allowed",
+			opts: androidkeytest.KeyOptions{VerifiedBootState: androidkey.VerifiedBootStateSelfSigned, Unlocked: true},
+			policy: policy(func(p *androidkey.Policy) {
+				p.VerifiedBootStates = []asn1.Enumerated{androidkey.VerifiedBootStateVerified, androidkey.VerifiedBootStateSelfSigned}
+				p.RequireDeviceLocked = false
+			}),
+		},
+		{
+			name:    "old patch level",
+			opts:    androidkeytest.KeyOptions{OsPatchLevel: 202212},
+			policy:  policy(func(p *androidkey.Policy) { p.MinOsPatchLevel = 202301 }),
+			wantErr: androidkey.ErrPolicy,
+		},
+		{
+			name:   "current patch level",
+			opts:   androidkeytest.KeyOptions{OsPatchLevel: 202301},
+			policy: policy(func(p *androidkey.Policy) { p.MinOsPatchLevel = 202301 }),
+		},
+		{
+			name:    "no packages allowed",
+			opts:    androidkeytest.KeyOptions{},
+			policy:  policy(func(p *androidkey.Policy) { p.PackageNames = nil }),
+			wantErr: androidkey.ErrPackageNotAllowed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.Challenge = challenge
+
+			_, chain := authority.Issue(t, tt.opts)
+
+			_, err := androidkey.NewVerifier().
+				WithPolicy(tt.policy).
+				WithRoots(authority.Roots()).
+				Verify(context.Background(), chain, challenge)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package androidkey
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// certificate statuses of the attestation status list
+const (
+	StatusRevoked   = "REVOKED"
+	StatusSuspended = "SUSPENDED"
+)
+
+// StatusList is google's attestation certificate status list, published at
+// https://android.googleapis.com/attestation/status. It is read from a local copy so verification
+// does not depend on the network, keeping the copy fresh is up to the caller.
+type StatusList struct {
+	// Entries are keyed by the lowercase hex serial number of the revoked or suspended certificates
+	Entries map[string]StatusEntry `json:"entries"`
+}
+
+type StatusEntry struct {
+	Status  string `json:"status"`
+	Reason  string `json:"reason,omitempty"`
+	Expires string `json:"expires,omitempty"`
+	Comment string `json:"comment,omitempty"`
+}
+
+// LoadStatusList reads a status list from a JSON file
+func LoadStatusList(path string) (*StatusList, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidStatusList, err)
+	}
+
+	return ParseStatusList(data)
+}
+
+// ParseStatusList parses the JSON encoding of a status list
+func ParseStatusList(data []byte) (*StatusList, error) {
+	var list StatusList
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidStatusList, err)
+	}
+
+	if list.Entries == nil {
+		return nil, fmt.Errorf("%w: missing entries", ErrInvalidStatusList)
+	}
+
+	entries := make(map[string]StatusEntry, len(list.Entries))
+	for serial, entry := range list.Entries {
+		entries[strings.ToLower(strings.TrimLeft(serial, "0"))] = entry
+	}
+	list.Entries = entries
+
+	return &list, nil
+}
+
+// Check fails if any certificate of a chain is revoked or suspended
+func (me *StatusList) Check(certs []*x509.Certificate) error {
+	for _, cert := range certs {
+		serial := cert.SerialNumber.Text(16)
+		if entry, ok := me.Entries[serial]; ok {
+			return fmt.Errorf("%w: certificate %s is %s: %s", ErrRevoked, serial, strings.ToLower(entry.Status), entry.Reason)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,55 @@
+package androidkey_test
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/webauthn/pkg/androidkey"
+	"github.com/walteh/webauthn/pkg/androidkey/androidkeytest"
+)
+
+func TestStatusList(t *testing.T) {
+	authority := androidkeytest.NewAuthority(t)
+	challenge := []byte("server challenge")
+
+	_, chain := authority.Issue(t, androidkeytest.KeyOptions{Challenge: challenge})
+
+	intermediate, err := x509.ParseCertificate(chain[1])
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "status.json")
+	require.NoError(t, os.WriteFile(path, []byte(fmt.Sprintf(`{
+		"entries": {
+			"2c8cdddfd5e03bfc": {"status": "REVOKED", "expires": "2020-11-13", "reason": "KEY_COMPROMISE"},
+			"%016x": {"status": "SUSPENDED", "reason": "SOFTWARE_FLAW", "comment": "test"}
+		}
+	}`, intermediate.SerialNumber)), 0o600))
+
+	list, err := androidkey.LoadStatusList(path)
+	require.NoError(t, err)
+	assert.Len(t, list.Entries, 2)
+
+	verifier := func() *androidkey.Verifier {
+		return androidkey.NewVerifier(androidkeytest.PackageName).
+			WithSignatureDigests(androidkeytest.SignatureDigest).
+			WithRoots(authority.Roots())
+	}
+
+	_, err = verifier().Verify(context.Background(), chain, challenge)
+	require.NoError(t, err)
+
+	_, err = verifier().WithStatusList(list).Verify(context.Background(), chain, challenge)
+	assert.ErrorIs(t, err, androidkey.ErrRevoked)
+
+	_, err = androidkey.ParseStatusList([]byte(`{"foo": {}}`))
+	assert.ErrorIs(t, err, androidkey.ErrInvalidStatusList)
+
+	_, err = androidkey.LoadStatusList(filepath.Join(t.TempDir(), "missing.json"))
+	assert.ErrorIs(t, err, androidkey.ErrInvalidStatusList)
+}
@@ -0,0 +1,54 @@
+package androidkey
+
+import (
+	"crypto/x509"
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+//go:embed roots
+var bundledRoots embed.FS
+
+// GoogleRoots returns a pool of the google attestation roots bundled in the roots directory,
+// the hardware attestation root and the remote key provisioning root
+func GoogleRoots() (*x509.CertPool, error) {
+	files, err := fs.Glob(bundledRoots, "roots/*.pem")
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	for _, name := range files {
+		data, err := bundledRoots.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("%w: no certificate in %s", ErrNoRoots, name)
+		}
+	}
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("%w: no google roots are bundled, see roots/README.md", ErrNoRoots)
+	}
+
+	return pool, nil
+}
+
+// LoadRoots reads a pool of PEM encoded roots from a file
+func LoadRoots(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("%w: no certificate in %s", ErrNoRoots, path)
+	}
+
+	return pool, nil
+}
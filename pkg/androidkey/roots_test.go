@@ -0,0 +1,103 @@
+package androidkey_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/webauthn/pkg/androidkey"
+)
+
+// hardwareRootKey is the sha256 of the public key of google's RSA hardware attestation root
+const hardwareRootKey = "feb2ea7551ee316ed4bb443c8293b884dbfdea40b603ee3e4f4a897e4580fbae"
+
+func readPEM(t *testing.T, path string) []*x509.Certificate {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return certs
+		}
+		c, err := x509.ParseCertificate(block.Bytes)
+		require.NoError(t, err)
+		certs = append(certs, c)
+	}
+}
+
+func TestGoogleRoots(t *testing.T) {
+	roots, err := androidkey.GoogleRoots()
+	require.NoError(t, err)
+
+	hardware := readPEM(t, filepath.Join("roots", "google-hardware-attestation-root.pem"))
+	require.Len(t, hardware, 2)
+	for _, c := range hardware {
+		sum := sha256.Sum256(c.RawSubjectPublicKeyInfo)
+		assert.Equal(t, hardwareRootKey, hex.EncodeToString(sum[:]))
+		assert.Equal(t, "f92009e853b6b045", c.Subject.SerialNumber)
+	}
+
+	rkp := readPEM(t, filepath.Join("roots", "google-rkp-root.pem"))
+	require.Len(t, rkp, 1)
+	key, ok := rkp[0].PublicKey.(*ecdsa.PublicKey)
+	require.True(t, ok)
+	assert.Equal(t, elliptic.P384(), key.Curve)
+	assert.Equal(t, "Key Attestation CA1", rkp[0].Subject.CommonName)
+
+	// every bundled root anchors chains while it is valid
+	for _, c := range append(hardware, rkp...) {
+		require.NoError(t, c.CheckSignatureFrom(c), c.Subject)
+		_, err := androidkey.VerifyChain([][]byte{c.Raw}, roots, c.NotBefore.Add(time.Hour))
+		assert.NoError(t, err, c.Subject)
+	}
+
+	// the hardware root stays usable after its first certificate expired
+	_, err = androidkey.VerifyChain([][]byte{hardware[0].Raw}, roots, time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC))
+	assert.NoError(t, err)
+}
+
+// TestGoogleRootsRecordedChains verifies the KeyStore chains recorded from real devices in
+// testdata/chains, one PEM file per chain with the leaf first, at the time their leaf was issued
+func TestGoogleRootsRecordedChains(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "chains", "*.pem"))
+	require.NoError(t, err)
+	if len(files) == 0 {
+		t.Skip("no chains are recorded in testdata/chains")
+	}
+
+	roots, err := androidkey.GoogleRoots()
+	require.NoError(t, err)
+
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			certs := readPEM(t, file)
+			require.NotEmpty(t, certs)
+
+			chain := make([][]byte, len(certs))
+			for i, c := range certs {
+				chain[i] = c.Raw
+			}
+
+			_, err := androidkey.VerifyChain(chain, roots, certs[0].NotBefore.Add(time.Minute))
+			require.NoError(t, err)
+
+			kd, err := androidkey.ParseKeyDescription(certs[0])
+			require.NoError(t, err)
+			assert.NotEmpty(t, kd.AttestationChallenge)
+		})
+	}
+}
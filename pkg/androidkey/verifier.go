@@ -0,0 +1,251 @@
+package androidkey
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/subtle"
+	"crypto/x509"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// AttestationType is recorded on the credentials of KeyStore keys attested by an app
+const AttestationType = "android-keystore"
+
+// key origins and purposes, https://source.android.com/docs/security/features/keystore/tags
+const (
+	originGenerated = 0
+	purposeSign     = 2
+)
+
+// Attestation is a verified KeyStore key
+type Attestation struct {
+	// Certificate is the leaf of the chain, holding the attested key
+	Certificate *x509.Certificate
+	PublicKey   crypto.PublicKey
+
+	KeyDescription *KeyDescription
+	ApplicationID  *AttestationApplicationID
+
+	// PackageName is the allowed package the key was generated by
+	PackageName string
+}
+
+// Verifier checks KeyStore attestation chains of keys generated by an android app,
+// as described in https://developer.android.com/privacy-and-security/security-key-attestation
+type Verifier struct {
+	roots      *x509.CertPool
+	policy     Policy
+	statusList *StatusList
+	time       *time.Time
+}
+
+// NewVerifier returns a verifier accepting keys of the given package names under the DefaultPolicy.
+// The bundled google roots are trusted, when none are bundled no chain is accepted until roots are set
+// with WithRoots.
+func NewVerifier(packageNames ...string) *Verifier {
+	roots, err := GoogleRoots()
+	if err != nil {
+		roots = x509.NewCertPool()
+	}
+
+	return &Verifier{
+		roots:  roots,
+		policy: DefaultPolicy(packageNames...),
+	}
+}
+
+// WithRoots sets the roots the chain must end in
+func (me *Verifier) WithRoots(roots *x509.CertPool) *Verifier {
+	me.roots = roots
+	return me
+}
+
+// WithPolicy replaces the policy, including the allowed package names and signature digests
+func (me *Verifier) WithPolicy(policy Policy) *Verifier {
+	me.policy = policy
+	return me
+}
+
+// WithSignatureDigests sets the SHA-256 digests of the certificates the app may be signed with,
+// every signer reported in the attestation application id must be one of them
+func (me *Verifier) WithSignatureDigests(digests ...[]byte) *Verifier {
+	me.policy.SignatureDigests = digests
+	return me
+}
+
+// WithStatusList rejects chains holding a certificate of the status list
+func (me *Verifier) WithStatusList(list *StatusList) *Verifier {
+	me.statusList = list
+	return me
+}
+
+// WithTime pins the time the chain is checked at
+func (me *Verifier) WithTime(t time.Time) *Verifier {
+	me.time = &t
+	return me
+}
+
+func (me *Verifier) now() time.Time {
+	if me.time != nil {
+		return *me.time
+	}
+	return time.Now()
+}
+
+// Verify checks a DER encoded chain, leaf first, and the key description of its leaf
+func (me *Verifier) Verify(ctx context.Context, chain [][]byte, challenge []byte) (*Attestation, error) {
+	certs, err := VerifyChain(chain, me.roots, me.now())
+	if err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Int("length", len(chain)).Msg("failed to verify key attestation chain")
+		return nil, err
+	}
+
+	if me.statusList != nil {
+		if err := me.statusList.Check(certs); err != nil {
+			zerolog.Ctx(ctx).Error().Err(err).Send()
+			return nil, err
+		}
+	}
+
+	leaf := certs[0]
+
+	kd, err := ParseKeyDescription(leaf)
+	if err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Msg("failed to parse key description")
+		return nil, err
+	}
+
+	if subtle.ConstantTimeCompare(kd.AttestationChallenge, challenge) != 1 {
+		err := fmt.Errorf("%w: attestation challenge does not match", ErrChallengeMismatch)
+		zerolog.Ctx(ctx).Error().Err(err).Send()
+		return nil, err
+	}
+
+	if err := verifyAuthorizations(kd); err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Send()
+		return nil, err
+	}
+
+	if err := me.policy.Check(kd); err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Send()
+		return nil, err
+	}
+
+	if len(me.policy.PackageNames) == 0 {
+		err := fmt.Errorf("%w: no packages are allowed", ErrPackageNotAllowed)
+		zerolog.Ctx(ctx).Error().Err(err).Send()
+		return nil, err
+	}
+
+	appID, err := kd.ApplicationID()
+	if err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Send()
+		return nil, err
+	}
+
+	packageName, err := me.policy.CheckApplicationID(appID)
+	if err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Strs("packages", appID.PackageNames()).Send()
+		return nil, err
+	}
+
+	return &Attestation{
+		Certificate:    leaf,
+		PublicKey:      leaf.PublicKey,
+		KeyDescription: kd,
+		ApplicationID:  appID,
+		PackageName:    packageName,
+	}, nil
+}
+
+// VerifyChain parses a DER encoded chain, leaf first, and checks it ends in one of the roots
+func VerifyChain(chain [][]byte, roots *x509.CertPool, at time.Time) ([]*x509.Certificate, error) {
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("%w: empty chain", ErrInvalidChain)
+	}
+
+	certs := make([]*x509.Certificate, 0, len(chain))
+	for _, der := range chain {
+		c, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidChain, err)
+		}
+		certs = append(certs, c)
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, c := range certs[1:] {
+		intermediates.AddCert(c)
+	}
+
+	if _, err := certs[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   at,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidChain, err)
+	}
+
+	return certs, nil
+}
+
+// verifyAuthorizations checks the key was generated in keystore for signing and is bound to the app
+func verifyAuthorizations(kd *KeyDescription) error {
+	if len(kd.SoftwareEnforced.AllApplications.FullBytes) > 0 || len(kd.TeeEnforced.AllApplications.FullBytes) > 0 {
+		return fmt.Errorf("%w: key is usable by all applications", ErrInvalidKeyDescription)
+	}
+
+	// the origin must be enforced by the keymaster that holds the key, a software keymaster reports every
+	// tag in the software enforced list
+	enforced := kd.TeeEnforced
+	if kd.KeymasterSecurityLevel == SecurityLevelSoftware {
+		enforced = kd.SoftwareEnforced
+	}
+
+	origin, ok := enforced.OriginValue()
+	if !ok {
+		return fmt.Errorf("%w: key origin is not enforced", ErrInvalidKeyDescription)
+	}
+
+	if other, ok := kd.SoftwareEnforced.OriginValue(); origin != originGenerated || (ok && other != originGenerated) {
+		return fmt.Errorf("%w: key was not generated in keystore", ErrInvalidKeyDescription)
+	}
+
+	if !containsInt(kd.SoftwareEnforced.Purpose, purposeSign) && !containsInt(kd.TeeEnforced.Purpose, purposeSign) {
+		return fmt.Errorf("%w: key purpose is not sign", ErrInvalidKeyDescription)
+	}
+
+	return nil
+}
+
+func containsInt(list []int, v int) bool {
+	for _, i := range list {
+		if i == v {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+func containsDigest(list [][]byte, v []byte) bool {
+	for _, d := range list {
+		if bytes.Equal(d, v) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,156 @@
+package androidkey_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/webauthn/pkg/androidkey"
+	"github.com/walteh/webauthn/pkg/androidkey/androidkeytest"
+)
+
+func TestVerifier(t *testing.T) {
+	authority := androidkeytest.NewAuthority(t)
+	challenge := []byte("server challenge")
+
+	tests := []struct {
+		name    string
+		opts    androidkeytest.KeyOptions
+		roots   bool
+		chain   func([][]byte) [][]byte
+		wantErr error
+	}{
+		{
+			name:  "valid",
+			opts:  androidkeytest.KeyOptions{Challenge: challenge},
+			roots: true,
+		},
+		{
+			name:    "untrusted root",
+			opts:    androidkeytest.KeyOptions{Challenge: challenge},
+			wantErr: androidkey.ErrInvalidChain,
+		},
+		{
+			name:    "leaf only",
+			opts:    androidkeytest.KeyOptions{Challenge: challenge},
+			roots:   true,
+			chain:   func(c [][]byte) [][]byte { return c[:1] },
+			wantErr: androidkey.ErrInvalidChain,
+		},
+		{
+			name:    "other challenge",
+			opts:    androidkeytest.KeyOptions{Challenge: []byte("old challenge")},
+			roots:   true,
+			wantErr: androidkey.ErrChallengeMismatch,
+		},
+		{
+			name:    "other package",
+			opts:    androidkeytest.KeyOptions{Challenge: challenge, PackageNames: []string{"com.example.other"}},
+			roots:   true,
+			wantErr: androidkey.ErrPackageNotAllowed,
+		},
+		{
+			name:    "shared uid with other package",
+			opts:    androidkeytest.KeyOptions{Challenge: challenge, PackageNames: []string{androidkeytest.PackageName, "com.example.other"}},
+			roots:   true,
+			wantErr: androidkey.ErrPackageNotAllowed,
+		},
+		{
+			name:    "other signer",
+			opts:    androidkeytest.KeyOptions{Challenge: challenge, SignatureDigests: [][]byte{make([]byte, 32)}},
+			roots:   true,
+			wantErr: androidkey.ErrSignatureNotAllowed,
+		},
+		{
+			name:    "all applications",
+			opts:    androidkeytest.KeyOptions{Challenge: challenge, AllApplications: true},
+			roots:   true,
+			wantErr: androidkey.ErrInvalidKeyDescription,
+		},
+		{
+			name:    "missing origin",
+			opts:    androidkeytest.KeyOptions{Challenge: challenge, MissingOrigin: true},
+			roots:   true,
+			wantErr: androidkey.ErrInvalidKeyDescription,
+		},
+		{
+			name:    "imported key",
+			opts:    androidkeytest.KeyOptions{Challenge: challenge, ImportedOrigin: true},
+			roots:   true,
+			wantErr: androidkey.ErrInvalidKeyDescription,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, chain := authority.Issue(t, tt.opts)
+			if tt.chain != nil {
+				chain = tt.chain(chain)
+			}
+
+			verifier := androidkey.NewVerifier(androidkeytest.PackageName).WithSignatureDigests(androidkeytest.SignatureDigest)
+			if tt.roots {
+				verifier = verifier.WithRoots(authority.Roots())
+			}
+
+			att, err := verifier.Verify(context.Background(), chain, challenge)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+
+			assert.Equal(t, androidkeytest.PackageName, att.PackageName)
+			assert.True(t, key.PublicKey.Equal(att.PublicKey))
+		})
+	}
+}
+
+func TestVerifierTime(t *testing.T) {
+	authority := androidkeytest.NewAuthority(t)
+
+	_, chain := authority.Issue(t, androidkeytest.KeyOptions{Challenge: []byte("abc")})
+
+	_, err := androidkey.NewVerifier(androidkeytest.PackageName).
+		WithSignatureDigests(androidkeytest.SignatureDigest).
+		WithRoots(authority.Roots()).
+		WithTime(time.Now().Add(-24*time.Hour)).
+		Verify(context.Background(), chain, []byte("abc"))
+
+	assert.ErrorIs(t, err, androidkey.ErrInvalidChain)
+}
+
+func TestAssertion(t *testing.T) {
+	authority := androidkeytest.NewAuthority(t)
+
+	key, chain := authority.Issue(t, androidkeytest.KeyOptions{Challenge: []byte("abc")})
+
+	att, err := androidkey.NewVerifier(androidkeytest.PackageName).
+		WithSignatureDigests(androidkeytest.SignatureDigest).
+		WithRoots(authority.Roots()).
+		Verify(context.Background(), chain, []byte("abc"))
+	require.NoError(t, err)
+
+	publicKey := att.Certificate.RawSubjectPublicKeyInfo
+
+	sum := sha256.Sum256(publicKey)
+	assert.Equal(t, sum[:], androidkey.CredentialID(att.Certificate))
+
+	signed := androidkey.SignedData(7, []byte("nonce"), []byte(`{"amount":100}`))
+	digest := sha256.Sum256(signed)
+	sig, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	require.NoError(t, err)
+
+	require.NoError(t, androidkey.VerifySignature(publicKey, signed, sig))
+	require.NoError(t, androidkey.VerifyCounter(6, 7))
+
+	assert.ErrorIs(t, androidkey.VerifySignature(publicKey, androidkey.SignedData(8, []byte("nonce"), []byte(`{"amount":100}`)), sig), androidkey.ErrInvalidSignature)
+	assert.ErrorIs(t, androidkey.VerifySignature([]byte{0x30}, signed, sig), androidkey.ErrInvalidKey)
+	assert.ErrorIs(t, androidkey.VerifyCounter(7, 7), androidkey.ErrInvalidCounter)
+}
@@ -0,0 +1,266 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/walteh/webauthn/app/devicecheck_assert"
+	"github.com/walteh/webauthn/pkg/errd"
+	whex "github.com/walteh/webauthn/pkg/hex"
+	"github.com/walteh/webauthn/pkg/ratelimit"
+	"github.com/walteh/webauthn/pkg/relyingparty"
+	"github.com/walteh/webauthn/pkg/storage"
+	"github.com/walteh/webauthn/pkg/webauthn/assertion"
+	"github.com/walteh/webauthn/pkg/webauthn/clientdata"
+	"github.com/walteh/webauthn/pkg/webauthn/types"
+	"github.com/walteh/webauthn/pkg/webauthnerr"
+)
+
+const (
+	// AssertionHeader carries the standard base64 encoded assertion json understood by
+	// assertion.ParseFidoAssertionInput, the device signs RequestBinding of the request followed by the nonce
+	AssertionHeader = "X-Nugg-DeviceCheck-Request-Assertion"
+
+	// CredentialHeader carries the standard base64 encoded credential id a nonce is requested for
+	CredentialHeader = "X-Nugg-DeviceCheck-Credential"
+)
+
+const (
+	DefaultNonceTTL    = 60 * time.Second
+	DefaultMaxBodySize = 1 << 20
+)
+
+var (
+	ErrMiddlewareMissingHeader = errors.New("ErrMiddlewareMissingHeader")
+	ErrMiddlewareInvalidHeader = errors.New("ErrMiddlewareInvalidHeader")
+	ErrMiddlewareBodyTooLarge  = errors.New("ErrMiddlewareBodyTooLarge")
+	ErrMiddlewareInvalidNonce  = errors.New("ErrMiddlewareInvalidNonce")
+	ErrMiddlewareExpiredNonce  = errors.New("ErrMiddlewareExpiredNonce")
+)
+
+// Device is the app attest key a request was verified with
+type Device struct {
+	CredentialID whex.Hash
+
+	// AppID is the "TEAMID.bundle.id" app id the key was attested for
+	AppID string
+}
+
+type deviceKey struct{}
+
+// DeviceFromContext returns the device of a request that passed the middleware
+func DeviceFromContext(ctx context.Context) (Device, bool) {
+	d, ok := ctx.Value(deviceKey{}).(Device)
+	return d, ok
+}
+
+func WithDevice(ctx context.Context, d Device) context.Context {
+	return context.WithValue(ctx, deviceKey{}, d)
+}
+
+// RequestBinding is the data a device signs for a request, followed by the nonce it was issued:
+//
+//	METHOD "\n" REQUEST-URI "\n" lowercase hex SHA-256 of the body
+//
+// The request uri is the escaped path and query as the server sees it.
+func RequestBinding(method string, requestURI string, body []byte) []byte {
+	sum := sha256.Sum256(body)
+	return []byte(method + "\n" + requestURI + "\n" + hex.EncodeToString(sum[:]))
+}
+
+// Middleware protects http handlers with app attest assertions, every request is signed by the device's
+// attested key over the request and a single use nonce issued by NonceHandler
+type Middleware struct {
+	storage      storage.Provider
+	relyingParty relyingparty.Provider
+	appIDs       []string
+	nonceTTL     time.Duration
+	maxBodySize  int64
+	time         *time.Time
+}
+
+func New(stg storage.Provider, rp relyingparty.Provider) *Middleware {
+	return &Middleware{
+		storage:      stg,
+		relyingParty: rp,
+		nonceTTL:     DefaultNonceTTL,
+		maxBodySize:  DefaultMaxBodySize,
+	}
+}
+
+// WithAppIDs sets the "TEAMID.bundle.id" app ids whose keys are accepted, instead of only the relying party id
+func (me *Middleware) WithAppIDs(appIDs ...string) *Middleware {
+	me.appIDs = appIDs
+	return me
+}
+
+// WithNonceTTL sets how long an issued nonce can be used for
+func (me *Middleware) WithNonceTTL(ttl time.Duration) *Middleware {
+	me.nonceTTL = ttl
+	return me
+}
+
+// WithMaxBodySize sets the largest request body that is read and hashed, larger requests are rejected
+func (me *Middleware) WithMaxBodySize(n int64) *Middleware {
+	me.maxBodySize = n
+	return me
+}
+
+func (me *Middleware) WithTime(t time.Time) *Middleware {
+	me.time = &t
+	return me
+}
+
+func (me *Middleware) now() time.Time {
+	if me.time != nil {
+		return *me.time
+	}
+	return time.Now()
+}
+
+type nonceResponse struct {
+	Nonce string `json:"nonce"`
+}
+
+// NonceHandler issues a nonce for the credential in the CredentialHeader, the nonce is returned
+// raw url base64 encoded as the client data challenge expects it
+func (me *Middleware) NonceHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		credentialID, err := decodeHeader(ctx, r, CredentialHeader)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if err := ratelimit.Ctx(ctx).Allow(ctx, ratelimit.Keys(ctx, ratelimit.Credential(credentialID.Hex()))...); err != nil {
+			w.WriteHeader(webauthnerr.HTTPStatus(errd.Wrap(ctx, err)))
+			return
+		}
+
+		// the nonce is stored where devicecheck_assert looks for it, the storage of the request's tenant
+		tenant, err := relyingparty.Resolve(ctx, me.relyingParty, nil)
+		if err != nil {
+			w.WriteHeader(webauthnerr.HTTPStatus(errd.Wrap(ctx, err)))
+			return
+		}
+
+		now := me.now()
+
+		cerem := types.NewCeremony(credentialID, whex.Hash{}, types.AssertCeremony)
+		cerem.CreatedAt = uint64(now.Unix())
+		cerem.Ttl = uint64(now.Add(me.nonceTTL).Unix())
+
+		if err := tenant.Storage(me.storage).WriteNewCeremony(ctx, cerem); err != nil {
+			_ = errd.Wrap(ctx, err)
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		_ = json.NewEncoder(w).Encode(nonceResponse{Nonce: cerem.ChallengeID.RawURLBase64()})
+	})
+}
+
+// Handler verifies the assertion of every request before passing it on with the device on its context.
+// The nonce is consumed and the key's counter updated by the storage provider, so each assertion is accepted once.
+func (me *Middleware) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		device, status := me.verify(ctx, r)
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(WithDevice(ctx, device)))
+	})
+}
+
+func (me *Middleware) verify(ctx context.Context, r *http.Request) (Device, int) {
+	raw, err := decodeHeader(ctx, r, AssertionHeader)
+	if err != nil {
+		return Device{}, http.StatusBadRequest
+	}
+
+	parsed, err := assertion.ParseFidoAssertionInput(ctx, raw)
+	if err != nil {
+		return Device{}, http.StatusBadRequest
+	}
+
+	cd, err := clientdata.ParseClientData(parsed.RawClientDataJSON)
+	if err != nil {
+		return Device{}, http.StatusBadRequest
+	}
+
+	tenant, err := relyingparty.Resolve(ctx, me.relyingParty, nil)
+	if err != nil {
+		return Device{}, webauthnerr.HTTPStatus(errd.Wrap(ctx, err))
+	}
+
+	// the ceremony lives on in storage until its ttl is enforced, so the nonce lifetime is checked here
+	cerem, err := tenant.Storage(me.storage).GetExistingCeremony(ctx, cd.Challenge.String())
+	if err != nil {
+		_ = errd.Wrap(ctx, err)
+		return Device{}, http.StatusBadGateway
+	}
+
+	if cerem == nil || cerem.CeremonyType != types.AssertCeremony {
+		_ = errd.Wrap(ctx, ErrMiddlewareInvalidNonce, cd.Challenge.String())
+		return Device{}, http.StatusUnauthorized
+	}
+
+	if uint64(me.now().Unix()) > cerem.Ttl {
+		_ = errd.Wrap(ctx, ErrMiddlewareExpiredNonce, cd.Challenge.String())
+		return Device{}, http.StatusUnauthorized
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, me.maxBodySize+1))
+	if err != nil {
+		_ = errd.Wrap(ctx, err)
+		return Device{}, http.StatusBadRequest
+	}
+
+	if int64(len(body)) > me.maxBodySize {
+		_ = errd.Wrap(ctx, ErrMiddlewareBodyTooLarge, r.URL.RequestURI())
+		return Device{}, http.StatusRequestEntityTooLarge
+	}
+
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	out, err := devicecheck_assert.Assert(ctx, me.storage, me.relyingParty, devicecheck_assert.DeviceCheckAssertionInput{
+		RawAssertionObject:   raw,
+		ClientDataToValidate: RequestBinding(r.Method, r.URL.RequestURI(), body),
+		AppIDs:               me.appIDs,
+	})
+	if err != nil || !out.OK {
+		return Device{}, out.SuggestedStatusCode
+	}
+
+	return Device{CredentialID: parsed.CredentialID, AppID: out.AppID}, http.StatusOK
+}
+
+func decodeHeader(ctx context.Context, r *http.Request, name string) (whex.Hash, error) {
+	raw := r.Header.Get(name)
+	if raw == "" {
+		return nil, errd.Wrap(ctx, ErrMiddlewareMissingHeader, name)
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, errd.Wrap(ctx, ErrMiddlewareInvalidHeader, name, err.Error())
+	}
+
+	return decoded, nil
+}
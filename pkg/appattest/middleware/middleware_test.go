@@ -0,0 +1,368 @@
+package middleware_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/webauthn/gen/mockery"
+	"github.com/walteh/webauthn/pkg/appattest/middleware"
+	"github.com/walteh/webauthn/pkg/hex"
+	"github.com/walteh/webauthn/pkg/ratelimit"
+	"github.com/walteh/webauthn/pkg/relyingparty"
+	"github.com/walteh/webauthn/pkg/webauthn/assertion"
+	"github.com/walteh/webauthn/pkg/webauthn/types"
+	"github.com/walteh/webauthn/pkg/webauthn/webauthncbor"
+)
+
+const (
+	testAppID  = "4497QJSAD3.xyz.nugg.app"
+	testOrigin = "https://nugg.xyz"
+)
+
+var testNow = time.Unix(1700000000, 0)
+
+type testDevice struct {
+	key        *ecdsa.PrivateKey
+	credential *types.Credential
+}
+
+func newTestDevice(t *testing.T, signCount uint64) *testDevice {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	aaguid := make([]byte, 16)
+	copy(aaguid, "appattestdevelop")
+
+	return &testDevice{
+		key: key,
+		credential: &types.Credential{
+			RawID:           hex.HexToHash("0xfb1fd0ac98dca2891761baf97a486c75726900d3a94105afa598575f89c47295"),
+			Type:            "public-key",
+			AAGUID:          aaguid,
+			PublicKey:       elliptic.Marshal(elliptic.P256(), key.X, key.Y),
+			AttestationType: "apple-appattest",
+			Environment:     "appattestdevelop",
+			AppID:           testAppID,
+			SignCount:       signCount,
+		},
+	}
+}
+
+// sign builds the assertion header an app makes for a request with the given nonce
+func (me *testDevice) sign(t *testing.T, nonce hex.Hash, counter uint32, method, uri string, body []byte) string {
+	rpIDHash := sha256.Sum256([]byte(testAppID))
+
+	authData := append([]byte{}, rpIDHash[:]...)
+	authData = append(authData, 0x00)
+	authData = binary.BigEndian.AppendUint32(authData, counter)
+
+	clientData := append(middleware.RequestBinding(method, uri, body), nonce...)
+	clientDataHash := sha256.Sum256(clientData)
+
+	signed := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	digest := sha256.Sum256(signed[:])
+
+	sig, err := ecdsa.SignASN1(rand.Reader, me.key, digest[:])
+	require.NoError(t, err)
+
+	obj, err := webauthncbor.Marshal(map[string][]byte{
+		"authenticatorData": authData,
+		"signature":         sig,
+	})
+	require.NoError(t, err)
+
+	clientDataJSON, err := json.Marshal(map[string]string{
+		"type":      string(types.AssertCeremony),
+		"challenge": nonce.RawURLBase64(),
+		"origin":    testOrigin,
+	})
+	require.NoError(t, err)
+
+	hdr, err := json.Marshal(assertion.AssertionResponse{
+		UTF8ClientDataJSON: string(clientDataJSON),
+		AssertionObject:    obj,
+		Provider:           "apple-appattest",
+		CredentialID:       me.credential.RawID,
+	})
+	require.NoError(t, err)
+
+	return base64.StdEncoding.EncodeToString(hdr)
+}
+
+func TestMiddleware(t *testing.T) {
+	nonce := hex.HexToHash("0x8a3e8bcbd1c5d1f1d7d3c4e8a7b2a9f6e5d4c3b2a1908f7e6d5c4b3a29181706")
+
+	freshCeremony := func() *types.Ceremony {
+		return &types.Ceremony{
+			ChallengeID:  nonce,
+			CredentialID: hex.HexToHash("0xfb1fd0ac98dca2891761baf97a486c75726900d3a94105afa598575f89c47295"),
+			CeremonyType: types.AssertCeremony,
+			CreatedAt:    uint64(testNow.Unix()),
+			Ttl:          uint64(testNow.Add(time.Minute).Unix()),
+		}
+	}
+
+	tests := []struct {
+		name       string
+		signMethod string
+		signURI    string
+		signBody   string
+		counter    uint32
+		stored     uint64
+		ceremony   func() *types.Ceremony
+		noHeader   bool
+		wantStatus int
+	}{
+		{
+			name:       "signed request",
+			counter:    2,
+			stored:     1,
+			ceremony:   freshCeremony,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "missing assertion",
+			noHeader:   true,
+			ceremony:   freshCeremony,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "body changed",
+			signBody:   `{"amount":1}`,
+			counter:    2,
+			stored:     1,
+			ceremony:   freshCeremony,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "method changed",
+			signMethod: http.MethodGet,
+			counter:    2,
+			stored:     1,
+			ceremony:   freshCeremony,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "path changed",
+			signURI:    "/api/other",
+			counter:    2,
+			stored:     1,
+			ceremony:   freshCeremony,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "counter replayed",
+			counter:    1,
+			stored:     1,
+			ceremony:   freshCeremony,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:    "nonce expired",
+			counter: 2,
+			stored:  1,
+			ceremony: func() *types.Ceremony {
+				c := freshCeremony()
+				c.Ttl = uint64(testNow.Add(-time.Second).Unix())
+				return c
+			},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:    "registration challenge",
+			counter: 2,
+			stored:  1,
+			ceremony: func() *types.Ceremony {
+				c := freshCeremony()
+				c.CeremonyType = types.CreateCeremony
+				return c
+			},
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := zerolog.New(zerolog.NewConsoleWriter()).With().Caller().Logger().WithContext(context.Background())
+
+			method, uri, body := http.MethodPost, "/api/transfer?to=abc", `{"amount":100}`
+
+			device := newTestDevice(t, tt.stored)
+			cerem := tt.ceremony()
+
+			stgp := mockery.NewMockProvider_storage(t)
+			rpp := mockery.NewMockProvider_relyingparty(t)
+
+			rpp.EXPECT().RPID().Return(testAppID).Maybe()
+			rpp.EXPECT().RPOrigin().Return(testOrigin).Maybe()
+			stgp.EXPECT().GetExistingCeremony(mock.Anything, nonce.String()).Return(cerem, nil).Maybe()
+			stgp.EXPECT().GetExisting(mock.Anything, nonce.String(), device.credential.RawID.String()).Return(cerem, device.credential, nil).Maybe()
+
+			if tt.wantStatus == http.StatusOK {
+				stgp.EXPECT().IncrementExistingCredential(mock.Anything, cerem, device.credential.RawID.String()).Return(nil)
+			}
+
+			var got middleware.Device
+			var gotBody string
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var ok bool
+				got, ok = middleware.DeviceFromContext(r.Context())
+				require.True(t, ok)
+				b, _ := io.ReadAll(r.Body)
+				gotBody = string(b)
+			})
+
+			mw := middleware.New(stgp, rpp).WithAppIDs(testAppID).WithTime(testNow)
+
+			req := httptest.NewRequest(method, uri, strings.NewReader(body)).WithContext(ctx)
+			if !tt.noHeader {
+				signMethod, signURI, signBody := method, uri, body
+				if tt.signMethod != "" {
+					signMethod = tt.signMethod
+				}
+				if tt.signURI != "" {
+					signURI = tt.signURI
+				}
+				if tt.signBody != "" {
+					signBody = tt.signBody
+				}
+				req.Header.Set(middleware.AssertionHeader, device.sign(t, nonce, tt.counter, signMethod, signURI, []byte(signBody)))
+			}
+
+			rec := httptest.NewRecorder()
+			mw.Handler(next).ServeHTTP(rec, req)
+
+			require.Equal(t, tt.wantStatus, rec.Code)
+
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			require.Equal(t, device.credential.RawID, got.CredentialID)
+			require.Equal(t, testAppID, got.AppID)
+			require.Equal(t, body, gotBody)
+		})
+	}
+}
+
+func TestNonceHandler(t *testing.T) {
+	ctx := zerolog.New(zerolog.NewConsoleWriter()).With().Caller().Logger().WithContext(context.Background())
+
+	credentialID := hex.HexToHash("0xfb1fd0ac98dca2891761baf97a486c75726900d3a94105afa598575f89c47295")
+
+	stgp := mockery.NewMockProvider_storage(t)
+	rpp := mockery.NewMockProvider_relyingparty(t)
+
+	var written *types.Ceremony
+	stgp.EXPECT().WriteNewCeremony(mock.Anything, mock.Anything).RunAndReturn(func(_ context.Context, c *types.Ceremony) error {
+		written = c
+		return nil
+	})
+
+	mw := middleware.New(stgp, rpp).WithNonceTTL(30 * time.Second).WithTime(testNow)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/nonce", nil).WithContext(ctx)
+	req.Header.Set(middleware.CredentialHeader, base64.StdEncoding.EncodeToString(credentialID))
+
+	rec := httptest.NewRecorder()
+	mw.NonceHandler().ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var res struct {
+		Nonce string `json:"nonce"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+
+	require.NotNil(t, written)
+	require.Equal(t, written.ChallengeID.RawURLBase64(), res.Nonce)
+	require.Equal(t, credentialID, written.CredentialID)
+	require.Equal(t, types.AssertCeremony, written.CeremonyType)
+	require.Equal(t, uint64(testNow.Add(30*time.Second).Unix()), written.Ttl)
+}
+
+func TestNonceHandlerRateLimit(t *testing.T) {
+	ctx := zerolog.New(zerolog.NewConsoleWriter()).With().Caller().Logger().WithContext(context.Background())
+
+	limiter := ratelimit.NewLimiter(ratelimit.NewMemory()).WithRate(ratelimit.ScopeIP, ratelimit.Rate{Burst: 1, Every: time.Hour})
+	ctx = ratelimit.WithLimiter(ctx, limiter)
+	ctx = ratelimit.WithClient(ctx, ratelimit.Client{IP: "203.0.113.7"})
+
+	stgp := mockery.NewMockProvider_storage(t)
+	rpp := mockery.NewMockProvider_relyingparty(t)
+
+	stgp.EXPECT().WriteNewCeremony(mock.Anything, mock.Anything).Return(nil).Once()
+
+	mw := middleware.New(stgp, rpp).WithTime(testNow)
+
+	for _, want := range []int{http.StatusOK, http.StatusTooManyRequests} {
+		req := httptest.NewRequest(http.MethodPost, "/api/nonce", nil).WithContext(ctx)
+		req.Header.Set(middleware.CredentialHeader, base64.StdEncoding.EncodeToString([]byte("credential")))
+
+		rec := httptest.NewRecorder()
+		mw.NonceHandler().ServeHTTP(rec, req)
+
+		require.Equal(t, want, rec.Code)
+	}
+}
+
+func TestNonceHandlerTenantStorage(t *testing.T) {
+	ctx := zerolog.New(zerolog.NewConsoleWriter()).With().Caller().Logger().WithContext(context.Background())
+
+	def := mockery.NewMockProvider_storage(t)
+	tenantStorage := mockery.NewMockProvider_storage(t)
+	rpp := mockery.NewMockProvider_relyingparty(t)
+
+	reg, err := relyingparty.NewRegistry(nil,
+		relyingparty.NewTenant("acme", relyingparty.NewSimpleRelyingParty("Acme", "acme.com", testOrigin)).
+			WithStorage(tenantStorage),
+	)
+	require.NoError(t, err)
+
+	ctx = relyingparty.WithResolver(ctx, reg)
+	ctx = relyingparty.WithHint(ctx, relyingparty.Hint{TenantID: "acme"})
+
+	var written *types.Ceremony
+	tenantStorage.EXPECT().WriteNewCeremony(mock.Anything, mock.Anything).RunAndReturn(func(_ context.Context, c *types.Ceremony) error {
+		written = c
+		return nil
+	})
+	tenantStorage.EXPECT().GetExistingCeremony(mock.Anything, mock.Anything).RunAndReturn(func(_ context.Context, id string) (*types.Ceremony, error) {
+		require.Equal(t, written.ChallengeID.String(), id)
+		return nil, nil
+	})
+
+	mw := middleware.New(def, rpp).WithTime(testNow)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/nonce", nil).WithContext(ctx)
+	req.Header.Set(middleware.CredentialHeader, base64.StdEncoding.EncodeToString([]byte("credential")))
+
+	rec := httptest.NewRecorder()
+	mw.NonceHandler().ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NotNil(t, written)
+
+	// the nonce is looked up in the tenant storage it was written to, the default storage is never used
+	device := newTestDevice(t, 0)
+	body := []byte(`{}`)
+	req = httptest.NewRequest(http.MethodPost, "/api/thing", strings.NewReader(string(body))).WithContext(ctx)
+	req.Header.Set(middleware.AssertionHeader, device.sign(t, written.ChallengeID, 1, http.MethodPost, "/api/thing", body))
+
+	rec = httptest.NewRecorder()
+	mw.Handler(http.NotFoundHandler()).ServeHTTP(rec, req)
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+}
@@ -0,0 +1,165 @@
+package receipt
+
+import (
+	"fmt"
+)
+
+// apple encodes receipts in BER with indefinite lengths and chunked octet strings, encoding/asn1 only reads DER.
+// ber2der re-encodes every element with definite lengths and joins constructed octet strings.
+func ber2der(b []byte) ([]byte, error) {
+	el, n, err := readBER(b, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	// anything after the outer element has to be padding
+	for _, c := range b[n:] {
+		if c != 0 {
+			return nil, fmt.Errorf("%w: trailing data after receipt", ErrInvalidReceipt)
+		}
+	}
+
+	return el.der(), nil
+}
+
+type berElement struct {
+	tag         []byte
+	constructed bool
+	content     []byte
+	children    []*berElement
+}
+
+const maxBERDepth = 32
+
+func readBER(b []byte, depth int) (*berElement, int, error) {
+	if depth > maxBERDepth {
+		return nil, 0, fmt.Errorf("%w: nesting too deep", ErrInvalidReceipt)
+	}
+
+	if len(b) < 2 {
+		return nil, 0, fmt.Errorf("%w: truncated element", ErrInvalidReceipt)
+	}
+
+	off := 1
+	if b[0]&0x1f == 0x1f {
+		for {
+			if off >= len(b) {
+				return nil, 0, fmt.Errorf("%w: truncated tag", ErrInvalidReceipt)
+			}
+			off++
+			if b[off-1]&0x80 == 0 {
+				break
+			}
+		}
+	}
+
+	el := &berElement{
+		tag:         b[:off],
+		constructed: b[0]&0x20 != 0,
+	}
+
+	if off >= len(b) {
+		return nil, 0, fmt.Errorf("%w: truncated length", ErrInvalidReceipt)
+	}
+
+	l := int(b[off])
+	off++
+
+	if l == 0x80 {
+		if !el.constructed {
+			return nil, 0, fmt.Errorf("%w: indefinite length on primitive element", ErrInvalidReceipt)
+		}
+		for {
+			if off+2 > len(b) {
+				return nil, 0, fmt.Errorf("%w: missing end of contents", ErrInvalidReceipt)
+			}
+			if b[off] == 0 && b[off+1] == 0 {
+				return el, off + 2, nil
+			}
+			child, n, err := readBER(b[off:], depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			el.children = append(el.children, child)
+			off += n
+		}
+	}
+
+	if l&0x80 != 0 {
+		count := l & 0x7f
+		if count > 4 || off+count > len(b) {
+			return nil, 0, fmt.Errorf("%w: invalid length", ErrInvalidReceipt)
+		}
+		l = 0
+		for _, c := range b[off : off+count] {
+			l = l<<8 | int(c)
+		}
+		off += count
+	}
+
+	if l < 0 || off+l > len(b) {
+		return nil, 0, fmt.Errorf("%w: length exceeds input", ErrInvalidReceipt)
+	}
+
+	content := b[off : off+l]
+
+	if !el.constructed {
+		el.content = content
+		return el, off + l, nil
+	}
+
+	for rest := content; len(rest) > 0; {
+		child, n, err := readBER(rest, depth+1)
+		if err != nil {
+			return nil, 0, err
+		}
+		el.children = append(el.children, child)
+		rest = rest[n:]
+	}
+
+	return el, off + l, nil
+}
+
+func (me *berElement) der() []byte {
+	tag := me.tag
+	var content []byte
+
+	switch {
+	case !me.constructed:
+		content = me.content
+	case len(tag) == 1 && tag[0] == 0x24:
+		// a constructed octet string is the concatenation of its chunks
+		tag = []byte{0x04}
+		content = me.octets()
+	default:
+		for _, c := range me.children {
+			content = append(content, c.der()...)
+		}
+	}
+
+	out := append([]byte{}, tag...)
+	out = append(out, derLength(len(content))...)
+	return append(out, content...)
+}
+
+func (me *berElement) octets() []byte {
+	if !me.constructed {
+		return me.content
+	}
+	var out []byte
+	for _, c := range me.children {
+		out = append(out, c.octets()...)
+	}
+	return out
+}
+
+func derLength(l int) []byte {
+	if l < 0x80 {
+		return []byte{byte(l)}
+	}
+	var b []byte
+	for ; l > 0; l >>= 8 {
+		b = append([]byte{byte(l)}, b...)
+	}
+	return append([]byte{0x80 | byte(len(b))}, b...)
+}
@@ -0,0 +1,131 @@
+package receipt
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/rs/zerolog"
+)
+
+const (
+	DevelopmentURL = "https://data-development.appattest.apple.com/v1/attestationData"
+	ProductionURL  = "https://data.appattest.apple.com/v1/attestationData"
+)
+
+// Client exchanges receipts for fresh ones carrying the current risk metric.
+// Apple returns a new receipt at most once per receipt NotBefore window.
+type Client struct {
+	endpoint   string
+	teamID     string
+	keyID      string
+	httpClient *http.Client
+	time       *time.Time
+}
+
+// NewClient returns a client for endpoint, DevelopmentURL or ProductionURL matching the app's environment.
+// teamID and keyID identify the DeviceCheck private key the requests are signed with.
+func NewClient(endpoint string, teamID string, keyID string) *Client {
+	return &Client{
+		endpoint: endpoint,
+		teamID:   teamID,
+		keyID:    keyID,
+		httpClient: &http.Client{
+			Timeout: 5 * time.Second,
+		},
+	}
+}
+
+func (me *Client) WithHTTPClient(client *http.Client) *Client {
+	me.httpClient = client
+	return me
+}
+
+func (me *Client) WithTime(t time.Time) *Client {
+	me.time = &t
+	return me
+}
+
+func (me *Client) now() time.Time {
+	if me.time != nil {
+		return *me.time
+	}
+	return time.Now()
+}
+
+// Refresh sends the receipt to apple and returns the new one. When apple has nothing newer it answers
+// 304 and the given receipt is returned with updated set to false.
+// pk is the pem encoded DeviceCheck private key. The new receipt is not checked, pass it to Verifier.Verify
+// with the credential public key before trusting its risk metric.
+func (me *Client) Refresh(ctx context.Context, pk string, receipt []byte) (next []byte, updated bool, err error) {
+	token, err := me.authorization(pk)
+	if err != nil {
+		return nil, false, err
+	}
+
+	body := base64.StdEncoding.EncodeToString(receipt)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, me.endpoint, strings.NewReader(body))
+	if err != nil {
+		return nil, false, err
+	}
+
+	req.Header.Set("authorization", token)
+
+	res, err := me.httpClient.Do(req)
+	if err != nil {
+		return nil, false, err
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		return receipt, false, nil
+	default:
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 1<<10))
+		err := fmt.Errorf("%w: %d %s", ErrRefresh, res.StatusCode, bytes.TrimSpace(msg))
+		zerolog.Ctx(ctx).Error().Err(err).Str("endpoint", me.endpoint).Msg("receipt refresh failed")
+		return nil, false, err
+	}
+
+	encoded, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return nil, false, err
+	}
+
+	next, err = base64.StdEncoding.DecodeString(string(bytes.TrimSpace(encoded)))
+	if err != nil {
+		return nil, false, fmt.Errorf("%w: response is not base64: %v", ErrRefresh, err)
+	}
+
+	return next, true, nil
+}
+
+func (me *Client) authorization(pk string) (string, error) {
+	block, _ := pem.Decode([]byte(pk))
+	if block == nil {
+		return "", fmt.Errorf("%w: empty block after decoding private key", ErrRefresh)
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, &jwt.RegisteredClaims{
+		Issuer:   me.teamID,
+		IssuedAt: jwt.NewNumericDate(me.now()),
+	})
+	token.Header["kid"] = me.keyID
+
+	return token.SignedString(key)
+}
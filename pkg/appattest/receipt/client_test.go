@@ -0,0 +1,148 @@
+package receipt
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// appleReceiptServer stands in for data-development.appattest.apple.com
+type appleReceiptServer struct {
+	t      *testing.T
+	key    *ecdsa.PublicKey
+	status int
+	next   []byte
+	got    []byte
+}
+
+func (me *appleReceiptServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	assert.Equal(me.t, http.MethodPost, r.Method)
+	assert.Equal(me.t, "/v1/attestationData", r.URL.Path)
+
+	claims := &jwt.RegisteredClaims{}
+	token, err := jwt.ParseWithClaims(r.Header.Get("authorization"), claims, func(t *jwt.Token) (interface{}, error) {
+		return me.key, nil
+	}, jwt.WithValidMethods([]string{"ES256"}))
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	assert.Equal(me.t, "TEAMID1234", claims.Issuer)
+	assert.Equal(me.t, "KEYID12345", token.Header["kid"])
+
+	body, _ := io.ReadAll(r.Body)
+	me.got, err = base64.StdEncoding.DecodeString(string(body))
+	require.NoError(me.t, err)
+
+	w.WriteHeader(me.status)
+	if me.status == http.StatusOK {
+		_, _ = w.Write([]byte(base64.StdEncoding.EncodeToString(me.next)))
+	}
+}
+
+func newDeviceCheckKey(t *testing.T) (*ecdsa.PrivateKey, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	return key, string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+}
+
+func TestClientRefresh(t *testing.T) {
+	key, pk := newDeviceCheckKey(t)
+
+	testCA := newTestAuthority(t)
+	now := time.Now().UTC().Truncate(time.Millisecond)
+
+	fresh := testCA.sign(t, testReceiptFields{
+		appID:      attestReceiptAppID,
+		typ:        TypeReceipt,
+		created:    now,
+		expires:    now.Add(90 * 24 * time.Hour),
+		riskMetric: "1",
+	})
+
+	tests := []struct {
+		name        string
+		status      int
+		wantUpdated bool
+		wantReceipt []byte
+		wantErr     error
+	}{
+		{
+			name:        "new receipt",
+			status:      http.StatusOK,
+			wantUpdated: true,
+			wantReceipt: fresh,
+		},
+		{
+			name:        "not modified",
+			status:      http.StatusNotModified,
+			wantUpdated: false,
+			wantReceipt: attestReceipt,
+		},
+		{
+			name:    "rejected",
+			status:  http.StatusBadRequest,
+			wantErr: ErrRefresh,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			apple := &appleReceiptServer{t: t, key: &key.PublicKey, status: tt.status, next: fresh}
+			srv := httptest.NewServer(apple)
+			defer srv.Close()
+
+			client := NewClient(srv.URL+"/v1/attestationData", "TEAMID1234", "KEYID12345").WithHTTPClient(srv.Client())
+
+			next, updated, err := client.Refresh(context.Background(), pk, attestReceipt)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Refresh() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			assert.Equal(t, []byte(attestReceipt), apple.got)
+			assert.Equal(t, tt.wantUpdated, updated)
+			assert.Equal(t, tt.wantReceipt, next)
+
+			if !tt.wantUpdated || err != nil {
+				return
+			}
+
+			r, err := NewVerifier(attestReceiptAppID).WithRoots(testCA.pool()).WithMaxAge(5*time.Minute).Verify(context.Background(), next, testCA.credentialKey)
+			require.NoError(t, err)
+			assert.Equal(t, 1, r.RiskMetric)
+		})
+	}
+}
+
+func TestClientRefreshWrongKey(t *testing.T) {
+	key, _ := newDeviceCheckKey(t)
+	_, otherPK := newDeviceCheckKey(t)
+
+	apple := &appleReceiptServer{t: t, key: &key.PublicKey, status: http.StatusOK}
+	srv := httptest.NewServer(apple)
+	defer srv.Close()
+
+	_, _, err := NewClient(srv.URL+"/v1/attestationData", "TEAMID1234", "KEYID12345").
+		WithHTTPClient(srv.Client()).
+		Refresh(context.Background(), otherPK, attestReceipt)
+
+	assert.ErrorIs(t, err, ErrRefresh)
+}
@@ -0,0 +1,16 @@
+package receipt
+
+import "errors"
+
+var (
+	ErrInvalidReceipt    = errors.New("ErrInvalidReceipt")
+	ErrInvalidSignature  = errors.New("ErrInvalidSignature")
+	ErrInvalidChain      = errors.New("ErrInvalidChain")
+	ErrAppIDMismatch     = errors.New("ErrAppIDMismatch")
+	ErrPublicKeyMismatch = errors.New("ErrPublicKeyMismatch")
+	ErrInvalidType       = errors.New("ErrInvalidType")
+	ErrReceiptExpired    = errors.New("ErrReceiptExpired")
+	ErrReceiptNotYet     = errors.New("ErrReceiptNotYet")
+	ErrReceiptTooOld     = errors.New("ErrReceiptTooOld")
+	ErrRefresh           = errors.New("ErrRefresh")
+)
@@ -0,0 +1,225 @@
+package receipt
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+var (
+	oidSignedData    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidData          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidSHA256        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+
+	// oidReceiptSigning marks the certificates apple issues for signing app attest receipts, the
+	// "Application Attestation Fraud Receipt Signing" leaves of Apple Application Integration CA 5
+	oidReceiptSigning = asn1.ObjectIdentifier{1, 2, 840, 113635, 100, 12, 15}
+)
+
+// signatureAlgorithms are the signer info signature algorithms receipts are accepted with, by the
+// digest algorithm they have to be paired with
+var signatureAlgorithms = []struct {
+	signature asn1.ObjectIdentifier
+	digest    asn1.ObjectIdentifier
+	algorithm x509.SignatureAlgorithm
+}{
+	{signature: asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}, digest: oidSHA256, algorithm: x509.ECDSAWithSHA256},
+}
+
+// rfc 5652 section 3
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+// rfc 5652 section 5.1
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo encapsulatedContentInfo
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos      []signerInfo  `asn1:"set"`
+}
+
+type encapsulatedContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     []byte `asn1:"explicit,optional,tag:0"`
+}
+
+// rfc 5652 section 5.3
+type signerInfo struct {
+	Version            int
+	Sid                issuerAndSerialNumber
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttrs      asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type issuerAndSerialNumber struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue `asn1:"set"`
+}
+
+// signedReceipt is the pkcs7 container around the receipt payload
+type signedReceipt struct {
+	content      []byte
+	certificates []*x509.Certificate
+	signer       signerInfo
+}
+
+func parseSignedData(raw []byte) (*signedReceipt, error) {
+	der, err := ber2der(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	var ci contentInfo
+	if _, err := asn1.Unmarshal(der, &ci); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidReceipt, err)
+	}
+
+	if !ci.ContentType.Equal(oidSignedData) {
+		return nil, fmt.Errorf("%w: content type %s is not signed data", ErrInvalidReceipt, ci.ContentType)
+	}
+
+	var sd signedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidReceipt, err)
+	}
+
+	if !sd.EncapContentInfo.ContentType.Equal(oidData) {
+		return nil, fmt.Errorf("%w: encapsulated content type %s is not data", ErrInvalidReceipt, sd.EncapContentInfo.ContentType)
+	}
+
+	if len(sd.SignerInfos) != 1 {
+		return nil, fmt.Errorf("%w: expected one signer, got %d", ErrInvalidReceipt, len(sd.SignerInfos))
+	}
+
+	certs, err := x509.ParseCertificates(sd.Certificates.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidReceipt, err)
+	}
+
+	return &signedReceipt{
+		content:      sd.EncapContentInfo.Content,
+		certificates: certs,
+		signer:       sd.SignerInfos[0],
+	}, nil
+}
+
+// verify checks the signer's signature over the content and chains the signer to roots at the given time
+func (me *signedReceipt) verify(roots *x509.CertPool, at time.Time) error {
+	signer := me.signerCertificate()
+	if signer == nil {
+		return fmt.Errorf("%w: signer certificate not included", ErrInvalidSignature)
+	}
+
+	algorithm, err := me.signatureAlgorithm()
+	if err != nil {
+		return err
+	}
+
+	if !isReceiptSigner(signer) {
+		return fmt.Errorf("%w: signer %q is not an app attest receipt signer", ErrInvalidChain, signer.Subject.CommonName)
+	}
+
+	signed := me.content
+
+	// with signed attributes the signature covers them instead, and they carry the content digest
+	if len(me.signer.SignedAttrs.Bytes) > 0 {
+		digest, err := me.messageDigest()
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(me.content)
+		if !bytes.Equal(digest, sum[:]) {
+			return fmt.Errorf("%w: message digest does not match content", ErrInvalidSignature)
+		}
+		signed = append([]byte{0x31}, me.signer.SignedAttrs.FullBytes[1:]...)
+	}
+
+	if err := signer.CheckSignature(algorithm, signed, me.signer.Signature); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, c := range me.certificates {
+		if c != signer {
+			intermediates.AddCert(c)
+		}
+	}
+
+	if _, err := signer.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   at,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidChain, err)
+	}
+
+	return nil
+}
+
+// signatureAlgorithm returns the algorithm of the signer info, only the ones of signatureAlgorithms with
+// their digest algorithm are accepted
+func (me *signedReceipt) signatureAlgorithm() (x509.SignatureAlgorithm, error) {
+	for _, a := range signatureAlgorithms {
+		if me.signer.SignatureAlgorithm.Algorithm.Equal(a.signature) && me.signer.DigestAlgorithm.Algorithm.Equal(a.digest) {
+			return a.algorithm, nil
+		}
+	}
+	return x509.UnknownSignatureAlgorithm, fmt.Errorf("%w: unsupported signature algorithm %s with digest %s",
+		ErrInvalidSignature, me.signer.SignatureAlgorithm.Algorithm, me.signer.DigestAlgorithm.Algorithm)
+}
+
+func isReceiptSigner(c *x509.Certificate) bool {
+	for _, ext := range c.Extensions {
+		if ext.Id.Equal(oidReceiptSigning) {
+			return true
+		}
+	}
+	return false
+}
+
+func (me *signedReceipt) signerCertificate() *x509.Certificate {
+	for _, c := range me.certificates {
+		if c.SerialNumber.Cmp(me.signer.Sid.SerialNumber) == 0 && bytes.Equal(c.RawIssuer, me.signer.Sid.Issuer.FullBytes) {
+			return c
+		}
+	}
+	return nil
+}
+
+func (me *signedReceipt) messageDigest() ([]byte, error) {
+	var attrs []attribute
+	if _, err := asn1.UnmarshalWithParams(me.signer.SignedAttrs.FullBytes, &attrs, "set,tag:0"); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+
+	for _, a := range attrs {
+		if a.Type.Equal(oidMessageDigest) {
+			var digest []byte
+			if _, err := asn1.Unmarshal(a.Values.Bytes, &digest); err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+			}
+			return digest, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: missing message digest attribute", ErrInvalidSignature)
+}
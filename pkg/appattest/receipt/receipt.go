@@ -0,0 +1,261 @@
+package receipt
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+type Type string
+
+const (
+	// TypeAttest is the receipt returned inside an attestation object
+	TypeAttest Type = "ATTEST"
+	// TypeReceipt is a receipt returned by apple's server in exchange for an earlier one
+	TypeReceipt Type = "RECEIPT"
+)
+
+// EnvironmentSandbox is reported by receipts of apps using the appattestdevelop environment,
+// production receipts carry no environment field
+const EnvironmentSandbox = "sandbox"
+
+// receipt field types, https://developer.apple.com/documentation/devicecheck/assessing_fraud_risk
+const (
+	fieldAppID             = 2
+	fieldAttestedPublicKey = 3
+	fieldClientHash        = 4
+	fieldToken             = 5
+	fieldType              = 6
+	fieldEnvironment       = 7
+	fieldCreationTime      = 12
+	fieldRiskMetric        = 17
+	fieldNotBefore         = 19
+	fieldExpirationTime    = 21
+)
+
+type Receipt struct {
+	// AppID is the team id and bundle id of the app, "TEAMID.bundle.id"
+	AppID string
+
+	// AttestedCertificate is the credential certificate from the attestation object
+	AttestedCertificate *x509.Certificate
+
+	ClientHash  []byte
+	Token       string
+	Type        Type
+	Environment string
+
+	// RiskMetric approximates the number of attested keys on the device over the last 30 days, it is only
+	// reported on receipts of TypeReceipt
+	RiskMetric    int
+	HasRiskMetric bool
+
+	CreationTime time.Time
+
+	// NotBefore is the earliest time the receipt can be exchanged for a new one
+	NotBefore time.Time
+
+	ExpirationTime time.Time
+
+	// Raw is the signed receipt as received
+	Raw []byte
+}
+
+type receiptField struct {
+	Type    int
+	Version int
+	Value   []byte
+}
+
+// Parse decodes a receipt without checking its signature, use a Verifier for receipts that are going to be trusted
+func Parse(raw []byte) (*Receipt, error) {
+	sr, err := parseSignedData(raw)
+	if err != nil {
+		return nil, err
+	}
+	return parsePayload(raw, sr.content)
+}
+
+func parsePayload(raw, payload []byte) (*Receipt, error) {
+	var fields []receiptField
+	if _, err := asn1.UnmarshalWithParams(payload, &fields, "set"); err != nil {
+		return nil, fmt.Errorf("%w: payload: %v", ErrInvalidReceipt, err)
+	}
+
+	r := &Receipt{Raw: raw}
+
+	for _, f := range fields {
+		var err error
+		switch f.Type {
+		case fieldAppID:
+			r.AppID = string(f.Value)
+		case fieldAttestedPublicKey:
+			r.AttestedCertificate, err = x509.ParseCertificate(f.Value)
+		case fieldClientHash:
+			r.ClientHash = f.Value
+		case fieldToken:
+			r.Token = string(f.Value)
+		case fieldType:
+			r.Type = Type(f.Value)
+		case fieldEnvironment:
+			r.Environment = string(f.Value)
+		case fieldCreationTime:
+			r.CreationTime, err = parseTime(f.Value)
+		case fieldRiskMetric:
+			r.RiskMetric, err = strconv.Atoi(strings.TrimSpace(string(f.Value)))
+			r.HasRiskMetric = err == nil
+		case fieldNotBefore:
+			r.NotBefore, err = parseTime(f.Value)
+		case fieldExpirationTime:
+			r.ExpirationTime, err = parseTime(f.Value)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: field %d: %v", ErrInvalidReceipt, f.Type, err)
+		}
+	}
+
+	if r.AppID == "" || r.Type == "" || r.CreationTime.IsZero() {
+		return nil, fmt.Errorf("%w: missing required fields", ErrInvalidReceipt)
+	}
+
+	return r, nil
+}
+
+func parseTime(b []byte) (time.Time, error) {
+	return time.Parse(time.RFC3339Nano, string(b))
+}
+
+// MatchesPublicKey reports whether the attested certificate holds the given X9.63 encoded P-256 key,
+// the form the key is stored in on the credential
+func (me *Receipt) MatchesPublicKey(x963 []byte) bool {
+	if me.AttestedCertificate == nil {
+		return false
+	}
+	pub, ok := me.AttestedCertificate.PublicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return false
+	}
+	return bytes.Equal(elliptic.Marshal(pub.Curve, pub.X, pub.Y), x963)
+}
+
+type Verifier struct {
+	roots  *x509.CertPool
+	appIDs []string
+	maxAge time.Duration
+	time   *time.Time
+}
+
+// NewVerifier returns a verifier trusting apple's root that accepts receipts of the given app ids
+func NewVerifier(appIDs ...string) *Verifier {
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM([]byte(AppleRootCAG3))
+
+	return &Verifier{
+		roots:  roots,
+		appIDs: appIDs,
+	}
+}
+
+// WithRoots replaces apple's root, for receipts signed by a test authority
+func (me *Verifier) WithRoots(roots *x509.CertPool) *Verifier {
+	me.roots = roots
+	return me
+}
+
+// WithTime pins the time the chain and the receipt's validity are checked at, for replaying recorded receipts
+func (me *Verifier) WithTime(t time.Time) *Verifier {
+	me.time = &t
+	return me
+}
+
+// WithMaxAge rejects receipts created longer than d ago, apple recommends five minutes for freshly fetched receipts
+func (me *Verifier) WithMaxAge(d time.Duration) *Verifier {
+	me.maxAge = d
+	return me
+}
+
+func (me *Verifier) now() time.Time {
+	if me.time != nil {
+		return *me.time
+	}
+	return time.Now()
+}
+
+// Verify checks the receipt's signature and chain and then its contents,
+// as described in https://developer.apple.com/documentation/devicecheck/assessing_fraud_risk.
+// publicKey is the X9.63 encoded key stored on the credential, a receipt attesting any other key is refused
+func (me *Verifier) Verify(ctx context.Context, raw []byte, publicKey []byte) (*Receipt, error) {
+	now := me.now()
+
+	sr, err := parseSignedData(raw)
+	if err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Msg("failed to parse receipt")
+		return nil, err
+	}
+
+	if err := sr.verify(me.roots, now); err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Msg("failed to verify receipt signature")
+		return nil, err
+	}
+
+	r, err := parsePayload(raw, sr.content)
+	if err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Msg("failed to parse receipt payload")
+		return nil, err
+	}
+
+	if err := me.verifyFields(r, now); err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Str("app_id", r.AppID).Str("type", string(r.Type)).Msg("invalid receipt")
+		return nil, err
+	}
+
+	if !r.MatchesPublicKey(publicKey) {
+		err := fmt.Errorf("%w: the receipt attests another key than the credential's", ErrPublicKeyMismatch)
+		zerolog.Ctx(ctx).Error().Err(err).Str("app_id", r.AppID).Msg("invalid receipt")
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (me *Verifier) verifyFields(r *Receipt, now time.Time) error {
+	if !me.appIDAllowed(r.AppID) {
+		return fmt.Errorf("%w: %q", ErrAppIDMismatch, r.AppID)
+	}
+
+	if r.Type != TypeAttest && r.Type != TypeReceipt {
+		return fmt.Errorf("%w: %q", ErrInvalidType, r.Type)
+	}
+
+	if r.CreationTime.After(now) {
+		return fmt.Errorf("%w: created at %s", ErrReceiptNotYet, r.CreationTime)
+	}
+
+	if me.maxAge > 0 && now.Sub(r.CreationTime) > me.maxAge {
+		return fmt.Errorf("%w: created at %s", ErrReceiptTooOld, r.CreationTime)
+	}
+
+	if !r.ExpirationTime.IsZero() && !now.Before(r.ExpirationTime) {
+		return fmt.Errorf("%w: expired at %s", ErrReceiptExpired, r.ExpirationTime)
+	}
+
+	return nil
+}
+
+func (me *Verifier) appIDAllowed(appID string) bool {
+	for _, id := range me.appIDs {
+		if id == appID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,358 @@
+package receipt
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/webauthn/pkg/hex"
+)
+
+// the receipt from the attestation object recorded in app/devicecheck_attest
+var attestReceipt = hex.HexToHash("0x308006092a864886f70d010702a0803080020101310f300d06096086480165030402010500308006092a864886f70d010701a0802480048203e8318203ff301f020102020101041734343937514a534144332e78797a2e6e7567672e617070308202e9020103020101048202df308202db30820262a00302010202060184b047841d300a06082a8648ce3d040302304f3123302106035504030c1a4170706c6520417070204174746573746174696f6e204341203131133011060355040a0c0a4170706c6520496e632e3113301106035504080c0a43616c69666f726e6961301e170d3232313132343139333330375a170d3233313131333133323330375a3081913149304706035504030c4037316430393162343138633163373666326535393639613436613963393661353636356239303137306266383231386532653136356535303565313130343839311a3018060355040b0c114141412043657274696669636174696f6e31133011060355040a0c0a4170706c6520496e632e3113301106035504080c0a43616c69666f726e69613059301306072a8648ce3d020106082a8648ce3d030107034200044a9e9ad76c6050b256c1746b133fc51f485a8f7696842b5b1ff1e10b16af8cc30f1bcfdf59ee86c31d8a7c81d494d1537c308eab3f02ac29e19d6906cd8b8cf3a381e63081e3300c0603551d130101ff04023000300e0603551d0f0101ff0404030204f0307106092a864886f76364080504643062a40302010abf893003020101bf893103020100bf893203020101bf893303020101bf893419041734343937514a534144332e78797a2e6e7567672e617070a5060404736b7320bf893603020105bf893703020100bf893903020100bf893a03020100301b06092a864886f763640807040e300cbf8a7808040631362e312e31303306092a864886f76364080204263024a1220420ba147271a67baa64d5f6d989e3193389d4119bf1d2075bbe2821bf7bf534ebe9300a06082a8648ce3d040302036700306402306d5a2877b2a73449eab63888c3825e8df5d1aacfb7d1050ddc4234ebd9a18be481eb43e4c0060347a7cbd0621b52fc5902304be779b8c2b7ca4d524488b44caed002837bcc96cefd8107049479c5842175c64bb67258485af8f4b0d73cb1752d426630280201040201010420d9de5906ceec0bf891cee9cd9390bc796ccbe80900575d8cdfd6f875d5c68304306002010502010104586a75443656536b6e7779356b345834526576505776663530667a616e70456577626d39496a556e59776e425a5a6566466b6e64706f71454944556c726a5056567575547a46437752334c437242745a44565a306461773d3d300e0201060201010406415454455354300f020107020101040773616e64626f78302002010c0201010418323032322d31312d32355431393a33333a30372e3737365a30200201150201041b010418323032332d30322d32335431393a33333a30372e3737365a000000000000a080308203ae30820354a00302010202100939b4bce90cc3a1816536372f667141300a06082a8648ce3d040302307c3130302e06035504030c274170706c65204170706c69636174696f6e20496e746567726174696f6e2043412035202d20473131263024060355040b0c1d4170706c652043657274696669636174696f6e20417574686f7269747931133011060355040a0c0a4170706c6520496e632e310b3009060355040613025553301e170d3232303431393133333330335a170d3233303531393133333330325a305a3136303406035504030c2d4170706c69636174696f6e204174746573746174696f6e2046726175642052656365697074205369676e696e6731133011060355040a0c0a4170706c6520496e632e310b30090603550406130255533059301306072a8648ce3d020106082a8648ce3d0301070342000439d4f9aa9b1cc445d65ba617acf2c084ec6f0708d59014a0e76ecf3dee3999a94c6bfb0155105555646cda8e23e026011402d07e13b9541fd8b4d657d82e9378a38201d8308201d4300c0603551d130101ff04023000301f0603551d23041830168014d917fe4b6790384b92f4dbced55780140b8f3dc9304306082b0601050507010104373035303306082b060105050730018627687474703a2f2f6f6373702e6170706c652e636f6d2f6f63737030332d616169636135673130313082011c0603551d20048201133082010f3082010b06092a864886f7636405013081fd3081c306082b060105050702023081b60c81b352656c69616e6365206f6e207468697320636572746966696361746520627920616e7920706172747920617373756d657320616363657074616e6365206f6620746865207468656e206170706c696361626c65207374616e64617264207465726d7320616e6420636f6e646974696f6e73206f66207573652c20636572746966696361746520706f6c69637920616e642063657274696669636174696f6e2070726163746963652073746174656d656e74732e303506082b060105050702011629687474703a2f2f7777772e6170706c652e636f6d2f6365727469666963617465617574686f72697479301d0603551d0e04160414fb67d30dbf73b792a6265d488d2cc11d95e273f8300e0603551d0f0101ff040403020780300f06092a864886f763640c0f04020500300a06082a8648ce3d04030203480030450221009490a0673773e72f7829367623b8dd51d7c89a09eabb00e39c6e450b05580bd0022047341a2bd13cc054a80a3aaacc3cc1457c00545318ea338d7d6dd5f60b2b872e308202f93082027fa003020102021056fb83d42bff8dc3379923b55aae6ebd300a06082a8648ce3d0403033067311b301906035504030c124170706c6520526f6f74204341202d20473331263024060355040b0c1d4170706c652043657274696669636174696f6e20417574686f7269747931133011060355040a0c0a4170706c6520496e632e310b3009060355040613025553301e170d3139303332323137353333335a170d3334303332323030303030305a307c3130302e06035504030c274170706c65204170706c69636174696f6e20496e746567726174696f6e2043412035202d20473131263024060355040b0c1d4170706c652043657274696669636174696f6e20417574686f7269747931133011060355040a0c0a4170706c6520496e632e310b30090603550406130255533059301306072a8648ce3d020106082a8648ce3d0301070342000492ce63bd7d86b1ab280a3b1ce1affb04948091acf631dfa6cb28356f444be121e557dd128d8dba827c95be49fabe33caaecd0419f12f4325faf4beb3cb837ebaa381f73081f4300f0603551d130101ff040530030101ff301f0603551d23041830168014bbb0dea15833889aa48a99debebdebafdacb24ab304606082b06010505070101043a3038303606082b06010505073001862a687474703a2f2f6f6373702e6170706c652e636f6d2f6f63737030332d6170706c65726f6f746361673330370603551d1f0430302e302ca02aa0288626687474703a2f2f63726c2e6170706c652e636f6d2f6170706c65726f6f74636167332e63726c301d0603551d0e04160414d917fe4b6790384b92f4dbced55780140b8f3dc9300e0603551d0f0101ff0404030201063010060a2a864886f7636406020304020500300a06082a8648ce3d04030303680030650231008d6fa69fa1e0e4ec5b4e738a927f3d7853988ff4da1f581ec3754afe38a84c2a831a1aaa0da6646de1b993e8d1554ced0230673b2cb4e1e8370777cbd5ec76a81a3a553b3f356ac8c5e692b0e161be804969e45f2ba96ce11102aacc61d938b7734a30820243308201c9a00302010202082dc5fc88d2c54b95300a06082a8648ce3d0403033067311b301906035504030c124170706c6520526f6f74204341202d20473331263024060355040b0c1d4170706c652043657274696669636174696f6e20417574686f7269747931133011060355040a0c0a4170706c6520496e632e310b3009060355040613025553301e170d3134303433303138313930365a170d3339303433303138313930365a3067311b301906035504030c124170706c6520526f6f74204341202d20473331263024060355040b0c1d4170706c652043657274696669636174696f6e20417574686f7269747931133011060355040a0c0a4170706c6520496e632e310b30090603550406130255533076301006072a8648ce3d020106052b810400220362000498e92f3d4072a4ed93227281131cdd1095f1c5a34e71dc1416d90ee5a6052a77647b5f4e38d3bb1c44b57ff51fb632625dc9e9845b4f304f115a00fd58580ca5f50f2c4d07471375da9797976f315ced2b9d7b203bd8b954d95e99a43a510a31a3423040301d0603551d0e04160414bbb0dea15833889aa48a99debebdebafdacb24ab300f0603551d130101ff040530030101ff300e0603551d0f0101ff040403020106300a06082a8648ce3d040303036800306502310083e9c1c4165e1a5d3418d9edeff46c0e00464bb8dfb24611c50ffde67a8ca1a66bcec203d49cf593c674b86adfaa231502306d668a10cad40dd44fcd8d433eb48a63a5336ee36dda17b7641fc85326f9886274390b175bcb51a80ce81803e7a2b22800003181fd3081fa020101308190307c3130302e06035504030c274170706c65204170706c69636174696f6e20496e746567726174696f6e2043412035202d20473131263024060355040b0c1d4170706c652043657274696669636174696f6e20417574686f7269747931133011060355040a0c0a4170706c6520496e632e310b300906035504061302555302100939b4bce90cc3a1816536372f667141300d06096086480165030402010500300a06082a8648ce3d04030204473045022100a967dc17accd16742fec491709d607c3b4c62424ad70d491a3ff4ab07a2846de02207bfedc920a9a091c4712bc703bc8188a499053a52c53eb3c475c2dfeb9f9e7ae000000000000")
+
+var attestReceiptKey = hex.HexToHash("0x044a9e9ad76c6050b256c1746b133fc51f485a8f7696842b5b1ff1e10b16af8cc30f1bcfdf59ee86c31d8a7c81d494d1537c308eab3f02ac29e19d6906cd8b8cf3")
+
+const attestReceiptAppID = "4497QJSAD3.xyz.nugg.app"
+
+var attestReceiptTime = time.Date(2022, 11, 26, 0, 0, 0, 0, time.UTC)
+
+func TestVerifyAttestReceipt(t *testing.T) {
+	r, err := NewVerifier(attestReceiptAppID).WithTime(attestReceiptTime).Verify(context.Background(), attestReceipt, attestReceiptKey)
+	require.NoError(t, err)
+
+	assert.Equal(t, attestReceiptAppID, r.AppID)
+	assert.Equal(t, TypeAttest, r.Type)
+	assert.Equal(t, EnvironmentSandbox, r.Environment)
+	assert.Equal(t, time.Date(2022, 11, 25, 19, 33, 7, 776000000, time.UTC), r.CreationTime)
+	assert.Equal(t, time.Date(2023, 2, 23, 19, 33, 7, 776000000, time.UTC), r.ExpirationTime)
+	assert.False(t, r.HasRiskMetric)
+	assert.Len(t, r.ClientHash, 32)
+	assert.NotEmpty(t, r.Token)
+	assert.True(t, r.MatchesPublicKey(attestReceiptKey))
+	assert.False(t, r.MatchesPublicKey(attestReceiptKey[1:]))
+}
+
+func TestVerifyAttestReceiptFailures(t *testing.T) {
+	tampered := append(hex.Hash{}, attestReceipt...)
+	// first byte of the app id inside the payload
+	tampered[0x48] ^= 0x01
+
+	testCA := newTestAuthority(t)
+	otherCA := newTestAuthorityWith(t, nil)
+
+	tests := []struct {
+		name      string
+		receipt   []byte
+		publicKey []byte
+		verifier  *Verifier
+		wantErr   error
+	}{
+		{
+			name:     "wrong app id",
+			receipt:  attestReceipt,
+			verifier: NewVerifier("4497QJSAD3.xyz.nugg.other").WithTime(attestReceiptTime),
+			wantErr:  ErrAppIDMismatch,
+		},
+		{
+			name:     "no app ids",
+			receipt:  attestReceipt,
+			verifier: NewVerifier().WithTime(attestReceiptTime),
+			wantErr:  ErrAppIDMismatch,
+		},
+		{
+			name:     "expired",
+			receipt:  attestReceipt,
+			verifier: NewVerifier(attestReceiptAppID).WithTime(time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC)),
+			wantErr:  ErrReceiptExpired,
+		},
+		{
+			name:     "created in the future",
+			receipt:  attestReceipt,
+			verifier: NewVerifier(attestReceiptAppID).WithTime(time.Date(2022, 11, 25, 0, 0, 0, 0, time.UTC)),
+			wantErr:  ErrReceiptNotYet,
+		},
+		{
+			name:     "too old",
+			receipt:  attestReceipt,
+			verifier: NewVerifier(attestReceiptAppID).WithTime(attestReceiptTime).WithMaxAge(5 * time.Minute),
+			wantErr:  ErrReceiptTooOld,
+		},
+		{
+			name:      "another credential's key",
+			receipt:   attestReceipt,
+			publicKey: testCA.credentialKey,
+			verifier:  NewVerifier(attestReceiptAppID).WithTime(attestReceiptTime),
+			wantErr:   ErrPublicKeyMismatch,
+		},
+		{
+			name:      "no key",
+			receipt:   attestReceipt,
+			publicKey: []byte{},
+			verifier:  NewVerifier(attestReceiptAppID).WithTime(attestReceiptTime),
+			wantErr:   ErrPublicKeyMismatch,
+		},
+		{
+			name:     "tampered payload",
+			receipt:  tampered,
+			verifier: NewVerifier(attestReceiptAppID).WithTime(attestReceiptTime),
+			wantErr:  ErrInvalidSignature,
+		},
+		{
+			name:     "untrusted root",
+			receipt:  attestReceipt,
+			verifier: NewVerifier(attestReceiptAppID).WithTime(attestReceiptTime).WithRoots(testCA.pool()),
+			wantErr:  ErrInvalidChain,
+		},
+		{
+			name:     "chain expired",
+			receipt:  attestReceipt,
+			verifier: NewVerifier(attestReceiptAppID).WithTime(time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)),
+			wantErr:  ErrInvalidChain,
+		},
+		{
+			name:     "not a receipt",
+			receipt:  []byte{0x30, 0x03, 0x02, 0x01, 0x01},
+			verifier: NewVerifier(attestReceiptAppID).WithTime(attestReceiptTime),
+			wantErr:  ErrInvalidReceipt,
+		},
+		{
+			name:     "truncated",
+			receipt:  attestReceipt[:100],
+			verifier: NewVerifier(attestReceiptAppID).WithTime(attestReceiptTime),
+			wantErr:  ErrInvalidReceipt,
+		},
+		{
+			name: "signer without receipt signing extension",
+			receipt: otherCA.sign(t, testReceiptFields{
+				appID:   attestReceiptAppID,
+				typ:     TypeAttest,
+				created: attestReceiptTime,
+			}),
+			verifier: NewVerifier(attestReceiptAppID).WithTime(attestReceiptTime).WithRoots(otherCA.pool()),
+			wantErr:  ErrInvalidChain,
+		},
+		{
+			name: "unsupported signature algorithm",
+			receipt: testCA.signWith(t, testReceiptFields{
+				appID:   attestReceiptAppID,
+				typ:     TypeAttest,
+				created: attestReceiptTime,
+			}, asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}),
+			verifier: NewVerifier(attestReceiptAppID).WithTime(attestReceiptTime).WithRoots(testCA.pool()),
+			wantErr:  ErrInvalidSignature,
+		},
+		{
+			name: "unknown type",
+			receipt: testCA.sign(t, testReceiptFields{
+				appID:   attestReceiptAppID,
+				typ:     "BOGUS",
+				created: attestReceiptTime,
+			}),
+			verifier: NewVerifier(attestReceiptAppID).WithTime(attestReceiptTime).WithRoots(testCA.pool()),
+			wantErr:  ErrInvalidType,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			publicKey := tt.publicKey
+			if publicKey == nil {
+				publicKey = attestReceiptKey
+			}
+
+			_, err := tt.verifier.Verify(context.Background(), tt.receipt, publicKey)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyRefreshedReceipt(t *testing.T) {
+	testCA := newTestAuthority(t)
+
+	raw := testCA.sign(t, testReceiptFields{
+		appID:      attestReceiptAppID,
+		typ:        TypeReceipt,
+		created:    attestReceiptTime,
+		notBefore:  attestReceiptTime.Add(24 * time.Hour),
+		expires:    attestReceiptTime.Add(90 * 24 * time.Hour),
+		riskMetric: "4",
+	})
+
+	r, err := NewVerifier(attestReceiptAppID).
+		WithRoots(testCA.pool()).
+		WithTime(attestReceiptTime.Add(time.Minute)).
+		WithMaxAge(5*time.Minute).
+		Verify(context.Background(), raw, testCA.credentialKey)
+	require.NoError(t, err)
+
+	assert.Equal(t, TypeReceipt, r.Type)
+	assert.True(t, r.HasRiskMetric)
+	assert.Equal(t, 4, r.RiskMetric)
+	assert.Equal(t, attestReceiptTime.Add(24*time.Hour), r.NotBefore)
+	assert.Equal(t, "", r.Environment)
+}
+
+func TestParse(t *testing.T) {
+	r, err := Parse(attestReceipt)
+	require.NoError(t, err)
+	assert.Equal(t, attestReceiptAppID, r.AppID)
+	assert.Equal(t, []byte(attestReceipt), r.Raw)
+}
+
+// testAuthority signs receipts the way apple does, with a root, an intermediate and a signing leaf,
+// every receipt attests the same credential certificate
+type testAuthority struct {
+	root          *x509.Certificate
+	intermediate  *x509.Certificate
+	leaf          *x509.Certificate
+	leafKey       *ecdsa.PrivateKey
+	credential    *x509.Certificate
+	credentialKey []byte
+}
+
+func newTestAuthority(t *testing.T) *testAuthority {
+	return newTestAuthorityWith(t, []pkix.Extension{{Id: oidReceiptSigning, Value: []byte{0x05, 0x00}}})
+}
+
+// newTestAuthorityWith issues the signing leaf with the given extensions
+func newTestAuthorityWith(t *testing.T, leafExtensions []pkix.Extension) *testAuthority {
+	t.Helper()
+
+	issue := func(cn string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey, ca bool, exts []pkix.Extension) (*x509.Certificate, *ecdsa.PrivateKey) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+
+		tmpl := &x509.Certificate{
+			SerialNumber:          big.NewInt(time.Now().UnixNano()),
+			Subject:               pkix.Name{CommonName: cn},
+			NotBefore:             time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+			NotAfter:              time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC),
+			BasicConstraintsValid: true,
+			IsCA:                  ca,
+			KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+			ExtraExtensions:       exts,
+		}
+
+		if parent == nil {
+			parent, parentKey = tmpl, key
+		}
+
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+		require.NoError(t, err)
+
+		cert, err := x509.ParseCertificate(der)
+		require.NoError(t, err)
+
+		return cert, key
+	}
+
+	root, rootKey := issue("test receipt root", nil, nil, true, nil)
+	intermediate, intermediateKey := issue("test receipt intermediate", root, rootKey, true, nil)
+	leaf, leafKey := issue("test receipt signing", intermediate, intermediateKey, false, leafExtensions)
+	credential, credentialKey := issue("test credential", intermediate, intermediateKey, false, nil)
+
+	return &testAuthority{
+		root:          root,
+		intermediate:  intermediate,
+		leaf:          leaf,
+		leafKey:       leafKey,
+		credential:    credential,
+		credentialKey: elliptic.Marshal(credentialKey.Curve, credentialKey.X, credentialKey.Y),
+	}
+}
+
+func (me *testAuthority) pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(me.root)
+	return pool
+}
+
+type testReceiptFields struct {
+	appID      string
+	typ        Type
+	created    time.Time
+	notBefore  time.Time
+	expires    time.Time
+	riskMetric string
+}
+
+func (me *testAuthority) sign(t *testing.T, f testReceiptFields) []byte {
+	t.Helper()
+	return me.signWith(t, f, asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2})
+}
+
+// signWith signs a receipt with a sha256 ecdsa signature, reporting signatureAlgorithm in the signer info
+func (me *testAuthority) signWith(t *testing.T, f testReceiptFields, signatureAlgorithm asn1.ObjectIdentifier) []byte {
+	t.Helper()
+
+	fields := []receiptField{
+		{Type: fieldAppID, Version: 1, Value: []byte(f.appID)},
+		{Type: fieldAttestedPublicKey, Version: 1, Value: me.credential.Raw},
+		{Type: fieldType, Version: 1, Value: []byte(f.typ)},
+		{Type: fieldCreationTime, Version: 1, Value: []byte(f.created.Format(time.RFC3339Nano))},
+	}
+	if !f.notBefore.IsZero() {
+		fields = append(fields, receiptField{Type: fieldNotBefore, Version: 1, Value: []byte(f.notBefore.Format(time.RFC3339Nano))})
+	}
+	if !f.expires.IsZero() {
+		fields = append(fields, receiptField{Type: fieldExpirationTime, Version: 1, Value: []byte(f.expires.Format(time.RFC3339Nano))})
+	}
+	if f.riskMetric != "" {
+		fields = append(fields, receiptField{Type: fieldRiskMetric, Version: 1, Value: []byte(f.riskMetric)})
+	}
+
+	payload, err := asn1.MarshalWithParams(fields, "set")
+	require.NoError(t, err)
+
+	digest := sha256.Sum256(payload)
+	sig, err := ecdsa.SignASN1(rand.Reader, me.leafKey, digest[:])
+	require.NoError(t, err)
+
+	sd := signedData{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{{Algorithm: oidSHA256}},
+		EncapContentInfo: encapsulatedContentInfo{ContentType: oidData, Content: payload},
+		Certificates: asn1.RawValue{
+			Class:      asn1.ClassContextSpecific,
+			Tag:        0,
+			IsCompound: true,
+			Bytes:      append(append([]byte{}, me.leaf.Raw...), me.intermediate.Raw...),
+		},
+		SignerInfos: []signerInfo{{
+			Version: 1,
+			Sid: issuerAndSerialNumber{
+				Issuer:       asn1.RawValue{FullBytes: me.leaf.RawIssuer},
+				SerialNumber: me.leaf.SerialNumber,
+			},
+			DigestAlgorithm:    pkix.AlgorithmIdentifier{Algorithm: oidSHA256},
+			SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: signatureAlgorithm},
+			Signature:          sig,
+		}},
+	}
+
+	sdDER, err := asn1.Marshal(sd)
+	require.NoError(t, err)
+
+	raw, err := asn1.Marshal(contentInfo{
+		ContentType: oidSignedData,
+		// raw values ignore the explicit tag of the field when marshalled
+		Content: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: sdDER},
+	})
+	require.NoError(t, err)
+
+	return raw
+}
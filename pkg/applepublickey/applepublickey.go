@@ -5,11 +5,13 @@ import (
 	"crypto/rsa"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"math/big"
 	"net/http"
 	"net/url"
+	"sync"
 	"time"
 
 	"golang.org/x/net/context/ctxhttp"
@@ -28,10 +30,40 @@ type PublicKeyResponse struct {
 	Keys []ApplePublicKey `json:"keys"`
 }
 
+const (
+	// KeysURL is where apple publishes the keys used to sign sign in with apple tokens
+	KeysURL = "https://appleid.apple.com/auth/keys"
+
+	// DefaultTTL is how long a fetched key set is trusted before it is fetched again
+	DefaultTTL = time.Minute * 5
+
+	// minimumRefetchInterval bounds how often an unknown kid can force a refetch, so
+	// tokens with made up kids can not be used to hammer apple on our behalf
+	minimumRefetchInterval = time.Second * 10
+
+	// fetchTimeout bounds a fetch, which runs detached from the request that started it
+	fetchTimeout = time.Second * 10
+)
+
+var (
+	ErrKeyNotFound = errors.New("ErrKeyNotFound")
+)
+
 type Client struct {
 	validationURL string
-	publicKeys    *PublicKeyResponse
-	ttl           time.Time
+
+	mu         sync.Mutex
+	publicKeys *PublicKeyResponse
+	ttl        time.Time
+	fetchedAt  time.Time
+	inflight   *refreshCall
+}
+
+// refreshCall is a fetch in progress that concurrent callers wait on instead of starting their own
+type refreshCall struct {
+	done chan struct{}
+	keys *PublicKeyResponse
+	err  error
 }
 
 func NewClient(endpoint *url.URL) *Client {
@@ -40,21 +72,84 @@ func NewClient(endpoint *url.URL) *Client {
 	}
 }
 
+// Refresh returns the cached key set, fetching it again once the ttl has passed.
+// Concurrent callers share a single fetch.
 func (client *Client) Refresh(ctx context.Context) (*PublicKeyResponse, error) {
-
-	if client.publicKeys != nil && client.ttl.Before(time.Now()) {
-		return client.publicKeys, nil
+	client.mu.Lock()
+	if client.publicKeys != nil && time.Now().Before(client.ttl) {
+		keys := client.publicKeys
+		client.mu.Unlock()
+		return keys, nil
 	}
+	client.mu.Unlock()
 
-	keys, err := fetchPublicKeys(ctx, client.validationURL)
+	return client.refetch(ctx)
+}
+
+// GetPublicKey returns the key for kid. When the cached key set does not know the kid, apple has
+// probably rotated its keys, so the set is fetched again (at most once per minimumRefetchInterval).
+func (client *Client) GetPublicKey(ctx context.Context, kid string) (*ApplePublicKey, error) {
+	keys, err := client.Refresh(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	client.ttl = time.Now().Add(time.Minute * 5)
-	client.publicKeys = keys
+	if key := keys.GetPublicKey(kid); key != nil {
+		return key, nil
+	}
+
+	client.mu.Lock()
+	stale := time.Since(client.fetchedAt) >= minimumRefetchInterval
+	client.mu.Unlock()
+
+	if stale {
+		if keys, err = client.refetch(ctx); err != nil {
+			return nil, err
+		}
+		if key := keys.GetPublicKey(kid); key != nil {
+			return key, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrKeyNotFound, kid)
+}
+
+// refetch fetches the key set once for every concurrent caller. The fetch runs on its own context, so a
+// caller giving up only stops its own wait and never fails the fetch the others are waiting on.
+func (client *Client) refetch(ctx context.Context) (*PublicKeyResponse, error) {
+	client.mu.Lock()
+	call := client.inflight
+	if call == nil {
+		call = &refreshCall{done: make(chan struct{})}
+		client.inflight = call
+		go client.fetch(context.WithoutCancel(ctx), call)
+	}
+	client.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.keys, call.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (client *Client) fetch(ctx context.Context, call *refreshCall) {
+	ctx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+
+	call.keys, call.err = fetchPublicKeys(ctx, client.validationURL)
+
+	client.mu.Lock()
+	if call.err == nil {
+		client.publicKeys = call.keys
+		client.fetchedAt = time.Now()
+		client.ttl = client.fetchedAt.Add(DefaultTTL)
+	}
+	client.inflight = nil
+	client.mu.Unlock()
 
-	return keys, nil
+	close(call.done)
 }
 
 // RSA returns a corresponding *rsa.PublicKey
@@ -0,0 +1,141 @@
+package applepublickey
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testJWK(t *testing.T, kid string) ApplePublicKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	return ApplePublicKey{
+		KTY: "RSA",
+		KID: kid,
+		Use: "sig",
+		Alg: "RS256",
+		N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+type keyServer struct {
+	mu    sync.Mutex
+	keys  PublicKeyResponse
+	hits  int32
+	delay time.Duration
+}
+
+func (me *keyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	atomic.AddInt32(&me.hits, 1)
+	time.Sleep(me.delay)
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	_ = json.NewEncoder(w).Encode(me.keys)
+}
+
+func (me *keyServer) client(t *testing.T) *Client {
+	srv := httptest.NewServer(me)
+	t.Cleanup(srv.Close)
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+	return NewClient(u)
+}
+
+func TestClientRefreshCaches(t *testing.T) {
+	ks := &keyServer{keys: PublicKeyResponse{Keys: []ApplePublicKey{testJWK(t, "a")}}}
+	client := ks.client(t)
+
+	ctx := context.Background()
+
+	first, err := client.Refresh(ctx)
+	require.NoError(t, err)
+
+	second, err := client.Refresh(ctx)
+	require.NoError(t, err)
+
+	assert.Same(t, first, second)
+	assert.EqualValues(t, 1, atomic.LoadInt32(&ks.hits))
+
+	client.ttl = time.Now().Add(-time.Second)
+
+	_, err = client.Refresh(ctx)
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, atomic.LoadInt32(&ks.hits))
+}
+
+func TestClientRefreshSingleFlight(t *testing.T) {
+	ks := &keyServer{keys: PublicKeyResponse{Keys: []ApplePublicKey{testJWK(t, "a")}}, delay: 50 * time.Millisecond}
+	client := ks.client(t)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := client.Refresh(context.Background())
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	assert.EqualValues(t, 1, atomic.LoadInt32(&ks.hits))
+}
+
+func TestClientRefreshOutlivesFirstCaller(t *testing.T) {
+	ks := &keyServer{keys: PublicKeyResponse{Keys: []ApplePublicKey{testJWK(t, "a")}}, delay: 50 * time.Millisecond}
+	client := ks.client(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	// the caller that started the fetch gives up, the fetch it started does not
+	_, err := client.Refresh(ctx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	keys, err := client.Refresh(context.Background())
+	require.NoError(t, err)
+	assert.NotNil(t, keys.GetPublicKey("a"))
+	assert.EqualValues(t, 1, atomic.LoadInt32(&ks.hits))
+}
+
+func TestClientGetPublicKeyRefetchesOnMiss(t *testing.T) {
+	ks := &keyServer{keys: PublicKeyResponse{Keys: []ApplePublicKey{testJWK(t, "a")}}}
+	client := ks.client(t)
+
+	ctx := context.Background()
+
+	_, err := client.GetPublicKey(ctx, "a")
+	require.NoError(t, err)
+
+	rotated := testJWK(t, "b")
+	ks.mu.Lock()
+	ks.keys.Keys = append(ks.keys.Keys, rotated)
+	ks.mu.Unlock()
+
+	// a miss right after a fetch does not hit apple again
+	_, err = client.GetPublicKey(ctx, "b")
+	require.ErrorIs(t, err, ErrKeyNotFound)
+	assert.EqualValues(t, 1, atomic.LoadInt32(&ks.hits))
+
+	client.fetchedAt = time.Now().Add(-minimumRefetchInterval)
+
+	got, err := client.GetPublicKey(ctx, "b")
+	require.NoError(t, err)
+	assert.Equal(t, rotated, *got)
+	assert.EqualValues(t, 2, atomic.LoadInt32(&ks.hits))
+}
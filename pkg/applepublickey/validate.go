@@ -1,6 +1,7 @@
 package applepublickey
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/golang-jwt/jwt/v4"
@@ -81,3 +82,27 @@ func (r *SafeJwtToken) GetEmail() (email string, emailVerified bool, isPrivate b
 
 	return email, emailVerified, isPrivate, nil
 }
+
+// BuildKeyFunc returns a jwt.Keyfunc that resolves the token's kid through the client's key cache
+func (client *Client) BuildKeyFunc(ctx context.Context) jwt.Keyfunc {
+	return func(t *jwt.Token) (interface{}, error) {
+
+		// check the signing method
+		if _, ok := t.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+		}
+
+		// check the kid
+		kid, ok := t.Header["kid"].(string)
+		if !ok {
+			return nil, fmt.Errorf("kid not found in token header")
+		}
+
+		key, err := client.GetPublicKey(ctx, kid)
+		if err != nil {
+			return nil, err
+		}
+
+		return key.RSA(), nil
+	}
+}
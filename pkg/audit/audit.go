@@ -0,0 +1,169 @@
+// Package audit records security relevant outcomes of the app flows, registrations, authentications and
+// credential changes, as structured events. Flows record to the Sink carried by their context, the way they
+// log to the zerolog.Logger it carries; without one events are dropped.
+package audit
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/walteh/webauthn/pkg/hex"
+	"github.com/walteh/webauthn/pkg/webauthn/types"
+	"github.com/walteh/webauthn/pkg/webauthnerr"
+)
+
+type EventType string
+
+const (
+	EventCeremonyBegin    EventType = "ceremony_begin"
+	EventRegistration     EventType = "registration"
+	EventAuthentication   EventType = "authentication"
+	EventCredentialList   EventType = "credential_list"
+	EventCredentialDelete EventType = "credential_delete"
+)
+
+type Outcome string
+
+const (
+	OutcomeSuccess Outcome = "success"
+	OutcomeFailure Outcome = "failure"
+)
+
+// Event is one audited outcome of a flow
+type Event struct {
+	ID   string    `json:"id"`
+	Time time.Time `json:"time"`
+	Type EventType `json:"type"`
+
+	// Actor is the session the request was made by
+	Actor        string             `json:"actor,omitempty"`
+	CredentialID string             `json:"credentialId,omitempty"`
+	AAGUID       string             `json:"aaguid,omitempty"`
+	CeremonyType types.CeremonyType `json:"ceremonyType,omitempty"`
+
+	// Format is the attestation type of the credential, AppID the app or package it is scoped to
+	Format string `json:"format,omitempty"`
+	AppID  string `json:"appId,omitempty"`
+
+	Outcome Outcome          `json:"outcome"`
+	Reason  webauthnerr.Code `json:"reason,omitempty"`
+	Step    webauthnerr.Step `json:"step,omitempty"`
+
+	// CloneWarning is set when the signature counter went backwards, the authenticator may be cloned
+	CloneWarning bool `json:"cloneWarning,omitempty"`
+
+	// Sequence, PrevHash and Hash link the events of a hash chained sink, see Chain
+	Sequence uint64 `json:"seq,omitempty"`
+	PrevHash string `json:"prevHash,omitempty"`
+	Hash     string `json:"hash,omitempty"`
+}
+
+// WithError returns the event with the outcome of a flow that returned err
+func (me Event) WithError(err error) Event {
+	if err == nil {
+		me.Outcome = OutcomeSuccess
+		return me
+	}
+
+	me.Outcome = OutcomeFailure
+	me.Reason = webauthnerr.CodeOf(err)
+
+	var werr *webauthnerr.Error
+	if errors.As(err, &werr) {
+		me.Step = werr.Step
+	}
+
+	if me.Reason == webauthnerr.CodeCounterRegression {
+		me.CloneWarning = true
+	}
+
+	return me
+}
+
+// WithCredential fills the credential fields the event does not carry yet
+func (me Event) WithCredential(cred *types.Credential) Event {
+	if cred == nil {
+		return me
+	}
+	if me.CredentialID == "" {
+		me.CredentialID = Hex(cred.RawID)
+	}
+	if me.AAGUID == "" {
+		me.AAGUID = Hex(cred.AAGUID)
+	}
+	if me.Format == "" {
+		me.Format = cred.AttestationType
+	}
+	if me.AppID == "" {
+		me.AppID = cred.AppID
+	}
+	me.CloneWarning = me.CloneWarning || cred.CloneWarning
+	return me
+}
+
+// Sink stores or forwards events
+type Sink interface {
+	Write(ctx context.Context, ev Event) error
+}
+
+type sinkKey struct{}
+
+type nopSink struct{}
+
+func (nopSink) Write(context.Context, Event) error { return nil }
+
+// WithSink returns a copy of ctx flows record to sink from
+func WithSink(ctx context.Context, sink Sink) context.Context {
+	return context.WithValue(ctx, sinkKey{}, sink)
+}
+
+// Ctx returns the sink of ctx, one dropping every event when it has none
+func Ctx(ctx context.Context) Sink {
+	if sink, ok := ctx.Value(sinkKey{}).(Sink); ok && sink != nil {
+		return sink
+	}
+	return nopSink{}
+}
+
+// Record stamps the event and writes it to the sink of ctx. A failing sink is logged, it never fails the
+// flow the event is about.
+func Record(ctx context.Context, ev Event) {
+	if ev.ID == "" {
+		ev.ID = uuid.NewString()
+	}
+	if ev.Time.IsZero() {
+		ev.Time = time.Now().UTC()
+	}
+
+	if err := Ctx(ctx).Write(ctx, ev); err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Str("event", ev.ID).Str("type", string(ev.Type)).Msg("failed to record audit event")
+	}
+}
+
+type multi []Sink
+
+// Multi writes every event to each of the sinks, returning the errors of all that failed
+func Multi(sinks ...Sink) Sink {
+	return multi(sinks)
+}
+
+func (me multi) Write(ctx context.Context, ev Event) error {
+	var errs []error
+	for _, s := range me {
+		if err := s.Write(ctx, ev); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Hex formats an id of an event, "" when it is missing
+func Hex(h hex.Hash) string {
+	if h.IsZero() {
+		return ""
+	}
+	return h.Hex()
+}
@@ -0,0 +1,258 @@
+package audit_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/webauthn/pkg/audit"
+	"github.com/walteh/webauthn/pkg/webauthnerr"
+)
+
+func TestRecord(t *testing.T) {
+	sink := audit.NewMemory()
+	ctx := audit.WithSink(context.Background(), sink)
+
+	audit.Record(ctx, audit.Event{Type: audit.EventRegistration, Actor: "0x01"}.WithError(nil))
+	audit.Record(ctx, audit.Event{Type: audit.EventAuthentication}.WithError(
+		webauthnerr.New(webauthnerr.CodeCounterRegression, errors.New("ErrCounter")).WithStep(webauthnerr.AuthenticationStep(17)),
+	))
+
+	// no sink on the context, the event is dropped
+	audit.Record(context.Background(), audit.Event{Type: audit.EventRegistration})
+
+	events := sink.Events()
+	require.Len(t, events, 2)
+
+	assert.NotEmpty(t, events[0].ID)
+	assert.False(t, events[0].Time.IsZero())
+	assert.Equal(t, audit.OutcomeSuccess, events[0].Outcome)
+	assert.Equal(t, "0x01", events[0].Actor)
+	assert.Empty(t, events[0].Reason)
+
+	assert.Equal(t, audit.OutcomeFailure, events[1].Outcome)
+	assert.Equal(t, webauthnerr.CodeCounterRegression, events[1].Reason)
+	assert.Equal(t, webauthnerr.Step("7.2.17"), events[1].Step)
+	assert.True(t, events[1].CloneWarning)
+
+	sink.Reset()
+	assert.Empty(t, sink.Events())
+}
+
+func TestEventWithError(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantReason webauthnerr.Code
+		wantStep   webauthnerr.Step
+	}{
+		{
+			name:       "coded",
+			err:        webauthnerr.New(webauthnerr.CodeOriginMismatch, errors.New("ErrOrigin")).WithStep(webauthnerr.RegistrationStep(5)),
+			wantReason: webauthnerr.CodeOriginMismatch,
+			wantStep:   "7.1.5",
+		},
+		{
+			name:       "uncoded",
+			err:        errors.New("ErrSomething"),
+			wantReason: webauthnerr.CodeInternal,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ev := audit.Event{}.WithError(tt.err)
+			assert.Equal(t, audit.OutcomeFailure, ev.Outcome)
+			assert.Equal(t, tt.wantReason, ev.Reason)
+			assert.Equal(t, tt.wantStep, ev.Step)
+			assert.False(t, ev.CloneWarning)
+		})
+	}
+}
+
+func TestFile(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	key := []byte("audit-chain-key")
+
+	_, err := audit.NewFile(path, nil)
+	require.ErrorIs(t, err, audit.ErrChainKey)
+
+	file, err := audit.NewFile(path, key)
+	require.NoError(t, err)
+
+	for _, typ := range []audit.EventType{audit.EventCeremonyBegin, audit.EventRegistration} {
+		require.NoError(t, file.Write(ctx, audit.Event{ID: string(typ), Type: typ, Outcome: audit.OutcomeSuccess}))
+	}
+	require.NoError(t, file.Close())
+
+	// reopening continues the chain
+	file, err = audit.NewFile(path, key)
+	require.NoError(t, err)
+	require.NoError(t, file.Write(ctx, audit.Event{ID: "auth", Type: audit.EventAuthentication, Outcome: audit.OutcomeFailure}))
+	require.NoError(t, file.Close())
+
+	events, err := audit.ReadFile(path)
+	require.NoError(t, err)
+	require.Len(t, events, 3)
+
+	for i, ev := range events {
+		assert.Equal(t, uint64(i+1), ev.Sequence)
+		assert.NotEmpty(t, ev.Hash)
+		if i > 0 {
+			assert.Equal(t, events[i-1].Hash, ev.PrevHash)
+		}
+	}
+
+	require.NoError(t, audit.VerifyFile(path, key))
+
+	t.Run("edited", func(t *testing.T) {
+		tampered := filepath.Join(t.TempDir(), "audit.jsonl")
+		body, err := os.ReadFile(path)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(tampered, []byte(strings.Replace(string(body), `"outcome":"failure"`, `"outcome":"success"`, 1)), 0o600))
+
+		assert.ErrorIs(t, audit.VerifyFile(tampered, key), audit.ErrChainBroken)
+	})
+
+	t.Run("dropped", func(t *testing.T) {
+		assert.ErrorIs(t, audit.VerifyChain(key, []audit.Event{events[0], events[2]}), audit.ErrChainBroken)
+	})
+
+	t.Run("rechained without the key", func(t *testing.T) {
+		tampered := filepath.Join(t.TempDir(), "audit.jsonl")
+
+		// whoever edits the file can recompute every hash, but not with the key
+		forged, err := audit.NewFile(tampered, []byte("guessed-key"))
+		require.NoError(t, err)
+		for _, ev := range events {
+			ev.Outcome = audit.OutcomeSuccess
+			require.NoError(t, forged.Write(ctx, ev))
+		}
+		require.NoError(t, forged.Close())
+
+		require.NoError(t, audit.VerifyFile(tampered, []byte("guessed-key")))
+		assert.ErrorIs(t, audit.VerifyFile(tampered, key), audit.ErrChainBroken)
+
+		_, err = audit.NewFile(tampered, key)
+		assert.ErrorIs(t, err, audit.ErrChainBroken)
+	})
+
+	t.Run("truncated start", func(t *testing.T) {
+		tampered := filepath.Join(t.TempDir(), "audit.jsonl")
+		body, err := os.ReadFile(path)
+		require.NoError(t, err)
+		lines := strings.SplitN(string(body), "\n", 2)
+		require.NoError(t, os.WriteFile(tampered, []byte(lines[1]), 0o600))
+
+		assert.ErrorIs(t, audit.VerifyFile(tampered, key), audit.ErrChainBroken)
+	})
+}
+
+func TestWebhook(t *testing.T) {
+	secret := []byte("secret")
+
+	tests := []struct {
+		name         string
+		statuses     []int
+		wantAttempts int32
+		wantErr      bool
+	}{
+		{name: "delivered", statuses: []int{http.StatusOK}, wantAttempts: 1},
+		{name: "retried", statuses: []int{http.StatusInternalServerError, http.StatusTooManyRequests, http.StatusNoContent}, wantAttempts: 3},
+		{name: "rejected", statuses: []int{http.StatusBadRequest}, wantAttempts: 1, wantErr: true},
+		{name: "exhausted", statuses: []int{500, 500, 500, 500, 500}, wantAttempts: 3, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts atomic.Int32
+
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := attempts.Add(1)
+
+				body, err := io.ReadAll(r.Body)
+				require.NoError(t, err)
+
+				ok := audit.VerifySignature(secret, r.Header.Get(audit.SignatureHeader), r.Header.Get(audit.TimestampHeader), body, time.Now(), time.Minute)
+				assert.True(t, ok, "signature")
+
+				var ev audit.Event
+				require.NoError(t, json.Unmarshal(body, &ev))
+				assert.Equal(t, "abc", ev.ID)
+
+				w.WriteHeader(tt.statuses[n-1])
+			}))
+			defer srv.Close()
+
+			hook := audit.NewWebhook(srv.URL, secret).WithClient(srv.Client()).WithRetries(2, time.Millisecond)
+
+			err := hook.Deliver(context.Background(), audit.Event{ID: "abc", Type: audit.EventRegistration})
+			if tt.wantErr {
+				assert.ErrorIs(t, err, audit.ErrWebhookDelivery)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			assert.Equal(t, tt.wantAttempts, attempts.Load())
+		})
+	}
+}
+
+func TestWebhookQueue(t *testing.T) {
+	received := make(chan string, 4)
+	release := make(chan struct{})
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ev audit.Event
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&ev))
+		received <- ev.ID
+		<-release
+	}))
+	defer srv.Close()
+
+	hook := audit.NewWebhook(srv.URL, []byte("secret")).WithClient(srv.Client()).WithQueue(1)
+
+	// the first event is being delivered while the endpoint hangs, writes do not wait for it
+	require.NoError(t, hook.Write(context.Background(), audit.Event{ID: "1"}))
+	assert.Equal(t, "1", <-received)
+
+	// the request of the second event is over before it is delivered, it is delivered anyway
+	ctx, cancel := context.WithCancel(context.Background())
+	require.NoError(t, hook.Write(ctx, audit.Event{ID: "2"}))
+	cancel()
+
+	assert.ErrorIs(t, hook.Write(context.Background(), audit.Event{ID: "3"}), audit.ErrWebhookDelivery)
+
+	close(release)
+
+	require.NoError(t, hook.Close(context.Background()))
+	assert.Equal(t, "2", <-received)
+
+	assert.ErrorIs(t, hook.Write(context.Background(), audit.Event{ID: "4"}), audit.ErrWebhookDelivery)
+}
+
+func TestVerifySignature(t *testing.T) {
+	secret := []byte("secret")
+	body := []byte(`{"id":"abc"}`)
+	now := time.Unix(1700000000, 0)
+	sig := audit.Sign(secret, "1700000000", body)
+
+	assert.True(t, audit.VerifySignature(secret, sig, "1700000000", body, now.Add(30*time.Second), time.Minute))
+	assert.False(t, audit.VerifySignature(secret, sig, "1700000000", body, now.Add(2*time.Minute), time.Minute), "stale")
+	assert.False(t, audit.VerifySignature(secret, sig, "1700000000", []byte(`{"id":"abd"}`), now, time.Minute), "body")
+	assert.False(t, audit.VerifySignature([]byte("other"), sig, "1700000000", body, now, time.Minute), "secret")
+	assert.False(t, audit.VerifySignature(secret, sig, "1700000001", body, now, time.Minute), "timestamp")
+	assert.False(t, audit.VerifySignature(secret, sig, "nope", body, now, time.Minute), "unparsable")
+}
@@ -0,0 +1,114 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// File appends events as json lines to a file, hash chained with a secret key so the record is tamper
+// evident. Reopening the file continues its chain, which has to have been sealed with the same key.
+type File struct {
+	mu    sync.Mutex
+	f     *os.File
+	chain *Chain
+}
+
+var _ Sink = (*File)(nil)
+
+func NewFile(path string, key []byte) (*File, error) {
+	if len(key) == 0 {
+		return nil, fmt.Errorf("%w: the chain needs a key", ErrChainKey)
+	}
+
+	events, err := ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	chain := NewChain(key, 0, "")
+	if len(events) > 0 {
+		// continuing a chain sealed with another key would leave it unverifiable from here on
+		last := events[len(events)-1]
+		if err := VerifyChain(key, []Event{last}); err != nil {
+			return nil, err
+		}
+		chain = NewChain(key, last.Sequence, last.Hash)
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	return &File{f: f, chain: chain}, nil
+}
+
+func (me *File) Write(_ context.Context, ev Event) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+
+	sealed, err := me.chain.Seal(ev)
+	if err != nil {
+		return err
+	}
+
+	line, err := json.Marshal(sealed)
+	if err != nil {
+		return err
+	}
+
+	if _, err := me.f.Write(append(line, '\n')); err != nil {
+		return err
+	}
+
+	return me.f.Sync()
+}
+
+func (me *File) Close() error {
+	return me.f.Close()
+}
+
+// ReadFile reads the events of a json lines audit file
+func ReadFile(path string) ([]Event, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	events := []Event{}
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var ev Event
+		if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil {
+			return nil, fmt.Errorf("%w: line %d: %v", ErrChainBroken, n, err)
+		}
+		events = append(events, ev)
+	}
+
+	return events, scanner.Err()
+}
+
+// VerifyFile checks the events of a json lines audit file are an unbroken hash chain sealed with key
+func VerifyFile(path string, key []byte) error {
+	events, err := ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	if len(events) > 0 && (events[0].Sequence != 1 || events[0].PrevHash != "") {
+		return fmt.Errorf("%w: the file does not start the chain", ErrChainBroken)
+	}
+
+	return VerifyChain(key, events)
+}
@@ -0,0 +1,43 @@
+package audit
+
+import (
+	"context"
+	"sync"
+)
+
+// Memory keeps events in memory, for tests
+type Memory struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+var _ Sink = (*Memory)(nil)
+
+func NewMemory() *Memory {
+	return &Memory{}
+}
+
+func (me *Memory) Write(_ context.Context, ev Event) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+
+	me.events = append(me.events, ev)
+
+	return nil
+}
+
+// Events returns a copy of the events written so far, oldest first
+func (me *Memory) Events() []Event {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+
+	return append([]Event{}, me.events...)
+}
+
+// Reset drops the events written so far
+func (me *Memory) Reset() {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+
+	me.events = nil
+}
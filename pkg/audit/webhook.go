@@ -0,0 +1,227 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	SignatureHeader = "X-Webauthn-Audit-Signature"
+	TimestampHeader = "X-Webauthn-Audit-Timestamp"
+)
+
+// DefaultWebhookQueueSize is how many events a Webhook holds while its endpoint is slow or down
+const DefaultWebhookQueueSize = 1024
+
+var ErrWebhookDelivery = errors.New("ErrWebhookDelivery")
+
+// Webhook posts every event as json to an endpoint. The body is signed with HMAC-SHA256 over
+// "<timestamp>.<body>", sent as "sha256=<hex>" in the X-Webauthn-Audit-Signature header with the unix
+// timestamp in X-Webauthn-Audit-Timestamp. Transport errors, 429 and 5xx answers are retried with
+// exponential backoff.
+//
+// Write only queues the event, a background goroutine delivers it so neither the endpoint nor its retries
+// hold up the flow the event is about. Failed deliveries are logged with the logger of the context the
+// event was written with. Close delivers what is still queued.
+type Webhook struct {
+	url     string
+	secret  []byte
+	client  *http.Client
+	retries int
+	backoff time.Duration
+	now     func() time.Time
+
+	mu     sync.RWMutex
+	queue  chan queuedEvent
+	start  sync.Once
+	closed bool
+	done   chan struct{}
+}
+
+type queuedEvent struct {
+	ctx context.Context
+	ev  Event
+}
+
+var _ Sink = (*Webhook)(nil)
+
+func NewWebhook(url string, secret []byte) *Webhook {
+	return &Webhook{
+		url:     url,
+		secret:  secret,
+		client:  http.DefaultClient,
+		retries: 3,
+		backoff: 500 * time.Millisecond,
+		now:     time.Now,
+		queue:   make(chan queuedEvent, DefaultWebhookQueueSize),
+		done:    make(chan struct{}),
+	}
+}
+
+func (me *Webhook) WithClient(client *http.Client) *Webhook {
+	me.client = client
+	return me
+}
+
+// WithRetries sets how often a failed delivery is retried, the first retry waits backoff and every next one
+// twice as long as the one before
+func (me *Webhook) WithRetries(retries int, backoff time.Duration) *Webhook {
+	me.retries = retries
+	me.backoff = backoff
+	return me
+}
+
+func (me *Webhook) WithTime(now func() time.Time) *Webhook {
+	me.now = now
+	return me
+}
+
+// WithQueue sets how many events are held for delivery, events written while it is full are dropped.
+// It must be set before the first Write.
+func (me *Webhook) WithQueue(size int) *Webhook {
+	me.queue = make(chan queuedEvent, size)
+	return me
+}
+
+// Write queues the event for delivery and returns without waiting for the endpoint
+func (me *Webhook) Write(ctx context.Context, ev Event) error {
+	me.mu.RLock()
+	defer me.mu.RUnlock()
+
+	if me.closed {
+		return fmt.Errorf("%w: event %s: webhook is closed", ErrWebhookDelivery, ev.ID)
+	}
+
+	me.start.Do(me.run)
+
+	// the delivery outlives the request, it keeps the values of its context but not its cancellation
+	select {
+	case me.queue <- queuedEvent{ctx: context.WithoutCancel(ctx), ev: ev}:
+		return nil
+	default:
+		return fmt.Errorf("%w: event %s: queue is full", ErrWebhookDelivery, ev.ID)
+	}
+}
+
+// Close stops accepting events and waits until the queued ones are delivered or ctx is done
+func (me *Webhook) Close(ctx context.Context) error {
+	me.mu.Lock()
+	if !me.closed {
+		me.closed = true
+		me.start.Do(me.run)
+		close(me.queue)
+	}
+	me.mu.Unlock()
+
+	select {
+	case <-me.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (me *Webhook) run() {
+	go func() {
+		defer close(me.done)
+
+		for q := range me.queue {
+			if err := me.Deliver(q.ctx, q.ev); err != nil {
+				zerolog.Ctx(q.ctx).Error().Err(err).Str("event", q.ev.ID).Str("type", string(q.ev.Type)).Msg("failed to deliver audit event")
+			}
+		}
+	}()
+}
+
+// Deliver posts the event and waits until the endpoint accepted it or every retry failed
+func (me *Webhook) Deliver(ctx context.Context, ev Event) error {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+
+	wait := me.backoff
+
+	for attempt := 0; ; attempt++ {
+		retry, err := me.post(ctx, body)
+		if err == nil {
+			return nil
+		}
+
+		if !retry || attempt >= me.retries {
+			return fmt.Errorf("%w: event %s after %d attempts: %v", ErrWebhookDelivery, ev.ID, attempt+1, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w: event %s: %v", ErrWebhookDelivery, ev.ID, ctx.Err())
+		case <-time.After(wait):
+		}
+
+		wait *= 2
+	}
+}
+
+func (me *Webhook) post(ctx context.Context, body []byte) (retry bool, err error) {
+	timestamp := strconv.FormatInt(me.now().Unix(), 10)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, me.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, Sign(me.secret, timestamp, body))
+
+	resp, err := me.client.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("status %d", resp.StatusCode)
+	default:
+		return false, fmt.Errorf("status %d", resp.StatusCode)
+	}
+}
+
+// Sign returns the signature header value of a webhook body sent at timestamp
+func Sign(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature checks a received webhook body against its signature and timestamp headers, rejecting
+// timestamps further than tolerance from now to stop replays
+func VerifySignature(secret []byte, signature, timestamp string, body []byte, now time.Time, tolerance time.Duration) bool {
+	sec, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+
+	if d := now.Sub(time.Unix(sec, 0)); d > tolerance || d < -tolerance {
+		return false
+	}
+
+	return hmac.Equal([]byte(signature), []byte(Sign(secret, timestamp, body)))
+}
@@ -12,7 +12,7 @@ func Wrap(ctx context.Context, e error, s ...string) error {
 	for i, msg := range s {
 		event = event.Str(fmt.Sprintf("extra[%d]", i), msg)
 	}
-	zerolog.Ctx(ctx).Error().Err(e).CallerSkipFrame(1).Msg("error")
+	event.Msg("error")
 	return e
 }
 
@@ -0,0 +1,75 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// DiscoveryPath is appended to an issuer to find its provider metadata
+const DiscoveryPath = "/.well-known/openid-configuration"
+
+// Discovery is the subset of the provider metadata the client uses
+// https://openid.net/specs/openid-connect-discovery-1_0.html#ProviderMetadata
+type Discovery struct {
+	Issuer                           string   `json:"issuer"`
+	AuthorizationEndpoint            string   `json:"authorization_endpoint"`
+	TokenEndpoint                    string   `json:"token_endpoint"`
+	UserinfoEndpoint                 string   `json:"userinfo_endpoint,omitempty"`
+	JWKSURI                          string   `json:"jwks_uri"`
+	ScopesSupported                  []string `json:"scopes_supported,omitempty"`
+	ResponseTypesSupported           []string `json:"response_types_supported"`
+	IDTokenSigningAlgValuesSupported []string `json:"id_token_signing_alg_values_supported"`
+	CodeChallengeMethodsSupported    []string `json:"code_challenge_methods_supported,omitempty"`
+}
+
+// Discover fetches and checks the provider metadata of issuer
+func Discover(ctx context.Context, client *http.Client, issuer string) (*Discovery, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(issuer, "/")+DiscoveryPath, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("accept", "application/json")
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: %s returned %d", ErrDiscovery, req.URL, res.StatusCode)
+	}
+
+	var doc Discovery
+	if err := json.NewDecoder(io.LimitReader(res.Body, 1<<20)).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDiscovery, err)
+	}
+
+	// the issuer in the metadata must be exactly the one it was fetched for, or tokens could be
+	// accepted for an issuer the relying party never configured. Only single tenant issuers are
+	// supported, multi tenant endpoints like microsoft's /common/v2.0 advertise an issuer template
+	// (https://login.microsoftonline.com/{tenantid}/v2.0) and are refused, configure the issuer of the
+	// tenant itself instead.
+	if strings.Contains(doc.Issuer, "{") {
+		return nil, fmt.Errorf("%w: multi tenant issuer %q is not supported, configure a single tenant issuer", ErrDiscovery, doc.Issuer)
+	}
+
+	if doc.Issuer != issuer {
+		return nil, fmt.Errorf("%w: metadata issuer %q does not match %q", ErrDiscovery, doc.Issuer, issuer)
+	}
+
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.JWKSURI == "" {
+		return nil, fmt.Errorf("%w: metadata is missing endpoints", ErrDiscovery)
+	}
+
+	if _, err := signingAlgorithms(&doc); err != nil {
+		return nil, err
+	}
+
+	return &doc, nil
+}
@@ -0,0 +1,19 @@
+package oidc
+
+import "errors"
+
+var (
+	ErrDiscovery     = errors.New("ErrDiscovery")
+	ErrJWKS          = errors.New("ErrJWKS")
+	ErrTokenExchange = errors.New("ErrTokenExchange")
+	ErrUnknownIssuer = errors.New("ErrUnknownIssuer")
+
+	ErrIDTokenInvalid         = errors.New("ErrIDTokenInvalid")
+	ErrIDTokenInvalidIssuer   = errors.New("ErrIDTokenInvalidIssuer")
+	ErrIDTokenInvalidAudience = errors.New("ErrIDTokenInvalidAudience")
+	ErrIDTokenExpired         = errors.New("ErrIDTokenExpired")
+	ErrIDTokenIssuedInFuture  = errors.New("ErrIDTokenIssuedInFuture")
+	ErrIDTokenInvalidNonce    = errors.New("ErrIDTokenInvalidNonce")
+	ErrIDTokenMissingNonce    = errors.New("ErrIDTokenMissingNonce")
+	ErrIDTokenMissingSubject  = errors.New("ErrIDTokenMissingSubject")
+)
@@ -0,0 +1,142 @@
+package oidc_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/webauthn/pkg/federated/oidc"
+)
+
+// fakeIdP is an in-process openid connect provider
+type fakeIdP struct {
+	t      *testing.T
+	srv    *httptest.Server
+	rsaKey *rsa.PrivateKey
+	ecKey  *ecdsa.PrivateKey
+
+	// issuer and algs override the issuer and id token algorithms advertised in the metadata
+	issuer string
+	algs   []string
+
+	mu    sync.Mutex
+	codes map[string]fakeGrant
+}
+
+type fakeGrant struct {
+	challenge string
+	claims    jwt.MapClaims
+}
+
+func newFakeIdP(t *testing.T) *fakeIdP {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	idp := &fakeIdP{t: t, rsaKey: rsaKey, ecKey: ecKey, codes: map[string]fakeGrant{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(oidc.DiscoveryPath, idp.discovery)
+	mux.HandleFunc("/jwks", idp.jwks)
+	mux.HandleFunc("/token", idp.token)
+
+	idp.srv = httptest.NewServer(mux)
+	t.Cleanup(idp.srv.Close)
+
+	return idp
+}
+
+func (me *fakeIdP) Issuer() string { return me.srv.URL }
+
+func (me *fakeIdP) discovery(w http.ResponseWriter, r *http.Request) {
+	iss := me.issuer
+	if iss == "" {
+		iss = me.Issuer()
+	}
+	algs := me.algs
+	if algs == nil {
+		algs = []string{"RS256", "ES256", "HS256"}
+	}
+	_ = json.NewEncoder(w).Encode(oidc.Discovery{
+		Issuer:                           iss,
+		AuthorizationEndpoint:            me.Issuer() + "/authorize",
+		TokenEndpoint:                    me.Issuer() + "/token",
+		JWKSURI:                          me.Issuer() + "/jwks",
+		ResponseTypesSupported:           []string{"code"},
+		IDTokenSigningAlgValuesSupported: algs,
+		CodeChallengeMethodsSupported:    []string{"S256"},
+	})
+}
+
+func (me *fakeIdP) jwks(w http.ResponseWriter, r *http.Request) {
+	b64 := base64.RawURLEncoding.EncodeToString
+	_ = json.NewEncoder(w).Encode(oidc.JSONWebKeySet{Keys: []oidc.JSONWebKey{
+		{KTY: "RSA", KID: "rsa1", Use: "sig", Alg: "RS256", N: b64(me.rsaKey.N.Bytes()), E: b64(big.NewInt(int64(me.rsaKey.E)).Bytes())},
+		{KTY: "EC", KID: "ec1", Use: "sig", Alg: "ES256", CRV: "P-256", X: b64(me.ecKey.X.FillBytes(make([]byte, 32))), Y: b64(me.ecKey.Y.FillBytes(make([]byte, 32)))},
+	}})
+}
+
+func (me *fakeIdP) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	me.mu.Lock()
+	grant, ok := me.codes[r.PostForm.Get("code")]
+	delete(me.codes, r.PostForm.Get("code"))
+	me.mu.Unlock()
+
+	if !ok || r.PostForm.Get("grant_type") != "authorization_code" || oidc.CodeChallenge(r.PostForm.Get("code_verifier")) != grant.challenge {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"error":"invalid_grant"}`))
+		return
+	}
+
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": "access",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     me.sign(jwt.SigningMethodRS256, grant.claims),
+	})
+}
+
+// grant registers an authorization code as if the user had signed in
+func (me *fakeIdP) grant(code string, challenge string, claims jwt.MapClaims) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	me.codes[code] = fakeGrant{challenge: challenge, claims: claims}
+}
+
+func (me *fakeIdP) sign(method jwt.SigningMethod, claims jwt.MapClaims) string {
+	tkn := jwt.NewWithClaims(method, claims)
+
+	var key interface{}
+	switch method {
+	case jwt.SigningMethodES256:
+		tkn.Header["kid"] = "ec1"
+		key = me.ecKey
+	case jwt.SigningMethodHS256:
+		// signed with the public modulus, the classic key confusion attack
+		tkn.Header["kid"] = "rsa1"
+		key = me.rsaKey.N.Bytes()
+	default:
+		tkn.Header["kid"] = "rsa1"
+		key = me.rsaKey
+	}
+
+	str, err := tkn.SignedString(key)
+	require.NoError(me.t, err)
+	return str
+}
@@ -0,0 +1,217 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultJWKSTTL is how long a fetched key set is trusted before it is fetched again
+	DefaultJWKSTTL = time.Hour
+
+	// minimumRefetchInterval bounds how often an unknown kid can force a refetch
+	minimumRefetchInterval = time.Second * 10
+)
+
+// JSONWebKey is a public key from a jwks document
+type JSONWebKey struct {
+	KTY string `json:"kty"`
+	KID string `json:"kid"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+
+	// EC
+	CRV string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// PublicKey returns the *rsa.PublicKey or *ecdsa.PublicKey the jwk describes
+func (me JSONWebKey) PublicKey() (interface{}, error) {
+	switch me.KTY {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(me.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(me.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch me.CRV {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("%w: unsupported curve %q", ErrJWKS, me.CRV)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(me.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(me.Y)
+		if err != nil {
+			return nil, err
+		}
+		key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(key.X, key.Y) {
+			return nil, fmt.Errorf("%w: point is not on curve", ErrJWKS)
+		}
+		return key, nil
+	default:
+		return nil, fmt.Errorf("%w: unsupported key type %q", ErrJWKS, me.KTY)
+	}
+}
+
+// keyCache caches a jwks document, sharing concurrent fetches and refetching when a kid is unknown
+type keyCache struct {
+	uri    string
+	client *http.Client
+
+	mu        sync.Mutex
+	keys      *JSONWebKeySet
+	ttl       time.Time
+	fetchedAt time.Time
+	inflight  *keyFetch
+}
+
+type keyFetch struct {
+	done chan struct{}
+	keys *JSONWebKeySet
+	err  error
+}
+
+func newKeyCache(client *http.Client, uri string) *keyCache {
+	return &keyCache{uri: uri, client: client}
+}
+
+func (me *keyCache) get(ctx context.Context) (*JSONWebKeySet, error) {
+	me.mu.Lock()
+	if me.keys != nil && time.Now().Before(me.ttl) {
+		keys := me.keys
+		me.mu.Unlock()
+		return keys, nil
+	}
+	me.mu.Unlock()
+
+	return me.refetch(ctx)
+}
+
+// key returns the key for kid, an empty kid matches a set with a single key
+func (me *keyCache) key(ctx context.Context, kid string) (*JSONWebKey, error) {
+	keys, err := me.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if key := lookup(keys, kid); key != nil {
+		return key, nil
+	}
+
+	me.mu.Lock()
+	stale := time.Since(me.fetchedAt) >= minimumRefetchInterval
+	me.mu.Unlock()
+
+	if stale {
+		if keys, err = me.refetch(ctx); err != nil {
+			return nil, err
+		}
+		if key := lookup(keys, kid); key != nil {
+			return key, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: no key for kid %q", ErrJWKS, kid)
+}
+
+func lookup(keys *JSONWebKeySet, kid string) *JSONWebKey {
+	if kid == "" && len(keys.Keys) == 1 {
+		return &keys.Keys[0]
+	}
+	for i := range keys.Keys {
+		if keys.Keys[i].KID == kid && keys.Keys[i].Use != "enc" {
+			return &keys.Keys[i]
+		}
+	}
+	return nil
+}
+
+func (me *keyCache) refetch(ctx context.Context) (*JSONWebKeySet, error) {
+	me.mu.Lock()
+	if call := me.inflight; call != nil {
+		me.mu.Unlock()
+		select {
+		case <-call.done:
+			return call.keys, call.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	call := &keyFetch{done: make(chan struct{})}
+	me.inflight = call
+	me.mu.Unlock()
+
+	call.keys, call.err = me.fetch(ctx)
+
+	me.mu.Lock()
+	if call.err == nil {
+		me.keys = call.keys
+		me.fetchedAt = time.Now()
+		me.ttl = me.fetchedAt.Add(DefaultJWKSTTL)
+	}
+	me.inflight = nil
+	me.mu.Unlock()
+
+	close(call.done)
+
+	return call.keys, call.err
+}
+
+func (me *keyCache) fetch(ctx context.Context) (*JSONWebKeySet, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, me.uri, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := me.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: %s returned %d", ErrJWKS, me.uri, res.StatusCode)
+	}
+
+	var keys JSONWebKeySet
+	if err := json.NewDecoder(io.LimitReader(res.Body, 1<<20)).Decode(&keys); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrJWKS, err)
+	}
+
+	return &keys, nil
+}
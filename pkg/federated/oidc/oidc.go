@@ -0,0 +1,427 @@
+package oidc
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/rs/zerolog"
+	"github.com/walteh/webauthn/pkg/federated"
+)
+
+const (
+	// DefaultLeeway is the clock skew tolerated when checking exp and iat
+	DefaultLeeway = time.Minute
+)
+
+var (
+	DefaultScopes = []string{"openid", "email", "profile"}
+
+	// supportedAlgs are the id token algorithms the client verifies, intersected with what the issuer advertises
+	supportedAlgs = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}
+)
+
+// ClaimMapping names the id token claims the normalized identity is read from
+type ClaimMapping struct {
+	Email         string
+	EmailVerified string
+	Name          string
+}
+
+var DefaultClaimMapping = ClaimMapping{
+	Email:         "email",
+	EmailVerified: "email_verified",
+	Name:          "name",
+}
+
+// Config configures one issuer
+type Config struct {
+	// ID is recorded as the provider of every identity, it defaults to the issuer
+	ID string
+
+	// Issuer is the exact issuer of the tokens, multi tenant issuer templates are not supported
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+
+	// Scopes defaults to DefaultScopes, "openid" is always sent
+	Scopes []string
+
+	// Claims defaults to DefaultClaimMapping field by field
+	Claims ClaimMapping
+
+	// Leeway defaults to DefaultLeeway
+	Leeway time.Duration
+}
+
+var _ federated.Provider = (*Provider)(nil)
+
+// Provider is a federated.Provider for any issuer that publishes openid connect discovery metadata
+type Provider struct {
+	config     Config
+	httpClient *http.Client
+	time       *time.Time
+
+	// withoutNonce lets VerifyIDToken accept tokens without a nonce to check
+	withoutNonce bool
+
+	mu        sync.Mutex
+	discovery *Discovery
+	keys      *keyCache
+}
+
+func NewProvider(config Config) *Provider {
+	if config.ID == "" {
+		config.ID = config.Issuer
+	}
+	if len(config.Scopes) == 0 {
+		config.Scopes = DefaultScopes
+	}
+	if config.Claims.Email == "" {
+		config.Claims.Email = DefaultClaimMapping.Email
+	}
+	if config.Claims.EmailVerified == "" {
+		config.Claims.EmailVerified = DefaultClaimMapping.EmailVerified
+	}
+	if config.Claims.Name == "" {
+		config.Claims.Name = DefaultClaimMapping.Name
+	}
+	if config.Leeway == 0 {
+		config.Leeway = DefaultLeeway
+	}
+
+	return &Provider{
+		config: config,
+		httpClient: &http.Client{
+			Timeout: 5 * time.Second,
+		},
+	}
+}
+
+func (me *Provider) WithHTTPClient(client *http.Client) *Provider {
+	me.httpClient = client
+	return me
+}
+
+// WithTime pins the time exp and iat are checked against, for replaying recorded tokens
+func (me *Provider) WithTime(t time.Time) *Provider {
+	me.time = &t
+	return me
+}
+
+// WithoutNonce lets VerifyIDToken skip the nonce check when it is given no nonce, for flows that never send
+// one. Without it an empty nonce is refused, so a nonce the caller lost on the way fails closed.
+func (me *Provider) WithoutNonce() *Provider {
+	me.withoutNonce = true
+	return me
+}
+
+func (me *Provider) ID() string { return me.config.ID }
+
+func (me *Provider) Issuer() string { return me.config.Issuer }
+
+func (me *Provider) now() time.Time {
+	if me.time != nil {
+		return *me.time
+	}
+	return time.Now()
+}
+
+// Discovery returns the issuer's metadata, fetching it on first use. A failed fetch is retried on the next call.
+func (me *Provider) Discovery(ctx context.Context) (*Discovery, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+
+	if me.discovery != nil {
+		return me.discovery, nil
+	}
+
+	doc, err := Discover(ctx, me.httpClient, me.config.Issuer)
+	if err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Str("issuer", me.config.Issuer).Msg("openid discovery failed")
+		return nil, err
+	}
+
+	me.discovery = doc
+	me.keys = newKeyCache(me.httpClient, doc.JWKSURI)
+
+	return doc, nil
+}
+
+func (me *Provider) AuthorizationURL(ctx context.Context, req federated.AuthorizeRequest) (string, error) {
+	doc, err := me.Discovery(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(doc.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrDiscovery, err)
+	}
+
+	scopes := req.Scopes
+	if len(scopes) == 0 {
+		scopes = me.config.Scopes
+	}
+	if !contains(scopes, "openid") {
+		scopes = append([]string{"openid"}, scopes...)
+	}
+
+	q := u.Query()
+	q.Set("response_type", "code")
+	q.Set("client_id", me.config.ClientID)
+	q.Set("redirect_uri", req.RedirectURI)
+	q.Set("scope", strings.Join(scopes, " "))
+	q.Set("state", req.State)
+
+	if req.RawNonce != "" {
+		q.Set("nonce", req.RawNonce)
+	}
+
+	if req.CodeVerifier != "" {
+		q.Set("code_challenge", CodeChallenge(req.CodeVerifier))
+		q.Set("code_challenge_method", CodeChallengeMethodS256)
+	}
+
+	u.RawQuery = q.Encode()
+
+	return u.String(), nil
+}
+
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	TokenType        string `json:"token_type"`
+	RefreshToken     string `json:"refresh_token"`
+	IDToken          string `json:"id_token"`
+	ExpiresIn        int    `json:"expires_in"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+func (me *Provider) ExchangeCode(ctx context.Context, req federated.ExchangeRequest) (*federated.Tokens, error) {
+	doc, err := me.Discovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	data := url.Values{}
+	data.Set("grant_type", "authorization_code")
+	data.Set("code", req.Code)
+	data.Set("redirect_uri", req.RedirectURI)
+	data.Set("client_id", me.config.ClientID)
+
+	if me.config.ClientSecret != "" {
+		data.Set("client_secret", me.config.ClientSecret)
+	}
+
+	if req.CodeVerifier != "" {
+		data.Set("code_verifier", req.CodeVerifier)
+	}
+
+	hreq, err := http.NewRequestWithContext(ctx, http.MethodPost, doc.TokenEndpoint, strings.NewReader(data.Encode()))
+	if err != nil {
+		return nil, err
+	}
+
+	hreq.Header.Set("content-type", "application/x-www-form-urlencoded")
+	hreq.Header.Set("accept", "application/json")
+
+	res, err := me.httpClient.Do(hreq)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	var body tokenResponse
+	if err := json.NewDecoder(io.LimitReader(res.Body, 1<<20)).Decode(&body); err != nil {
+		return nil, fmt.Errorf("%w: %d %v", ErrTokenExchange, res.StatusCode, err)
+	}
+
+	if res.StatusCode != http.StatusOK || body.Error != "" {
+		err := fmt.Errorf("%w: %d %s %s", ErrTokenExchange, res.StatusCode, body.Error, body.ErrorDescription)
+		zerolog.Ctx(ctx).Error().Err(err).Str("issuer", me.config.Issuer).Msg("code exchange failed")
+		return nil, err
+	}
+
+	return &federated.Tokens{
+		AccessToken:  body.AccessToken,
+		RefreshToken: body.RefreshToken,
+		IDToken:      body.IDToken,
+		ExpiresIn:    body.ExpiresIn,
+	}, nil
+}
+
+// VerifyIDToken validates an id token as described in openid connect core section 3.1.3.7.
+// An empty rawNonce is refused unless the provider was built WithoutNonce.
+func (me *Provider) VerifyIDToken(ctx context.Context, idToken string, rawNonce string) (*federated.Identity, error) {
+	doc, err := me.Discovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	algs, err := signingAlgorithms(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := jwt.MapClaims{}
+
+	parser := jwt.NewParser(jwt.WithValidMethods(algs), jwt.WithoutClaimsValidation())
+
+	_, err = parser.ParseWithClaims(idToken, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		key, err := me.keys.key(ctx, kid)
+		if err != nil {
+			return nil, err
+		}
+		return key.PublicKey()
+	})
+	if err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Str("issuer", me.config.Issuer).Msg("invalid id token")
+		return nil, fmt.Errorf("%w: %v", ErrIDTokenInvalid, err)
+	}
+
+	if err := me.verifyClaims(claims, rawNonce); err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Str("issuer", me.config.Issuer).Msg("invalid id token claims")
+		return nil, err
+	}
+
+	return me.identity(claims), nil
+}
+
+func (me *Provider) verifyClaims(claims jwt.MapClaims, rawNonce string) error {
+	if iss, _ := claims["iss"].(string); iss != me.config.Issuer {
+		return fmt.Errorf("%w: %q", ErrIDTokenInvalidIssuer, iss)
+	}
+
+	aud := audience(claims["aud"])
+	if !contains(aud, me.config.ClientID) {
+		return fmt.Errorf("%w: %v", ErrIDTokenInvalidAudience, aud)
+	}
+
+	// with several audiences the authorized party has to be us
+	if azp, ok := claims["azp"].(string); ok && azp != me.config.ClientID {
+		return fmt.Errorf("%w: azp %q", ErrIDTokenInvalidAudience, azp)
+	} else if !ok && len(aud) > 1 {
+		return fmt.Errorf("%w: missing azp", ErrIDTokenInvalidAudience)
+	}
+
+	now := me.now()
+
+	exp, ok := numericDate(claims["exp"])
+	if !ok || !now.Before(exp.Add(me.config.Leeway)) {
+		return ErrIDTokenExpired
+	}
+
+	iat, ok := numericDate(claims["iat"])
+	if !ok || now.Add(me.config.Leeway).Before(iat) {
+		return ErrIDTokenIssuedInFuture
+	}
+
+	if sub, _ := claims["sub"].(string); sub == "" {
+		return ErrIDTokenMissingSubject
+	}
+
+	if rawNonce == "" {
+		if !me.withoutNonce {
+			return ErrIDTokenMissingNonce
+		}
+		return nil
+	}
+
+	nonce, _ := claims["nonce"].(string)
+	if subtle.ConstantTimeCompare([]byte(nonce), []byte(rawNonce)) != 1 {
+		return ErrIDTokenInvalidNonce
+	}
+
+	return nil
+}
+
+func (me *Provider) identity(claims jwt.MapClaims) *federated.Identity {
+	ident := &federated.Identity{
+		Provider: me.config.ID,
+	}
+
+	ident.Subject, _ = claims["sub"].(string)
+	ident.Email, _ = claims[me.config.Claims.Email].(string)
+	ident.Name, _ = claims[me.config.Claims.Name].(string)
+
+	switch v := claims[me.config.Claims.EmailVerified].(type) {
+	case bool:
+		ident.EmailVerified = v
+	case string:
+		ident.EmailVerified, _ = strconv.ParseBool(v)
+	}
+
+	return ident
+}
+
+// signingAlgorithms returns the id token algorithms advertised by the issuer that the client verifies. It never
+// returns an empty list, jwt.WithValidMethods would then accept any algorithm.
+func signingAlgorithms(doc *Discovery) ([]string, error) {
+	if len(doc.IDTokenSigningAlgValuesSupported) == 0 {
+		// RS256 is the default required by the discovery spec
+		return []string{"RS256"}, nil
+	}
+
+	var algs []string
+	for _, alg := range doc.IDTokenSigningAlgValuesSupported {
+		if contains(supportedAlgs, alg) {
+			algs = append(algs, alg)
+		}
+	}
+
+	if len(algs) == 0 {
+		return nil, fmt.Errorf("%w: none of the id token algorithms %v are supported", ErrDiscovery, doc.IDTokenSigningAlgValuesSupported)
+	}
+
+	return algs, nil
+}
+
+func audience(v interface{}) []string {
+	switch a := v.(type) {
+	case string:
+		return []string{a}
+	case []interface{}:
+		out := make([]string, 0, len(a))
+		for _, s := range a {
+			if str, ok := s.(string); ok {
+				out = append(out, str)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+func numericDate(v interface{}) (time.Time, bool) {
+	switch n := v.(type) {
+	case float64:
+		return time.Unix(int64(n), 0), true
+	case json.Number:
+		f, err := n.Float64()
+		if err != nil {
+			return time.Time{}, false
+		}
+		return time.Unix(int64(f), 0), true
+	}
+	return time.Time{}, false
+}
+
+func contains(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
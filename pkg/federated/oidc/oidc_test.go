@@ -0,0 +1,245 @@
+package oidc_test
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/webauthn/pkg/federated"
+	"github.com/walteh/webauthn/pkg/federated/oidc"
+)
+
+func TestProvider_AuthorizationCodeWithPKCE(t *testing.T) {
+	ctx := context.Background()
+	idp := newFakeIdP(t)
+
+	p := oidc.NewProvider(oidc.Config{ID: "fake", Issuer: idp.Issuer(), ClientID: "nugg", ClientSecret: "secret"})
+
+	verifier, err := oidc.NewCodeVerifier()
+	require.NoError(t, err)
+
+	raw, err := p.AuthorizationURL(ctx, federated.AuthorizeRequest{
+		RedirectURI:  "https://nugg.xyz/callback",
+		State:        "state-abc",
+		RawNonce:     "nonce-abc",
+		CodeVerifier: verifier,
+	})
+	require.NoError(t, err)
+
+	u, err := url.Parse(raw)
+	require.NoError(t, err)
+	assert.Equal(t, idp.Issuer()+"/authorize", u.Scheme+"://"+u.Host+u.Path)
+
+	q := u.Query()
+	assert.Equal(t, "code", q.Get("response_type"))
+	assert.Equal(t, "nugg", q.Get("client_id"))
+	assert.Equal(t, "openid email profile", q.Get("scope"))
+	assert.Equal(t, "state-abc", q.Get("state"))
+	assert.Equal(t, "nonce-abc", q.Get("nonce"))
+	assert.Equal(t, "S256", q.Get("code_challenge_method"))
+
+	now := time.Now()
+	idp.grant("code-abc", q.Get("code_challenge"), jwt.MapClaims{
+		"iss":            idp.Issuer(),
+		"aud":            "nugg",
+		"sub":            "user-1",
+		"exp":            now.Add(time.Hour).Unix(),
+		"iat":            now.Unix(),
+		"nonce":          "nonce-abc",
+		"email":          "nugg@nugg.xyz",
+		"email_verified": true,
+		"name":           "Nugg",
+	})
+
+	tokens, err := p.ExchangeCode(ctx, federated.ExchangeRequest{Code: "code-abc", RedirectURI: "https://nugg.xyz/callback", CodeVerifier: verifier})
+	require.NoError(t, err)
+
+	ident, err := p.VerifyIDToken(ctx, tokens.IDToken, "nonce-abc")
+	require.NoError(t, err)
+	assert.Equal(t, &federated.Identity{
+		Provider:      "fake",
+		Subject:       "user-1",
+		Email:         "nugg@nugg.xyz",
+		EmailVerified: true,
+		Name:          "Nugg",
+	}, ident)
+}
+
+func TestProvider_ExchangeRejectsWrongVerifier(t *testing.T) {
+	ctx := context.Background()
+	idp := newFakeIdP(t)
+
+	p := oidc.NewProvider(oidc.Config{Issuer: idp.Issuer(), ClientID: "nugg"})
+
+	idp.grant("code-abc", oidc.CodeChallenge("right"), jwt.MapClaims{})
+
+	_, err := p.ExchangeCode(ctx, federated.ExchangeRequest{Code: "code-abc", RedirectURI: "https://nugg.xyz/callback", CodeVerifier: "wrong"})
+	assert.ErrorIs(t, err, oidc.ErrTokenExchange)
+}
+
+func TestProvider_VerifyIDToken(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+
+	idp := newFakeIdP(t)
+
+	base := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss":   idp.Issuer(),
+			"aud":   "nugg",
+			"sub":   "user-1",
+			"exp":   now.Add(time.Hour).Unix(),
+			"iat":   now.Unix(),
+			"nonce": "nonce-abc",
+		}
+	}
+
+	with := func(k string, v interface{}) jwt.MapClaims {
+		c := base()
+		c[k] = v
+		return c
+	}
+
+	tests := []struct {
+		name         string
+		method       jwt.SigningMethod
+		claims       jwt.MapClaims
+		emptyNonce   bool
+		withoutNonce bool
+		wantErr      error
+	}{
+		{name: "rsa", method: jwt.SigningMethodRS256, claims: base()},
+		{name: "ec", method: jwt.SigningMethodES256, claims: base()},
+		{name: "multiple audiences with azp", method: jwt.SigningMethodRS256, claims: func() jwt.MapClaims {
+			c := with("aud", []string{"nugg", "other"})
+			c["azp"] = "nugg"
+			return c
+		}()},
+		{name: "multiple audiences without azp", method: jwt.SigningMethodRS256, claims: with("aud", []string{"nugg", "other"}), wantErr: oidc.ErrIDTokenInvalidAudience},
+		{name: "wrong issuer", method: jwt.SigningMethodRS256, claims: with("iss", "https://evil.example.com"), wantErr: oidc.ErrIDTokenInvalidIssuer},
+		{name: "wrong audience", method: jwt.SigningMethodRS256, claims: with("aud", "other"), wantErr: oidc.ErrIDTokenInvalidAudience},
+		{name: "expired", method: jwt.SigningMethodRS256, claims: with("exp", now.Add(-time.Hour).Unix()), wantErr: oidc.ErrIDTokenExpired},
+		{name: "issued in the future", method: jwt.SigningMethodRS256, claims: with("iat", now.Add(time.Hour).Unix()), wantErr: oidc.ErrIDTokenIssuedInFuture},
+		{name: "nonce mismatch", method: jwt.SigningMethodRS256, claims: with("nonce", "other"), wantErr: oidc.ErrIDTokenInvalidNonce},
+		{name: "lost nonce", method: jwt.SigningMethodRS256, claims: base(), emptyNonce: true, wantErr: oidc.ErrIDTokenMissingNonce},
+		{name: "flow without a nonce", method: jwt.SigningMethodRS256, claims: with("nonce", nil), emptyNonce: true, withoutNonce: true},
+		{name: "nonce still checked when given", method: jwt.SigningMethodRS256, claims: with("nonce", "other"), withoutNonce: true, wantErr: oidc.ErrIDTokenInvalidNonce},
+		{name: "hmac key confusion", method: jwt.SigningMethodHS256, claims: base(), wantErr: oidc.ErrIDTokenInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := oidc.NewProvider(oidc.Config{Issuer: idp.Issuer(), ClientID: "nugg"}).WithTime(now)
+			if tt.withoutNonce {
+				p = p.WithoutNonce()
+			}
+
+			nonce := "nonce-abc"
+			if tt.emptyNonce {
+				nonce = ""
+			}
+
+			ident, err := p.VerifyIDToken(context.Background(), idp.sign(tt.method, tt.claims), nonce)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "user-1", ident.Subject)
+		})
+	}
+}
+
+func TestProvider_ClaimMapping(t *testing.T) {
+	now := time.Now()
+	idp := newFakeIdP(t)
+
+	p := oidc.NewProvider(oidc.Config{
+		ID:       "microsoft",
+		Issuer:   idp.Issuer(),
+		ClientID: "nugg",
+		Claims:   oidc.ClaimMapping{Email: "preferred_username", EmailVerified: "xms_edov"},
+	}).WithoutNonce()
+
+	ident, err := p.VerifyIDToken(context.Background(), idp.sign(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":                idp.Issuer(),
+		"aud":                "nugg",
+		"sub":                "user-1",
+		"exp":                now.Add(time.Hour).Unix(),
+		"iat":                now.Unix(),
+		"preferred_username": "nugg@nugg.xyz",
+		"xms_edov":           "true",
+		"name":               "Nugg",
+	}), "")
+	require.NoError(t, err)
+
+	assert.Equal(t, &federated.Identity{
+		Provider:      "microsoft",
+		Subject:       "user-1",
+		Email:         "nugg@nugg.xyz",
+		EmailVerified: true,
+		Name:          "Nugg",
+	}, ident)
+}
+
+func TestDiscover_IssuerMismatch(t *testing.T) {
+	idp := newFakeIdP(t)
+	idp.issuer = "https://accounts.example.com"
+
+	p := oidc.NewProvider(oidc.Config{Issuer: idp.Issuer(), ClientID: "nugg"})
+
+	_, err := p.AuthorizationURL(context.Background(), federated.AuthorizeRequest{})
+	assert.ErrorIs(t, err, oidc.ErrDiscovery)
+}
+
+func TestDiscover_IssuerTemplate(t *testing.T) {
+	idp := newFakeIdP(t)
+	idp.issuer = "https://login.microsoftonline.com/{tenantid}/v2.0"
+
+	p := oidc.NewProvider(oidc.Config{Issuer: idp.Issuer(), ClientID: "nugg"})
+
+	_, err := p.AuthorizationURL(context.Background(), federated.AuthorizeRequest{})
+	assert.ErrorIs(t, err, oidc.ErrDiscovery)
+}
+
+func TestDiscover_NoSupportedAlgorithm(t *testing.T) {
+	idp := newFakeIdP(t)
+	idp.algs = []string{"HS256", "none"}
+
+	p := oidc.NewProvider(oidc.Config{Issuer: idp.Issuer(), ClientID: "nugg"})
+
+	_, err := p.VerifyIDToken(context.Background(), "e30.e30.", "")
+	assert.ErrorIs(t, err, oidc.ErrDiscovery)
+}
+
+func TestRegistry_RoutesByIssuer(t *testing.T) {
+	now := time.Now()
+
+	a := newFakeIdP(t)
+	b := newFakeIdP(t)
+
+	reg := oidc.NewRegistry(
+		oidc.Config{ID: "a", Issuer: a.Issuer(), ClientID: "nugg"},
+		oidc.Config{ID: "b", Issuer: b.Issuer(), ClientID: "nugg"},
+	).WithoutNonce()
+
+	assert.Len(t, reg.Providers(), 2)
+
+	claims := func(iss string) jwt.MapClaims {
+		return jwt.MapClaims{"iss": iss, "aud": "nugg", "sub": "user-1", "exp": now.Add(time.Hour).Unix(), "iat": now.Unix()}
+	}
+
+	ident, err := reg.VerifyIDToken(context.Background(), b.sign(jwt.SigningMethodRS256, claims(b.Issuer())), "")
+	require.NoError(t, err)
+	assert.Equal(t, "b", ident.Provider)
+
+	// a token claiming b's issuer but signed by a is rejected by b's keys
+	_, err = reg.VerifyIDToken(context.Background(), a.sign(jwt.SigningMethodRS256, claims(b.Issuer())), "")
+	assert.ErrorIs(t, err, oidc.ErrIDTokenInvalid)
+
+	_, err = reg.VerifyIDToken(context.Background(), a.sign(jwt.SigningMethodRS256, claims("https://unknown.example.com")), "")
+	assert.ErrorIs(t, err, oidc.ErrUnknownIssuer)
+}
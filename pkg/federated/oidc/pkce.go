@@ -0,0 +1,25 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+)
+
+// CodeChallengeMethodS256 is the only PKCE method the client sends, "plain" offers no protection
+const CodeChallengeMethodS256 = "S256"
+
+// NewCodeVerifier returns a PKCE code verifier (rfc 7636 section 4.1)
+func NewCodeVerifier() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// CodeChallenge returns the S256 challenge for a code verifier (rfc 7636 section 4.2)
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
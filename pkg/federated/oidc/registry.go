@@ -0,0 +1,81 @@
+package oidc
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/walteh/webauthn/pkg/federated"
+)
+
+// Registry holds the providers for every configured issuer
+type Registry struct {
+	byIssuer map[string]*Provider
+	byID     map[string]*Provider
+	order    []*Provider
+}
+
+func NewRegistry(configs ...Config) *Registry {
+	reg := &Registry{
+		byIssuer: map[string]*Provider{},
+		byID:     map[string]*Provider{},
+	}
+
+	for _, c := range configs {
+		p := NewProvider(c)
+		reg.byIssuer[p.Issuer()] = p
+		reg.byID[p.ID()] = p
+		reg.order = append(reg.order, p)
+	}
+
+	return reg
+}
+
+// WithHTTPClient sets the http client of every provider
+func (me *Registry) WithHTTPClient(client *http.Client) *Registry {
+	for _, p := range me.order {
+		p.WithHTTPClient(client)
+	}
+	return me
+}
+
+// WithoutNonce lets every provider verify id tokens without a nonce, see Provider.WithoutNonce
+func (me *Registry) WithoutNonce() *Registry {
+	for _, p := range me.order {
+		p.WithoutNonce()
+	}
+	return me
+}
+
+// Provider returns the provider configured with the given id
+func (me *Registry) Provider(id string) (*Provider, bool) {
+	p, ok := me.byID[id]
+	return p, ok
+}
+
+// Providers returns every provider in configuration order
+func (me *Registry) Providers() []federated.Provider {
+	out := make([]federated.Provider, len(me.order))
+	for i, p := range me.order {
+		out[i] = p
+	}
+	return out
+}
+
+// VerifyIDToken routes an id token to the provider of its (unverified) iss claim, which then verifies it fully
+func (me *Registry) VerifyIDToken(ctx context.Context, idToken string, rawNonce string) (*federated.Identity, error) {
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(idToken, claims); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrIDTokenInvalid, err)
+	}
+
+	iss, _ := claims["iss"].(string)
+
+	p, ok := me.byIssuer[iss]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownIssuer, iss)
+	}
+
+	return p.VerifyIDToken(ctx, idToken, rawNonce)
+}
@@ -1 +1,75 @@
 package federated
+
+import (
+	"context"
+)
+
+// Identity is a user identity asserted by a federated provider, normalized across providers
+type Identity struct {
+	// Provider is the id of the provider that verified the identity
+	Provider string
+
+	// Subject is the provider's stable identifier for the user, unique only within the provider
+	Subject string
+
+	Email         string
+	EmailVerified bool
+
+	// IsPrivateEmail is set for relay addresses (e.g. sign in with apple's hide my email) that are unique per app
+	IsPrivateEmail bool
+
+	Name string
+}
+
+// Key uniquely identifies the identity across providers
+func (me Identity) Key() string {
+	return me.Provider + "|" + me.Subject
+}
+
+// AuthorizeRequest describes the redirect that starts a sign in
+type AuthorizeRequest struct {
+	RedirectURI string
+	State       string
+
+	// RawNonce is bound into the id_token; providers hash it if their protocol requires
+	RawNonce string
+
+	Scopes []string
+
+	// CodeVerifier enables PKCE for providers that support it, its S256 challenge is sent with the request
+	CodeVerifier string
+}
+
+// ExchangeRequest redeems the code returned to the redirect uri
+type ExchangeRequest struct {
+	Code        string
+	RedirectURI string
+
+	// CodeVerifier is the PKCE verifier passed to AuthorizationURL
+	CodeVerifier string
+}
+
+// Tokens are the tokens returned by a code exchange
+type Tokens struct {
+	AccessToken  string
+	RefreshToken string
+	IDToken      string
+	ExpiresIn    int
+}
+
+// Provider is a federated identity provider the relying party can sign users in with
+type Provider interface {
+	// ID names the provider, it is recorded on every Identity the provider returns
+	ID() string
+
+	// AuthorizationURL returns the url the user agent is sent to in order to sign in
+	AuthorizationURL(ctx context.Context, req AuthorizeRequest) (string, error)
+
+	// ExchangeCode redeems an authorization code at the provider's token endpoint
+	ExchangeCode(ctx context.Context, req ExchangeRequest) (*Tokens, error)
+
+	// VerifyIDToken checks an id_token's signature and claims and returns the identity it asserts. rawNonce
+	// is the nonce passed to AuthorizationURL; an empty rawNonce is refused unless the provider was
+	// explicitly built to accept tokens without one, so a nonce lost on the way fails closed.
+	VerifyIDToken(ctx context.Context, idToken string, rawNonce string) (*Identity, error)
+}
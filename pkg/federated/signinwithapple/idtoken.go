@@ -0,0 +1,252 @@
+package signinwithapple
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/rs/zerolog"
+	"github.com/walteh/webauthn/pkg/applepublickey"
+)
+
+const (
+	// Issuer is the iss claim of every token apple signs
+	Issuer = "https://appleid.apple.com"
+
+	// DefaultLeeway is the clock skew tolerated when checking exp and iat
+	DefaultLeeway = time.Minute
+)
+
+var (
+	ErrIDTokenInvalid         = errors.New("ErrIDTokenInvalid")
+	ErrIDTokenInvalidIssuer   = errors.New("ErrIDTokenInvalidIssuer")
+	ErrIDTokenInvalidAudience = errors.New("ErrIDTokenInvalidAudience")
+	ErrIDTokenExpired         = errors.New("ErrIDTokenExpired")
+	ErrIDTokenIssuedInFuture  = errors.New("ErrIDTokenIssuedInFuture")
+	ErrIDTokenInvalidNonce    = errors.New("ErrIDTokenInvalidNonce")
+	ErrIDTokenMissingNonce    = errors.New("ErrIDTokenMissingNonce")
+	ErrIDTokenMissingSubject  = errors.New("ErrIDTokenMissingSubject")
+)
+
+// RealUserStatus is apple's estimate of whether the user is a real person
+// https://developer.apple.com/documentation/authenticationservices/asuserdetectionstatus
+type RealUserStatus int
+
+const (
+	RealUserStatusUnsupported RealUserStatus = 0
+	RealUserStatusUnknown     RealUserStatus = 1
+	RealUserStatusLikelyReal  RealUserStatus = 2
+)
+
+// AppleIdentity is the verified content of a sign in with apple id_token
+type AppleIdentity struct {
+	// Subject is the stable, team scoped identifier of the user
+	Subject        string
+	Email          string
+	EmailVerified  bool
+	IsPrivateEmail bool
+	RealUserStatus RealUserStatus
+	AuthTime       time.Time
+}
+
+// IDTokenVerifier verifies id_tokens against apple's published keys and the expected claims
+type IDTokenVerifier struct {
+	keys      *applepublickey.Client
+	clientIDs []string
+	leeway    time.Duration
+	time      *time.Time
+
+	// withoutNonce lets Verify accept tokens without a nonce to check
+	withoutNonce bool
+
+	// maxAge is how long notifications are accepted after they were issued
+	maxAge time.Duration
+}
+
+// NewIDTokenVerifier creates a verifier accepting tokens issued to any of clientIDs
+// (the bundle id for native apps, the services id for the web flow).
+func NewIDTokenVerifier(keys *applepublickey.Client, clientIDs ...string) *IDTokenVerifier {
+	return &IDTokenVerifier{
+		keys:      keys,
+		clientIDs: clientIDs,
+		leeway:    DefaultLeeway,
+	}
+}
+
+func (me *IDTokenVerifier) WithLeeway(leeway time.Duration) *IDTokenVerifier {
+	me.leeway = leeway
+	return me
+}
+
+// WithoutNonce lets Verify skip the nonce check when it is given no nonce, for flows that never send one.
+// Without it an empty nonce is refused, so a nonce the caller lost on the way fails closed.
+func (me *IDTokenVerifier) WithoutNonce() *IDTokenVerifier {
+	me.withoutNonce = true
+	return me
+}
+
+// WithNotificationMaxAge sets how long after apple issued a notification VerifyNotification still accepts
+// it, DefaultNotificationMaxAge when not set
+func (me *IDTokenVerifier) WithNotificationMaxAge(maxAge time.Duration) *IDTokenVerifier {
+	me.maxAge = maxAge
+	return me
+}
+
+func (me *IDTokenVerifier) notificationMaxAge() time.Duration {
+	if me.maxAge > 0 {
+		return me.maxAge
+	}
+	return DefaultNotificationMaxAge
+}
+
+// WithTime pins the time exp and iat are checked against, for replaying recorded tokens
+func (me *IDTokenVerifier) WithTime(t time.Time) *IDTokenVerifier {
+	me.time = &t
+	return me
+}
+
+func (me *IDTokenVerifier) now() time.Time {
+	if me.time != nil {
+		return *me.time
+	}
+	return time.Now()
+}
+
+// Verify checks the signature and claims of an id_token. rawNonce is the nonce before hashing - the
+// client sends its sha256 hex digest to apple, and the digest is what comes back in the token.
+// An empty rawNonce is refused unless the verifier was built WithoutNonce.
+func (me *IDTokenVerifier) Verify(ctx context.Context, idToken string, rawNonce string) (*AppleIdentity, error) {
+	claims := &idTokenClaims{}
+
+	parser := jwt.NewParser(jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg()}), jwt.WithoutClaimsValidation())
+
+	if _, err := parser.ParseWithClaims(idToken, claims, me.keys.BuildKeyFunc(ctx)); err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Msg("invalid apple id token")
+		return nil, fmt.Errorf("%w: %v", ErrIDTokenInvalid, err)
+	}
+
+	if err := me.verifyClaims(claims, rawNonce); err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Str("sub", claims.Subject).Msg("invalid apple id token claims")
+		return nil, err
+	}
+
+	ident := &AppleIdentity{
+		Subject:        claims.Subject,
+		Email:          claims.Email,
+		EmailVerified:  bool(claims.EmailVerified),
+		IsPrivateEmail: bool(claims.IsPrivateEmail),
+		RealUserStatus: RealUserStatus(claims.RealUserStatus),
+	}
+
+	if claims.AuthTime != nil {
+		ident.AuthTime = claims.AuthTime.Time
+	}
+
+	return ident, nil
+}
+
+func (me *IDTokenVerifier) verifyClaims(claims *idTokenClaims, rawNonce string) error {
+	if claims.Issuer != Issuer {
+		return fmt.Errorf("%w: %q", ErrIDTokenInvalidIssuer, claims.Issuer)
+	}
+
+	if !me.audienceAllowed(claims.Audience) {
+		return fmt.Errorf("%w: %v", ErrIDTokenInvalidAudience, []string(claims.Audience))
+	}
+
+	now := me.now()
+
+	if claims.ExpiresAt == nil || !now.Before(claims.ExpiresAt.Add(me.leeway)) {
+		return ErrIDTokenExpired
+	}
+
+	if claims.IssuedAt == nil || now.Add(me.leeway).Before(claims.IssuedAt.Time) {
+		return ErrIDTokenIssuedInFuture
+	}
+
+	if claims.Subject == "" {
+		return ErrIDTokenMissingSubject
+	}
+
+	if rawNonce == "" {
+		if !me.withoutNonce {
+			return ErrIDTokenMissingNonce
+		}
+		return nil
+	}
+
+	expected := HashNonce(rawNonce)
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(claims.Nonce)) != 1 {
+		return ErrIDTokenInvalidNonce
+	}
+
+	return nil
+}
+
+func (me *IDTokenVerifier) audienceAllowed(aud jwt.ClaimStrings) bool {
+	for _, a := range aud {
+		for _, id := range me.clientIDs {
+			if a == id {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// HashNonce returns the sha256 hex digest of a raw nonce, which is the value clients pass to apple
+func HashNonce(rawNonce string) string {
+	sum := sha256.Sum256([]byte(rawNonce))
+	return hex.EncodeToString(sum[:])
+}
+
+type idTokenClaims struct {
+	Issuer         string           `json:"iss"`
+	Audience       jwt.ClaimStrings `json:"aud"`
+	ExpiresAt      *jwt.NumericDate `json:"exp"`
+	IssuedAt       *jwt.NumericDate `json:"iat"`
+	AuthTime       *jwt.NumericDate `json:"auth_time"`
+	Subject        string           `json:"sub"`
+	Nonce          string           `json:"nonce"`
+	Email          string           `json:"email"`
+	EmailVerified  appleBool        `json:"email_verified"`
+	IsPrivateEmail appleBool        `json:"is_private_email"`
+	RealUserStatus int              `json:"real_user_status"`
+}
+
+// Valid is a no-op, claims are verified by IDTokenVerifier.verifyClaims
+func (idTokenClaims) Valid() error { return nil }
+
+// appleBool decodes the boolean claims apple sends either as json booleans or as "true"/"false" strings
+type appleBool bool
+
+func (me *appleBool) UnmarshalJSON(b []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+
+	switch t := v.(type) {
+	case bool:
+		*me = appleBool(t)
+	case string:
+		parsed, err := strconv.ParseBool(t)
+		if err != nil {
+			return err
+		}
+		*me = appleBool(parsed)
+	case nil:
+		*me = false
+	default:
+		return fmt.Errorf("unexpected boolean claim: %s", string(b))
+	}
+
+	return nil
+}
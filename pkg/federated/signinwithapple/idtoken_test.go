@@ -0,0 +1,232 @@
+package signinwithapple
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/webauthn/pkg/applepublickey"
+)
+
+// testKeySet serves a single rsa key as an apple style jwks and signs tokens with it
+type testKeySet struct {
+	kid string
+	key *rsa.PrivateKey
+}
+
+func newTestKeySet(t *testing.T) (*testKeySet, *applepublickey.Client) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	ks := &testKeySet{kid: "W6WcOKB", key: key}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(applepublickey.PublicKeyResponse{Keys: []applepublickey.ApplePublicKey{{
+			KTY: "RSA",
+			KID: ks.kid,
+			Use: "sig",
+			Alg: "RS256",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	}))
+	t.Cleanup(srv.Close)
+
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+
+	return ks, applepublickey.NewClient(u)
+}
+
+func (me *testKeySet) sign(t *testing.T, claims jwt.MapClaims) string {
+	tkn := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	tkn.Header["kid"] = me.kid
+	str, err := tkn.SignedString(me.key)
+	require.NoError(t, err)
+	return str
+}
+
+func TestIDTokenVerifier_Verify(t *testing.T) {
+	now := time.Unix(1667838310, 0)
+
+	base := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss":              Issuer,
+			"aud":              "xyz.nugg.app",
+			"exp":              now.Add(time.Hour).Unix(),
+			"iat":              now.Unix(),
+			"auth_time":        now.Unix(),
+			"sub":              "001437.def535ddd9e24c4fa4367dca50fdfedb.1951",
+			"nonce":            HashNonce("raw-nonce"),
+			"nonce_supported":  true,
+			"email":            "abc@privaterelay.appleid.com",
+			"email_verified":   "true",
+			"is_private_email": true,
+			"real_user_status": 2,
+		}
+	}
+
+	with := func(k string, v interface{}) jwt.MapClaims {
+		c := base()
+		if v == nil {
+			delete(c, k)
+		} else {
+			c[k] = v
+		}
+		return c
+	}
+
+	tests := []struct {
+		name         string
+		claims       jwt.MapClaims
+		nonce        string
+		withoutNonce bool
+		want         *AppleIdentity
+		wantErr      error
+	}{
+		{
+			name:   "valid",
+			claims: base(),
+			nonce:  "raw-nonce",
+			want: &AppleIdentity{
+				Subject:        "001437.def535ddd9e24c4fa4367dca50fdfedb.1951",
+				Email:          "abc@privaterelay.appleid.com",
+				EmailVerified:  true,
+				IsPrivateEmail: true,
+				RealUserStatus: RealUserStatusLikelyReal,
+				AuthTime:       now,
+			},
+		},
+		{
+			name:   "second client id",
+			claims: with("aud", "xyz.nugg.web"),
+			nonce:  "raw-nonce",
+			want: &AppleIdentity{
+				Subject:        "001437.def535ddd9e24c4fa4367dca50fdfedb.1951",
+				Email:          "abc@privaterelay.appleid.com",
+				EmailVerified:  true,
+				IsPrivateEmail: true,
+				RealUserStatus: RealUserStatusLikelyReal,
+				AuthTime:       now,
+			},
+		},
+		{
+			name:    "wrong issuer",
+			claims:  with("iss", "https://evil.example.com"),
+			nonce:   "raw-nonce",
+			wantErr: ErrIDTokenInvalidIssuer,
+		},
+		{
+			name:    "wrong audience",
+			claims:  with("aud", "com.other.app"),
+			nonce:   "raw-nonce",
+			wantErr: ErrIDTokenInvalidAudience,
+		},
+		{
+			name:    "expired",
+			claims:  with("exp", now.Add(-2*DefaultLeeway).Unix()),
+			nonce:   "raw-nonce",
+			wantErr: ErrIDTokenExpired,
+		},
+		{
+			name:    "issued in the future",
+			claims:  with("iat", now.Add(2*DefaultLeeway).Unix()),
+			nonce:   "raw-nonce",
+			wantErr: ErrIDTokenIssuedInFuture,
+		},
+		{
+			name:    "nonce mismatch",
+			claims:  base(),
+			nonce:   "other-nonce",
+			wantErr: ErrIDTokenInvalidNonce,
+		},
+		{
+			name:    "unhashed nonce",
+			claims:  with("nonce", "raw-nonce"),
+			nonce:   "raw-nonce",
+			wantErr: ErrIDTokenInvalidNonce,
+		},
+		{
+			name:    "lost nonce",
+			claims:  base(),
+			nonce:   "",
+			wantErr: ErrIDTokenMissingNonce,
+		},
+		{
+			name:         "flow without a nonce",
+			claims:       with("nonce", nil),
+			nonce:        "",
+			withoutNonce: true,
+			want: &AppleIdentity{
+				Subject:        "001437.def535ddd9e24c4fa4367dca50fdfedb.1951",
+				Email:          "abc@privaterelay.appleid.com",
+				EmailVerified:  true,
+				IsPrivateEmail: true,
+				RealUserStatus: RealUserStatusLikelyReal,
+				AuthTime:       now,
+			},
+		},
+		{
+			name:         "nonce still checked when given",
+			claims:       base(),
+			nonce:        "other-nonce",
+			withoutNonce: true,
+			wantErr:      ErrIDTokenInvalidNonce,
+		},
+		{
+			name:    "missing subject",
+			claims:  with("sub", nil),
+			nonce:   "raw-nonce",
+			wantErr: ErrIDTokenMissingSubject,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ks, keys := newTestKeySet(t)
+
+			verifier := NewIDTokenVerifier(keys, "xyz.nugg.app", "xyz.nugg.web").WithTime(now)
+			if tt.withoutNonce {
+				verifier = verifier.WithoutNonce()
+			}
+
+			got, err := verifier.Verify(context.Background(), ks.sign(t, tt.claims), tt.nonce)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestIDTokenVerifier_RejectsForeignSignature(t *testing.T) {
+	_, keys := newTestKeySet(t)
+	other, _ := newTestKeySet(t)
+
+	now := time.Unix(1667838310, 0)
+
+	tkn := other.sign(t, jwt.MapClaims{
+		"iss": Issuer,
+		"aud": "xyz.nugg.app",
+		"exp": now.Add(time.Hour).Unix(),
+		"iat": now.Unix(),
+		"sub": "001437.def535ddd9e24c4fa4367dca50fdfedb.1951",
+	})
+
+	_, err := NewIDTokenVerifier(keys, "xyz.nugg.app").WithTime(now).Verify(context.Background(), tkn, "")
+	assert.ErrorIs(t, err, ErrIDTokenInvalid)
+}
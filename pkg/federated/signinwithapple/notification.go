@@ -0,0 +1,362 @@
+package signinwithapple
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/rs/zerolog"
+)
+
+// NotificationType is the type of a server-to-server notification
+// https://developer.apple.com/documentation/sign_in_with_apple/processing_changes_for_sign_in_with_apple_accounts
+type NotificationType string
+
+const (
+	NotificationTypeEmailDisabled  NotificationType = "email-disabled"
+	NotificationTypeEmailEnabled   NotificationType = "email-enabled"
+	NotificationTypeConsentRevoked NotificationType = "consent-revoked"
+	NotificationTypeAccountDelete  NotificationType = "account-delete"
+)
+
+// DefaultNotificationMaxAge is how long after apple issued a notification it is still accepted
+const DefaultNotificationMaxAge = 24 * time.Hour
+
+var (
+	ErrNotificationInvalid     = errors.New("ErrNotificationInvalid")
+	ErrNotificationUnknownType = errors.New("ErrNotificationUnknownType")
+	ErrNotificationStale       = errors.New("ErrNotificationStale")
+)
+
+// NotificationEvent holds the fields common to every notification
+type NotificationEvent struct {
+	Type      NotificationType
+	Subject   string
+	EventTime time.Time
+
+	// ID is the jti of the notification, IssuedAt its iat
+	ID       string
+	IssuedAt time.Time
+}
+
+// key identifies the notification for de-duplication, by its jti or else by what it is about
+func (me NotificationEvent) key() string {
+	if me.ID != "" {
+		return me.ID
+	}
+	return fmt.Sprintf("%s/%s/%d", me.Type, me.Subject, me.EventTime.UnixMilli())
+}
+
+// EmailDisabledEvent is sent when a user stops forwarding from their private relay address
+type EmailDisabledEvent struct {
+	NotificationEvent
+	Email          string
+	IsPrivateEmail bool
+}
+
+// EmailEnabledEvent is sent when a user starts forwarding from their private relay address again
+type EmailEnabledEvent struct {
+	NotificationEvent
+	Email          string
+	IsPrivateEmail bool
+}
+
+// ConsentRevokedEvent is sent when a user stops using their apple id with the app
+type ConsentRevokedEvent struct {
+	NotificationEvent
+}
+
+// AccountDeleteEvent is sent when a user deletes their apple account
+type AccountDeleteEvent struct {
+	NotificationEvent
+}
+
+// NotificationReceiver is called with each verified notification. Returning an error makes the
+// handler answer with a 500, so apple delivers the notification again.
+type NotificationReceiver interface {
+	EmailDisabled(ctx context.Context, event EmailDisabledEvent) error
+	EmailEnabled(ctx context.Context, event EmailEnabledEvent) error
+	ConsentRevoked(ctx context.Context, event ConsentRevokedEvent) error
+	AccountDeleted(ctx context.Context, event AccountDeleteEvent) error
+}
+
+// NotificationDeduplicator remembers the notifications a handler dispatched, so a notification that is
+// delivered or replayed again within its max age is only handled once
+type NotificationDeduplicator interface {
+	// Claim records the notification key until expires and reports whether it was not recorded yet
+	Claim(ctx context.Context, key string, expires time.Time) (bool, error)
+	// Release forgets a claimed key whose dispatch failed, so apple's retry is handled
+	Release(ctx context.Context, key string) error
+}
+
+// NotificationHandler receives the notifications apple posts to the endpoint registered for a services id
+type NotificationHandler struct {
+	verifier *IDTokenVerifier
+	receiver NotificationReceiver
+	dedup    NotificationDeduplicator
+}
+
+var _ http.Handler = (*NotificationHandler)(nil)
+
+// NewNotificationHandler verifies notifications with the keys, client ids and clock of verifier
+func NewNotificationHandler(verifier *IDTokenVerifier, receiver NotificationReceiver) *NotificationHandler {
+	return &NotificationHandler{
+		verifier: verifier,
+		receiver: receiver,
+	}
+}
+
+// WithDeduplicator only dispatches notifications the deduplicator has not seen before. Notifications
+// are de-duplicated by their jti, or by their type, subject and event time when they have none.
+func (me *NotificationHandler) WithDeduplicator(dedup NotificationDeduplicator) *NotificationHandler {
+	me.dedup = dedup
+	return me
+}
+
+type notificationBody struct {
+	Payload string `json:"payload"`
+}
+
+func (me *NotificationHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var body notificationBody
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<16)).Decode(&body); err != nil || body.Payload == "" {
+		zerolog.Ctx(ctx).Error().Err(err).Msg("invalid apple notification body")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	event, err := me.verifier.VerifyNotification(ctx, body.Payload)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	common := commonEvent(event)
+
+	if me.dedup != nil {
+		fresh, err := me.dedup.Claim(ctx, common.key(), common.IssuedAt.Add(me.verifier.notificationMaxAge()+me.verifier.leeway))
+		if err != nil {
+			zerolog.Ctx(ctx).Error().Err(err).Msg("failed to de-duplicate apple notification")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if !fresh {
+			zerolog.Ctx(ctx).Warn().Str("key", common.key()).Msg("apple notification already handled")
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+	}
+
+	if err := me.Dispatch(ctx, event); err != nil {
+		if errors.Is(err, ErrNotificationUnknownType) {
+			// acknowledge types we do not understand so apple does not keep retrying them
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		if me.dedup != nil {
+			if err := me.dedup.Release(ctx, common.key()); err != nil {
+				zerolog.Ctx(ctx).Error().Err(err).Msg("failed to release apple notification")
+			}
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// commonEvent returns the fields every event returned by VerifyNotification shares
+func commonEvent(event interface{}) NotificationEvent {
+	switch e := event.(type) {
+	case EmailDisabledEvent:
+		return e.NotificationEvent
+	case EmailEnabledEvent:
+		return e.NotificationEvent
+	case ConsentRevokedEvent:
+		return e.NotificationEvent
+	case AccountDeleteEvent:
+		return e.NotificationEvent
+	case NotificationEvent:
+		return e
+	default:
+		return NotificationEvent{}
+	}
+}
+
+// Dispatch hands a verified notification to the matching receiver method
+func (me *NotificationHandler) Dispatch(ctx context.Context, event interface{}) error {
+	var err error
+
+	switch e := event.(type) {
+	case EmailDisabledEvent:
+		err = me.receiver.EmailDisabled(ctx, e)
+	case EmailEnabledEvent:
+		err = me.receiver.EmailEnabled(ctx, e)
+	case ConsentRevokedEvent:
+		err = me.receiver.ConsentRevoked(ctx, e)
+	case AccountDeleteEvent:
+		err = me.receiver.AccountDeleted(ctx, e)
+	default:
+		err = fmt.Errorf("%w: %T", ErrNotificationUnknownType, event)
+	}
+
+	if err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Msg("apple notification not handled")
+	}
+
+	return err
+}
+
+// VerifyNotification checks the signature, issuer, audience and issue time of a notification jwt, refusing
+// ones issued longer than the notification max age ago, and returns its event as one of EmailDisabledEvent, EmailEnabledEvent, ConsentRevokedEvent or AccountDeleteEvent.
+func (me *IDTokenVerifier) VerifyNotification(ctx context.Context, payload string) (interface{}, error) {
+	claims := &notificationClaims{}
+
+	parser := jwt.NewParser(jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg()}), jwt.WithoutClaimsValidation())
+
+	if _, err := parser.ParseWithClaims(payload, claims, me.keys.BuildKeyFunc(ctx)); err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Msg("invalid apple notification")
+		return nil, fmt.Errorf("%w: %v", ErrNotificationInvalid, err)
+	}
+
+	if claims.Issuer != Issuer {
+		return nil, fmt.Errorf("%w: %q", ErrIDTokenInvalidIssuer, claims.Issuer)
+	}
+
+	if !me.audienceAllowed(claims.Audience) {
+		return nil, fmt.Errorf("%w: %v", ErrIDTokenInvalidAudience, []string(claims.Audience))
+	}
+
+	if claims.IssuedAt == nil || me.now().Add(me.leeway).Before(claims.IssuedAt.Time) {
+		return nil, ErrIDTokenIssuedInFuture
+	}
+
+	if age := me.now().Sub(claims.IssuedAt.Time); age > me.notificationMaxAge()+me.leeway {
+		zerolog.Ctx(ctx).Error().Dur("age", age).Str("jti", claims.ID).Msg("stale apple notification")
+		return nil, fmt.Errorf("%w: issued %s ago", ErrNotificationStale, age)
+	}
+
+	// apple sends the events claim as a json encoded string, accept a plain object as well
+	raw := []byte(claims.Events)
+	var str string
+	if err := json.Unmarshal(raw, &str); err == nil {
+		raw = []byte(str)
+	}
+
+	var ev notificationEvent
+	if err := json.Unmarshal(raw, &ev); err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Msg("invalid apple notification events claim")
+		return nil, fmt.Errorf("%w: %v", ErrNotificationInvalid, err)
+	}
+
+	if ev.Subject == "" {
+		return nil, ErrIDTokenMissingSubject
+	}
+
+	common := NotificationEvent{
+		Type:      ev.Type,
+		Subject:   ev.Subject,
+		EventTime: eventTime(ev.EventTime),
+		ID:        claims.ID,
+		IssuedAt:  claims.IssuedAt.Time,
+	}
+
+	switch ev.Type {
+	case NotificationTypeEmailDisabled:
+		return EmailDisabledEvent{NotificationEvent: common, Email: ev.Email, IsPrivateEmail: bool(ev.IsPrivateEmail)}, nil
+	case NotificationTypeEmailEnabled:
+		return EmailEnabledEvent{NotificationEvent: common, Email: ev.Email, IsPrivateEmail: bool(ev.IsPrivateEmail)}, nil
+	case NotificationTypeConsentRevoked:
+		return ConsentRevokedEvent{NotificationEvent: common}, nil
+	case NotificationTypeAccountDelete:
+		return AccountDeleteEvent{NotificationEvent: common}, nil
+	default:
+		return common, nil
+	}
+}
+
+type notificationClaims struct {
+	Issuer   string           `json:"iss"`
+	Audience jwt.ClaimStrings `json:"aud"`
+	IssuedAt *jwt.NumericDate `json:"iat"`
+	ID       string           `json:"jti"`
+	Events   json.RawMessage  `json:"events"`
+}
+
+// Valid is a no-op, claims are verified by IDTokenVerifier.VerifyNotification
+func (notificationClaims) Valid() error { return nil }
+
+type notificationEvent struct {
+	Type           NotificationType `json:"type"`
+	Subject        string           `json:"sub"`
+	Email          string           `json:"email"`
+	IsPrivateEmail appleBool        `json:"is_private_email"`
+	EventTime      int64            `json:"event_time"`
+}
+
+// eventTime converts event_time, which apple documents in seconds but delivers in milliseconds
+func eventTime(v int64) time.Time {
+	if v > 1e12 {
+		return time.UnixMilli(v)
+	}
+	return time.Unix(v, 0)
+}
+
+// MemoryDeduplicator is a NotificationDeduplicator for a single instance, keeping the keys in memory
+type MemoryDeduplicator struct {
+	mu   sync.Mutex
+	keys map[string]time.Time
+	time func() time.Time
+}
+
+var _ NotificationDeduplicator = (*MemoryDeduplicator)(nil)
+
+func NewMemoryDeduplicator() *MemoryDeduplicator {
+	return &MemoryDeduplicator{keys: map[string]time.Time{}, time: time.Now}
+}
+
+// WithTime sets the clock expired keys are pruned by
+func (me *MemoryDeduplicator) WithTime(now func() time.Time) *MemoryDeduplicator {
+	me.time = now
+	return me
+}
+
+func (me *MemoryDeduplicator) Claim(_ context.Context, key string, expires time.Time) (bool, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+
+	now := me.time()
+	for k, exp := range me.keys {
+		if !now.Before(exp) {
+			delete(me.keys, k)
+		}
+	}
+
+	if _, ok := me.keys[key]; ok {
+		return false, nil
+	}
+
+	me.keys[key] = expires
+	return true, nil
+}
+
+func (me *MemoryDeduplicator) Release(_ context.Context, key string) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+
+	delete(me.keys, key)
+	return nil
+}
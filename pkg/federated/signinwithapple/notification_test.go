@@ -0,0 +1,187 @@
+package signinwithapple
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingReceiver struct {
+	events []interface{}
+	err    error
+}
+
+func (me *recordingReceiver) EmailDisabled(_ context.Context, e EmailDisabledEvent) error {
+	me.events = append(me.events, e)
+	return me.err
+}
+
+func (me *recordingReceiver) EmailEnabled(_ context.Context, e EmailEnabledEvent) error {
+	me.events = append(me.events, e)
+	return me.err
+}
+
+func (me *recordingReceiver) ConsentRevoked(_ context.Context, e ConsentRevokedEvent) error {
+	me.events = append(me.events, e)
+	return me.err
+}
+
+func (me *recordingReceiver) AccountDeleted(_ context.Context, e AccountDeleteEvent) error {
+	me.events = append(me.events, e)
+	return me.err
+}
+
+func TestNotificationHandler(t *testing.T) {
+	now := time.Unix(1668984054, 0)
+	sub := "001437.def535ddd9e24c4fa4367dca50fdfedb.1951"
+	jti := "Xo4Y6lT3wvGvKiyJ4HpUpA"
+
+	claims := func(iss string, events interface{}) jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss":    iss,
+			"aud":    "xyz.nugg.web",
+			"iat":    now.Unix(),
+			"jti":    jti,
+			"events": events,
+		}
+	}
+
+	stale := claims(Issuer, `{"type":"account-delete","sub":"`+sub+`","event_time":1668984054000}`)
+	stale["iat"] = now.Add(-DefaultNotificationMaxAge - 2*DefaultLeeway).Unix()
+
+	tests := []struct {
+		name        string
+		claims      jwt.MapClaims
+		receiverErr error
+		wantStatus  int
+		want        []interface{}
+	}{
+		{
+			name:       "email disabled",
+			claims:     claims(Issuer, `{"type":"email-disabled","sub":"`+sub+`","email":"abc@privaterelay.appleid.com","is_private_email":"true","event_time":1668984054000}`),
+			wantStatus: http.StatusOK,
+			want: []interface{}{EmailDisabledEvent{
+				NotificationEvent: NotificationEvent{Type: NotificationTypeEmailDisabled, Subject: sub, EventTime: now, ID: jti, IssuedAt: now},
+				Email:             "abc@privaterelay.appleid.com",
+				IsPrivateEmail:    true,
+			}},
+		},
+		{
+			name:       "email enabled",
+			claims:     claims(Issuer, `{"type":"email-enabled","sub":"`+sub+`","email":"abc@privaterelay.appleid.com","is_private_email":true,"event_time":1668984054}`),
+			wantStatus: http.StatusOK,
+			want: []interface{}{EmailEnabledEvent{
+				NotificationEvent: NotificationEvent{Type: NotificationTypeEmailEnabled, Subject: sub, EventTime: now, ID: jti, IssuedAt: now},
+				Email:             "abc@privaterelay.appleid.com",
+				IsPrivateEmail:    true,
+			}},
+		},
+		{
+			name:       "consent revoked",
+			claims:     claims(Issuer, `{"type":"consent-revoked","sub":"`+sub+`","event_time":1668984054000}`),
+			wantStatus: http.StatusOK,
+			want: []interface{}{ConsentRevokedEvent{
+				NotificationEvent: NotificationEvent{Type: NotificationTypeConsentRevoked, Subject: sub, EventTime: now, ID: jti, IssuedAt: now},
+			}},
+		},
+		{
+			name:       "account delete as object",
+			claims:     claims(Issuer, map[string]interface{}{"type": "account-delete", "sub": sub, "event_time": 1668984054000}),
+			wantStatus: http.StatusOK,
+			want: []interface{}{AccountDeleteEvent{
+				NotificationEvent: NotificationEvent{Type: NotificationTypeAccountDelete, Subject: sub, EventTime: now, ID: jti, IssuedAt: now},
+			}},
+		},
+		{
+			name:       "unknown type is acknowledged",
+			claims:     claims(Issuer, `{"type":"something-new","sub":"`+sub+`","event_time":1668984054000}`),
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "wrong issuer",
+			claims:     claims("https://evil.example.com", `{"type":"account-delete","sub":"`+sub+`","event_time":1668984054000}`),
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "stale notification",
+			claims:     stale,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:        "receiver failure is retried",
+			claims:      claims(Issuer, `{"type":"consent-revoked","sub":"`+sub+`","event_time":1668984054000}`),
+			receiverErr: errors.New("storage down"),
+			wantStatus:  http.StatusInternalServerError,
+			want: []interface{}{ConsentRevokedEvent{
+				NotificationEvent: NotificationEvent{Type: NotificationTypeConsentRevoked, Subject: sub, EventTime: now, ID: jti, IssuedAt: now},
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ks, keys := newTestKeySet(t)
+
+			rec := &recordingReceiver{err: tt.receiverErr}
+			handler := NewNotificationHandler(NewIDTokenVerifier(keys, "xyz.nugg.web").WithTime(now), rec)
+
+			req := httptest.NewRequest(http.MethodPost, "/auth/apple/notifications", strings.NewReader(`{"payload":"`+ks.sign(t, tt.claims)+`"}`))
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, req)
+
+			require.Equal(t, tt.wantStatus, w.Code)
+			assert.Equal(t, tt.want, rec.events)
+		})
+	}
+}
+
+func TestNotificationHandlerDeduplicates(t *testing.T) {
+	now := time.Unix(1668984054, 0)
+	ks, keys := newTestKeySet(t)
+
+	payload := ks.sign(t, jwt.MapClaims{
+		"iss":    Issuer,
+		"aud":    "xyz.nugg.web",
+		"iat":    now.Unix(),
+		"jti":    "Xo4Y6lT3wvGvKiyJ4HpUpA",
+		"events": `{"type":"account-delete","sub":"001437.def535ddd9e24c4fa4367dca50fdfedb.1951","event_time":1668984054000}`,
+	})
+
+	rec := &recordingReceiver{}
+	clock := now
+	verifier := NewIDTokenVerifier(keys, "xyz.nugg.web").WithTime(now).WithNotificationMaxAge(time.Hour)
+	handler := NewNotificationHandler(verifier, rec).WithDeduplicator(NewMemoryDeduplicator().WithTime(func() time.Time { return clock }))
+
+	deliver := func() int {
+		req := httptest.NewRequest(http.MethodPost, "/auth/apple/notifications", strings.NewReader(`{"payload":"`+payload+`"}`))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// a failed dispatch is handled again when apple retries
+	rec.err = errors.New("storage down")
+	require.Equal(t, http.StatusInternalServerError, deliver())
+	rec.err = nil
+	require.Equal(t, http.StatusOK, deliver())
+	require.Len(t, rec.events, 2)
+
+	// the replay is acknowledged without being dispatched again
+	require.Equal(t, http.StatusOK, deliver())
+	assert.Len(t, rec.events, 2)
+
+	// once it is past its max age the verifier refuses it before it gets to the deduplicator
+	clock = now.Add(2 * time.Hour)
+	handler.verifier.WithTime(clock)
+	assert.Equal(t, http.StatusBadRequest, deliver())
+	assert.Len(t, rec.events, 2)
+}
@@ -0,0 +1,79 @@
+package signinwithapple
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/walteh/webauthn/pkg/federated"
+)
+
+// ProviderID is recorded on identities verified by sign in with apple
+const ProviderID = "apple"
+
+var _ federated.Provider = (*Provider)(nil)
+
+// Provider adapts the sign in with apple client and id token verifier to federated.Provider
+type Provider struct {
+	client   *Client
+	verifier *IDTokenVerifier
+	pk       string
+}
+
+// NewProvider creates the provider, pk is the pem encoded key used to generate client secrets
+func NewProvider(client *Client, verifier *IDTokenVerifier, pk string) *Provider {
+	return &Provider{
+		client:   client,
+		verifier: verifier,
+		pk:       pk,
+	}
+}
+
+func (me *Provider) ID() string { return ProviderID }
+
+func (me *Provider) AuthorizationURL(_ context.Context, req federated.AuthorizeRequest) (string, error) {
+	return me.client.AuthorizationURL(AuthorizationURLRequest{
+		RedirectURI: req.RedirectURI,
+		State:       req.State,
+		RawNonce:    req.RawNonce,
+		Scopes:      req.Scopes,
+	}), nil
+}
+
+func (me *Provider) ExchangeCode(ctx context.Context, req federated.ExchangeRequest) (*federated.Tokens, error) {
+	redirect, err := url.Parse(req.RedirectURI)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := me.client.ValidateWebToken(ctx, me.pk, req.Code, redirect)
+	if err != nil {
+		return nil, err
+	}
+
+	return &federated.Tokens{
+		AccessToken:  resp.AccessToken,
+		RefreshToken: resp.RefreshToken,
+		IDToken:      resp.IDToken,
+		ExpiresIn:    resp.ExpiresIn,
+	}, nil
+}
+
+func (me *Provider) VerifyIDToken(ctx context.Context, idToken string, rawNonce string) (*federated.Identity, error) {
+	ident, err := me.verifier.Verify(ctx, idToken, rawNonce)
+	if err != nil {
+		return nil, err
+	}
+
+	return ident.Federated(), nil
+}
+
+// Federated converts the apple specific identity into the normalized federated.Identity
+func (me *AppleIdentity) Federated() *federated.Identity {
+	return &federated.Identity{
+		Provider:       ProviderID,
+		Subject:        me.Subject,
+		Email:          me.Email,
+		EmailVerified:  me.EmailVerified,
+		IsPrivateEmail: me.IsPrivateEmail,
+	}
+}
@@ -0,0 +1,285 @@
+package signinwithapple
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	ScopeName  = "name"
+	ScopeEmail = "email"
+
+	// ResponseModeFormPost makes apple post the authorization result to the redirect uri,
+	// which it requires whenever scopes are requested
+	ResponseModeFormPost = "form_post"
+)
+
+// TokenTypeHint tells apple which kind of token is being revoked
+type TokenTypeHint string
+
+const (
+	TokenTypeHintRefreshToken TokenTypeHint = "refresh_token"
+	TokenTypeHintAccessToken  TokenTypeHint = "access_token"
+)
+
+var (
+	ErrAuthorizationDenied  = errors.New("ErrAuthorizationDenied")
+	ErrAuthorizationInvalid = errors.New("ErrAuthorizationInvalid")
+	ErrAuthorizationState   = errors.New("ErrAuthorizationState")
+	ErrRevokeFailed         = errors.New("ErrRevokeFailed")
+)
+
+// AuthorizationURLRequest describes the authorize redirect for the web flow
+// https://developer.apple.com/documentation/sign_in_with_apple/request_an_authorization_to_the_sign_in_with_apple_server
+type AuthorizationURLRequest struct {
+	// RedirectURI must be registered for the services id, apple posts the result to it
+	RedirectURI string
+
+	// State is returned unchanged in the callback and must be checked against the value stored for the browser
+	State string
+
+	// RawNonce is hashed before it is sent, the id_token carries the hash (see HashNonce)
+	RawNonce string
+
+	// Scopes are any of ScopeName and ScopeEmail
+	Scopes []string
+}
+
+// AuthorizationURL builds the url the browser is sent to in order to sign in
+func (me *Client) AuthorizationURL(req AuthorizationURLRequest) string {
+	q := url.Values{}
+	q.Set("client_id", me.config.ClientID)
+	q.Set("redirect_uri", req.RedirectURI)
+	q.Set("response_type", "code id_token")
+	q.Set("response_mode", ResponseModeFormPost)
+	q.Set("state", req.State)
+
+	if req.RawNonce != "" {
+		q.Set("nonce", HashNonce(req.RawNonce))
+	}
+
+	if len(req.Scopes) > 0 {
+		q.Set("scope", strings.Join(req.Scopes, " "))
+	}
+
+	u := me.endpoint("authorize")
+	u.RawQuery = q.Encode()
+
+	return u.String()
+}
+
+// RevokeToken invalidates a refresh or access token previously issued to the client
+// https://developer.apple.com/documentation/sign_in_with_apple/revoke_tokens
+func (me *Client) RevokeToken(ctx context.Context, pk string, token string, hint TokenTypeHint) error {
+	secret, err := me.config.GenerateClientSecret(pk)
+	if err != nil {
+		return err
+	}
+
+	data := url.Values{}
+	data.Set("client_id", me.config.ClientID)
+	data.Set("client_secret", secret)
+	data.Set("token", token)
+	data.Set("token_type_hint", string(hint))
+
+	req, err := http.NewRequestWithContext(ctx, "POST", me.endpoint("revoke").String(), strings.NewReader(data.Encode()))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Add("content-type", ContentType)
+	req.Header.Add("accept", AcceptHeader)
+	req.Header.Add("user-agent", UserAgent) // apple requires a user agent
+
+	res, err := me.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		var body RefreshResponse
+		_ = json.NewDecoder(io.LimitReader(res.Body, 1<<16)).Decode(&body)
+		return fmt.Errorf("%w: %d %s %s", ErrRevokeFailed, res.StatusCode, body.Error, body.ErrorDescription)
+	}
+
+	return nil
+}
+
+// endpoint resolves a sibling of the validation url, so /auth/token becomes /auth/authorize or /auth/revoke
+func (me *Client) endpoint(name string) *url.URL {
+	base, err := url.Parse(me.validationURL)
+	if err != nil {
+		return &url.URL{Path: name}
+	}
+	return base.ResolveReference(&url.URL{Path: name})
+}
+
+// NewRandomValue returns a url safe random string suitable for a state or a raw nonce
+func NewRandomValue() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// AuthorizationUser is the one-time user json apple posts the first time a user authorizes the app
+type AuthorizationUser struct {
+	Name struct {
+		FirstName string `json:"firstName"`
+		LastName  string `json:"lastName"`
+	} `json:"name"`
+	Email string `json:"email"`
+}
+
+// AuthorizationCallback is the form apple posts to the redirect uri
+type AuthorizationCallback struct {
+	Code    string
+	IDToken string
+	State   string
+
+	// User is only present on the first authorization, it must be stored then as apple never sends it again
+	User *AuthorizationUser
+}
+
+// ParseAuthorizationCallback reads the form_post body of the redirect
+func ParseAuthorizationCallback(r *http.Request) (*AuthorizationCallback, error) {
+	if err := r.ParseForm(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrAuthorizationInvalid, err)
+	}
+
+	if e := r.PostForm.Get("error"); e != "" {
+		return nil, fmt.Errorf("%w: %s", ErrAuthorizationDenied, e)
+	}
+
+	cb := &AuthorizationCallback{
+		Code:    r.PostForm.Get("code"),
+		IDToken: r.PostForm.Get("id_token"),
+		State:   r.PostForm.Get("state"),
+	}
+
+	if cb.Code == "" || cb.State == "" {
+		return nil, fmt.Errorf("%w: missing code or state", ErrAuthorizationInvalid)
+	}
+
+	if u := r.PostForm.Get("user"); u != "" {
+		cb.User = &AuthorizationUser{}
+		if err := json.Unmarshal([]byte(u), cb.User); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrAuthorizationInvalid, err)
+		}
+	}
+
+	return cb, nil
+}
+
+// AuthorizationStateStore remembers the state and raw nonce of each authorize redirect
+type AuthorizationStateStore interface {
+	// ConsumeState returns the raw nonce stored for state and forgets it, so a callback can not be replayed
+	ConsumeState(ctx context.Context, state string) (rawNonce string, err error)
+}
+
+// WebSignInResult is a completed web sign in
+type WebSignInResult struct {
+	Identity *AppleIdentity
+	User     *AuthorizationUser
+	Tokens   *ValidationResponse
+}
+
+// WebSignInReceiver finishes a web sign in, usually by starting a session and redirecting
+type WebSignInReceiver interface {
+	WebSignIn(ctx context.Context, w http.ResponseWriter, r *http.Request, result *WebSignInResult)
+}
+
+// CallbackHandler handles the form_post redirect: it checks the state, exchanges the code and
+// verifies the returned id_token before handing the result to the receiver.
+type CallbackHandler struct {
+	client      *Client
+	verifier    *IDTokenVerifier
+	states      AuthorizationStateStore
+	receiver    WebSignInReceiver
+	pk          string
+	redirectURI string
+}
+
+var _ http.Handler = (*CallbackHandler)(nil)
+
+func NewCallbackHandler(client *Client, verifier *IDTokenVerifier, states AuthorizationStateStore, receiver WebSignInReceiver, pk string, redirectURI string) *CallbackHandler {
+	return &CallbackHandler{
+		client:      client,
+		verifier:    verifier,
+		states:      states,
+		receiver:    receiver,
+		pk:          pk,
+		redirectURI: redirectURI,
+	}
+}
+
+func (me *CallbackHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	result, err := me.Complete(ctx, r)
+	if err != nil {
+		if errors.Is(err, ErrAuthorizationInvalid) || errors.Is(err, ErrAuthorizationDenied) || errors.Is(err, ErrAuthorizationState) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	me.receiver.WebSignIn(ctx, w, r, result)
+}
+
+// Complete runs the callback steps without writing a response
+func (me *CallbackHandler) Complete(ctx context.Context, r *http.Request) (*WebSignInResult, error) {
+	cb, err := ParseAuthorizationCallback(r)
+	if err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Msg("invalid apple authorization callback")
+		return nil, err
+	}
+
+	rawNonce, err := me.states.ConsumeState(ctx, cb.State)
+	if err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Msg("unknown apple authorization state")
+		return nil, fmt.Errorf("%w: %v", ErrAuthorizationState, err)
+	}
+
+	redirect, err := url.Parse(me.redirectURI)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := me.client.ValidateWebToken(ctx, me.pk, cb.Code, redirect)
+	if err != nil {
+		return nil, err
+	}
+
+	// the token endpoint's id_token is authoritative, the one in the form is only a convenience for clients
+	ident, err := me.verifier.Verify(ctx, tokens.IDToken, rawNonce)
+	if err != nil {
+		return nil, err
+	}
+
+	return &WebSignInResult{
+		Identity: ident,
+		User:     cb.User,
+		Tokens:   tokens,
+	}, nil
+}
@@ -0,0 +1,341 @@
+package lambda
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/walteh/webauthn/app/devicecheck_assert"
+	devicecheck "github.com/walteh/webauthn/app/devicecheck_attest"
+	"github.com/walteh/webauthn/app/passkey_assert"
+	"github.com/walteh/webauthn/app/passkey_attest"
+	"github.com/walteh/webauthn/pkg/accesstoken"
+	"github.com/walteh/webauthn/pkg/accesstoken/cognito"
+	"github.com/walteh/webauthn/pkg/errd"
+	"github.com/walteh/webauthn/pkg/hex"
+	"github.com/walteh/webauthn/pkg/ratelimit"
+	"github.com/walteh/webauthn/pkg/relyingparty"
+	"github.com/walteh/webauthn/pkg/storage"
+	"github.com/walteh/webauthn/pkg/webauthnerr"
+	"github.com/walteh/webauthn/pkg/wellknown"
+)
+
+const (
+	PasskeyAttestationHeader     = "X-Nugg-Webauthn-Creation"
+	PasskeyAssertionHeader       = "X-Nugg-Webauthn-Assertion"
+	DeviceCheckAttestationHeader = "X-Nugg-DeviceCheck-Attestation"
+	DeviceCheckAssertionHeader   = "X-Nugg-DeviceCheck-Assertion"
+	AccessTokenHeader            = "X-Nugg-Access-Token"
+	TenantHeader                 = "X-Nugg-Tenant"
+)
+
+const (
+	PasskeyAttestationPath     = "/auth/apple/passkey/register"
+	PasskeyAssertionPath       = "/auth/apple/passkey/login"
+	DeviceCheckAttestationPath = "/auth/apple/devicecheck/attest"
+	DeviceCheckAssertionPath   = "/auth/apple/devicecheck/assert"
+)
+
+var (
+	ErrLambdaMissingHeader = errors.New("ErrLambdaMissingHeader")
+	ErrLambdaInvalidHeader = errors.New("ErrLambdaInvalidHeader")
+	ErrLambdaInvalidBody   = errors.New("ErrLambdaInvalidBody")
+	ErrLambdaUnknownRoute  = errors.New("ErrLambdaUnknownRoute")
+)
+
+// XNuggWebauthnCreation is the json carried (standard base64 encoded) in the X-Nugg-Webauthn-Creation header.
+type XNuggWebauthnCreation struct {
+	RawAttestationObject []byte `json:"rawAttestationObject"`
+	RawClientData        []byte `json:"rawClientData"`
+	CredentialID         []byte `json:"credentialID"`
+}
+
+// XNuggWebauthnAssertion is the json carried (standard base64 encoded) in the X-Nugg-Webauthn-Assertion header.
+type XNuggWebauthnAssertion struct {
+	UserID               []byte `json:"userID"`
+	CredentialID         []byte `json:"credentialID"`
+	RawClientDataJSON    []byte `json:"rawClientDataJSON"`
+	RawAuthenticatorData []byte `json:"rawAuthenticatorData"`
+	Signature            []byte `json:"signature"`
+	PublicKey            []byte `json:"publicKey,omitempty"`
+	AAGUID               []byte `json:"aaguid,omitempty"`
+	Type                 string `json:"credentialType"`
+}
+
+// XNuggDeviceCheckAttestation is the json carried (standard base64 encoded) in the X-Nugg-DeviceCheck-Attestation header.
+type XNuggDeviceCheckAttestation struct {
+	RawAttestationObject []byte `json:"rawAttestationObject"`
+	RawClientData        []byte `json:"rawClientData"`
+	CredentialID         []byte `json:"credentialID"`
+	SessionID            []byte `json:"sessionID"`
+}
+
+// The X-Nugg-DeviceCheck-Assertion header carries the standard base64 encoded assertion json
+// understood by assertion.ParseFidoAssertionInput; the request body is the data the device signed.
+
+type Handler struct {
+	storage      storage.Provider
+	relyingParty relyingparty.Provider
+	accessTokens accesstoken.Provider
+	cognito      cognito.Client
+	production   bool
+	appIDs       []string
+	limiter      *ratelimit.Limiter
+	registry     *relyingparty.Registry
+}
+
+func NewHandler(stg storage.Provider, rp relyingparty.Provider, tkns accesstoken.Provider, cog cognito.Client) *Handler {
+	return &Handler{
+		storage:      stg,
+		relyingParty: rp,
+		accessTokens: tkns,
+		cognito:      cog,
+	}
+}
+
+// WithProduction makes the device check attestation flow refuse keys attested in the development environment.
+func (me *Handler) WithProduction(production bool) *Handler {
+	me.production = production
+	return me
+}
+
+// WithAppIDs sets the "TEAMID.bundle.id" app ids the device check flows accept, instead of only the relying party id.
+// They are ignored when a registry is set, each tenant accepts the app ids of its policy.
+func (me *Handler) WithAppIDs(appIDs ...string) *Handler {
+	me.appIDs = appIDs
+	return me
+}
+
+// appIDsOf returns the app ids the device check flows of ctx are given, none when they resolve a tenant
+func (me *Handler) appIDsOf(ctx context.Context) []string {
+	if relyingparty.ResolverOf(ctx) != nil {
+		return nil
+	}
+	return me.appIDs
+}
+
+// WithLimiter rate limits the flows by the source ip of the requests and their sessions and credentials.
+func (me *Handler) WithLimiter(limiter *ratelimit.Limiter) *Handler {
+	me.limiter = limiter
+	return me
+}
+
+// WithRegistry serves the tenants of the registry, picked by the X-Nugg-Tenant header or the host the
+// request was sent to. The relying party of the handler is only used when no registry is set.
+func (me *Handler) WithRegistry(registry *relyingparty.Registry) *Handler {
+	me.registry = registry
+	return me
+}
+
+// Invoke routes an api gateway event to the matching app flow. Failures are reported through the
+// status code of the response, so the returned error is only non-nil when no response could be built.
+func (me *Handler) Invoke(ctx context.Context, req APIGatewayV2HTTPRequest) (APIGatewayV2HTTPResponse, error) {
+	path := req.RawPath
+	if path == "" {
+		path = req.RequestContext.HTTP.Path
+	}
+
+	if me.registry != nil {
+		host := req.Header("host")
+		if host == "" {
+			host = req.RequestContext.DomainName
+		}
+		ctx = relyingparty.WithResolver(relyingparty.WithHint(ctx, relyingparty.Hint{TenantID: req.Header(TenantHeader), Host: host}), me.registry)
+	}
+
+	if me.limiter != nil {
+		ctx = ratelimit.WithLimiter(ratelimit.WithClient(ctx, ratelimit.Client{IP: req.RequestContext.HTTP.SourceIP}), me.limiter)
+	}
+
+	switch strings.TrimSuffix(path, "/") {
+	case PasskeyAttestationPath:
+		return me.PasskeyAttest(ctx, req)
+	case PasskeyAssertionPath:
+		return me.PasskeyAssert(ctx, req)
+	case DeviceCheckAttestationPath:
+		return me.DeviceCheckAttest(ctx, req)
+	case DeviceCheckAssertionPath:
+		return me.DeviceCheckAssert(ctx, req)
+	case wellknown.WebAuthnPath, wellknown.AppleAppSiteAssociationPath, wellknown.AssetLinksPath:
+		return me.WellKnown(ctx, req, path)
+	default:
+		_ = errd.Wrap(ctx, ErrLambdaUnknownRoute, path)
+		return response(404, nil), nil
+	}
+}
+
+func (me *Handler) PasskeyAttest(ctx context.Context, req APIGatewayV2HTTPRequest) (APIGatewayV2HTTPResponse, error) {
+	var hdr XNuggWebauthnCreation
+	if err := decodeHeader(ctx, req, PasskeyAttestationHeader, &hdr); err != nil {
+		return problem(req, err), nil
+	}
+
+	out, err := passkey_attest.Attest(ctx, me.storage, me.relyingParty, me.accessTokens, passkey_attest.PasskeyAttestationInput{
+		RawAttestationObject: hdr.RawAttestationObject,
+		UTF8ClientDataJSON:   string(hdr.RawClientData),
+		RawCredentialID:      hdr.CredentialID,
+	})
+	if err != nil {
+		return problem(req, err), nil
+	}
+
+	return response(out.SuggestedStatusCode, accessTokenHeaders(out.AccessToken)), nil
+}
+
+func (me *Handler) PasskeyAssert(ctx context.Context, req APIGatewayV2HTTPRequest) (APIGatewayV2HTTPResponse, error) {
+	var hdr XNuggWebauthnAssertion
+	if err := decodeHeader(ctx, req, PasskeyAssertionHeader, &hdr); err != nil {
+		return problem(req, err), nil
+	}
+
+	out, err := passkey_assert.Assert(ctx, me.storage, me.relyingParty, me.cognito, passkey_assert.PasskeyAssertionInput{
+		SessionID:            hdr.UserID,
+		CredentialID:         hdr.CredentialID,
+		UTF8ClientDataJSON:   string(hdr.RawClientDataJSON),
+		RawAuthenticatorData: hdr.RawAuthenticatorData,
+		RawSignature:         hdr.Signature,
+		PublicKey:            hdr.PublicKey,
+		AAGUID:               hdr.AAGUID,
+	})
+	if err != nil {
+		return problem(req, err), nil
+	}
+
+	return response(out.SuggestedStatusCode, accessTokenHeaders(out.AccessToken)), nil
+}
+
+func (me *Handler) DeviceCheckAttest(ctx context.Context, req APIGatewayV2HTTPRequest) (APIGatewayV2HTTPResponse, error) {
+	var hdr XNuggDeviceCheckAttestation
+	if err := decodeHeader(ctx, req, DeviceCheckAttestationHeader, &hdr); err != nil {
+		return problem(req, err), nil
+	}
+
+	out, err := devicecheck.Attest(ctx, me.storage, me.relyingParty, devicecheck.DeviceCheckAttestationInput{
+		RawAttestationObject: hdr.RawAttestationObject,
+		UTF8ClientDataJSON:   string(hdr.RawClientData),
+		RawCredentialID:      hdr.CredentialID,
+		RawSessionID:         hdr.SessionID,
+		Production:           me.production,
+		AppIDs:               me.appIDsOf(ctx),
+	})
+	if err != nil {
+		return problem(req, err), nil
+	}
+
+	return response(out.SuggestedStatusCode, nil), nil
+}
+
+func (me *Handler) DeviceCheckAssert(ctx context.Context, req APIGatewayV2HTTPRequest) (APIGatewayV2HTTPResponse, error) {
+	raw := req.Header(DeviceCheckAssertionHeader)
+	if raw == "" {
+		return problem(req, errd.Wrap(ctx, webauthnerr.New(webauthnerr.CodeInvalidInput, ErrLambdaMissingHeader), DeviceCheckAssertionHeader)), nil
+	}
+
+	assertion, err := base64.StdEncoding.DecodeString(raw)
+	if err != nil {
+		return problem(req, errd.Wrap(ctx, webauthnerr.New(webauthnerr.CodeInvalidInput, ErrLambdaInvalidHeader), DeviceCheckAssertionHeader, err.Error())), nil
+	}
+
+	body, err := req.RawBody()
+	if err != nil {
+		return problem(req, errd.Wrap(ctx, webauthnerr.New(webauthnerr.CodeInvalidInput, ErrLambdaInvalidBody), err.Error())), nil
+	}
+
+	out, err := devicecheck_assert.Assert(ctx, me.storage, me.relyingParty, devicecheck_assert.DeviceCheckAssertionInput{
+		RawAssertionObject:   assertion,
+		ClientDataToValidate: body,
+		AppIDs:               me.appIDsOf(ctx),
+	})
+	if err != nil {
+		return problem(req, err), nil
+	}
+
+	return response(out.SuggestedStatusCode, nil), nil
+}
+
+// WellKnown serves the association file at path generated from the configuration of the request's tenant,
+// the one its origins are validated with.
+func (me *Handler) WellKnown(ctx context.Context, req APIGatewayV2HTTPRequest, path string) (APIGatewayV2HTTPResponse, error) {
+	tenant, err := relyingparty.Resolve(ctx, me.relyingParty, nil)
+	if err != nil {
+		return problem(req, err), nil
+	}
+
+	body, _, err := wellknown.Document(tenant, path)
+	if err != nil {
+		return problem(req, err), nil
+	}
+
+	return APIGatewayV2HTTPResponse{
+		StatusCode: 200,
+		Headers:    map[string]string{"Content-Type": wellknown.ContentType},
+		Body:       string(body),
+	}, nil
+}
+
+// RawBody returns the request body, undoing the base64 encoding api gateway applies to binary payloads.
+func (me APIGatewayV2HTTPRequest) RawBody() (hex.Hash, error) {
+	if !me.IsBase64Encoded {
+		return hex.Hash(me.Body), nil
+	}
+	return base64.StdEncoding.DecodeString(me.Body)
+}
+
+func decodeHeader(ctx context.Context, req APIGatewayV2HTTPRequest, name string, v interface{}) error {
+	raw := req.Header(name)
+	if raw == "" {
+		return errd.Wrap(ctx, webauthnerr.New(webauthnerr.CodeInvalidInput, ErrLambdaMissingHeader), name)
+	}
+
+	js, err := base64.StdEncoding.DecodeString(raw)
+	if err != nil {
+		return errd.Wrap(ctx, webauthnerr.New(webauthnerr.CodeInvalidInput, ErrLambdaInvalidHeader), name, err.Error())
+	}
+
+	if err := json.Unmarshal(js, v); err != nil {
+		return errd.Wrap(ctx, webauthnerr.New(webauthnerr.CodeInvalidInput, ErrLambdaInvalidHeader), name, err.Error())
+	}
+
+	return nil
+}
+
+func header(headers map[string]string, name string) string {
+	if v, ok := headers[name]; ok {
+		return v
+	}
+	for k, v := range headers {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	return ""
+}
+
+func accessTokenHeaders(tkn string) map[string]string {
+	if tkn == "" {
+		return nil
+	}
+	return map[string]string{AccessTokenHeader: tkn}
+}
+
+// problem answers a failed request with the problem+json document describing err
+func problem(req APIGatewayV2HTTPRequest, err error) APIGatewayV2HTTPResponse {
+	body, _ := webauthnerr.MarshalProblem(err, req.RequestContext.RequestID)
+	return APIGatewayV2HTTPResponse{
+		StatusCode: webauthnerr.HTTPStatus(err),
+		Headers:    map[string]string{"Content-Type": webauthnerr.ProblemContentType},
+		Body:       string(body),
+	}
+}
+
+func response(status int, headers map[string]string) APIGatewayV2HTTPResponse {
+	if status == 0 {
+		status = 500
+	}
+	return APIGatewayV2HTTPResponse{
+		StatusCode: status,
+		Headers:    headers,
+	}
+}
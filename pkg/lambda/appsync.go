@@ -0,0 +1,157 @@
+package lambda
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"strings"
+
+	"github.com/walteh/webauthn/app/devicecheck_assert"
+	"github.com/walteh/webauthn/pkg/errd"
+	"github.com/walteh/webauthn/pkg/hex"
+	"github.com/walteh/webauthn/pkg/relyingparty"
+	"github.com/walteh/webauthn/pkg/storage"
+	"github.com/walteh/webauthn/pkg/webauthn/assertion"
+)
+
+// An appsync authorization token is "Nugg06 " followed by one of:
+//
+//	appattest:<standard base64 encoded assertion json>  - an app attest assertion over the graphql query
+//	session:<token>                                      - a session token issued by an accesstoken.Provider
+const (
+	AppAttestTokenKind = "appattest"
+	SessionTokenKind   = "session"
+)
+
+const (
+	ResolverContextAuthType     = "auth_type"
+	ResolverContextCredentialID = "credential_id"
+	ResolverContextUserID       = "user_id"
+)
+
+var (
+	ErrAuthorizerMissingPrefix = errors.New("ErrAuthorizerMissingPrefix")
+	ErrAuthorizerUnknownKind   = errors.New("ErrAuthorizerUnknownKind")
+	ErrAuthorizerInvalidToken  = errors.New("ErrAuthorizerInvalidToken")
+	ErrAuthorizerUnauthorized  = errors.New("ErrAuthorizerUnauthorized")
+)
+
+// SessionValidator resolves a session token back to the user it was issued for.
+type SessionValidator interface {
+	UserIDForSessionToken(ctx context.Context, token string) (string, error)
+}
+
+type Authorizer struct {
+	storage      storage.Provider
+	relyingParty relyingparty.Provider
+	sessions     SessionValidator
+	sessionTTL   int
+}
+
+func NewAuthorizer(stg storage.Provider, rp relyingparty.Provider, sessions SessionValidator) *Authorizer {
+	return &Authorizer{
+		storage:      stg,
+		relyingParty: rp,
+		sessions:     sessions,
+	}
+}
+
+// WithSessionTTL lets appsync cache session token decisions for the given number of seconds.
+// App attest assertions are single use and are never cached.
+func (me *Authorizer) WithSessionTTL(seconds int) *Authorizer {
+	me.sessionTTL = seconds
+	return me
+}
+
+// Invoke never returns an error for a rejected token - appsync treats a function error as a
+// failure of the authorizer itself, so rejections are reported with IsAuthorized=false.
+func (me *Authorizer) Invoke(ctx context.Context, req AppSyncLambdaAuthorizerRequest) (AppSyncLambdaAuthorizerResponse, error) {
+	kind, token, err := splitAuthorizationToken(ctx, req.AuthorizationToken)
+	if err != nil {
+		return unauthorized(), nil
+	}
+
+	switch kind {
+	case AppAttestTokenKind:
+		return me.authorizeAppAttest(ctx, token, req.RequestContext.QueryString)
+	case SessionTokenKind:
+		return me.authorizeSession(ctx, token)
+	default:
+		_ = errd.Wrap(ctx, ErrAuthorizerUnknownKind, kind)
+		return unauthorized(), nil
+	}
+}
+
+func (me *Authorizer) authorizeAppAttest(ctx context.Context, token string, query string) (AppSyncLambdaAuthorizerResponse, error) {
+	raw, err := base64.StdEncoding.DecodeString(token)
+	if err != nil {
+		_ = errd.Wrap(ctx, ErrAuthorizerInvalidToken, err.Error())
+		return unauthorized(), nil
+	}
+
+	parsed, err := assertion.ParseFidoAssertionInput(ctx, raw)
+	if err != nil {
+		return unauthorized(), nil
+	}
+
+	out, err := devicecheck_assert.Assert(ctx, me.storage, me.relyingParty, devicecheck_assert.DeviceCheckAssertionInput{
+		RawAssertionObject:   raw,
+		ClientDataToValidate: hex.Hash(query),
+	})
+	if err != nil || !out.OK {
+		_ = errd.Wrap(ctx, ErrAuthorizerUnauthorized, AppAttestTokenKind)
+		return unauthorized(), nil
+	}
+
+	return AppSyncLambdaAuthorizerResponse{
+		IsAuthorized: true,
+		ResolverContext: map[string]string{
+			ResolverContextAuthType:     AppAttestTokenKind,
+			ResolverContextCredentialID: parsed.CredentialID.Hex(),
+		},
+		TTLOverride: ttl(0),
+	}, nil
+}
+
+func (me *Authorizer) authorizeSession(ctx context.Context, token string) (AppSyncLambdaAuthorizerResponse, error) {
+	if me.sessions == nil {
+		_ = errd.Wrap(ctx, ErrAuthorizerUnknownKind, SessionTokenKind)
+		return unauthorized(), nil
+	}
+
+	userID, err := me.sessions.UserIDForSessionToken(ctx, token)
+	if err != nil || userID == "" {
+		_ = errd.Wrap(ctx, ErrAuthorizerUnauthorized, SessionTokenKind)
+		return unauthorized(), nil
+	}
+
+	return AppSyncLambdaAuthorizerResponse{
+		IsAuthorized: true,
+		ResolverContext: map[string]string{
+			ResolverContextAuthType: SessionTokenKind,
+			ResolverContextUserID:   userID,
+		},
+		TTLOverride: ttl(me.sessionTTL),
+	}, nil
+}
+
+func splitAuthorizationToken(ctx context.Context, header string) (string, string, error) {
+	if !strings.HasPrefix(header, relyingparty.AppsyncAuthHeaderPrefix) {
+		return "", "", errd.Wrap(ctx, ErrAuthorizerMissingPrefix)
+	}
+
+	kind, token, ok := strings.Cut(strings.TrimPrefix(header, relyingparty.AppsyncAuthHeaderPrefix), ":")
+	if !ok || token == "" {
+		return "", "", errd.Wrap(ctx, ErrAuthorizerInvalidToken)
+	}
+
+	return kind, token, nil
+}
+
+func unauthorized() AppSyncLambdaAuthorizerResponse {
+	return AppSyncLambdaAuthorizerResponse{IsAuthorized: false, TTLOverride: ttl(0)}
+}
+
+func ttl(seconds int) *int {
+	return &seconds
+}
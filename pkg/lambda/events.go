@@ -0,0 +1,77 @@
+package lambda
+
+// the event shapes below mirror the json documents that api gateway (http api, payload format 2.0)
+// and appsync (AWS_LAMBDA authorization) hand to a lambda function. only the fields the
+// adapters need are declared, so they unmarshal cleanly from the full events.
+
+type APIGatewayV2HTTPRequest struct {
+	Version               string                         `json:"version"`
+	RouteKey              string                         `json:"routeKey"`
+	RawPath               string                         `json:"rawPath"`
+	RawQueryString        string                         `json:"rawQueryString"`
+	Cookies               []string                       `json:"cookies,omitempty"`
+	Headers               map[string]string              `json:"headers"`
+	QueryStringParameters map[string]string              `json:"queryStringParameters,omitempty"`
+	PathParameters        map[string]string              `json:"pathParameters,omitempty"`
+	RequestContext        APIGatewayV2HTTPRequestContext `json:"requestContext"`
+	StageVariables        map[string]string              `json:"stageVariables,omitempty"`
+	Body                  string                         `json:"body,omitempty"`
+	IsBase64Encoded       bool                           `json:"isBase64Encoded"`
+}
+
+type APIGatewayV2HTTPRequestContext struct {
+	AccountID    string                                        `json:"accountId"`
+	APIID        string                                        `json:"apiId"`
+	DomainName   string                                        `json:"domainName"`
+	DomainPrefix string                                        `json:"domainPrefix"`
+	RequestID    string                                        `json:"requestId"`
+	RouteKey     string                                        `json:"routeKey"`
+	Stage        string                                        `json:"stage"`
+	Time         string                                        `json:"time"`
+	TimeEpoch    int64                                         `json:"timeEpoch"`
+	HTTP         APIGatewayV2HTTPRequestContextHTTPDescription `json:"http"`
+}
+
+type APIGatewayV2HTTPRequestContextHTTPDescription struct {
+	Method    string `json:"method"`
+	Path      string `json:"path"`
+	Protocol  string `json:"protocol"`
+	SourceIP  string `json:"sourceIp"`
+	UserAgent string `json:"userAgent"`
+}
+
+type APIGatewayV2HTTPResponse struct {
+	StatusCode      int               `json:"statusCode"`
+	Headers         map[string]string `json:"headers,omitempty"`
+	Cookies         []string          `json:"cookies,omitempty"`
+	Body            string            `json:"body,omitempty"`
+	IsBase64Encoded bool              `json:"isBase64Encoded"`
+}
+
+type AppSyncLambdaAuthorizerRequest struct {
+	AuthorizationToken string                                `json:"authorizationToken"`
+	RequestContext     AppSyncLambdaAuthorizerRequestContext `json:"requestContext"`
+	RequestHeaders     map[string]string                     `json:"requestHeaders,omitempty"`
+}
+
+type AppSyncLambdaAuthorizerRequestContext struct {
+	APIID         string                 `json:"apiId"`
+	AccountID     string                 `json:"accountId"`
+	RequestID     string                 `json:"requestId"`
+	QueryString   string                 `json:"queryString"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+}
+
+type AppSyncLambdaAuthorizerResponse struct {
+	IsAuthorized    bool              `json:"isAuthorized"`
+	ResolverContext map[string]string `json:"resolverContext,omitempty"`
+	DeniedFields    []string          `json:"deniedFields,omitempty"`
+	TTLOverride     *int              `json:"ttlOverride,omitempty"`
+}
+
+// Header returns the value of the named header, ignoring case as api gateway
+// lower-cases header names in payload format 2.0 but not in every test harness.
+func (me APIGatewayV2HTTPRequest) Header(name string) string {
+	return header(me.Headers, name)
+}
@@ -0,0 +1,251 @@
+package lambda_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/webauthn/gen/mockery"
+	"github.com/walteh/webauthn/pkg/hex"
+	"github.com/walteh/webauthn/pkg/lambda"
+	"github.com/walteh/webauthn/pkg/relyingparty"
+	"github.com/walteh/webauthn/pkg/storage"
+	"github.com/walteh/webauthn/pkg/webauthn/types"
+	"github.com/walteh/webauthn/pkg/webauthnerr"
+	"github.com/walteh/webauthn/pkg/wellknown"
+)
+
+var existingCeremony = &types.Ceremony{
+	ChallengeID:  hex.MustBase64ToHash("7fR9jktPydRpkGevqZIls_ff2VN_oLSK4HNBWzrIrTk"),
+	SessionID:    hex.HexToHash("0x3a298ca21194c5ee7920d2ffc5247d6fa0f330a038cf3933e138602660430b8d"),
+	CeremonyType: "webauthn.create",
+	CreatedAt:    1668984054,
+	CredentialID: hex.HexToHash("0xfb1fd0ac98dca2891761baf97a486c75726900d3a94105afa598575f89c47295"),
+	Ttl:          1668984354,
+}
+
+var existingCredential = &types.Credential{
+	CreatedAt:       1669414368,
+	SessionId:       hex.HexToHash("0x"),
+	AAGUID:          hex.HexToHash("0x617070617474657374646576656c6f70"),
+	PublicKey:       hex.HexToHash("0x04bee9490389b5b36c0d4bd0676c52c46426bee73ace82f6d3c4479d6b6bec24f20ad2264f7739994e636f65f280c384aa2b70c2311741027e677db62ec80071ee"),
+	AttestationType: "apple-appattest",
+	UpdatedAt:       1669414368,
+	RawID:           hex.HexToHash("0xfb1fd0ac98dca2891761baf97a486c75726900d3a94105afa598575f89c47295"),
+	Type:            "public-key",
+}
+
+func loadEvent(t *testing.T, name string, v interface{}) {
+	t.Helper()
+	b, err := os.ReadFile(filepath.Join("testdata", name))
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(b, v))
+}
+
+func testContext() context.Context {
+	return zerolog.New(zerolog.NewConsoleWriter()).With().Caller().Logger().WithContext(context.Background())
+}
+
+func TestHandler_Invoke(t *testing.T) {
+	tests := []struct {
+		name       string
+		event      string
+		withStore  bool
+		wantStatus int
+		wantCode   webauthnerr.Code
+	}{
+		{
+			name:       "device check assertion",
+			event:      "apigateway_devicecheck_assert.json",
+			withStore:  true,
+			wantStatus: 204,
+		},
+		{
+			name:       "passkey registration without header",
+			event:      "apigateway_passkey_register_missing_header.json",
+			wantStatus: 400,
+			wantCode:   webauthnerr.CodeInvalidInput,
+		},
+		{
+			name:       "unknown route",
+			event:      "apigateway_unknown_route.json",
+			wantStatus: 404,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := testContext()
+
+			stgp := mockery.NewMockProvider_storage(t)
+			rpp := mockery.NewMockProvider_relyingparty(t)
+
+			if tt.withStore {
+				stgp.EXPECT().GetExisting(ctx, existingCeremony.ChallengeID.String(), existingCredential.RawID.String()).Return(existingCeremony, existingCredential, nil)
+				stgp.EXPECT().IncrementExistingCredential(ctx, existingCeremony, existingCredential.RawID.String()).Return(nil)
+				rpp.EXPECT().RPID().Return("4497QJSAD3.xyz.nugg.app")
+				rpp.EXPECT().RPOrigin().Return("https://nugg.xyz")
+			}
+
+			var event lambda.APIGatewayV2HTTPRequest
+			loadEvent(t, tt.event, &event)
+
+			got, err := lambda.NewHandler(stgp, rpp, nil, nil).Invoke(ctx, event)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.wantStatus, got.StatusCode)
+
+			if tt.wantCode != "" {
+				assert.Equal(t, webauthnerr.ProblemContentType, got.Headers["Content-Type"])
+
+				var problem webauthnerr.Problem
+				require.NoError(t, json.Unmarshal([]byte(got.Body), &problem))
+				assert.Equal(t, tt.wantCode, problem.Code)
+				assert.Equal(t, tt.wantStatus, problem.Status)
+				assert.Equal(t, event.RequestContext.RequestID, problem.Instance)
+			}
+		})
+	}
+}
+
+func TestHandler_WellKnown(t *testing.T) {
+	reg, err := relyingparty.NewRegistry(func(string) storage.Provider { return mockery.NewMockProvider_storage(t) },
+		relyingparty.NewTenant("nugg", relyingparty.NewSimpleRelyingParty("Nugg", "nugg.xyz", "https://nugg.xyz")).
+			WithPolicy(relyingparty.Policy{AppIDs: []string{"4497QJSAD3.xyz.nugg.app"}}),
+	)
+	require.NoError(t, err)
+
+	ctx := testContext()
+	handler := lambda.NewHandler(mockery.NewMockProvider_storage(t), mockery.NewMockProvider_relyingparty(t), nil, nil).WithRegistry(reg)
+
+	event := lambda.APIGatewayV2HTTPRequest{
+		RawPath:        wellknown.AppleAppSiteAssociationPath,
+		RequestContext: lambda.APIGatewayV2HTTPRequestContext{DomainName: "nugg.xyz"},
+	}
+
+	got, err := handler.Invoke(ctx, event)
+	require.NoError(t, err)
+	assert.Equal(t, 200, got.StatusCode)
+	assert.Equal(t, wellknown.ContentType, got.Headers["Content-Type"])
+	assert.JSONEq(t, `{"webcredentials":{"apps":["4497QJSAD3.xyz.nugg.app"]}}`, got.Body)
+
+	event.RequestContext.DomainName = "other.xyz"
+	got, err = handler.Invoke(ctx, event)
+	require.NoError(t, err)
+	assert.Equal(t, 404, got.StatusCode)
+	assert.Equal(t, webauthnerr.ProblemContentType, got.Headers["Content-Type"])
+}
+
+func TestHandler_RegistryAppIDs(t *testing.T) {
+	ctx := testContext()
+
+	stgp := mockery.NewMockProvider_storage(t)
+	// the flows run with the tenant resolver on the context
+	stgp.EXPECT().GetExisting(mock.Anything, existingCeremony.ChallengeID.String(), existingCredential.RawID.String()).Return(existingCeremony, existingCredential, nil)
+	stgp.EXPECT().IncrementExistingCredential(mock.Anything, existingCeremony, existingCredential.RawID.String()).Return(nil)
+
+	reg, err := relyingparty.NewRegistry(func(string) storage.Provider { return stgp },
+		relyingparty.NewTenant("nugg", relyingparty.NewSimpleRelyingParty("Nugg", "nugg.xyz", "https://nugg.xyz")).
+			WithPolicy(relyingparty.Policy{AppIDs: []string{"4497QJSAD3.xyz.nugg.app"}}),
+	)
+	require.NoError(t, err)
+
+	var event lambda.APIGatewayV2HTTPRequest
+	loadEvent(t, "apigateway_devicecheck_assert.json", &event)
+	event.Headers[lambda.TenantHeader] = "nugg"
+
+	// the handler wide app ids only serve the single tenant path, the tenant's policy decides here
+	handler := lambda.NewHandler(nil, nil, nil, nil).WithAppIDs("AAAAAAAAAA.xyz.nugg.other").WithRegistry(reg)
+
+	got, err := handler.Invoke(ctx, event)
+	require.NoError(t, err)
+	assert.Equal(t, 204, got.StatusCode, got.Body)
+}
+
+type staticSessions map[string]string
+
+func (me staticSessions) UserIDForSessionToken(_ context.Context, token string) (string, error) {
+	if id, ok := me[token]; ok {
+		return id, nil
+	}
+	return "", errors.New("unknown session")
+}
+
+func TestAuthorizer_Invoke(t *testing.T) {
+	tests := []struct {
+		name      string
+		event     string
+		withStore bool
+		sessions  staticSessions
+		want      lambda.AppSyncLambdaAuthorizerResponse
+	}{
+		{
+			name:      "app attest assertion",
+			event:     "appsync_appattest.json",
+			withStore: true,
+			want: lambda.AppSyncLambdaAuthorizerResponse{
+				IsAuthorized: true,
+				ResolverContext: map[string]string{
+					lambda.ResolverContextAuthType:     lambda.AppAttestTokenKind,
+					lambda.ResolverContextCredentialID: existingCredential.RawID.Hex(),
+				},
+			},
+		},
+		{
+			name:     "session token",
+			event:    "appsync_session.json",
+			sessions: staticSessions{"session-token-abc": "0xabc"},
+			want: lambda.AppSyncLambdaAuthorizerResponse{
+				IsAuthorized: true,
+				ResolverContext: map[string]string{
+					lambda.ResolverContextAuthType: lambda.SessionTokenKind,
+					lambda.ResolverContextUserID:   "0xabc",
+				},
+			},
+		},
+		{
+			name:     "unknown session token",
+			event:    "appsync_session.json",
+			sessions: staticSessions{},
+			want:     lambda.AppSyncLambdaAuthorizerResponse{IsAuthorized: false},
+		},
+		{
+			name:     "missing prefix",
+			event:    "appsync_missing_prefix.json",
+			sessions: staticSessions{"session-token-abc": "0xabc"},
+			want:     lambda.AppSyncLambdaAuthorizerResponse{IsAuthorized: false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := testContext()
+
+			stgp := mockery.NewMockProvider_storage(t)
+			rpp := mockery.NewMockProvider_relyingparty(t)
+
+			if tt.withStore {
+				stgp.EXPECT().GetExisting(ctx, existingCeremony.ChallengeID.String(), existingCredential.RawID.String()).Return(existingCeremony, existingCredential, nil)
+				stgp.EXPECT().IncrementExistingCredential(ctx, existingCeremony, existingCredential.RawID.String()).Return(nil)
+				rpp.EXPECT().RPID().Return("4497QJSAD3.xyz.nugg.app")
+				rpp.EXPECT().RPOrigin().Return("https://nugg.xyz")
+			}
+
+			var event lambda.AppSyncLambdaAuthorizerRequest
+			loadEvent(t, tt.event, &event)
+
+			got, err := lambda.NewAuthorizer(stgp, rpp, tt.sessions).Invoke(ctx, event)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.want.IsAuthorized, got.IsAuthorized)
+			assert.Equal(t, tt.want.ResolverContext, got.ResolverContext)
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package playintegrity
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ParseDecryptionKey decodes the base64 AES-256 decryption key of the play console
+func ParseDecryptionKey(b64 string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(b64))
+	if err != nil {
+		return nil, fmt.Errorf("%w: decryption key: %v", ErrInvalidKey, err)
+	}
+
+	if len(key) != 32 {
+		return nil, fmt.Errorf("%w: decryption key is %d bytes, want 32", ErrInvalidKey, len(key))
+	}
+
+	return key, nil
+}
+
+// ParseVerificationKey decodes the base64 DER encoded EC public key of the play console
+func ParseVerificationKey(b64 string) (*ecdsa.PublicKey, error) {
+	der, err := base64.StdEncoding.DecodeString(strings.TrimSpace(b64))
+	if err != nil {
+		return nil, fmt.Errorf("%w: verification key: %v", ErrInvalidKey, err)
+	}
+
+	pub, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("%w: verification key: %v", ErrInvalidKey, err)
+	}
+
+	key, ok := pub.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%w: verification key is a %T", ErrInvalidKey, pub)
+	}
+
+	return key, nil
+}
+
+type jweHeader struct {
+	Alg string `json:"alg"`
+	Enc string `json:"enc"`
+}
+
+// Decrypt opens a compact A256KW/A256GCM JWE integrity token and returns the JWS it holds
+func Decrypt(token string, key []byte) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 5 {
+		return "", fmt.Errorf("%w: expected 5 jwe parts, got %d", ErrInvalidToken, len(parts))
+	}
+
+	rawHeader, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", fmt.Errorf("%w: jwe header: %v", ErrInvalidToken, err)
+	}
+
+	var header jweHeader
+	if err := json.Unmarshal(rawHeader, &header); err != nil {
+		return "", fmt.Errorf("%w: jwe header: %v", ErrInvalidToken, err)
+	}
+
+	if header.Alg != "A256KW" || header.Enc != "A256GCM" {
+		return "", fmt.Errorf("%w: unsupported jwe alg %q enc %q", ErrInvalidToken, header.Alg, header.Enc)
+	}
+
+	decoded := make([][]byte, 4)
+	for i, p := range parts[1:] {
+		if decoded[i], err = base64.RawURLEncoding.DecodeString(p); err != nil {
+			return "", fmt.Errorf("%w: jwe part %d: %v", ErrInvalidToken, i+1, err)
+		}
+	}
+	wrapped, iv, ciphertext, tag := decoded[0], decoded[1], decoded[2], decoded[3]
+
+	cek, err := unwrapKey(key, wrapped)
+	if err != nil {
+		return "", err
+	}
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	gcm, err := cipher.NewGCMWithNonceSize(block, len(iv))
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	// the additional authenticated data is the encoded protected header
+	plaintext, err := gcm.Open(nil, iv, append(ciphertext, tag...), []byte(parts[0]))
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	return string(plaintext), nil
+}
+
+// keyWrapIV is the default initial value of RFC 3394
+var keyWrapIV = []byte{0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6}
+
+// unwrapKey undoes the AES key wrap of RFC 3394 §2.2.2
+func unwrapKey(kek, wrapped []byte) ([]byte, error) {
+	if len(wrapped) < 24 || len(wrapped)%8 != 0 {
+		return nil, fmt.Errorf("%w: wrapped key is %d bytes", ErrInvalidToken, len(wrapped))
+	}
+
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+	}
+
+	n := len(wrapped)/8 - 1
+	a := make([]byte, 8)
+	copy(a, wrapped[:8])
+
+	r := make([]byte, n*8)
+	copy(r, wrapped[8:])
+
+	buf := make([]byte, 16)
+	for j := 5; j >= 0; j-- {
+		for i := n; i >= 1; i-- {
+			t := uint64(n*j + i)
+			binary.BigEndian.PutUint64(buf[:8], binary.BigEndian.Uint64(a)^t)
+			copy(buf[8:], r[(i-1)*8:i*8])
+			block.Decrypt(buf, buf)
+			copy(a, buf[:8])
+			copy(r[(i-1)*8:i*8], buf[8:])
+		}
+	}
+
+	if subtle.ConstantTimeCompare(a, keyWrapIV) != 1 {
+		return nil, fmt.Errorf("%w: content key does not unwrap with the decryption key", ErrInvalidToken)
+	}
+
+	return r, nil
+}
@@ -0,0 +1,17 @@
+package playintegrity
+
+import "errors"
+
+var (
+	ErrInvalidKey          = errors.New("ErrInvalidKey")
+	ErrInvalidToken        = errors.New("ErrInvalidToken")
+	ErrInvalidSignature    = errors.New("ErrInvalidSignature")
+	ErrNonceMismatch       = errors.New("ErrNonceMismatch")
+	ErrPackageMismatch     = errors.New("ErrPackageMismatch")
+	ErrCertificateDigest   = errors.New("ErrCertificateDigest")
+	ErrAppNotRecognized    = errors.New("ErrAppNotRecognized")
+	ErrDeviceIntegrity     = errors.New("ErrDeviceIntegrity")
+	ErrAppNotLicensed      = errors.New("ErrAppNotLicensed")
+	ErrTokenExpired        = errors.New("ErrTokenExpired")
+	ErrTokenIssuedInFuture = errors.New("ErrTokenIssuedInFuture")
+)
@@ -0,0 +1,144 @@
+// Package playintegritytest issues integrity tokens the way play does, with throwaway keys, for tests of
+// code verifying them.
+package playintegritytest
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/webauthn/pkg/playintegrity"
+)
+
+const PackageName = "xyz.nugg.app"
+
+// CertificateDigest is the digest of the signing certificate of the test app
+var CertificateDigest = func() []byte {
+	sum := sha256.Sum256([]byte("playintegritytest signing certificate"))
+	return sum[:]
+}()
+
+// Issuer holds the key pair of an app's integrity tokens
+type Issuer struct {
+	decryptionKey []byte
+	signingKey    *ecdsa.PrivateKey
+}
+
+func NewIssuer(t testing.TB) *Issuer {
+	me := &Issuer{decryptionKey: make([]byte, 32)}
+
+	_, err := rand.Read(me.decryptionKey)
+	require.NoError(t, err)
+
+	me.signingKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	return me
+}
+
+// DecryptionKey returns the decryption key as the play console shows it
+func (me *Issuer) DecryptionKey() string {
+	return base64.StdEncoding.EncodeToString(me.decryptionKey)
+}
+
+// VerificationKey returns the verification key as the play console shows it
+func (me *Issuer) VerificationKey(t testing.TB) string {
+	der, err := x509.MarshalPKIXPublicKey(&me.signingKey.PublicKey)
+	require.NoError(t, err)
+	return base64.StdEncoding.EncodeToString(der)
+}
+
+// Verdict returns a verdict of PackageName that passes the default policy, issued now for the nonce
+func Verdict(nonce string) playintegrity.Verdict {
+	return playintegrity.Verdict{
+		RequestDetails: playintegrity.RequestDetails{
+			RequestPackageName: PackageName,
+			Nonce:              nonce,
+			TimestampMillis:    playintegrity.Millis(time.Now().UnixMilli()),
+		},
+		AppIntegrity: playintegrity.AppIntegrity{
+			AppRecognitionVerdict:   playintegrity.AppPlayRecognized,
+			PackageName:             PackageName,
+			CertificateSha256Digest: []string{base64.RawURLEncoding.EncodeToString(CertificateDigest)},
+			VersionCode:             "42",
+		},
+		DeviceIntegrity: playintegrity.DeviceIntegrity{
+			DeviceRecognitionVerdict: []playintegrity.DeviceRecognitionVerdict{playintegrity.DeviceMeetsDeviceIntegrity},
+		},
+		AccountDetails: playintegrity.AccountDetails{
+			AppLicensingVerdict: playintegrity.AppLicensed,
+		},
+	}
+}
+
+// Token signs and encrypts a verdict
+func (me *Issuer) Token(t testing.TB, verdict playintegrity.Verdict) string {
+	jws, err := jwt.NewWithClaims(jwt.SigningMethodES256, claims{verdict}).SignedString(me.signingKey)
+	require.NoError(t, err)
+
+	return me.Seal(t, jws)
+}
+
+// Seal encrypts a jws for the issuer's decryption key
+func (me *Issuer) Seal(t testing.TB, jws string) string {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"A256KW","enc":"A256GCM"}`))
+
+	cek := make([]byte, 32)
+	_, err := rand.Read(cek)
+	require.NoError(t, err)
+
+	iv := make([]byte, 12)
+	_, err = rand.Read(iv)
+	require.NoError(t, err)
+
+	block, err := aes.NewCipher(cek)
+	require.NoError(t, err)
+
+	gcm, err := cipher.NewGCM(block)
+	require.NoError(t, err)
+
+	sealed := gcm.Seal(nil, iv, []byte(jws), []byte(header))
+	ciphertext, tag := sealed[:len(sealed)-gcm.Overhead()], sealed[len(sealed)-gcm.Overhead():]
+
+	enc := base64.RawURLEncoding.EncodeToString
+	return header + "." + enc(wrapKey(t, me.decryptionKey, cek)) + "." + enc(iv) + "." + enc(ciphertext) + "." + enc(tag)
+}
+
+// wrapKey is the AES key wrap of RFC 3394 §2.2.1
+func wrapKey(t testing.TB, kek, key []byte) []byte {
+	block, err := aes.NewCipher(kek)
+	require.NoError(t, err)
+
+	n := len(key) / 8
+	a := []byte{0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6}
+	r := append([]byte(nil), key...)
+
+	buf := make([]byte, 16)
+	for j := 0; j <= 5; j++ {
+		for i := 1; i <= n; i++ {
+			copy(buf[:8], a)
+			copy(buf[8:], r[(i-1)*8:i*8])
+			block.Encrypt(buf, buf)
+			binary.BigEndian.PutUint64(a, binary.BigEndian.Uint64(buf[:8])^uint64(n*j+i))
+			copy(r[(i-1)*8:i*8], buf[8:])
+		}
+	}
+
+	return append(a, r...)
+}
+
+type claims struct {
+	playintegrity.Verdict
+}
+
+func (claims) Valid() error { return nil }
@@ -0,0 +1,110 @@
+package playintegrity
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+// AppRecognitionVerdict tells whether the app binary is one play distributes,
+// https://developer.android.com/google/play/integrity/verdicts#application-integrity-field
+type AppRecognitionVerdict string
+
+const (
+	AppPlayRecognized      AppRecognitionVerdict = "PLAY_RECOGNIZED"
+	AppUnrecognizedVersion AppRecognitionVerdict = "UNRECOGNIZED_VERSION"
+	AppUnevaluated         AppRecognitionVerdict = "UNEVALUATED"
+)
+
+// DeviceRecognitionVerdict is one of the labels play gives the device,
+// https://developer.android.com/google/play/integrity/verdicts#device-integrity-field
+type DeviceRecognitionVerdict string
+
+const (
+	DeviceMeetsBasicIntegrity   DeviceRecognitionVerdict = "MEETS_BASIC_INTEGRITY"
+	DeviceMeetsDeviceIntegrity  DeviceRecognitionVerdict = "MEETS_DEVICE_INTEGRITY"
+	DeviceMeetsStrongIntegrity  DeviceRecognitionVerdict = "MEETS_STRONG_INTEGRITY"
+	DeviceMeetsVirtualIntegrity DeviceRecognitionVerdict = "MEETS_VIRTUAL_INTEGRITY"
+)
+
+// AppLicensingVerdict tells whether the user got the app from play,
+// https://developer.android.com/google/play/integrity/verdicts#account-details-field
+type AppLicensingVerdict string
+
+const (
+	AppLicensed             AppLicensingVerdict = "LICENSED"
+	AppUnlicensed           AppLicensingVerdict = "UNLICENSED"
+	AppUnevaluatedLicensing AppLicensingVerdict = "UNEVALUATED"
+)
+
+// Verdict is the decrypted and verified payload of an integrity token
+type Verdict struct {
+	RequestDetails  RequestDetails  `json:"requestDetails"`
+	AppIntegrity    AppIntegrity    `json:"appIntegrity"`
+	DeviceIntegrity DeviceIntegrity `json:"deviceIntegrity"`
+	AccountDetails  AccountDetails  `json:"accountDetails"`
+}
+
+type RequestDetails struct {
+	RequestPackageName string `json:"requestPackageName"`
+
+	// Nonce is the nonce the app passed to the classic request, see Nonce
+	Nonce string `json:"nonce"`
+
+	// TimestampMillis is when the token was issued
+	TimestampMillis Millis `json:"timestampMillis"`
+}
+
+type AppIntegrity struct {
+	AppRecognitionVerdict AppRecognitionVerdict `json:"appRecognitionVerdict"`
+	PackageName           string                `json:"packageName,omitempty"`
+
+	// CertificateSha256Digest are the unpadded base64url SHA-256 digests of the app's signing certificates
+	CertificateSha256Digest []string `json:"certificateSha256Digest,omitempty"`
+	VersionCode             string   `json:"versionCode,omitempty"`
+}
+
+type DeviceIntegrity struct {
+	DeviceRecognitionVerdict []DeviceRecognitionVerdict `json:"deviceRecognitionVerdict,omitempty"`
+}
+
+type AccountDetails struct {
+	AppLicensingVerdict AppLicensingVerdict `json:"appLicensingVerdict"`
+}
+
+// Timestamp returns when the token was issued
+func (me *Verdict) Timestamp() time.Time {
+	return time.UnixMilli(int64(me.RequestDetails.TimestampMillis))
+}
+
+// MeetsDevice reports whether play gave the device the label
+func (me *Verdict) MeetsDevice(label DeviceRecognitionVerdict) bool {
+	for _, l := range me.DeviceIntegrity.DeviceRecognitionVerdict {
+		if l == label {
+			return true
+		}
+	}
+	return false
+}
+
+// Millis is a unix timestamp in milliseconds, play sends them as strings
+type Millis int64
+
+func (me *Millis) UnmarshalJSON(b []byte) error {
+	var s json.Number
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+
+	v, err := strconv.ParseInt(s.String(), 10, 64)
+	if err != nil {
+		return err
+	}
+
+	*me = Millis(v)
+	return nil
+}
+
+func (me Millis) MarshalJSON() ([]byte, error) {
+	return json.Marshal(strconv.FormatInt(int64(me), 10))
+}
@@ -0,0 +1,223 @@
+// Package playintegrity verifies Play Integrity tokens locally with the decryption and verification keys
+// of the play console, the replacement of the deprecated SafetyNet attestation API.
+package playintegrity
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/rs/zerolog"
+	"github.com/walteh/webauthn/pkg/webauthn/types"
+)
+
+// DefaultMaxAge is how old a token may be when it is verified
+const DefaultMaxAge = 5 * time.Minute
+
+// Policy is what the verdicts of a token must satisfy to be accepted
+type Policy struct {
+	// PackageName is the package the token must be requested by and issued for
+	PackageName string
+
+	// CertificateDigests are the SHA-256 digests of the certificates the app may be signed with,
+	// the digests are not checked when empty
+	CertificateDigests [][]byte
+
+	// RequirePlayRecognized rejects app binaries play does not know
+	RequirePlayRecognized bool
+
+	// DeviceVerdicts are the device labels of which at least one must be given, any device is accepted when empty
+	DeviceVerdicts []DeviceRecognitionVerdict
+
+	// RequireLicensed rejects users who did not get the app from play
+	RequireLicensed bool
+}
+
+// DefaultPolicy accepts play recognized, licensed copies of the package on devices meeting device integrity
+func DefaultPolicy(packageName string) Policy {
+	return Policy{
+		PackageName:           packageName,
+		RequirePlayRecognized: true,
+		DeviceVerdicts:        []DeviceRecognitionVerdict{DeviceMeetsDeviceIntegrity, DeviceMeetsStrongIntegrity},
+		RequireLicensed:       true,
+	}
+}
+
+// Verifier decrypts and verifies integrity tokens
+type Verifier struct {
+	decryptionKey   []byte
+	verificationKey *ecdsa.PublicKey
+	policy          Policy
+	maxAge          time.Duration
+	time            *time.Time
+}
+
+// NewVerifier returns a verifier of tokens of the package under the DefaultPolicy
+func NewVerifier(packageName string, decryptionKey []byte, verificationKey *ecdsa.PublicKey) *Verifier {
+	return &Verifier{
+		decryptionKey:   decryptionKey,
+		verificationKey: verificationKey,
+		policy:          DefaultPolicy(packageName),
+		maxAge:          DefaultMaxAge,
+	}
+}
+
+// WithPolicy replaces the policy, including the package name
+func (me *Verifier) WithPolicy(policy Policy) *Verifier {
+	me.policy = policy
+	return me
+}
+
+func (me *Verifier) WithMaxAge(maxAge time.Duration) *Verifier {
+	me.maxAge = maxAge
+	return me
+}
+
+// WithTime pins the time the token age is checked against
+func (me *Verifier) WithTime(t time.Time) *Verifier {
+	me.time = &t
+	return me
+}
+
+func (me *Verifier) now() time.Time {
+	if me.time != nil {
+		return *me.time
+	}
+	return time.Now()
+}
+
+// Nonce returns the nonce an app passes to the integrity request of a ceremony,
+// the unpadded base64url encoding of its challenge
+func Nonce(cerem *types.Ceremony) string {
+	return base64.RawURLEncoding.EncodeToString(cerem.ChallengeID)
+}
+
+// Verify decrypts a token, checks its signature and that its verdicts are for the ceremony and satisfy the policy
+func (me *Verifier) Verify(ctx context.Context, token string, cerem *types.Ceremony) (*Verdict, error) {
+	jws, err := Decrypt(token, me.decryptionKey)
+	if err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Msg("failed to decrypt integrity token")
+		return nil, err
+	}
+
+	claims := &verdictClaims{}
+
+	parser := jwt.NewParser(jwt.WithValidMethods([]string{jwt.SigningMethodES256.Alg()}), jwt.WithoutClaimsValidation())
+
+	if _, err := parser.ParseWithClaims(jws, claims, func(*jwt.Token) (interface{}, error) { return me.verificationKey, nil }); err != nil {
+		err = fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+		zerolog.Ctx(ctx).Error().Err(err).Msg("failed to verify integrity token")
+		return nil, err
+	}
+
+	verdict := &claims.Verdict
+
+	if err := me.verify(verdict, cerem); err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).
+			Str("package", verdict.AppIntegrity.PackageName).
+			Str("app", string(verdict.AppIntegrity.AppRecognitionVerdict)).
+			Interface("device", verdict.DeviceIntegrity.DeviceRecognitionVerdict).
+			Str("licensing", string(verdict.AccountDetails.AppLicensingVerdict)).
+			Msg("integrity verdict rejected")
+		return nil, err
+	}
+
+	return verdict, nil
+}
+
+func (me *Verifier) verify(verdict *Verdict, cerem *types.Ceremony) error {
+	nonce, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(verdict.RequestDetails.Nonce, "="))
+	if err != nil || cerem == nil || subtle.ConstantTimeCompare(nonce, cerem.ChallengeID) != 1 {
+		return ErrNonceMismatch
+	}
+
+	issued := verdict.Timestamp()
+	now := me.now()
+
+	if issued.After(now.Add(time.Minute)) {
+		return fmt.Errorf("%w: issued at %s", ErrTokenIssuedInFuture, issued)
+	}
+
+	if me.maxAge > 0 && now.Sub(issued) > me.maxAge {
+		return fmt.Errorf("%w: issued at %s", ErrTokenExpired, issued)
+	}
+
+	if verdict.RequestDetails.RequestPackageName != me.policy.PackageName {
+		return fmt.Errorf("%w: requested by %q", ErrPackageMismatch, verdict.RequestDetails.RequestPackageName)
+	}
+
+	app := verdict.AppIntegrity
+
+	if me.policy.RequirePlayRecognized && app.AppRecognitionVerdict != AppPlayRecognized {
+		return fmt.Errorf("%w: %s", ErrAppNotRecognized, app.AppRecognitionVerdict)
+	}
+
+	// the package name and digests are only set when play evaluated the app
+	if app.AppRecognitionVerdict != AppUnevaluated {
+		if app.PackageName != me.policy.PackageName {
+			return fmt.Errorf("%w: issued for %q", ErrPackageMismatch, app.PackageName)
+		}
+
+		if err := me.verifyCertificateDigests(app.CertificateSha256Digest); err != nil {
+			return err
+		}
+	}
+
+	if len(me.policy.DeviceVerdicts) > 0 {
+		met := false
+		for _, label := range me.policy.DeviceVerdicts {
+			met = met || verdict.MeetsDevice(label)
+		}
+		if !met {
+			return fmt.Errorf("%w: %v", ErrDeviceIntegrity, verdict.DeviceIntegrity.DeviceRecognitionVerdict)
+		}
+	}
+
+	if me.policy.RequireLicensed && verdict.AccountDetails.AppLicensingVerdict != AppLicensed {
+		return fmt.Errorf("%w: %s", ErrAppNotLicensed, verdict.AccountDetails.AppLicensingVerdict)
+	}
+
+	return nil
+}
+
+// verifyCertificateDigests requires every signer of the app to be an allowed one
+func (me *Verifier) verifyCertificateDigests(digests []string) error {
+	if len(me.policy.CertificateDigests) == 0 {
+		return nil
+	}
+
+	if len(digests) == 0 {
+		return fmt.Errorf("%w: no certificate digests", ErrCertificateDigest)
+	}
+
+	for _, d := range digests {
+		raw, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(d, "="))
+		if err != nil {
+			return fmt.Errorf("%w: %q: %v", ErrCertificateDigest, d, err)
+		}
+
+		allowed := false
+		for _, a := range me.policy.CertificateDigests {
+			allowed = allowed || bytes.Equal(a, raw)
+		}
+
+		if !allowed {
+			return fmt.Errorf("%w: %q", ErrCertificateDigest, d)
+		}
+	}
+
+	return nil
+}
+
+type verdictClaims struct {
+	Verdict
+}
+
+// Valid is a no-op, verdicts are checked by Verifier.verify
+func (verdictClaims) Valid() error { return nil }
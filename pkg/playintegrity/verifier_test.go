@@ -0,0 +1,176 @@
+package playintegrity_test
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/webauthn/pkg/hex"
+	"github.com/walteh/webauthn/pkg/playintegrity"
+	"github.com/walteh/webauthn/pkg/playintegrity/playintegritytest"
+	"github.com/walteh/webauthn/pkg/webauthn/types"
+)
+
+func TestVerifier(t *testing.T) {
+	issuer := playintegritytest.NewIssuer(t)
+	other := playintegritytest.NewIssuer(t)
+
+	cerem := &types.Ceremony{
+		ChallengeID:  hex.HexToHash("0x1dd5d0ab4a2e1b06b4a7d7f2c3e4b9a1e8ee2b1cfb5a3c0a9d4a3bc2e5f60718"),
+		CeremonyType: types.CreateCeremony,
+	}
+
+	decryptionKey, err := playintegrity.ParseDecryptionKey(issuer.DecryptionKey())
+	require.NoError(t, err)
+
+	verificationKey, err := playintegrity.ParseVerificationKey(issuer.VerificationKey(t))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		edit    func(*playintegrity.Verdict)
+		token   func(playintegrity.Verdict) string
+		wantErr error
+	}{
+		{
+			name: "valid",
+		},
+		{
+			name: "padded nonce",
+			edit: func(v *playintegrity.Verdict) {
+				v.RequestDetails.Nonce = base64.URLEncoding.EncodeToString(cerem.ChallengeID)
+			},
+		},
+		{
+			name:    "nonce of another ceremony",
+			edit:    func(v *playintegrity.Verdict) { v.RequestDetails.Nonce = "AAAAAAAAAAAAAAAAAAAAAA" },
+			wantErr: playintegrity.ErrNonceMismatch,
+		},
+		{
+			name:    "encrypted for another app",
+			token:   func(v playintegrity.Verdict) string { return other.Token(t, v) },
+			wantErr: playintegrity.ErrInvalidToken,
+		},
+		{
+			name: "signed by another key",
+			token: func(v playintegrity.Verdict) string {
+				// a token signed by the other issuer, encrypted for this one
+				return encryptedFor(t, issuer, other, v)
+			},
+			wantErr: playintegrity.ErrInvalidSignature,
+		},
+		{
+			name:    "tampered ciphertext",
+			token:   func(v playintegrity.Verdict) string { return tamper(issuer.Token(t, v)) },
+			wantErr: playintegrity.ErrInvalidToken,
+		},
+		{
+			name:    "other package",
+			edit:    func(v *playintegrity.Verdict) { v.RequestDetails.RequestPackageName = "com.example.other" },
+			wantErr: playintegrity.ErrPackageMismatch,
+		},
+		{
+			name: "other signer",
+			edit: func(v *playintegrity.Verdict) {
+				v.AppIntegrity.CertificateSha256Digest = []string{base64.RawURLEncoding.EncodeToString(make([]byte, 32))}
+			},
+			wantErr: playintegrity.ErrCertificateDigest,
+		},
+		{
+			name: "sideloaded",
+			edit: func(v *playintegrity.Verdict) {
+				v.AppIntegrity.AppRecognitionVerdict = playintegrity.AppUnrecognizedVersion
+			},
+			wantErr: playintegrity.ErrAppNotRecognized,
+		},
+		{
+			name: "basic integrity only",
+			edit: func(v *playintegrity.Verdict) {
+				v.DeviceIntegrity.DeviceRecognitionVerdict = []playintegrity.DeviceRecognitionVerdict{playintegrity.DeviceMeetsBasicIntegrity}
+			},
+			wantErr: playintegrity.ErrDeviceIntegrity,
+		},
+		{
+			name:    "no device verdict",
+			edit:    func(v *playintegrity.Verdict) { v.DeviceIntegrity.DeviceRecognitionVerdict = nil },
+			wantErr: playintegrity.ErrDeviceIntegrity,
+		},
+		{
+			name:    "unlicensed",
+			edit:    func(v *playintegrity.Verdict) { v.AccountDetails.AppLicensingVerdict = playintegrity.AppUnlicensed },
+			wantErr: playintegrity.ErrAppNotLicensed,
+		},
+		{
+			name: "old token",
+			edit: func(v *playintegrity.Verdict) {
+				v.RequestDetails.TimestampMillis = playintegrity.Millis(time.Now().Add(-time.Hour).UnixMilli())
+			},
+			wantErr: playintegrity.ErrTokenExpired,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verdict := playintegritytest.Verdict(playintegrity.Nonce(cerem))
+			if tt.edit != nil {
+				tt.edit(&verdict)
+			}
+
+			token := issuer.Token(t, verdict)
+			if tt.token != nil {
+				token = tt.token(verdict)
+			}
+
+			policy := playintegrity.DefaultPolicy(playintegritytest.PackageName)
+			policy.CertificateDigests = [][]byte{playintegritytest.CertificateDigest}
+
+			got, err := playintegrity.NewVerifier(playintegritytest.PackageName, decryptionKey, verificationKey).
+				WithPolicy(policy).
+				Verify(context.Background(), token, cerem)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+
+			assert.Equal(t, verdict, *got)
+			assert.True(t, got.MeetsDevice(playintegrity.DeviceMeetsDeviceIntegrity))
+		})
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	_, err := playintegrity.ParseDecryptionKey(base64.StdEncoding.EncodeToString(make([]byte, 16)))
+	assert.ErrorIs(t, err, playintegrity.ErrInvalidKey)
+
+	_, err = playintegrity.ParseVerificationKey("not base64")
+	assert.ErrorIs(t, err, playintegrity.ErrInvalidKey)
+}
+
+// encryptedFor re-encrypts the jws of a token signed by signer for the decryption key of encrypter
+func encryptedFor(t *testing.T, encrypter, signer *playintegritytest.Issuer, v playintegrity.Verdict) string {
+	key, err := playintegrity.ParseDecryptionKey(signer.DecryptionKey())
+	require.NoError(t, err)
+
+	jws, err := playintegrity.Decrypt(signer.Token(t, v), key)
+	require.NoError(t, err)
+
+	return encrypter.Seal(t, jws)
+}
+
+func tamper(token string) string {
+	parts := strings.Split(token, ".")
+	b := []byte(parts[3])
+	if b[0] == 'A' {
+		b[0] = 'B'
+	} else {
+		b[0] = 'A'
+	}
+	parts[3] = string(b)
+	return strings.Join(parts, ".")
+}
@@ -0,0 +1,305 @@
+// Package ratelimit protects the app flows from abuse. Token buckets cap how fast an ip, session, user or
+// credential can start and finish ceremonies, and a credential whose signatures keep failing is locked
+// out for exponentially growing periods. Flows take the Limiter carried by their context, the way they
+// record to the audit sink it carries; without one nothing is limited.
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/walteh/webauthn/pkg/errd"
+	"github.com/walteh/webauthn/pkg/webauthnerr"
+)
+
+var (
+	ErrRateLimited = errors.New("ErrRateLimited")
+	ErrLockedOut   = errors.New("ErrLockedOut")
+	ErrStore       = errors.New("ErrStore")
+)
+
+// Scope is what a bucket counts the requests of
+type Scope string
+
+const (
+	ScopeIP         Scope = "ip"
+	ScopeSession    Scope = "session"
+	ScopeUser       Scope = "user"
+	ScopeCredential Scope = "credential"
+)
+
+// Key identifies the bucket or lockout of one ip, session, user or credential
+type Key struct {
+	Scope Scope
+	Value string
+}
+
+func IP(ip string) Key         { return Key{ScopeIP, ip} }
+func Session(id string) Key    { return Key{ScopeSession, id} }
+func User(id string) Key       { return Key{ScopeUser, id} }
+func Credential(id string) Key { return Key{ScopeCredential, id} }
+func (me Key) String() string  { return string(me.Scope) + ":" + me.Value }
+func (me Key) bucket() string  { return "rate:" + me.String() }
+func (me Key) lock() string    { return "lock:" + me.String() }
+func (me Key) missing() bool   { return me.Value == "" || me.Value == "0x" }
+
+// Rate is a token bucket holding up to Burst requests, refilled by one every Every
+type Rate struct {
+	Burst int
+	Every time.Duration
+}
+
+// Lockout locks a credential after Threshold consecutive signature failures, for Base and then twice as
+// long with every further failure up to Max. Failures are forgotten after Reset without any.
+type Lockout struct {
+	Threshold int
+	Base      time.Duration
+	Max       time.Duration
+	Reset     time.Duration
+}
+
+var DefaultRates = map[Scope]Rate{
+	ScopeIP:         {Burst: 30, Every: 2 * time.Second},
+	ScopeSession:    {Burst: 10, Every: 6 * time.Second},
+	ScopeUser:       {Burst: 20, Every: 3 * time.Second},
+	ScopeCredential: {Burst: 10, Every: 6 * time.Second},
+}
+
+var DefaultLockout = Lockout{
+	Threshold: 5,
+	Base:      time.Minute,
+	Max:       24 * time.Hour,
+	Reset:     24 * time.Hour,
+}
+
+type Limiter struct {
+	store   Store
+	rates   map[Scope]Rate
+	lockout Lockout
+	now     func() time.Time
+}
+
+func NewLimiter(store Store) *Limiter {
+	rates := make(map[Scope]Rate, len(DefaultRates))
+	for scope, rate := range DefaultRates {
+		rates[scope] = rate
+	}
+
+	return &Limiter{
+		store:   store,
+		rates:   rates,
+		lockout: DefaultLockout,
+		now:     time.Now,
+	}
+}
+
+// WithRate sets the bucket of a scope, a zero Burst stops limiting it
+func (me *Limiter) WithRate(scope Scope, rate Rate) *Limiter {
+	me.rates[scope] = rate
+	return me
+}
+
+// WithLockout sets the lockout of failing credentials, a zero Threshold disables it
+func (me *Limiter) WithLockout(lockout Lockout) *Limiter {
+	me.lockout = lockout
+	return me
+}
+
+func (me *Limiter) WithTime(now func() time.Time) *Limiter {
+	me.now = now
+	return me
+}
+
+// Allow takes a token from the bucket of each key, failing with a rate_limited error naming the first
+// bucket that is empty. Every bucket is checked before any token is taken, so a request refused by one
+// bucket does not drain the others; only a request racing for the same last token can still do so. Keys
+// without a value are skipped. A nil Limiter allows everything.
+func (me *Limiter) Allow(ctx context.Context, keys ...Key) error {
+	if me == nil {
+		return nil
+	}
+
+	limited := make([]Key, 0, len(keys))
+	for _, key := range keys {
+		rate, ok := me.rates[key.Scope]
+		if !ok || rate.Burst <= 0 || key.missing() {
+			continue
+		}
+
+		state, err := me.store.Get(ctx, key.bucket())
+		if err != nil {
+			return errd.Wrap(ctx, webauthnerr.New(webauthnerr.CodeStorageUnavailable, fmt.Errorf("%w: %v", ErrStore, err)), key.String())
+		}
+
+		if wait := state.take(me.now(), rate); wait > 0 {
+			return me.limited(ctx, key, wait)
+		}
+
+		limited = append(limited, key)
+	}
+
+	for _, key := range limited {
+		rate := me.rates[key.Scope]
+
+		var wait time.Duration
+
+		err := me.store.Update(ctx, key.bucket(), rate.Every*time.Duration(rate.Burst), func(state *State) error {
+			now := me.now()
+			wait = state.take(now, rate)
+			return nil
+		})
+		if err != nil {
+			return errd.Wrap(ctx, webauthnerr.New(webauthnerr.CodeStorageUnavailable, fmt.Errorf("%w: %v", ErrStore, err)), key.String())
+		}
+
+		if wait > 0 {
+			return me.limited(ctx, key, wait)
+		}
+	}
+
+	return nil
+}
+
+func (me *Limiter) limited(ctx context.Context, key Key, wait time.Duration) error {
+	return errd.Wrap(ctx, webauthnerr.New(webauthnerr.CodeRateLimited, ErrRateLimited).WithDetails("%s retry after %s", key, wait.Round(time.Second)))
+}
+
+// Check fails with a locked_out error while the key is locked out
+func (me *Limiter) Check(ctx context.Context, key Key) error {
+	if me == nil || me.lockout.Threshold <= 0 || key.missing() {
+		return nil
+	}
+
+	state, err := me.store.Get(ctx, key.lock())
+	if err != nil {
+		return errd.Wrap(ctx, webauthnerr.New(webauthnerr.CodeStorageUnavailable, fmt.Errorf("%w: %v", ErrStore, err)), key.String())
+	}
+
+	if now := me.now(); now.Before(state.LockedUntil) {
+		return errd.Wrap(ctx, webauthnerr.New(webauthnerr.CodeLockedOut, ErrLockedOut).WithDetails("%s locked for %s", key, state.LockedUntil.Sub(now).Round(time.Second)))
+	}
+
+	return nil
+}
+
+// Failure counts a failed signature of the key, locking it out once the failures reach the threshold
+func (me *Limiter) Failure(ctx context.Context, key Key) error {
+	if me == nil || me.lockout.Threshold <= 0 || key.missing() {
+		return nil
+	}
+
+	return me.updateLock(ctx, key, func(now time.Time, state *State) {
+		if !state.LastFailure.IsZero() && now.Sub(state.LastFailure) > me.lockout.Reset {
+			state.Failures = 0
+		}
+
+		state.Failures++
+		state.LastFailure = now
+
+		if over := state.Failures - me.lockout.Threshold; over >= 0 {
+			state.LockedUntil = now.Add(me.lockout.duration(over))
+		}
+	})
+}
+
+// Success forgets the failures of the key
+func (me *Limiter) Success(ctx context.Context, key Key) error {
+	if me == nil || me.lockout.Threshold <= 0 || key.missing() {
+		return nil
+	}
+
+	return me.updateLock(ctx, key, func(_ time.Time, state *State) {
+		state.Failures = 0
+		state.LastFailure = time.Time{}
+		state.LockedUntil = time.Time{}
+	})
+}
+
+// Result counts the outcome of an assertion of the key: an invalid signature or a counter regression
+// counts towards its lockout, a success forgets the failures and any other error is left alone. A failing
+// store is logged, the outcome of the assertion stands.
+func (me *Limiter) Result(ctx context.Context, key Key, err error) {
+	if err != nil && !countsTowardsLockout(err) {
+		return
+	}
+
+	update := me.Success
+	if err != nil {
+		update = me.Failure
+	}
+
+	if uerr := update(ctx, key); uerr != nil {
+		zerolog.Ctx(ctx).Error().Err(uerr).Str("key", key.String()).Msg("failed to record assertion result")
+	}
+}
+
+// countsTowardsLockout is true for the failures only a wrong key or a cloned authenticator produces, a
+// malformed request or a stale challenge says nothing about who holds the credential
+func countsTowardsLockout(err error) bool {
+	switch webauthnerr.CodeOf(err) {
+	case webauthnerr.CodeSignatureInvalid, webauthnerr.CodeCounterRegression:
+		return true
+	}
+	return false
+}
+
+func (me *Limiter) updateLock(ctx context.Context, key Key, fn func(now time.Time, state *State)) error {
+	err := me.store.Update(ctx, key.lock(), me.lockout.Reset+me.lockout.Max, func(state *State) error {
+		fn(me.now(), state)
+		return nil
+	})
+	if err != nil {
+		return errd.Wrap(ctx, webauthnerr.New(webauthnerr.CodeStorageUnavailable, fmt.Errorf("%w: %v", ErrStore, err)), key.String())
+	}
+	return nil
+}
+
+func (me Lockout) duration(over int) time.Duration {
+	d := float64(me.Base) * math.Pow(2, float64(over))
+	if me.Max > 0 && d > float64(me.Max) {
+		return me.Max
+	}
+	return time.Duration(d)
+}
+
+type limiterKey struct{}
+
+type clientKey struct{}
+
+// WithLimiter returns a copy of ctx flows take their Limiter from
+func WithLimiter(ctx context.Context, limiter *Limiter) context.Context {
+	return context.WithValue(ctx, limiterKey{}, limiter)
+}
+
+// Ctx returns the Limiter of ctx, nil when it has none
+func Ctx(ctx context.Context) *Limiter {
+	limiter, _ := ctx.Value(limiterKey{}).(*Limiter)
+	return limiter
+}
+
+// Client is who a request came from, as far as the transport knows
+type Client struct {
+	IP   string
+	User string
+}
+
+// WithClient returns a copy of ctx carrying the client the request came from
+func WithClient(ctx context.Context, client Client) context.Context {
+	return context.WithValue(ctx, clientKey{}, client)
+}
+
+// ClientOf returns the client of ctx
+func ClientOf(ctx context.Context) Client {
+	client, _ := ctx.Value(clientKey{}).(Client)
+	return client
+}
+
+// Keys returns the ip and user keys of the client of ctx followed by the extra keys
+func Keys(ctx context.Context, extra ...Key) []Key {
+	client := ClientOf(ctx)
+	return append([]Key{IP(client.IP), User(client.User)}, extra...)
+}
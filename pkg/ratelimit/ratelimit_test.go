@@ -0,0 +1,250 @@
+package ratelimit_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/webauthn/pkg/ratelimit"
+	"github.com/walteh/webauthn/pkg/storage"
+	"github.com/walteh/webauthn/pkg/webauthnerr"
+)
+
+type clock struct{ now time.Time }
+
+func (me *clock) Now() time.Time          { return me.now }
+func (me *clock) Advance(d time.Duration) { me.now = me.now.Add(d) }
+
+func newClock() *clock { return &clock{now: time.Unix(1700000000, 0)} }
+
+func TestLimiterAllow(t *testing.T) {
+	ctx := context.Background()
+	clk := newClock()
+
+	limiter := ratelimit.NewLimiter(ratelimit.NewMemory().WithTime(clk.Now)).
+		WithTime(clk.Now).
+		WithRate(ratelimit.ScopeSession, ratelimit.Rate{Burst: 3, Every: 10 * time.Second}).
+		WithRate(ratelimit.ScopeIP, ratelimit.Rate{})
+
+	session := ratelimit.Session("0x01")
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, limiter.Allow(ctx, session), "request %d", i)
+	}
+
+	err := limiter.Allow(ctx, session)
+	require.ErrorIs(t, err, ratelimit.ErrRateLimited)
+	assert.Equal(t, webauthnerr.CodeRateLimited, webauthnerr.CodeOf(err))
+	assert.Equal(t, 429, webauthnerr.HTTPStatus(err))
+	assert.Equal(t, uint32(8), webauthnerr.GRPCCode(err))
+
+	// other sessions have their own bucket
+	assert.NoError(t, limiter.Allow(ctx, ratelimit.Session("0x02")))
+
+	// one token is back after Every
+	clk.Advance(10 * time.Second)
+	assert.NoError(t, limiter.Allow(ctx, session))
+	assert.ErrorIs(t, limiter.Allow(ctx, session), ratelimit.ErrRateLimited)
+
+	// the bucket never holds more than Burst
+	clk.Advance(time.Hour)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, limiter.Allow(ctx, session), "request %d", i)
+	}
+	assert.ErrorIs(t, limiter.Allow(ctx, session), ratelimit.ErrRateLimited)
+
+	// keys without a value and unlimited scopes are skipped
+	assert.NoError(t, limiter.Allow(ctx, ratelimit.Session(""), ratelimit.Session("0x"), ratelimit.IP("10.0.0.1")))
+
+	t.Run("an empty bucket takes no token from the others", func(t *testing.T) {
+		limiter := ratelimit.NewLimiter(ratelimit.NewMemory().WithTime(clk.Now)).
+			WithTime(clk.Now).
+			WithRate(ratelimit.ScopeIP, ratelimit.Rate{Burst: 2, Every: time.Minute}).
+			WithRate(ratelimit.ScopeSession, ratelimit.Rate{Burst: 1, Every: time.Minute})
+
+		ip := ratelimit.IP("10.0.0.2")
+
+		require.NoError(t, limiter.Allow(ctx, ip, ratelimit.Session("0x10")))
+		for i := 0; i < 5; i++ {
+			require.ErrorIs(t, limiter.Allow(ctx, ip, ratelimit.Session("0x10")), ratelimit.ErrRateLimited, "request %d", i)
+		}
+
+		assert.NoError(t, limiter.Allow(ctx, ip))
+		assert.ErrorIs(t, limiter.Allow(ctx, ip), ratelimit.ErrRateLimited)
+	})
+}
+
+func TestLimiterLockout(t *testing.T) {
+	ctx := context.Background()
+	clk := newClock()
+
+	limiter := ratelimit.NewLimiter(ratelimit.NewMemory().WithTime(clk.Now)).
+		WithTime(clk.Now).
+		WithLockout(ratelimit.Lockout{Threshold: 3, Base: time.Minute, Max: 5 * time.Minute, Reset: time.Hour})
+
+	cred := ratelimit.Credential("0xfb1f")
+	failure := webauthnerr.New(webauthnerr.CodeSignatureInvalid, errors.New("ErrSignature"))
+
+	for i := 0; i < 2; i++ {
+		limiter.Result(ctx, cred, failure)
+		require.NoError(t, limiter.Check(ctx, cred))
+	}
+
+	locked := []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 5 * time.Minute}
+	for _, d := range locked {
+		limiter.Result(ctx, cred, failure)
+
+		err := limiter.Check(ctx, cred)
+		require.ErrorIs(t, err, ratelimit.ErrLockedOut, d)
+		assert.Equal(t, webauthnerr.CodeLockedOut, webauthnerr.CodeOf(err))
+
+		clk.Advance(d - time.Second)
+		require.ErrorIs(t, limiter.Check(ctx, cred), ratelimit.ErrLockedOut, d)
+
+		clk.Advance(time.Second)
+		require.NoError(t, limiter.Check(ctx, cred), d)
+	}
+
+	// failures that are not about the assertion itself do not count
+	limiter.Result(ctx, ratelimit.Credential("0x02"), webauthnerr.New(webauthnerr.CodeStorageUnavailable, nil))
+	limiter.Result(ctx, ratelimit.Credential("0x02"), webauthnerr.New(webauthnerr.CodeStorageUnavailable, nil))
+	limiter.Result(ctx, ratelimit.Credential("0x02"), webauthnerr.New(webauthnerr.CodeStorageUnavailable, nil))
+	assert.NoError(t, limiter.Check(ctx, ratelimit.Credential("0x02")))
+
+	// neither do rejected requests that never got to the signature
+	for _, code := range []webauthnerr.Code{webauthnerr.CodeChallengeMismatch, webauthnerr.CodeMalformedAssertion, webauthnerr.CodeOriginMismatch} {
+		for i := 0; i < 3; i++ {
+			limiter.Result(ctx, ratelimit.Credential("0x05"), webauthnerr.New(code, errors.New("ErrRejected")))
+		}
+	}
+	assert.NoError(t, limiter.Check(ctx, ratelimit.Credential("0x05")))
+
+	// a counter regression does
+	for i := 0; i < 3; i++ {
+		limiter.Result(ctx, ratelimit.Credential("0x06"), webauthnerr.New(webauthnerr.CodeCounterRegression, errors.New("ErrCounter")))
+	}
+	assert.ErrorIs(t, limiter.Check(ctx, ratelimit.Credential("0x06")), ratelimit.ErrLockedOut)
+
+	t.Run("success resets", func(t *testing.T) {
+		cred := ratelimit.Credential("0x03")
+
+		limiter.Result(ctx, cred, failure)
+		limiter.Result(ctx, cred, failure)
+		limiter.Result(ctx, cred, nil)
+		limiter.Result(ctx, cred, failure)
+		limiter.Result(ctx, cred, failure)
+
+		assert.NoError(t, limiter.Check(ctx, cred))
+	})
+
+	t.Run("failures are forgotten", func(t *testing.T) {
+		cred := ratelimit.Credential("0x04")
+
+		limiter.Result(ctx, cred, failure)
+		limiter.Result(ctx, cred, failure)
+		clk.Advance(2 * time.Hour)
+		limiter.Result(ctx, cred, failure)
+
+		assert.NoError(t, limiter.Check(ctx, cred))
+	})
+}
+
+func TestNilLimiter(t *testing.T) {
+	ctx := context.Background()
+
+	limiter := ratelimit.Ctx(ctx)
+	require.Nil(t, limiter)
+
+	assert.NoError(t, limiter.Allow(ctx, ratelimit.IP("10.0.0.1")))
+	assert.NoError(t, limiter.Check(ctx, ratelimit.Credential("0x01")))
+	limiter.Result(ctx, ratelimit.Credential("0x01"), webauthnerr.New(webauthnerr.CodeSignatureInvalid, nil))
+}
+
+func TestKeys(t *testing.T) {
+	ctx := ratelimit.WithClient(context.Background(), ratelimit.Client{IP: "10.0.0.1", User: "user-1"})
+
+	assert.Equal(t, []ratelimit.Key{
+		ratelimit.IP("10.0.0.1"),
+		ratelimit.User("user-1"),
+		ratelimit.Session("0x01"),
+	}, ratelimit.Keys(ctx, ratelimit.Session("0x01")))
+}
+
+// backend is a Backend keeping versioned state in a map, racing once per key when asked to
+type backend struct {
+	mu       sync.Mutex
+	states   map[string]ratelimit.State
+	versions map[string]uint64
+	race     bool
+	fail     error
+}
+
+func newBackend() *backend {
+	return &backend{states: map[string]ratelimit.State{}, versions: map[string]uint64{}}
+}
+
+func (me *backend) GetLimit(_ context.Context, key string) (ratelimit.State, uint64, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+
+	if me.fail != nil {
+		return ratelimit.State{}, 0, me.fail
+	}
+
+	version, ok := me.versions[key]
+	if !ok {
+		return ratelimit.State{}, 0, storage.ErrNotFound
+	}
+	return me.states[key], version, nil
+}
+
+func (me *backend) PutLimit(_ context.Context, key string, state ratelimit.State, version uint64, _ time.Time) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+
+	if me.race {
+		// another instance took a token in between
+		me.race = false
+		s := me.states[key]
+		s.Tokens--
+		me.states[key] = s
+		me.versions[key]++
+	}
+
+	if me.versions[key] != version {
+		return ratelimit.ErrConflict
+	}
+
+	me.states[key] = state
+	me.versions[key] = version + 1
+
+	return nil
+}
+
+func TestStorage(t *testing.T) {
+	ctx := context.Background()
+	clk := newClock()
+	be := newBackend()
+
+	limiter := ratelimit.NewLimiter(ratelimit.NewStorage(be).WithTime(clk.Now)).
+		WithTime(clk.Now).
+		WithRate(ratelimit.ScopeIP, ratelimit.Rate{Burst: 3, Every: time.Minute})
+
+	ip := ratelimit.IP("10.0.0.1")
+
+	require.NoError(t, limiter.Allow(ctx, ip))
+
+	// the conflicting write is retried on top of the other one
+	be.race = true
+	require.NoError(t, limiter.Allow(ctx, ip))
+	assert.ErrorIs(t, limiter.Allow(ctx, ip), ratelimit.ErrRateLimited)
+
+	be.fail = errors.New("throttled")
+	err := limiter.Allow(ctx, ip)
+	require.ErrorIs(t, err, ratelimit.ErrStore)
+	assert.Equal(t, webauthnerr.CodeStorageUnavailable, webauthnerr.CodeOf(err))
+}
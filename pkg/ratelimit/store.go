@@ -0,0 +1,177 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/walteh/webauthn/pkg/storage"
+)
+
+// ErrConflict is returned by a Backend when the state was changed since it was read
+var ErrConflict = errors.New("ErrConflict")
+
+// State is what a Store keeps per key, the token bucket of a rate key or the failures of a lockout key
+type State struct {
+	Tokens   float64   `dynamodbav:"tokens" json:"tokens"`
+	Refilled time.Time `dynamodbav:"refilled" json:"refilled"`
+
+	Failures    int       `dynamodbav:"failures" json:"failures"`
+	LastFailure time.Time `dynamodbav:"last_failure" json:"last_failure"`
+	LockedUntil time.Time `dynamodbav:"locked_until" json:"locked_until"`
+}
+
+// take refills the bucket up to now and takes a token from it, returning how long to wait for one when
+// it is empty
+func (me *State) take(now time.Time, rate Rate) time.Duration {
+	burst := float64(rate.Burst)
+
+	if me.Refilled.IsZero() {
+		me.Tokens = burst
+	} else if elapsed := now.Sub(me.Refilled); elapsed > 0 && rate.Every > 0 {
+		me.Tokens += float64(elapsed) / float64(rate.Every)
+	}
+	if me.Tokens > burst {
+		me.Tokens = burst
+	}
+	me.Refilled = now
+
+	if me.Tokens < 1 {
+		return time.Duration((1 - me.Tokens) * float64(rate.Every))
+	}
+
+	me.Tokens--
+
+	return 0
+}
+
+// Store keeps the limiter state. Update has to apply fn atomically, concurrent requests of the same key
+// must not both take the last token. ttl is how long the state matters after the update, stores may drop
+// it afterwards.
+type Store interface {
+	Get(ctx context.Context, key string) (State, error)
+	Update(ctx context.Context, key string, ttl time.Duration, fn func(*State) error) error
+}
+
+type entry struct {
+	state   State
+	expires time.Time
+}
+
+// Memory keeps the state in process, for a single instance or tests
+type Memory struct {
+	mu      sync.Mutex
+	entries map[string]entry
+	writes  int
+	now     func() time.Time
+}
+
+var _ Store = (*Memory)(nil)
+
+func NewMemory() *Memory {
+	return &Memory{entries: map[string]entry{}, now: time.Now}
+}
+
+func (me *Memory) WithTime(now func() time.Time) *Memory {
+	me.now = now
+	return me
+}
+
+func (me *Memory) Get(_ context.Context, key string) (State, error) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+
+	if e, ok := me.entries[key]; ok && me.now().Before(e.expires) {
+		return e.state, nil
+	}
+
+	return State{}, nil
+}
+
+func (me *Memory) Update(_ context.Context, key string, ttl time.Duration, fn func(*State) error) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+
+	now := me.now()
+
+	e, ok := me.entries[key]
+	if !ok || !now.Before(e.expires) {
+		e = entry{}
+	}
+
+	if err := fn(&e.state); err != nil {
+		return err
+	}
+
+	e.expires = now.Add(ttl)
+	me.entries[key] = e
+
+	if me.writes++; me.writes%1024 == 0 {
+		for k, e := range me.entries {
+			if !now.Before(e.expires) {
+				delete(me.entries, k)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Backend persists the state for the Storage store. PutLimit has to be a conditional write, failing with
+// ErrConflict unless the stored version is still the one GetLimit returned; GetLimit returns
+// storage.ErrNotFound for keys without state, which are at version zero.
+type Backend interface {
+	GetLimit(ctx context.Context, key string) (State, uint64, error)
+	PutLimit(ctx context.Context, key string, state State, version uint64, expires time.Time) error
+}
+
+// Storage keeps the state in a Backend shared by every instance, retrying updates that raced another one
+type Storage struct {
+	backend  Backend
+	attempts int
+	now      func() time.Time
+}
+
+var _ Store = (*Storage)(nil)
+
+func NewStorage(backend Backend) *Storage {
+	return &Storage{backend: backend, attempts: 5, now: time.Now}
+}
+
+func (me *Storage) WithTime(now func() time.Time) *Storage {
+	me.now = now
+	return me
+}
+
+func (me *Storage) Get(ctx context.Context, key string) (State, error) {
+	state, _, err := me.backend.GetLimit(ctx, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return State{}, nil
+	}
+	return state, err
+}
+
+func (me *Storage) Update(ctx context.Context, key string, ttl time.Duration, fn func(*State) error) error {
+	for attempt := 0; attempt < me.attempts; attempt++ {
+		state, version, err := me.backend.GetLimit(ctx, key)
+		if errors.Is(err, storage.ErrNotFound) {
+			state, version = State{}, 0
+		} else if err != nil {
+			return err
+		}
+
+		if err := fn(&state); err != nil {
+			return err
+		}
+
+		err = me.backend.PutLimit(ctx, key, state, version, me.now().Add(ttl))
+		if errors.Is(err, ErrConflict) {
+			continue
+		}
+		return err
+	}
+
+	return fmt.Errorf("%w: %s after %d attempts", ErrConflict, key, me.attempts)
+}
@@ -0,0 +1,234 @@
+package relyingparty
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/walteh/webauthn/pkg/hex"
+	"github.com/walteh/webauthn/pkg/storage"
+	"github.com/walteh/webauthn/pkg/webauthnerr"
+)
+
+var (
+	ErrUnknownTenant   = errors.New("ErrUnknownTenant")
+	ErrDuplicateTenant = errors.New("ErrDuplicateTenant")
+
+	ErrUnpublishedOrigin = errors.New("ErrUnpublishedOrigin")
+	ErrNoStorage         = errors.New("ErrNoStorage")
+)
+
+// Hint is what a request tells about the tenant it is for, in the order a Registry looks at it
+type Hint struct {
+	// TenantID is the tenant named by the request itself
+	TenantID string
+
+	// Host is the Host header the request was sent to
+	Host string
+
+	// RPIDHash is the rpIdHash of the authenticator data, the sha256 of the rp id or app id the
+	// credential is scoped to
+	RPIDHash hex.Hash
+}
+
+// Resolver picks the tenant of a request
+type Resolver interface {
+	Resolve(ctx context.Context, hint Hint) (*Tenant, error)
+}
+
+// Registry holds the tenants of a multi tenant deployment
+type Registry struct {
+	tenants []*Tenant
+	byID    map[string]*Tenant
+	byHost  map[string]*Tenant
+	byHash  map[string]*Tenant
+	def     *Tenant
+}
+
+var _ Resolver = (*Registry)(nil)
+
+// NewRegistry returns the registry of the tenants. Tenants without storage of their own get the one open
+// returns for their namespace, so no two tenants share ceremonies or credentials by accident; a tenant left
+// without storage is an error rather than a fall back to a shared table.
+func NewRegistry(open func(namespace string) storage.Provider, tenants ...*Tenant) (*Registry, error) {
+	me := &Registry{
+		byID:   map[string]*Tenant{},
+		byHost: map[string]*Tenant{},
+		byHash: map[string]*Tenant{},
+	}
+
+	for _, t := range tenants {
+		if t.storage == nil && open != nil {
+			t.storage = open(t.Namespace())
+		}
+		if t.storage == nil {
+			return nil, fmt.Errorf("%w: tenant %q", ErrNoStorage, t.ID())
+		}
+
+		if err := me.add(t); err != nil {
+			return nil, err
+		}
+	}
+
+	return me, nil
+}
+
+func (me *Registry) add(t *Tenant) error {
+	if _, ok := me.byID[t.ID()]; ok || t.ID() == "" {
+		return fmt.Errorf("%w: id %q", ErrDuplicateTenant, t.ID())
+	}
+
+	if err := t.buildMatcher(); err != nil {
+		return err
+	}
+
+	hosts := map[string]*Tenant{}
+	for _, h := range t.Hosts() {
+		h = normalizeHost(h)
+		if other, ok := me.byHost[h]; ok {
+			return fmt.Errorf("%w: host %q of %q is served by %q", ErrDuplicateTenant, h, t.ID(), other.ID())
+		}
+		hosts[h] = t
+	}
+
+	hashes := map[string]*Tenant{}
+	for _, id := range append([]string{t.RPID()}, t.Policy().AppIDs...) {
+		sum := sha256.Sum256([]byte(id))
+		key := hex.Hash(sum[:]).Hex()
+		if other, ok := me.byHash[key]; ok {
+			return fmt.Errorf("%w: rp id %q of %q is used by %q", ErrDuplicateTenant, id, t.ID(), other.ID())
+		}
+		hashes[key] = t
+	}
+
+	me.tenants = append(me.tenants, t)
+	me.byID[t.ID()] = t
+	for h := range hosts {
+		me.byHost[h] = t
+	}
+	for k := range hashes {
+		me.byHash[k] = t
+	}
+
+	return nil
+}
+
+// WithDefault makes the tenant id answer requests no tenant matches
+func (me *Registry) WithDefault(id string) (*Registry, error) {
+	t, ok := me.byID[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownTenant, id)
+	}
+	me.def = t
+	return me, nil
+}
+
+// Tenants returns the tenants in the order they were registered
+func (me *Registry) Tenants() []*Tenant {
+	return append([]*Tenant{}, me.tenants...)
+}
+
+// Tenant returns the tenant id
+func (me *Registry) Tenant(id string) (*Tenant, bool) {
+	t, ok := me.byID[id]
+	return t, ok
+}
+
+// Resolve picks the tenant named by the hint, else the one served from its host, else the one whose rp id
+// hashes to its rpIdHash, else the default tenant. A tenant id that is not registered is never answered
+// by another tenant.
+func (me *Registry) Resolve(_ context.Context, hint Hint) (*Tenant, error) {
+	if hint.TenantID != "" {
+		if t, ok := me.byID[hint.TenantID]; ok {
+			return t, nil
+		}
+		return nil, webauthnerr.New(webauthnerr.CodeUnknownRelyingParty, ErrUnknownTenant).WithDetails("tenant %q", hint.TenantID)
+	}
+
+	if hint.Host != "" {
+		if t, ok := me.byHost[normalizeHost(hint.Host)]; ok {
+			return t, nil
+		}
+	}
+
+	if !hint.RPIDHash.IsZero() {
+		if t, ok := me.byHash[hint.RPIDHash.Hex()]; ok {
+			return t, nil
+		}
+	}
+
+	if me.def != nil {
+		return me.def, nil
+	}
+
+	return nil, webauthnerr.New(webauthnerr.CodeUnknownRelyingParty, ErrUnknownTenant).WithDetails("host %q rp id hash %s", hint.Host, hint.RPIDHash.Hex())
+}
+
+type resolverKey struct{}
+
+type hintKey struct{}
+
+// WithResolver returns a copy of ctx the flows resolve their tenant with
+func WithResolver(ctx context.Context, resolver Resolver) context.Context {
+	return context.WithValue(ctx, resolverKey{}, resolver)
+}
+
+// WithHint returns a copy of ctx carrying what the transport knows of the tenant of the request
+func WithHint(ctx context.Context, hint Hint) context.Context {
+	return context.WithValue(ctx, hintKey{}, hint)
+}
+
+// HintOf returns the hint of ctx
+func HintOf(ctx context.Context) Hint {
+	hint, _ := ctx.Value(hintKey{}).(Hint)
+	return hint
+}
+
+// ResolverOf returns the resolver of ctx, nil when the flows serve a single relying party
+func ResolverOf(ctx context.Context) Resolver {
+	resolver, _ := ctx.Value(resolverKey{}).(Resolver)
+	return resolver
+}
+
+// Resolve returns the tenant of a flow. With a Resolver on ctx it picks one by the hint of ctx, falling
+// back to the rpIdHash of the authenticator data when the hint has none; without one rp is the only tenant.
+func Resolve(ctx context.Context, rp Provider, rpIDHash hex.Hash) (*Tenant, error) {
+	resolver := ResolverOf(ctx)
+	if resolver == nil {
+		return Single(rp), nil
+	}
+
+	hint := HintOf(ctx)
+	if hint.RPIDHash.IsZero() {
+		hint.RPIDHash = rpIDHash
+	}
+
+	return resolver.Resolve(ctx, hint)
+}
+
+// RPIDHashOf returns the rpIdHash authenticator data starts with, nil when it is too short to hold one
+func RPIDHashOf(authData hex.Hash) hex.Hash {
+	if len(authData) < sha256.Size {
+		return nil
+	}
+	return authData[:sha256.Size]
+}
+
+func hostOf(origin string) string {
+	u, err := url.Parse(origin)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
+
+func normalizeHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
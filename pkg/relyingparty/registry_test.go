@@ -0,0 +1,256 @@
+package relyingparty_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/webauthn/gen/mockery"
+	"github.com/walteh/webauthn/pkg/hex"
+	"github.com/walteh/webauthn/pkg/relyingparty"
+	"github.com/walteh/webauthn/pkg/storage"
+	"github.com/walteh/webauthn/pkg/webauthnerr"
+)
+
+func rpIDHash(id string) hex.Hash {
+	sum := sha256.Sum256([]byte(id))
+	return sum[:]
+}
+
+func mockStorage(t *testing.T) func(string) storage.Provider {
+	return func(string) storage.Provider { return mockery.NewMockProvider_storage(t) }
+}
+
+func newRegistry(t *testing.T) *relyingparty.Registry {
+	t.Helper()
+
+	reg, err := relyingparty.NewRegistry(mockStorage(t),
+		relyingparty.NewTenant("acme", relyingparty.NewSimpleRelyingParty("Acme", "acme.com", "https://acme.com")).
+			WithOrigins("https://acme.com", "https://login.acme.com"),
+		relyingparty.NewTenant("globex", relyingparty.NewSimpleRelyingParty("Globex", "globex.io", "https://globex.io")).
+			WithHosts("auth.globex.io").
+			WithPolicy(relyingparty.Policy{UserVerification: true, AppIDs: []string{"ABCDE12345.io.globex.app"}}),
+	)
+	require.NoError(t, err)
+
+	return reg
+}
+
+func TestRegistryResolve(t *testing.T) {
+	reg := newRegistry(t)
+
+	tests := []struct {
+		name    string
+		hint    relyingparty.Hint
+		want    string
+		wantErr bool
+	}{
+		{name: "tenant id", hint: relyingparty.Hint{TenantID: "globex"}, want: "globex"},
+		{name: "tenant id wins over host", hint: relyingparty.Hint{TenantID: "globex", Host: "acme.com"}, want: "globex"},
+		{name: "unknown tenant id", hint: relyingparty.Hint{TenantID: "initech", Host: "acme.com"}, wantErr: true},
+		{name: "rp id host", hint: relyingparty.Hint{Host: "acme.com"}, want: "acme"},
+		{name: "origin host with port", hint: relyingparty.Hint{Host: "LOGIN.acme.com:443"}, want: "acme"},
+		{name: "explicit host", hint: relyingparty.Hint{Host: "auth.globex.io"}, want: "globex"},
+		{name: "explicit hosts replace the defaults", hint: relyingparty.Hint{Host: "globex.io"}, wantErr: true},
+		{name: "rp id hash", hint: relyingparty.Hint{RPIDHash: rpIDHash("globex.io")}, want: "globex"},
+		{name: "app id hash", hint: relyingparty.Hint{RPIDHash: rpIDHash("ABCDE12345.io.globex.app")}, want: "globex"},
+		{name: "unknown host falls back to rp id hash", hint: relyingparty.Hint{Host: "other.com", RPIDHash: rpIDHash("acme.com")}, want: "acme"},
+		{name: "nothing matches", hint: relyingparty.Hint{Host: "other.com", RPIDHash: rpIDHash("other.com")}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := reg.Resolve(context.Background(), tt.hint)
+			if tt.wantErr {
+				require.ErrorIs(t, err, relyingparty.ErrUnknownTenant)
+				assert.Equal(t, webauthnerr.CodeUnknownRelyingParty, webauthnerr.CodeOf(err))
+				assert.Equal(t, 404, webauthnerr.HTTPStatus(err))
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got.ID())
+		})
+	}
+
+	t.Run("default", func(t *testing.T) {
+		reg, err := newRegistry(t).WithDefault("acme")
+		require.NoError(t, err)
+
+		got, err := reg.Resolve(context.Background(), relyingparty.Hint{Host: "other.com"})
+		require.NoError(t, err)
+		assert.Equal(t, "acme", got.ID())
+
+		_, err = reg.Resolve(context.Background(), relyingparty.Hint{TenantID: "initech"})
+		assert.ErrorIs(t, err, relyingparty.ErrUnknownTenant)
+
+		_, err = newRegistry(t).WithDefault("initech")
+		assert.ErrorIs(t, err, relyingparty.ErrUnknownTenant)
+	})
+}
+
+func TestRegistryDuplicates(t *testing.T) {
+	acme := relyingparty.NewSimpleRelyingParty("Acme", "acme.com", "https://acme.com")
+
+	tests := []struct {
+		name    string
+		tenants []*relyingparty.Tenant
+	}{
+		{
+			name:    "id",
+			tenants: []*relyingparty.Tenant{relyingparty.NewTenant("acme", acme), relyingparty.NewTenant("acme", relyingparty.NewSimpleRelyingParty("", "other.com", ""))},
+		},
+		{
+			name:    "host",
+			tenants: []*relyingparty.Tenant{relyingparty.NewTenant("acme", acme), relyingparty.NewTenant("other", relyingparty.NewSimpleRelyingParty("", "other.com", "")).WithHosts("acme.com")},
+		},
+		{
+			name:    "rp id",
+			tenants: []*relyingparty.Tenant{relyingparty.NewTenant("acme", acme), relyingparty.NewTenant("other", acme).WithHosts("other.com")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := relyingparty.NewRegistry(mockStorage(t), tt.tenants...)
+			assert.ErrorIs(t, err, relyingparty.ErrDuplicateTenant)
+		})
+	}
+}
+
+func TestTenant(t *testing.T) {
+	reg := newRegistry(t)
+
+	acme, ok := reg.Tenant("acme")
+	require.True(t, ok)
+	globex, ok := reg.Tenant("globex")
+	require.True(t, ok)
+
+	assert.Equal(t, "acme.com", acme.RPID())
+	assert.Equal(t, "Acme", acme.RPDisplayName())
+	assert.Equal(t, []string{"https://acme.com", "https://login.acme.com"}, acme.Origins())
+	assert.Equal(t, []string{"acme.com"}, acme.AppIDs())
+	assert.False(t, acme.Policy().UserVerification)
+
+	assert.Equal(t, []string{"https://globex.io"}, globex.Origins())
+	assert.Equal(t, []string{"ABCDE12345.io.globex.app"}, globex.AppIDs())
+	assert.True(t, globex.Policy().UserVerification)
+
+}
+
+func TestRegistryStorage(t *testing.T) {
+	def := mockery.NewMockProvider_storage(t)
+	own := mockery.NewMockProvider_storage(t)
+
+	opened := map[string]storage.Provider{}
+	reg, err := relyingparty.NewRegistry(func(namespace string) storage.Provider {
+		opened[namespace] = mockery.NewMockProvider_storage(t)
+		return opened[namespace]
+	},
+		relyingparty.NewTenant("acme", relyingparty.NewSimpleRelyingParty("Acme", "acme.com", "https://acme.com")),
+		relyingparty.NewTenant("globex", relyingparty.NewSimpleRelyingParty("Globex", "globex.io", "https://globex.io")).WithNamespace("globex-prod"),
+		relyingparty.NewTenant("initech", relyingparty.NewSimpleRelyingParty("Initech", "initech.com", "https://initech.com")).WithStorage(own),
+	)
+	require.NoError(t, err)
+
+	acme, _ := reg.Tenant("acme")
+	globex, _ := reg.Tenant("globex")
+	initech, _ := reg.Tenant("initech")
+
+	assert.Len(t, opened, 2)
+	assert.Same(t, opened["acme"], acme.Storage(def))
+	assert.Same(t, opened["globex-prod"], globex.Storage(def))
+	assert.Same(t, own, initech.Storage(def))
+
+	// only a deployment without a registry uses the default storage
+	assert.Same(t, def, relyingparty.Single(relyingparty.NewSimpleRelyingParty("Acme", "acme.com", "https://acme.com")).Storage(def))
+
+	t.Run("no storage", func(t *testing.T) {
+		_, err := relyingparty.NewRegistry(nil, relyingparty.NewTenant("acme", relyingparty.NewSimpleRelyingParty("Acme", "acme.com", "https://acme.com")))
+		assert.ErrorIs(t, err, relyingparty.ErrNoStorage)
+
+		_, err = relyingparty.NewRegistry(func(string) storage.Provider { return nil }, relyingparty.NewTenant("acme", relyingparty.NewSimpleRelyingParty("Acme", "acme.com", "https://acme.com")))
+		assert.ErrorIs(t, err, relyingparty.ErrNoStorage)
+	})
+}
+
+func TestResolve(t *testing.T) {
+	rp := relyingparty.NewSimpleRelyingParty("Acme", "acme.com", "https://acme.com")
+
+	t.Run("single tenant", func(t *testing.T) {
+		got, err := relyingparty.Resolve(context.Background(), rp, rpIDHash("globex.io"))
+		require.NoError(t, err)
+		assert.Equal(t, "acme.com", got.RPID())
+		assert.Equal(t, []string{"https://acme.com"}, got.Origins())
+	})
+
+	t.Run("registry", func(t *testing.T) {
+		ctx := relyingparty.WithResolver(context.Background(), newRegistry(t))
+
+		got, err := relyingparty.Resolve(ctx, rp, rpIDHash("globex.io"))
+		require.NoError(t, err)
+		assert.Equal(t, "globex", got.ID())
+
+		// the hint of the transport wins over the authenticator data
+		got, err = relyingparty.Resolve(relyingparty.WithHint(ctx, relyingparty.Hint{Host: "acme.com"}), rp, rpIDHash("globex.io"))
+		require.NoError(t, err)
+		assert.Equal(t, "acme", got.ID())
+	})
+
+	assert.Nil(t, relyingparty.RPIDHashOf(hex.Hash{0x01}))
+	assert.Equal(t, rpIDHash("acme.com"), relyingparty.RPIDHashOf(append(rpIDHash("acme.com"), 0x05, 0, 0, 0, 1)))
+}
+
+func TestTenantOriginMatcher(t *testing.T) {
+	const fingerprint = "14:6D:E9:83:C5:73:06:50:D8:EE:B9:95:2F:34:FC:64:16:A0:83:42:E6:1D:BE:A8:8A:04:96:B2:3F:CF:44:E5"
+
+	reg, err := relyingparty.NewRegistry(mockStorage(t),
+		relyingparty.NewTenant("acme", relyingparty.NewSimpleRelyingParty("Acme", "acme.com", "https://acme.com")).
+			WithOrigins("https://acme.com", "https://*.acme.com", "http://localhost:*").
+			WithUnpublishedOrigins().
+			WithPolicy(relyingparty.Policy{
+				APKCertificateFingerprints: []string{fingerprint},
+				TopOrigins:                 []string{"https://partner.com"},
+			}),
+	)
+	require.NoError(t, err)
+
+	acme, ok := reg.Tenant("acme")
+	require.True(t, ok)
+
+	matcher := acme.OriginMatcher()
+	assert.True(t, matcher.MatchOrigin("https://eu.acme.com"))
+	assert.True(t, matcher.MatchOrigin("http://localhost:5173"))
+	assert.True(t, matcher.MatchOrigin("android:apk-key-hash:FG3pg8VzBlDY7rmVLzT8ZBagg0LmHb6oigSWsj_PROU"))
+	assert.False(t, matcher.MatchOrigin("https://evil.com"))
+	assert.True(t, matcher.MatchTopOrigin("https://partner.com"))
+
+	// patterns are not hosts a request can be resolved by
+	assert.Equal(t, []string{"acme.com", "acme.com"}, acme.Hosts())
+
+	t.Run("unpublished without opting in", func(t *testing.T) {
+		_, err := relyingparty.NewRegistry(mockStorage(t),
+			relyingparty.NewTenant("acme", relyingparty.NewSimpleRelyingParty("Acme", "acme.com", "https://acme.com")).
+				WithOrigins("https://acme.com", "https://*.acme.com"),
+		)
+		assert.ErrorIs(t, err, relyingparty.ErrUnpublishedOrigin)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, tenant := range []*relyingparty.Tenant{
+			relyingparty.NewTenant("evil", relyingparty.NewSimpleRelyingParty("", "acme.com", "")).WithOrigins("https://*.evil.com").WithUnpublishedOrigins(),
+			relyingparty.NewTenant("apk", relyingparty.NewSimpleRelyingParty("", "acme.com", "")).WithPolicy(relyingparty.Policy{APKCertificateFingerprints: []string{"14:6D"}}),
+			relyingparty.NewTenant("top", relyingparty.NewSimpleRelyingParty("", "acme.com", "")).WithPolicy(relyingparty.Policy{TopOrigins: []string{"partner.com"}}),
+		} {
+			_, err := relyingparty.NewRegistry(mockStorage(t), tenant)
+			assert.Error(t, err, tenant.ID())
+		}
+	})
+
+	// tenants outside a registry only accept their origin
+	single := relyingparty.Single(relyingparty.NewSimpleRelyingParty("Acme", "acme.com", "https://acme.com")).OriginMatcher()
+	assert.True(t, single.MatchOrigin("https://acme.com"))
+	assert.False(t, single.MatchOrigin("https://eu.acme.com"))
+}
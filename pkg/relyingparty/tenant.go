@@ -0,0 +1,248 @@
+package relyingparty
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/walteh/webauthn/pkg/accesstoken"
+	"github.com/walteh/webauthn/pkg/storage"
+	"github.com/walteh/webauthn/pkg/webauthn/origin"
+	"github.com/walteh/webauthn/pkg/webauthn/types"
+)
+
+// Policy is what a tenant requires of its ceremonies beyond the WebAuthn procedures
+type Policy struct {
+	// UserVerification requires the authenticator to have verified the user, not only their presence
+	UserVerification bool
+
+	// AppIDs are the "TEAMID.bundle.id" app ids of the tenant's Apple apps, the app attest flows accept their
+	// keys when the request does not name its own
+	AppIDs []string
+
+	// PackageNames are the package names of the tenant's Android apps, the android key flows accept their
+	// keys when the request does not name its own. There is no fallback, without them nothing is accepted.
+	PackageNames []string
+
+	// Production refuses app attest keys attested in the development environment
+	Production bool
+
+	// APKCertificateFingerprints are the sha256 fingerprints of the certificates the tenant's Android apps
+	// are signed with, their "android:apk-key-hash:" origins are accepted next to the tenant's origins
+	APKCertificateFingerprints []string
+
+	// TopOrigins are the origins of the pages allowed to embed the tenant's ceremonies in cross origin
+	// iframes, in the pattern syntax of origin.NewMatcher; without any cross origin ceremonies are rejected
+	TopOrigins []string
+}
+
+// Tenant is one relying party of a Registry: its id and origins, the hosts it is served from, its policy,
+// and the token provider and storage its ceremonies use
+type Tenant struct {
+	id        string
+	rp        Provider
+	origins   []string
+	hosts     []string
+	policy    Policy
+	namespace string
+	tokens    accesstoken.Provider
+	storage   storage.Provider
+	matcher   *origin.Matcher
+
+	// unpublished lets the tenant accept origins its well-known documents can not list
+	unpublished bool
+}
+
+var _ Provider = (*Tenant)(nil)
+
+// NewTenant returns the tenant id serving rp. Its origins default to the one of rp, its hosts to those of
+// its origins and rp id, and its storage namespace to id.
+func NewTenant(id string, rp Provider) *Tenant {
+	return &Tenant{id: id, rp: rp, namespace: id}
+}
+
+// Single returns rp as the only tenant of a deployment without a Registry
+func Single(rp Provider) *Tenant {
+	return &Tenant{rp: rp}
+}
+
+// WithOrigins sets every origin the tenant's ceremonies may come from, in the pattern syntax of
+// origin.NewMatcher
+func (me *Tenant) WithOrigins(origins ...string) *Tenant {
+	me.origins = origins
+	return me
+}
+
+// WithUnpublishedOrigins lets a Registry tenant accept wildcard and dev port origins. They can not be listed
+// in its /.well-known/webauthn document, so without this opt-in a Registry refuses them to keep what the
+// tenant publishes and what it accepts the same.
+func (me *Tenant) WithUnpublishedOrigins() *Tenant {
+	me.unpublished = true
+	return me
+}
+
+// WithHosts sets the hosts the tenant is served from, matched against the Host header of requests
+func (me *Tenant) WithHosts(hosts ...string) *Tenant {
+	me.hosts = hosts
+	return me
+}
+
+func (me *Tenant) WithPolicy(policy Policy) *Tenant {
+	me.policy = policy
+	return me
+}
+
+// WithNamespace sets the storage namespace, the prefix of the tenant's tables NewRegistry opens its
+// storage with
+func (me *Tenant) WithNamespace(namespace string) *Tenant {
+	me.namespace = namespace
+	return me
+}
+
+// WithTokens sets the provider issuing the tenant's access tokens
+func (me *Tenant) WithTokens(tokens accesstoken.Provider) *Tenant {
+	me.tokens = tokens
+	return me
+}
+
+// WithStorage sets the storage holding the tenant's ceremonies and credentials
+func (me *Tenant) WithStorage(stg storage.Provider) *Tenant {
+	me.storage = stg
+	return me
+}
+
+func (me *Tenant) ID() string        { return me.id }
+func (me *Tenant) Policy() Policy    { return me.policy }
+func (me *Tenant) Namespace() string { return me.namespace }
+
+func (me *Tenant) RPDisplayName() string {
+	if me.rp == nil {
+		return ""
+	}
+	return me.rp.RPDisplayName()
+}
+
+func (me *Tenant) RPID() string {
+	if me.rp == nil {
+		return ""
+	}
+	return me.rp.RPID()
+}
+
+func (me *Tenant) RPOrigin() string {
+	if me.rp == nil {
+		return ""
+	}
+	return me.rp.RPOrigin()
+}
+
+// Origins returns every origin the tenant's ceremonies may come from
+func (me *Tenant) Origins() []string {
+	if len(me.origins) > 0 {
+		return me.origins
+	}
+	if origin := me.RPOrigin(); origin != "" {
+		return []string{origin}
+	}
+	return nil
+}
+
+// UnpublishedOrigins returns the wildcard and dev port origins of the tenant, which are accepted but can not
+// be published as related origins
+func (me *Tenant) UnpublishedOrigins() []string {
+	res := []string{}
+	for _, o := range me.Origins() {
+		if !strings.HasPrefix(o, origin.APKKeyHashPrefix) && strings.Contains(o, "*") {
+			res = append(res, o)
+		}
+	}
+	return res
+}
+
+// Hosts returns the hosts the tenant is served from
+func (me *Tenant) Hosts() []string {
+	if len(me.hosts) > 0 {
+		return me.hosts
+	}
+
+	hosts := []string{}
+	if rpID := me.RPID(); rpID != "" {
+		hosts = append(hosts, rpID)
+	}
+	for _, o := range me.Origins() {
+		if host := hostOf(o); host != "" && !strings.Contains(host, "*") {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
+
+// OriginMatcher returns the matcher of the tenant's origins, its apps' apk key hash origins and top origins.
+// Tenants outside a Registry only accept their origins exactly.
+func (me *Tenant) OriginMatcher() types.OriginMatcher {
+	if me.matcher != nil {
+		return me.matcher
+	}
+	return origin.Exact(me.Origins()...)
+}
+
+func (me *Tenant) buildMatcher() error {
+	if unpublished := me.UnpublishedOrigins(); len(unpublished) > 0 && !me.unpublished {
+		return fmt.Errorf("tenant %q: %w: %s can not be published, see WithUnpublishedOrigins", me.id, ErrUnpublishedOrigin, strings.Join(unpublished, ", "))
+	}
+
+	patterns := append([]string{}, me.Origins()...)
+	for _, fp := range me.policy.APKCertificateFingerprints {
+		o, err := origin.APKKeyHashOrigin(fp)
+		if err != nil {
+			return fmt.Errorf("tenant %q: %w", me.id, err)
+		}
+		patterns = append(patterns, o)
+	}
+
+	matcher, err := origin.NewMatcher(me.RPID(), patterns...)
+	if err != nil {
+		return fmt.Errorf("tenant %q: %w", me.id, err)
+	}
+
+	if len(me.policy.TopOrigins) > 0 {
+		top, err := origin.NewMatcher("", me.policy.TopOrigins...)
+		if err != nil {
+			return fmt.Errorf("tenant %q: top origins: %w", me.id, err)
+		}
+		matcher = matcher.WithTopOrigins(top)
+	}
+
+	me.matcher = matcher
+
+	return nil
+}
+
+// AppIDs returns the app ids of the tenant's policy, its rp id when it has none
+func (me *Tenant) AppIDs() []string {
+	if len(me.policy.AppIDs) > 0 {
+		return me.policy.AppIDs
+	}
+	return []string{me.RPID()}
+}
+
+// PackageNames returns the package names of the tenant's Android apps, empty when none are configured
+func (me *Tenant) PackageNames() []string {
+	return me.policy.PackageNames
+}
+
+// Tokens returns the tenant's token provider, def when it has none of its own
+func (me *Tenant) Tokens(def accesstoken.Provider) accesstoken.Provider {
+	if me.tokens != nil {
+		return me.tokens
+	}
+	return def
+}
+
+// Storage returns the tenant's storage. Every Registry tenant has its own, only the Single tenant of a
+// deployment without a Registry uses def.
+func (me *Tenant) Storage(def storage.Provider) storage.Provider {
+	if me.storage != nil {
+		return me.storage
+	}
+	return def
+}
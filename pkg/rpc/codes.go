@@ -0,0 +1,151 @@
+package rpc
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/walteh/webauthn/pkg/webauthnerr"
+)
+
+// Code is a grpc status code, numbered as in google.golang.org/grpc/codes and connectrpc.com/connect
+type Code uint32
+
+const (
+	CodeOK                 Code = 0
+	CodeCanceled           Code = 1
+	CodeUnknown            Code = 2
+	CodeInvalidArgument    Code = 3
+	CodeDeadlineExceeded   Code = 4
+	CodeNotFound           Code = 5
+	CodeAlreadyExists      Code = 6
+	CodePermissionDenied   Code = 7
+	CodeResourceExhausted  Code = 8
+	CodeFailedPrecondition Code = 9
+	CodeAborted            Code = 10
+	CodeOutOfRange         Code = 11
+	CodeUnimplemented      Code = 12
+	CodeInternal           Code = 13
+	CodeUnavailable        Code = 14
+	CodeDataLoss           Code = 15
+	CodeUnauthenticated    Code = 16
+)
+
+var codeNames = map[Code]string{
+	CodeOK:                 "ok",
+	CodeCanceled:           "canceled",
+	CodeUnknown:            "unknown",
+	CodeInvalidArgument:    "invalid_argument",
+	CodeDeadlineExceeded:   "deadline_exceeded",
+	CodeNotFound:           "not_found",
+	CodeAlreadyExists:      "already_exists",
+	CodePermissionDenied:   "permission_denied",
+	CodeResourceExhausted:  "resource_exhausted",
+	CodeFailedPrecondition: "failed_precondition",
+	CodeAborted:            "aborted",
+	CodeOutOfRange:         "out_of_range",
+	CodeUnimplemented:      "unimplemented",
+	CodeInternal:           "internal",
+	CodeUnavailable:        "unavailable",
+	CodeDataLoss:           "data_loss",
+	CodeUnauthenticated:    "unauthenticated",
+}
+
+func (me Code) String() string {
+	if name, ok := codeNames[me]; ok {
+		return name
+	}
+	return fmt.Sprintf("code_%d", uint32(me))
+}
+
+// CodeForStatus returns the grpc code of the http status code an app flow suggests
+func CodeForStatus(status int) Code {
+	switch {
+	case status >= 200 && status < 300:
+		return CodeOK
+	case status == http.StatusBadRequest:
+		return CodeInvalidArgument
+	case status == http.StatusUnauthorized:
+		return CodeUnauthenticated
+	case status == http.StatusForbidden:
+		return CodePermissionDenied
+	case status == http.StatusNotFound:
+		return CodeNotFound
+	case status == http.StatusConflict:
+		return CodeAlreadyExists
+	case status == http.StatusPreconditionFailed:
+		return CodeFailedPrecondition
+	case status == http.StatusTooManyRequests:
+		return CodeResourceExhausted
+	case status == http.StatusNotImplemented:
+		return CodeUnimplemented
+	case status == http.StatusBadGateway, status == http.StatusServiceUnavailable:
+		return CodeUnavailable
+	case status == http.StatusGatewayTimeout:
+		return CodeDeadlineExceeded
+	case status >= 400 && status < 500:
+		return CodeInvalidArgument
+	case status >= 500:
+		return CodeInternal
+	}
+	return CodeUnknown
+}
+
+var ErrRequestFailed = errors.New("ErrRequestFailed")
+
+// Error is a failed call with the grpc code it is reported with
+type Error struct {
+	Code Code
+	Err  error
+}
+
+func (me *Error) Error() string {
+	return fmt.Sprintf("%s: %v", me.Code, me.Err)
+}
+
+func (me *Error) Unwrap() error {
+	return me.Err
+}
+
+// ErrorCode returns the grpc code of an error returned by the service, CodeUnknown for other errors
+func ErrorCode(err error) Code {
+	if err == nil {
+		return CodeOK
+	}
+
+	var rpcErr *Error
+	if errors.As(err, &rpcErr) {
+		return rpcErr.Code
+	}
+
+	return CodeUnknown
+}
+
+// statusError turns the outcome of an app flow into an *Error, reported with the code of the
+// *webauthnerr.Error the flow failed with or else with the one of its status code
+func statusError(status int, err error) error {
+	code := CodeForStatus(status)
+	if code == CodeOK {
+		return nil
+	}
+
+	if err == nil {
+		err = fmt.Errorf("%w: status %d", ErrRequestFailed, status)
+	}
+
+	var werr *webauthnerr.Error
+	if errors.As(err, &werr) {
+		code = Code(werr.Code.GRPCCode())
+	}
+
+	return &Error{Code: code, Err: err}
+}
+
+// SafeMessage returns the message a client may be sent for an error returned by the service
+func SafeMessage(err error) string {
+	var werr *webauthnerr.Error
+	if errors.As(err, &werr) {
+		return werr.SafeMessage()
+	}
+	return ErrorCode(err).String()
+}
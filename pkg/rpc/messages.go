@@ -0,0 +1,96 @@
+package rpc
+
+import "github.com/walteh/webauthn/pkg/hex"
+
+// The messages of the WebAuthnService in proto/webauthn.proto
+
+type BeginRegistrationRequest struct {
+	SessionID    hex.Hash `json:"sessionId"`
+	CredentialID hex.Hash `json:"credentialId"`
+}
+
+type BeginRegistrationResponse struct {
+	Challenge hex.Hash `json:"challenge"`
+	ExpiresAt uint64   `json:"expiresAt"`
+}
+
+type FinishRegistrationRequest struct {
+	AttestationObject hex.Hash `json:"attestationObject"`
+	ClientDataJSON    hex.Hash `json:"clientDataJson"`
+	CredentialID      hex.Hash `json:"credentialId"`
+}
+
+type FinishRegistrationResponse struct {
+	AccessToken string `json:"accessToken"`
+}
+
+type BeginAuthenticationRequest struct {
+	SessionID    hex.Hash `json:"sessionId"`
+	CredentialID hex.Hash `json:"credentialId"`
+}
+
+type BeginAuthenticationResponse struct {
+	Challenge hex.Hash `json:"challenge"`
+	ExpiresAt uint64   `json:"expiresAt"`
+}
+
+type FinishAuthenticationRequest struct {
+	SessionID         hex.Hash `json:"sessionId"`
+	CredentialID      hex.Hash `json:"credentialId"`
+	ClientDataJSON    hex.Hash `json:"clientDataJson"`
+	AuthenticatorData hex.Hash `json:"authenticatorData"`
+	Signature         hex.Hash `json:"signature"`
+}
+
+type FinishAuthenticationResponse struct {
+	AccessToken string `json:"accessToken"`
+}
+
+type Credential struct {
+	CredentialID    hex.Hash `json:"credentialId"`
+	AttestationType string   `json:"attestationType"`
+	AAGUID          hex.Hash `json:"aaguid"`
+	SignCount       uint64   `json:"signCount"`
+	CloneWarning    bool     `json:"cloneWarning"`
+	AppID           string   `json:"appId"`
+	Environment     string   `json:"environment"`
+	CreatedAt       uint64   `json:"createdAt"`
+	UpdatedAt       uint64   `json:"updatedAt"`
+}
+
+// ListCredentialsRequest and DeleteCredentialRequest are authorized with an access token a ceremony issued,
+// the session is the one that registered the credential the token was issued for
+type ListCredentialsRequest struct {
+	AccessToken string `json:"accessToken"`
+}
+
+type ListCredentialsResponse struct {
+	Credentials []*Credential `json:"credentials"`
+}
+
+type DeleteCredentialRequest struct {
+	AccessToken  string   `json:"accessToken"`
+	CredentialID hex.Hash `json:"credentialId"`
+}
+
+type DeleteCredentialResponse struct{}
+
+type FinishAppAttestRegistrationRequest struct {
+	AttestationObject hex.Hash `json:"attestationObject"`
+	ClientDataJSON    hex.Hash `json:"clientDataJson"`
+	CredentialID      hex.Hash `json:"credentialId"`
+	SessionID         hex.Hash `json:"sessionId"`
+}
+
+type FinishAppAttestRegistrationResponse struct {
+	AppID string `json:"appId"`
+}
+
+type FinishAppAttestAuthenticationRequest struct {
+	Assertion  hex.Hash `json:"assertion"`
+	ClientData hex.Hash `json:"clientData"`
+}
+
+type FinishAppAttestAuthenticationResponse struct {
+	AppID string `json:"appId"`
+}
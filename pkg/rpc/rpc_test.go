@@ -0,0 +1,264 @@
+package rpc_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/webauthn/gen/mockery"
+	"github.com/walteh/webauthn/pkg/hex"
+	"github.com/walteh/webauthn/pkg/relyingparty"
+	"github.com/walteh/webauthn/pkg/rpc"
+	"github.com/walteh/webauthn/pkg/storage"
+	"github.com/walteh/webauthn/pkg/webauthn/types"
+)
+
+var (
+	sessionID    = hex.HexToHash("0x3a298ca21194c5ee7920d2ffc5247d6fa0f330a038cf3933e138602660430b8d")
+	credentialID = hex.HexToHash("0xfb1fd0ac98dca2891761baf97a486c75726900d3a94105afa598575f89c47295")
+
+	existingCeremony = &types.Ceremony{
+		ChallengeID:  hex.MustBase64ToHash("7fR9jktPydRpkGevqZIls_ff2VN_oLSK4HNBWzrIrTk"),
+		SessionID:    sessionID,
+		CeremonyType: types.CreateCeremony,
+		CreatedAt:    1668984054,
+		CredentialID: credentialID,
+		Ttl:          1668984354,
+	}
+
+	existingCredential = &types.Credential{
+		CreatedAt:       1669414368,
+		SessionId:       sessionID,
+		AAGUID:          hex.HexToHash("0x617070617474657374646576656c6f70"),
+		PublicKey:       hex.HexToHash("0x04bee9490389b5b36c0d4bd0676c52c46426bee73ace82f6d3c4479d6b6bec24f20ad2264f7739994e636f65f280c384aa2b70c2311741027e677db62ec80071ee"),
+		AttestationType: "apple-appattest",
+		UpdatedAt:       1669414368,
+		RawID:           credentialID,
+		Type:            "public-key",
+	}
+
+	appAttestAssertion = hex.HexToHash("0x7b2263726564656e7469616c5f6964223a22307866623166643061633938646361323839313736316261663937613438366337353732363930306433613934313035616661353938353735663839633437323935222c22617373657274696f6e5f6f626a656374223a223078613236393733363936373665363137343735373236353538343733303435303232313030643336313135376361323132313339633431343532646435313838396435353330666333636663356634336332613937616161636330326132646638373566393032323034663133323532376263643937626563653864383465313337636331643764313163336664303762313837353938393938313931646563383265633332356136373136313735373436383635366537343639363336313734366637323434363137343631353832356334316663353535616366616334353330613466613461353635633139376331326464356434346432353264333332393963373336396233346366353737633634303030303030303031222c2273657373696f6e5f6964223a22307833613239386361323131393463356565373932306432666663353234376436666130663333306130333863663339333365313338363032363630343330623864222c2270726f7669646572223a226170706c65222c22636c69656e745f646174615f6a736f6e223a227b5c226368616c6c656e67655c223a5c22376652396a6b7450796452706b476576715a496c735f666632564e5f6f4c534b34484e42577a724972546b5c222c5c226f726967696e5c223a5c2268747470733a2f2f6e7567672e78797a5c222c5c22747970655c223a5c22776562617574686e2e6765745c227d227d")
+)
+
+func testContext() context.Context {
+	return zerolog.New(zerolog.NewConsoleWriter()).With().Caller().Logger().WithContext(context.Background())
+}
+
+func TestCodeForStatus(t *testing.T) {
+	for status, want := range map[int]rpc.Code{
+		200: rpc.CodeOK,
+		204: rpc.CodeOK,
+		400: rpc.CodeInvalidArgument,
+		401: rpc.CodeUnauthenticated,
+		403: rpc.CodePermissionDenied,
+		404: rpc.CodeNotFound,
+		409: rpc.CodeAlreadyExists,
+		418: rpc.CodeInvalidArgument,
+		429: rpc.CodeResourceExhausted,
+		500: rpc.CodeInternal,
+		502: rpc.CodeUnavailable,
+		504: rpc.CodeDeadlineExceeded,
+		0:   rpc.CodeUnknown,
+	} {
+		assert.Equal(t, want, rpc.CodeForStatus(status), status)
+	}
+
+	assert.Equal(t, "permission_denied", rpc.CodePermissionDenied.String())
+	assert.Equal(t, rpc.CodeUnknown, rpc.ErrorCode(errors.New("other")))
+	assert.Equal(t, rpc.CodeOK, rpc.ErrorCode(nil))
+}
+
+func TestService_Begin(t *testing.T) {
+	ctx := testContext()
+
+	stgp := mockery.NewMockProvider_storage(t)
+
+	var written *types.Ceremony
+	stgp.EXPECT().WriteNewCeremony(ctx, mock.Anything).RunAndReturn(func(_ context.Context, c *types.Ceremony) error {
+		written = c
+		return nil
+	}).Once()
+
+	svc := rpc.NewService(stgp, nil, nil, nil)
+
+	res, err := svc.BeginAppAttestAuthentication(ctx, &rpc.BeginAuthenticationRequest{SessionID: sessionID, CredentialID: credentialID})
+	require.NoError(t, err)
+
+	require.NotNil(t, written)
+	assert.Equal(t, written.ChallengeID, res.Challenge)
+	assert.Equal(t, written.Ttl, res.ExpiresAt)
+	assert.Equal(t, sessionID, written.SessionID)
+	assert.Equal(t, credentialID, written.CredentialID)
+	assert.Equal(t, types.AssertCeremony, written.CeremonyType)
+
+	_, err = svc.BeginAuthentication(ctx, &rpc.BeginAuthenticationRequest{SessionID: sessionID})
+	assert.Equal(t, rpc.CodeInvalidArgument, rpc.ErrorCode(err))
+
+	_, err = svc.BeginRegistration(ctx, &rpc.BeginRegistrationRequest{})
+	assert.Equal(t, rpc.CodeInvalidArgument, rpc.ErrorCode(err))
+
+	stgp.EXPECT().WriteNewCeremony(ctx, mock.Anything).Return(errors.New("throttled")).Once()
+
+	_, err = svc.BeginRegistration(ctx, &rpc.BeginRegistrationRequest{SessionID: sessionID})
+	assert.Equal(t, rpc.CodeUnavailable, rpc.ErrorCode(err))
+}
+
+// staticTokens maps access tokens to the user id they were issued for
+type staticTokens map[string]string
+
+func (me staticTokens) UserIDForAccessToken(_ context.Context, token string) (string, error) {
+	id, ok := me[token]
+	if !ok {
+		return "", errors.New("unknown token")
+	}
+	return id, nil
+}
+
+func TestService_Credentials(t *testing.T) {
+	ctx := testContext()
+
+	tokenCredential := &types.Credential{RawID: hex.HexToHash("0x02"), SessionId: sessionID}
+	tokens := staticTokens{"token": tokenCredential.RawID.Hex()}
+
+	other := &types.Credential{RawID: credentialID, SessionId: hex.HexToHash("0x01")}
+
+	tests := []struct {
+		name     string
+		token    string
+		stored   *types.Credential
+		getErr   error
+		deleted  bool
+		wantCode rpc.Code
+	}{
+		{name: "own credential", token: "token", stored: existingCredential, deleted: true, wantCode: rpc.CodeOK},
+		{name: "credential of other session", token: "token", stored: other, wantCode: rpc.CodePermissionDenied},
+		{name: "unknown credential", token: "token", getErr: storage.ErrNotFound, wantCode: rpc.CodeNotFound},
+		{name: "storage failure", token: "token", getErr: errors.New("throttled"), wantCode: rpc.CodeUnavailable},
+		{name: "forged token", token: "forged", wantCode: rpc.CodeUnauthenticated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stgp := mockery.NewMockProvider_storage(t)
+
+			if tt.stored != nil || tt.getErr != nil {
+				stgp.EXPECT().GetExistingCredential(ctx, tokenCredential.RawID.Hex()).Return(tokenCredential, nil)
+				stgp.EXPECT().GetExistingCredential(ctx, credentialID.Hex()).Return(tt.stored, tt.getErr)
+			}
+			if tt.deleted {
+				stgp.EXPECT().DeleteCredential(ctx, credentialID.Hex()).Return(nil)
+			}
+
+			svc := rpc.NewService(stgp, nil, nil, nil).WithAccessTokenValidator(tokens)
+
+			_, err := svc.DeleteCredential(ctx, &rpc.DeleteCredentialRequest{AccessToken: tt.token, CredentialID: credentialID})
+			assert.Equal(t, tt.wantCode, rpc.ErrorCode(err))
+		})
+	}
+
+	t.Run("list", func(t *testing.T) {
+		stgp := mockery.NewMockProvider_storage(t)
+
+		stgp.EXPECT().GetExistingCredential(ctx, tokenCredential.RawID.Hex()).Return(tokenCredential, nil)
+		stgp.EXPECT().ListCredentials(ctx, sessionID.Hex()).Return([]*types.Credential{existingCredential}, nil)
+
+		res, err := rpc.NewService(stgp, nil, nil, nil).WithAccessTokenValidator(tokens).ListCredentials(ctx, &rpc.ListCredentialsRequest{AccessToken: "token"})
+		require.NoError(t, err)
+
+		assert.Equal(t, []*rpc.Credential{{
+			CredentialID:    credentialID,
+			AttestationType: "apple-appattest",
+			AAGUID:          existingCredential.AAGUID,
+			CreatedAt:       1669414368,
+			UpdatedAt:       1669414368,
+		}}, res.Credentials)
+	})
+
+	t.Run("without a validator", func(t *testing.T) {
+		stgp := mockery.NewMockProvider_storage(t)
+
+		_, err := rpc.NewService(stgp, nil, nil, nil).ListCredentials(ctx, &rpc.ListCredentialsRequest{AccessToken: "token"})
+		assert.Equal(t, rpc.CodeUnauthenticated, rpc.ErrorCode(err))
+	})
+}
+
+func TestService_FinishAppAttestAuthentication(t *testing.T) {
+	ctx := testContext()
+
+	tests := []struct {
+		name     string
+		req      *rpc.FinishAppAttestAuthenticationRequest
+		store    bool
+		wantCode rpc.Code
+		wantApp  string
+		wantMsg  string
+	}{
+		{
+			name:     "valid",
+			req:      &rpc.FinishAppAttestAuthenticationRequest{Assertion: appAttestAssertion, ClientData: []byte("hi")},
+			store:    true,
+			wantCode: rpc.CodeOK,
+			wantApp:  "4497QJSAD3.xyz.nugg.app",
+		},
+		{
+			name:     "other client data",
+			req:      &rpc.FinishAppAttestAuthenticationRequest{Assertion: appAttestAssertion, ClientData: []byte("ho")},
+			store:    true,
+			wantCode: rpc.CodeUnauthenticated,
+			wantMsg:  "the signature could not be verified",
+		},
+		{
+			name:     "missing client data",
+			req:      &rpc.FinishAppAttestAuthenticationRequest{Assertion: appAttestAssertion},
+			wantCode: rpc.CodeInvalidArgument,
+			wantMsg:  "the request is missing required fields",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stgp := mockery.NewMockProvider_storage(t)
+			rpp := mockery.NewMockProvider_relyingparty(t)
+
+			if tt.store {
+				stgp.EXPECT().GetExisting(ctx, existingCeremony.ChallengeID.String(), credentialID.String()).Return(existingCeremony, existingCredential, nil)
+				stgp.EXPECT().IncrementExistingCredential(ctx, existingCeremony, credentialID.String()).Return(nil).Maybe()
+				rpp.EXPECT().RPID().Return("4497QJSAD3.xyz.nugg.app").Maybe()
+				rpp.EXPECT().RPOrigin().Return("https://nugg.xyz").Maybe()
+			}
+
+			res, err := rpc.NewService(stgp, rpp, nil, nil).FinishAppAttestAuthentication(ctx, tt.req)
+			assert.Equal(t, tt.wantCode, rpc.ErrorCode(err), err)
+
+			if tt.wantCode == rpc.CodeOK {
+				require.NoError(t, err)
+				assert.Equal(t, tt.wantApp, res.AppID)
+			} else {
+				assert.Nil(t, res)
+				assert.Equal(t, tt.wantMsg, rpc.SafeMessage(err))
+			}
+		})
+	}
+}
+
+func TestService_RegistryAppIDs(t *testing.T) {
+	stgp := mockery.NewMockProvider_storage(t)
+	stgp.EXPECT().GetExisting(mock.Anything, existingCeremony.ChallengeID.String(), credentialID.String()).Return(existingCeremony, existingCredential, nil)
+	stgp.EXPECT().IncrementExistingCredential(mock.Anything, existingCeremony, credentialID.String()).Return(nil)
+
+	reg, err := relyingparty.NewRegistry(func(string) storage.Provider { return stgp },
+		relyingparty.NewTenant("nugg", relyingparty.NewSimpleRelyingParty("Nugg", "nugg.xyz", "https://nugg.xyz")).
+			WithPolicy(relyingparty.Policy{AppIDs: []string{"4497QJSAD3.xyz.nugg.app"}}),
+	)
+	require.NoError(t, err)
+
+	ctx := relyingparty.WithResolver(relyingparty.WithHint(testContext(), relyingparty.Hint{TenantID: "nugg"}), reg)
+
+	// the service wide app ids only serve the single tenant path, the tenant's policy decides here
+	res, err := rpc.NewService(nil, nil, nil, nil).WithAppIDs("AAAAAAAAAA.xyz.nugg.other").
+		FinishAppAttestAuthentication(ctx, &rpc.FinishAppAttestAuthenticationRequest{Assertion: appAttestAssertion, ClientData: []byte("hi")})
+	require.NoError(t, err)
+	assert.Equal(t, "4497QJSAD3.xyz.nugg.app", res.AppID)
+}
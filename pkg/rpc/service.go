@@ -0,0 +1,200 @@
+// Package rpc implements the WebAuthnService of proto/webauthn.proto on top of the app flows, for backend
+// services that talk grpc rather than the header based http api. The package holds no transport, the server
+// that mounts Service converts the messages of its generated stubs to the ones of this package and reports
+// errors with rpc.ErrorCode(err) and rpc.SafeMessage(err), the wrapped error is only logged. Multi tenant
+// servers put their relying party registry and what the request tells of its tenant on the context with
+// relyingparty.WithResolver and relyingparty.WithHint, the flows resolve the tenant from there.
+package rpc
+
+import (
+	"context"
+
+	"github.com/walteh/webauthn/app/ceremony_begin"
+	"github.com/walteh/webauthn/app/credentials"
+	"github.com/walteh/webauthn/app/devicecheck_assert"
+	devicecheck "github.com/walteh/webauthn/app/devicecheck_attest"
+	"github.com/walteh/webauthn/app/passkey_assert"
+	"github.com/walteh/webauthn/app/passkey_attest"
+	"github.com/walteh/webauthn/pkg/accesstoken"
+	"github.com/walteh/webauthn/pkg/accesstoken/cognito"
+	"github.com/walteh/webauthn/pkg/relyingparty"
+	"github.com/walteh/webauthn/pkg/storage"
+	"github.com/walteh/webauthn/pkg/webauthn/types"
+)
+
+type Service struct {
+	storage      storage.Provider
+	relyingParty relyingparty.Provider
+	accessTokens accesstoken.Provider
+	validator    accesstoken.Validator
+	cognito      cognito.Client
+	production   bool
+	appIDs       []string
+}
+
+func NewService(stg storage.Provider, rp relyingparty.Provider, tkns accesstoken.Provider, cog cognito.Client) *Service {
+	return &Service{
+		storage:      stg,
+		relyingParty: rp,
+		accessTokens: tkns,
+		cognito:      cog,
+	}
+}
+
+// WithProduction makes app attest registrations refuse keys attested in the development environment.
+func (me *Service) WithProduction(production bool) *Service {
+	me.production = production
+	return me
+}
+
+// WithAccessTokenValidator sets the validator of the access tokens ListCredentials and DeleteCredential are
+// authorized with, without one both refuse every request.
+func (me *Service) WithAccessTokenValidator(validator accesstoken.Validator) *Service {
+	me.validator = validator
+	return me
+}
+
+// WithAppIDs sets the "TEAMID.bundle.id" app ids the app attest flows accept, instead of only the relying party id.
+// They are ignored for requests whose context carries a relying party resolver, each tenant accepts the app ids
+// of its policy.
+func (me *Service) WithAppIDs(appIDs ...string) *Service {
+	me.appIDs = appIDs
+	return me
+}
+
+// appIDsOf returns the app ids the app attest flows of ctx are given, none when they resolve a tenant
+func (me *Service) appIDsOf(ctx context.Context) []string {
+	if relyingparty.ResolverOf(ctx) != nil {
+		return nil
+	}
+	return me.appIDs
+}
+
+func (me *Service) BeginRegistration(ctx context.Context, req *BeginRegistrationRequest) (*BeginRegistrationResponse, error) {
+	out, err := ceremony_begin.Begin(ctx, me.storage, ceremony_begin.BeginInput{
+		RawSessionID:    req.SessionID,
+		RawCredentialID: req.CredentialID,
+		CeremonyType:    types.CreateCeremony,
+	})
+	if err := statusError(out.SuggestedStatusCode, err); err != nil {
+		return nil, err
+	}
+
+	return &BeginRegistrationResponse{Challenge: out.Challenge, ExpiresAt: out.ExpiresAt}, nil
+}
+
+func (me *Service) FinishRegistration(ctx context.Context, req *FinishRegistrationRequest) (*FinishRegistrationResponse, error) {
+	out, err := passkey_attest.Attest(ctx, me.storage, me.relyingParty, me.accessTokens, passkey_attest.PasskeyAttestationInput{
+		RawAttestationObject: req.AttestationObject,
+		UTF8ClientDataJSON:   string(req.ClientDataJSON),
+		RawCredentialID:      req.CredentialID,
+	})
+	if err := statusError(out.SuggestedStatusCode, err); err != nil {
+		return nil, err
+	}
+
+	return &FinishRegistrationResponse{AccessToken: out.AccessToken}, nil
+}
+
+func (me *Service) BeginAuthentication(ctx context.Context, req *BeginAuthenticationRequest) (*BeginAuthenticationResponse, error) {
+	out, err := ceremony_begin.Begin(ctx, me.storage, ceremony_begin.BeginInput{
+		RawSessionID:    req.SessionID,
+		RawCredentialID: req.CredentialID,
+		CeremonyType:    types.AssertCeremony,
+	})
+	if err := statusError(out.SuggestedStatusCode, err); err != nil {
+		return nil, err
+	}
+
+	return &BeginAuthenticationResponse{Challenge: out.Challenge, ExpiresAt: out.ExpiresAt}, nil
+}
+
+func (me *Service) FinishAuthentication(ctx context.Context, req *FinishAuthenticationRequest) (*FinishAuthenticationResponse, error) {
+	out, err := passkey_assert.Assert(ctx, me.storage, me.relyingParty, me.cognito, passkey_assert.PasskeyAssertionInput{
+		SessionID:            req.SessionID,
+		CredentialID:         req.CredentialID,
+		UTF8ClientDataJSON:   string(req.ClientDataJSON),
+		RawAuthenticatorData: req.AuthenticatorData,
+		RawSignature:         req.Signature,
+	})
+	if err := statusError(out.SuggestedStatusCode, err); err != nil {
+		return nil, err
+	}
+
+	return &FinishAuthenticationResponse{AccessToken: out.AccessToken}, nil
+}
+
+func (me *Service) ListCredentials(ctx context.Context, req *ListCredentialsRequest) (*ListCredentialsResponse, error) {
+	out, err := credentials.List(ctx, me.storage, me.validator, credentials.ListInput{
+		AccessToken: req.AccessToken,
+	})
+	if err := statusError(out.SuggestedStatusCode, err); err != nil {
+		return nil, err
+	}
+
+	res := &ListCredentialsResponse{Credentials: make([]*Credential, 0, len(out.Credentials))}
+	for _, c := range out.Credentials {
+		res.Credentials = append(res.Credentials, &Credential{
+			CredentialID:    c.RawID,
+			AttestationType: c.AttestationType,
+			AAGUID:          c.AAGUID,
+			SignCount:       c.SignCount,
+			CloneWarning:    c.CloneWarning,
+			AppID:           c.AppID,
+			Environment:     c.Environment,
+			CreatedAt:       c.CreatedAt,
+			UpdatedAt:       c.UpdatedAt,
+		})
+	}
+
+	return res, nil
+}
+
+func (me *Service) DeleteCredential(ctx context.Context, req *DeleteCredentialRequest) (*DeleteCredentialResponse, error) {
+	out, err := credentials.Delete(ctx, me.storage, me.validator, credentials.DeleteInput{
+		AccessToken:     req.AccessToken,
+		RawCredentialID: req.CredentialID,
+	})
+	if err := statusError(out.SuggestedStatusCode, err); err != nil {
+		return nil, err
+	}
+
+	return &DeleteCredentialResponse{}, nil
+}
+
+func (me *Service) BeginAppAttestRegistration(ctx context.Context, req *BeginRegistrationRequest) (*BeginRegistrationResponse, error) {
+	return me.BeginRegistration(ctx, req)
+}
+
+func (me *Service) FinishAppAttestRegistration(ctx context.Context, req *FinishAppAttestRegistrationRequest) (*FinishAppAttestRegistrationResponse, error) {
+	out, err := devicecheck.Attest(ctx, me.storage, me.relyingParty, devicecheck.DeviceCheckAttestationInput{
+		RawAttestationObject: req.AttestationObject,
+		UTF8ClientDataJSON:   string(req.ClientDataJSON),
+		RawCredentialID:      req.CredentialID,
+		RawSessionID:         req.SessionID,
+		Production:           me.production,
+		AppIDs:               me.appIDsOf(ctx),
+	})
+	if err := statusError(out.SuggestedStatusCode, err); err != nil {
+		return nil, err
+	}
+
+	return &FinishAppAttestRegistrationResponse{AppID: out.AppID}, nil
+}
+
+func (me *Service) BeginAppAttestAuthentication(ctx context.Context, req *BeginAuthenticationRequest) (*BeginAuthenticationResponse, error) {
+	return me.BeginAuthentication(ctx, req)
+}
+
+func (me *Service) FinishAppAttestAuthentication(ctx context.Context, req *FinishAppAttestAuthenticationRequest) (*FinishAppAttestAuthenticationResponse, error) {
+	out, err := devicecheck_assert.Assert(ctx, me.storage, me.relyingParty, devicecheck_assert.DeviceCheckAssertionInput{
+		RawAssertionObject:   req.Assertion,
+		ClientDataToValidate: req.ClientData,
+		AppIDs:               me.appIDsOf(ctx),
+	})
+	if err := statusError(out.SuggestedStatusCode, err); err != nil {
+		return nil, err
+	}
+
+	return &FinishAppAttestAuthenticationResponse{AppID: out.AppID}, nil
+}
@@ -2,10 +2,14 @@ package storage
 
 import (
 	"context"
+	"errors"
 
 	"github.com/walteh/webauthn/pkg/webauthn/types"
 )
 
+// ErrNotFound is returned by providers when the ceremony or credential does not exist
+var ErrNotFound = errors.New("ErrNotFound")
+
 type Provider interface {
 	WriteNewCeremony(ctx context.Context, crm *types.Ceremony) error
 	GetExistingCeremony(ctx context.Context, challenge string) (*types.Ceremony, error)
@@ -13,4 +17,9 @@ type Provider interface {
 	GetExistingCredential(ctx context.Context, credid string) (*types.Credential, error)
 	WriteNewCredential(ctx context.Context, crm *types.Ceremony, cred *types.Credential) error
 	IncrementExistingCredential(ctx context.Context, crm *types.Ceremony, credid string) error
+	// UpdateExistingCredentialCounter consumes the ceremony like IncrementExistingCredential but stores the sign
+	// count the authenticator reported, refusing one that is not above the stored count
+	UpdateExistingCredentialCounter(ctx context.Context, crm *types.Ceremony, credid string, signCount uint64) error
+	ListCredentials(ctx context.Context, sessionid string) ([]*types.Credential, error)
+	DeleteCredential(ctx context.Context, credid string) error
 }
@@ -0,0 +1,198 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/walteh/webauthn/pkg/federated"
+	"github.com/walteh/webauthn/pkg/hex"
+)
+
+var (
+	// ErrEmailConflict is returned when a verified email is already held by another account. The user
+	// has to sign in to that account and link the new identity from there - accounts are never merged
+	// on email alone, since that would hand the account to whoever controls a provider asserting the address.
+	ErrEmailConflict = errors.New("ErrEmailConflict")
+
+	// ErrIdentityLinked is returned when an identity already belongs to a different account
+	ErrIdentityLinked = errors.New("ErrIdentityLinked")
+
+	// ErrCredentialLinked is returned when a passkey already belongs to a different account
+	ErrCredentialLinked = errors.New("ErrCredentialLinked")
+
+	// ErrLastSignInMethod is returned when unlinking would leave an account with no way to sign in
+	ErrLastSignInMethod = errors.New("ErrLastSignInMethod")
+)
+
+// LinkingService attaches federated identities and passkeys to accounts.
+//
+// Email collisions follow these rules:
+//   - only verified emails claim an address; an unverified email is recorded but never conflicts
+//   - signing in with a new identity whose verified email is held by another account fails with ErrEmailConflict
+//   - linking an identity to a signed in account fails with ErrEmailConflict if its verified email is held by a different account
+//   - an account without a verified email adopts the verified email of the first identity linked to it
+type LinkingService struct {
+	store Store
+	now   func() time.Time
+}
+
+func NewLinkingService(store Store) *LinkingService {
+	return &LinkingService{
+		store: store,
+		now:   time.Now,
+	}
+}
+
+// SignInWithIdentity returns the account the identity is linked to, creating one if the identity is new.
+func (me *LinkingService) SignInWithIdentity(ctx context.Context, ident federated.Identity) (usr *User, created bool, err error) {
+	usr, err = me.store.GetUserByIdentity(ctx, ident.Provider, ident.Subject)
+	if err == nil {
+		return usr, false, nil
+	}
+	if !errors.Is(err, ErrUserNotFound) {
+		return nil, false, err
+	}
+
+	if err := me.checkEmail(ctx, ident, ""); err != nil {
+		return nil, false, err
+	}
+
+	now := uint64(me.now().Unix())
+
+	usr = &User{
+		ID:            uuid.NewString(),
+		Email:         ident.Email,
+		EmailVerified: ident.EmailVerified,
+		Identities:    []federated.Identity{ident},
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+
+	if err := me.store.PutUser(ctx, usr); err != nil {
+		return nil, false, err
+	}
+
+	return usr, true, nil
+}
+
+// SignInWithCredential returns the account a passkey is linked to
+func (me *LinkingService) SignInWithCredential(ctx context.Context, credentialID hex.Hash) (*User, error) {
+	return me.store.GetUserByCredential(ctx, credentialID)
+}
+
+// LinkIdentity attaches an identity to the signed in account userID
+func (me *LinkingService) LinkIdentity(ctx context.Context, userID string, ident federated.Identity) (*User, error) {
+	usr, err := me.store.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if usr.HasIdentity(ident) {
+		return usr, nil
+	}
+
+	other, err := me.store.GetUserByIdentity(ctx, ident.Provider, ident.Subject)
+	if err == nil && other.ID != usr.ID {
+		zerolog.Ctx(ctx).Error().Str("identity", ident.Key()).Str("user", usr.ID).Str("other", other.ID).Msg("identity linked to another user")
+		return nil, fmt.Errorf("%w: %s", ErrIdentityLinked, ident.Key())
+	}
+	if err != nil && !errors.Is(err, ErrUserNotFound) {
+		return nil, err
+	}
+
+	if err := me.checkEmail(ctx, ident, usr.ID); err != nil {
+		return nil, err
+	}
+
+	usr.Identities = append(usr.Identities, ident)
+
+	if !usr.EmailVerified && ident.EmailVerified && ident.Email != "" {
+		usr.Email = ident.Email
+		usr.EmailVerified = true
+	}
+
+	return usr, me.put(ctx, usr)
+}
+
+// UnlinkIdentity detaches an identity, e.g. when the provider reports that consent was revoked
+func (me *LinkingService) UnlinkIdentity(ctx context.Context, userID string, ident federated.Identity) (*User, error) {
+	usr, err := me.store.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	kept := usr.Identities[:0]
+	for _, i := range usr.Identities {
+		if i.Key() != ident.Key() {
+			kept = append(kept, i)
+		}
+	}
+
+	if len(kept) == len(usr.Identities) {
+		return usr, nil
+	}
+
+	if len(kept)+len(usr.CredentialIDs) == 0 {
+		return nil, ErrLastSignInMethod
+	}
+
+	usr.Identities = kept
+
+	return usr, me.put(ctx, usr)
+}
+
+// LinkCredential attaches a passkey registered by the signed in account userID
+func (me *LinkingService) LinkCredential(ctx context.Context, userID string, credentialID hex.Hash) (*User, error) {
+	usr, err := me.store.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if usr.HasCredential(credentialID) {
+		return usr, nil
+	}
+
+	other, err := me.store.GetUserByCredential(ctx, credentialID)
+	if err == nil && other.ID != usr.ID {
+		return nil, fmt.Errorf("%w: %s", ErrCredentialLinked, credentialID.Hex())
+	}
+	if err != nil && !errors.Is(err, ErrUserNotFound) {
+		return nil, err
+	}
+
+	usr.CredentialIDs = append(usr.CredentialIDs, credentialID)
+
+	return usr, me.put(ctx, usr)
+}
+
+// checkEmail fails when the identity's verified email belongs to an account other than userID
+func (me *LinkingService) checkEmail(ctx context.Context, ident federated.Identity, userID string) error {
+	if !ident.EmailVerified || ident.Email == "" {
+		return nil
+	}
+
+	holder, err := me.store.GetUserByVerifiedEmail(ctx, ident.Email)
+	if errors.Is(err, ErrUserNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if holder.ID == userID {
+		return nil
+	}
+
+	zerolog.Ctx(ctx).Error().Str("identity", ident.Key()).Str("holder", holder.ID).Msg("verified email already in use")
+
+	return ErrEmailConflict
+}
+
+func (me *LinkingService) put(ctx context.Context, usr *User) error {
+	usr.UpdatedAt = uint64(me.now().Unix())
+	return me.store.PutUser(ctx, usr)
+}
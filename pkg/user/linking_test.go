@@ -0,0 +1,166 @@
+package user_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/webauthn/pkg/federated"
+	"github.com/walteh/webauthn/pkg/hex"
+	"github.com/walteh/webauthn/pkg/user"
+)
+
+var (
+	appleIdent = federated.Identity{
+		Provider:      "apple",
+		Subject:       "001437.def535ddd9e24c4fa4367dca50fdfedb.1951",
+		Email:         "nugg@nugg.xyz",
+		EmailVerified: true,
+	}
+
+	googleIdent = federated.Identity{
+		Provider:      "https://accounts.google.com",
+		Subject:       "110169484474386276334",
+		Email:         "Nugg@nugg.xyz",
+		EmailVerified: true,
+	}
+
+	passkey = hex.HexToHash("0x7053ed09000cfafdd6e1d98d929796f9c07c466b")
+)
+
+func TestLinkingService_AppleUserAddsPasskey(t *testing.T) {
+	ctx := context.Background()
+	svc := user.NewLinkingService(user.NewMemoryStore())
+
+	usr, created, err := svc.SignInWithIdentity(ctx, appleIdent)
+	require.NoError(t, err)
+	assert.True(t, created)
+
+	_, err = svc.LinkCredential(ctx, usr.ID, passkey)
+	require.NoError(t, err)
+
+	byPasskey, err := svc.SignInWithCredential(ctx, passkey)
+	require.NoError(t, err)
+	assert.Equal(t, usr.ID, byPasskey.ID)
+
+	byApple, created, err := svc.SignInWithIdentity(ctx, appleIdent)
+	require.NoError(t, err)
+	assert.False(t, created)
+	assert.Equal(t, usr.ID, byApple.ID)
+}
+
+func TestLinkingService_EmailCollisions(t *testing.T) {
+	tests := []struct {
+		name    string
+		second  federated.Identity
+		wantErr error
+	}{
+		{
+			name:    "verified email held by another account",
+			second:  googleIdent,
+			wantErr: user.ErrEmailConflict,
+		},
+		{
+			name: "unverified email does not claim the address",
+			second: federated.Identity{
+				Provider: "https://login.example.com",
+				Subject:  "abc",
+				Email:    "nugg@nugg.xyz",
+			},
+		},
+		{
+			name: "different email",
+			second: federated.Identity{
+				Provider:      "https://accounts.google.com",
+				Subject:       "110169484474386276334",
+				Email:         "other@nugg.xyz",
+				EmailVerified: true,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			svc := user.NewLinkingService(user.NewMemoryStore())
+
+			first, _, err := svc.SignInWithIdentity(ctx, appleIdent)
+			require.NoError(t, err)
+
+			second, created, err := svc.SignInWithIdentity(ctx, tt.second)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.True(t, created)
+			assert.NotEqual(t, first.ID, second.ID)
+		})
+	}
+}
+
+func TestLinkingService_LinkIdentity(t *testing.T) {
+	ctx := context.Background()
+	svc := user.NewLinkingService(user.NewMemoryStore())
+
+	usr, _, err := svc.SignInWithIdentity(ctx, appleIdent)
+	require.NoError(t, err)
+
+	// the same verified email on the signed in account is not a conflict
+	usr, err = svc.LinkIdentity(ctx, usr.ID, googleIdent)
+	require.NoError(t, err)
+	assert.Len(t, usr.Identities, 2)
+
+	byGoogle, created, err := svc.SignInWithIdentity(ctx, googleIdent)
+	require.NoError(t, err)
+	assert.False(t, created)
+	assert.Equal(t, usr.ID, byGoogle.ID)
+
+	other, _, err := svc.SignInWithIdentity(ctx, federated.Identity{Provider: "apple", Subject: "002"})
+	require.NoError(t, err)
+
+	_, err = svc.LinkIdentity(ctx, other.ID, googleIdent)
+	assert.ErrorIs(t, err, user.ErrIdentityLinked)
+
+	_, err = svc.LinkIdentity(ctx, other.ID, federated.Identity{Provider: "github", Subject: "1", Email: "nugg@nugg.xyz", EmailVerified: true})
+	assert.ErrorIs(t, err, user.ErrEmailConflict)
+}
+
+func TestLinkingService_AdoptsVerifiedEmail(t *testing.T) {
+	ctx := context.Background()
+	svc := user.NewLinkingService(user.NewMemoryStore())
+
+	usr, _, err := svc.SignInWithIdentity(ctx, federated.Identity{Provider: "apple", Subject: "002", Email: "nugg@nugg.xyz"})
+	require.NoError(t, err)
+	assert.False(t, usr.EmailVerified)
+
+	usr, err = svc.LinkIdentity(ctx, usr.ID, googleIdent)
+	require.NoError(t, err)
+	assert.True(t, usr.EmailVerified)
+	assert.Equal(t, googleIdent.Email, usr.Email)
+}
+
+func TestLinkingService_Credentials(t *testing.T) {
+	ctx := context.Background()
+	svc := user.NewLinkingService(user.NewMemoryStore())
+
+	a, _, err := svc.SignInWithIdentity(ctx, appleIdent)
+	require.NoError(t, err)
+	b, _, err := svc.SignInWithIdentity(ctx, federated.Identity{Provider: "apple", Subject: "002"})
+	require.NoError(t, err)
+
+	_, err = svc.LinkCredential(ctx, a.ID, passkey)
+	require.NoError(t, err)
+
+	_, err = svc.LinkCredential(ctx, b.ID, passkey)
+	assert.ErrorIs(t, err, user.ErrCredentialLinked)
+
+	// the passkey keeps the account reachable once apple is unlinked
+	a, err = svc.UnlinkIdentity(ctx, a.ID, appleIdent)
+	require.NoError(t, err)
+	assert.Empty(t, a.Identities)
+
+	_, err = svc.UnlinkIdentity(ctx, b.ID, federated.Identity{Provider: "apple", Subject: "002"})
+	assert.ErrorIs(t, err, user.ErrLastSignInMethod)
+}
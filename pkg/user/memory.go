@@ -0,0 +1,99 @@
+package user
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/walteh/webauthn/pkg/hex"
+)
+
+var _ Store = (*MemoryStore)(nil)
+
+// MemoryStore is a Store kept in process memory, for tests and single instance deployments
+type MemoryStore struct {
+	mu    sync.RWMutex
+	users map[string][]byte
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		users: map[string][]byte{},
+	}
+}
+
+func (me *MemoryStore) GetUser(_ context.Context, id string) (*User, error) {
+	me.mu.RLock()
+	defer me.mu.RUnlock()
+
+	b, ok := me.users[id]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+
+	return decode(b)
+}
+
+func (me *MemoryStore) GetUserByIdentity(_ context.Context, provider string, subject string) (*User, error) {
+	return me.find(func(u *User) bool {
+		for _, i := range u.Identities {
+			if i.Provider == provider && i.Subject == subject {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func (me *MemoryStore) GetUserByCredential(_ context.Context, credentialID hex.Hash) (*User, error) {
+	return me.find(func(u *User) bool {
+		return u.HasCredential(credentialID)
+	})
+}
+
+func (me *MemoryStore) GetUserByVerifiedEmail(_ context.Context, email string) (*User, error) {
+	email = NormalizeEmail(email)
+	return me.find(func(u *User) bool {
+		return u.EmailVerified && NormalizeEmail(u.Email) == email
+	})
+}
+
+func (me *MemoryStore) PutUser(_ context.Context, user *User) error {
+	b, err := json.Marshal(user)
+	if err != nil {
+		return err
+	}
+
+	me.mu.Lock()
+	defer me.mu.Unlock()
+
+	me.users[user.ID] = b
+
+	return nil
+}
+
+func (me *MemoryStore) find(match func(*User) bool) (*User, error) {
+	me.mu.RLock()
+	defer me.mu.RUnlock()
+
+	for _, b := range me.users {
+		u, err := decode(b)
+		if err != nil {
+			return nil, err
+		}
+		if match(u) {
+			return u, nil
+		}
+	}
+
+	return nil, ErrUserNotFound
+}
+
+// users are stored encoded so callers never share (and race on) the stored value
+func decode(b []byte) (*User, error) {
+	u := &User{}
+	if err := json.Unmarshal(b, u); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
@@ -1,28 +1,71 @@
 package user
 
-// import (
-// 	"time"
-
-// 	"github.com/walteh/webauthn/pkg/signinwithapple"
-// )
-
-// type User struct {
-// 	Id string `dynamodbav:"id"                  json:"id"`
-// 	// Username  string `dynamodbav:"username"            json:"username"`
-// 	CreatedAt int64 `dynamodbav:"created_at"          json:"created_at"`
-// 	UpdatedAt int64 `dynamodbav:"updated_at"          json:"updated_at"`
-
-// 	// // Apple
-// 	// AppleId       string         `dynamodbav:"apple_id,omitempty"                   json:"apple_id,omitempty"`
-// 	// AppleAuthData *AppleAuthData `dynamodbav:"apple_auth_data,omitempty"            json:"apple_auth_data,omitempty"`
-// }
-
-// func NewAppleUser(newId string, username string, appleId string, abc *signinwithapple.ValidationResponse) *User {
-// 	now := time.Now().Unix()
-
-// 	return &User{
-// 		Id:        newId,
-// 		CreatedAt: now,
-// 		UpdatedAt: now,
-// 	}
-// }
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/walteh/webauthn/pkg/federated"
+	"github.com/walteh/webauthn/pkg/hex"
+)
+
+var (
+	ErrUserNotFound = errors.New("ErrUserNotFound")
+)
+
+// User is an account that federated identities and passkeys are attached to.
+// Any one of them can be used to sign in.
+type User struct {
+	ID string `json:"id"`
+
+	// Email is only trusted for collision checks when EmailVerified is set
+	Email         string `json:"email,omitempty"`
+	EmailVerified bool   `json:"email_verified"`
+
+	Identities    []federated.Identity `json:"identities,omitempty"`
+	CredentialIDs []hex.Hash           `json:"credential_ids,omitempty"`
+
+	CreatedAt uint64 `json:"created_at"`
+	UpdatedAt uint64 `json:"updated_at"`
+}
+
+func (me *User) HasIdentity(ident federated.Identity) bool {
+	for _, i := range me.Identities {
+		if i.Key() == ident.Key() {
+			return true
+		}
+	}
+	return false
+}
+
+func (me *User) HasCredential(credentialID hex.Hash) bool {
+	for _, c := range me.CredentialIDs {
+		if c.Equals(credentialID) {
+			return true
+		}
+	}
+	return false
+}
+
+// SignInMethods is the number of identities and passkeys the user can sign in with
+func (me *User) SignInMethods() int {
+	return len(me.Identities) + len(me.CredentialIDs)
+}
+
+// Store persists users and the indexes the linking service looks them up by.
+// Lookups return ErrUserNotFound when nothing matches.
+type Store interface {
+	GetUser(ctx context.Context, id string) (*User, error)
+	GetUserByIdentity(ctx context.Context, provider string, subject string) (*User, error)
+	GetUserByCredential(ctx context.Context, credentialID hex.Hash) (*User, error)
+
+	// GetUserByVerifiedEmail only matches users whose email is verified
+	GetUserByVerifiedEmail(ctx context.Context, email string) (*User, error)
+
+	PutUser(ctx context.Context, user *User) error
+}
+
+// NormalizeEmail is the form emails are compared in
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
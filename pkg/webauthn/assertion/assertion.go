@@ -2,17 +2,15 @@ package assertion
 
 import (
 	"context"
-	"crypto/ecdsa"
-	"crypto/elliptic"
 	"crypto/sha256"
 	"encoding/json"
 	"errors"
 
-	"github.com/go-webauthn/webauthn/protocol/webauthncose"
 	"github.com/walteh/webauthn/pkg/hex"
 	"github.com/walteh/webauthn/pkg/webauthn/authdata"
 	"github.com/walteh/webauthn/pkg/webauthn/clientdata"
 	"github.com/walteh/webauthn/pkg/webauthn/types"
+	"github.com/walteh/webauthn/pkg/webauthnerr"
 
 	"github.com/rs/zerolog"
 	"github.com/ugorji/go/codec"
@@ -26,7 +24,6 @@ func VerifyAssertionInput(ctx context.Context, args types.VerifyAssertionInputAr
 	// "assertive" steps, i.e "Let JSONtext be the result of running UTF-8 decode on the value of cData."
 	// We handle these steps in part as we verify but also beforehand
 	var (
-		key      interface{}
 		err      error
 		asserter types.AssertionObject
 	)
@@ -66,6 +63,7 @@ func VerifyAssertionInput(ctx context.Context, args types.VerifyAssertionInputAr
 		StoredChallenge:    args.StoredChallenge,
 		CeremonyType:       types.AssertCeremony,
 		RelyingPartyOrigin: args.RelyingPartyOrigin,
+		Origins:            args.Origins,
 	})
 	if validError != nil {
 		return validError
@@ -92,84 +90,58 @@ func VerifyAssertionInput(ctx context.Context, args types.VerifyAssertionInputAr
 		RelyingPartyID:          args.RelyingPartyID,
 		RequireUserVerification: args.VerifyUser,
 		RequireUserPresence:     false,
-		LastSignCount:           args.LastSignCount,
 		OptionalAttestedCredentialData: types.AttestedCredentialData{
 			CredentialID:        args.Input.CredentialID,
 			AAGUID:              args.AAGUID,
 			CredentialPublicKey: args.CredentialPublicKey,
 		},
 		UseSavedAttestedCredentialData: args.UseSavedAttestedCredentialData,
+		CeremonyType:                   types.AssertCeremony,
 	})
 	if validError != nil {
 		return validError
 	}
 
 	// Step 15. Let hash be the result of computing a hash over the cData using SHA-256.
-	// clientDataHash := sha256.Sum256(args.DataSignedByClient.Bytes())
-
-	// combo := append(args.DataSignedByClient, args.StoredChallenge...)
-
-	onemore := sha256.Sum256(args.DataSignedByClient)
+	clientDataHash := sha256.Sum256(args.DataSignedByClient)
 
 	// Step 16. Using the credential public key looked up in step 3, verify that sig is
 	// a valid signature over the binary concatenation of authData and hash.
+	// How the key is stored and what exactly is signed is up to the credential's attestation format.
+	verifier := args.AttestationProvider
 
-	sigData := append(asserter.RawAuthenticatorData, onemore[:]...)
-
-	if args.AttestationProvider.ID() == "apple-appattest" {
-		// Apple's App Attest uses a different signature format
-		// https://developer.apple.com/documentation/devicecheck/accessing_and_modifying_per-device_keys
-
-		// The signature is a DER-encoded ECDSA signature with the following structure:
-		// SEQUENCE {
-		//   r INTEGER,
-		//   s INTEGER
-		// }
-
-		// key, err = webauthncose.ParseFIDOPublicKey(args.CredentialPublicKey)
-		nonce := sha256.Sum256(sigData)
-
-		// 3. Use the public key that you stored from the attestation object to verify that the assertion’s signature is valid for nonce.
-		x, y := elliptic.Unmarshal(elliptic.P256(), args.CredentialPublicKey)
-		if x == nil {
-			err := errors.New("error parsing the public key")
-			zerolog.Ctx(ctx).Error().Err(err).Send()
-			return err
-		}
+	key, err := verifier.DecodeAssertionKey(args.CredentialPublicKey, appID)
+	if err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Str("provider", verifier.ID()).Msg("Error parsing the assertion public key")
+		return err
+	}
 
-		pubkey := &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
-		nonceHash := sha256.Sum256(nonce[:])
+	sigData := hex.Hash(verifier.AssertionSignedData(asserter.RawAuthenticatorData, clientDataHash[:]))
 
-		valid := ecdsa.VerifyASN1(pubkey, nonceHash[:], asserter.Signature)
-		if !valid {
-			err := errors.New("error validating the assertion signature")
-			zerolog.Ctx(ctx).Error().Err(err).Send()
-			return err
-		}
-	} else {
-		if appID == "" {
-			key, err = webauthncose.ParsePublicKey(args.CredentialPublicKey)
-		} else {
-			key, err = webauthncose.ParseFIDOPublicKey(args.CredentialPublicKey)
-		}
-
-		if err != nil {
-			zerolog.Ctx(ctx).Error().Err(err).Msg("Error parsing the assertion public key")
-			return err
-		}
+	if err := verifier.VerifyAssertionSignature(key, sigData, asserter.Signature); err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).
+			Str("provider", verifier.ID()).
+			Str("signature", asserter.Signature.Hex()).
+			Str("sigData", sigData.Hex()).
+			Str("appID", appID).
+			Msg("error validating the assertion signature")
+		return webauthnerr.New(webauthnerr.CodeSignatureInvalid, err).WithStep(webauthnerr.AuthenticationStep(16))
+	}
 
-		valid, err := webauthncose.VerifySignature(key, sigData[:], asserter.Signature)
-		if !valid || err != nil {
-			err := errors.New("error validating the assertion signature")
-			zerolog.Ctx(ctx).Error().Err(err).
-				Bool("valid", valid).
-				Any("key", key).
-				Str("signature", asserter.Signature.Hex()).
-				Str("sigData", sigData.Hex()).
-				Str("appID", appID)
-			return err
+	// Step 17. If the signature counter value authData.signCount is nonzero or the value stored in
+	// conjunction with credential’s id attribute is nonzero, then run the provider's counter check.
+	data, err := authdata.ParseAuthenticatorDataSavedAttestedCredential(ctx, asserter.RawAuthenticatorData, !args.CredentialPublicKey.IsZero())
+	if err != nil {
+		return err
+	}
 
-		}
+	if err := verifier.VerifyAssertionCounter(args.LastSignCount, data.Counter); err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).
+			Str("provider", verifier.ID()).
+			Uint64("data.Counter", data.Counter).
+			Uint64("args.LastSignCount", args.LastSignCount).
+			Msg("Counter value too low")
+		return webauthnerr.New(webauthnerr.CodeCounterRegression, err).WithStep(webauthnerr.AuthenticationStep(17))
 	}
 
 	return nil
@@ -12,6 +12,7 @@ import (
 	"github.com/rs/zerolog"
 	"github.com/walteh/webauthn/pkg/hex"
 	"github.com/walteh/webauthn/pkg/webauthn/types"
+	"github.com/walteh/webauthn/pkg/webauthnerr"
 )
 
 const (
@@ -135,6 +136,13 @@ func ResidentKeyUnrequired() *bool {
 // and Steps 11 through 14 for Assertion.
 func VerifyAuenticatorData(ctx context.Context, args types.VerifyAuenticatorDataArgs) error {
 
+	step := func(registration, assertion int) webauthnerr.Step {
+		if args.CeremonyType == types.CreateCeremony {
+			return webauthnerr.RegistrationStep(registration)
+		}
+		return webauthnerr.AuthenticationStep(assertion)
+	}
+
 	// Begin Step 11. Verify that the rpIdHash in authData is the SHA-256 hash of the RP ID expected by the RP.
 	rpIDHash := sha256.Sum256([]byte(args.RelyingPartyID))
 
@@ -166,7 +174,7 @@ func VerifyAuenticatorData(ctx context.Context, args types.VerifyAuenticatorData
 			Str("appIDHash[:]", hex.Bytes2Hex(appIDHash[:])).
 			Msg("RP Hash mismatch")
 
-		return err
+		return webauthnerr.New(webauthnerr.CodeRPIDMismatch, err).WithStep(step(9, 11))
 	}
 
 	// Registration Step 10 & Assertion Step 12
@@ -174,7 +182,7 @@ func VerifyAuenticatorData(ctx context.Context, args types.VerifyAuenticatorData
 	if args.RequireUserPresence && !data.Flags.UserPresent() {
 		err := errors.New("user presence flag not set by authenticator")
 		zerolog.Ctx(ctx).Error().Err(err).Send()
-		return err
+		return webauthnerr.New(webauthnerr.CodeUserNotPresent, err).WithStep(step(10, 12))
 	}
 
 	// Registration Step 11 & Assertion Step 13
@@ -183,14 +191,8 @@ func VerifyAuenticatorData(ctx context.Context, args types.VerifyAuenticatorData
 	if args.RequireUserVerification && !data.Flags.UserVerified() {
 		err := errors.New("user verification required but flag not set by authenticator")
 		zerolog.Ctx(ctx).Error().Err(err).Send()
-		return err
-
-	}
+		return webauthnerr.New(webauthnerr.CodeUserNotVerified, err).WithStep(step(11, 13))
 
-	if data.Counter < args.LastSignCount {
-		err := errors.New("counter value too low")
-		zerolog.Ctx(ctx).Error().Err(err).Uint64("data.Counter", data.Counter).Uint64("args.LastSignCount", args.LastSignCount).Msg("Counter value too low")
-		return err
 	}
 
 	// Registration Step 12 & Assertion Step 14
@@ -4,12 +4,14 @@ import (
 	"context"
 	"crypto/subtle"
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/url"
-	"strings"
 
 	"github.com/walteh/webauthn/pkg/errd"
+	"github.com/walteh/webauthn/pkg/webauthn/origin"
 	"github.com/walteh/webauthn/pkg/webauthn/types"
+	"github.com/walteh/webauthn/pkg/webauthnerr"
 )
 
 func ParseClientData(clientData string) (types.CollectedClientData, error) {
@@ -17,7 +19,7 @@ func ParseClientData(clientData string) (types.CollectedClientData, error) {
 	err := json.Unmarshal([]byte(clientData), &cd)
 	if err != nil {
 		log.Printf("failed to unmarshal client data, %v", err)
-		return types.CollectedClientData{}, err
+		return types.CollectedClientData{}, webauthnerr.New(webauthnerr.CodeMalformedClientData, err)
 	}
 	return cd, nil
 }
@@ -29,11 +31,18 @@ func ParseClientData(clientData string) (types.CollectedClientData, error) {
 func Verify(ctx context.Context, expected types.VerifyClientDataArgs) error {
 
 	r := expected.ClientData
+
+	step := func(registration, assertion int) webauthnerr.Step {
+		if expected.CeremonyType == types.CreateCeremony {
+			return webauthnerr.RegistrationStep(registration)
+		}
+		return webauthnerr.AuthenticationStep(assertion)
+	}
 	// Registration Step 3. Verify that the value of C.type is webauthn.create.
 
 	// Assertion Step 7. Verify that the value of C.type is the string webauthn.get.
 	if r.Type != expected.CeremonyType {
-		return errd.Wrap(ctx, ErrInvalidCeremonyType)
+		return errd.Wrap(ctx, webauthnerr.New(webauthnerr.CodeCeremonyTypeMismatch, ErrInvalidCeremonyType).WithStep(step(3, 7)))
 	}
 
 	// Registration Step 4. Verify that the value of C.challenge matches the challenge
@@ -55,18 +64,32 @@ func Verify(ctx context.Context, expected types.VerifyClientDataArgs) error {
 	// log.Println(abc)
 
 	if subtle.ConstantTimeCompare(expected.StoredChallenge, r.Challenge) != 1 {
-		return errd.Mismatch(ctx, ErrChallengeMismatch, string(expected.StoredChallenge), string(r.Challenge))
+		return errd.Mismatch(ctx, webauthnerr.New(webauthnerr.CodeChallengeMismatch, ErrChallengeMismatch).WithStep(step(4, 8)), string(expected.StoredChallenge), string(r.Challenge))
 	}
 
 	// Registration Step 5 & Assertion Step 9. Verify that the value of C.origin matches
 	// the Relying Party's origin.
 	clientDataOrigin, err := url.Parse(r.Origin)
 	if err != nil {
-		return errd.Wrap(ctx, ErrOriginNotParsableAsURL)
+		return errd.Wrap(ctx, webauthnerr.New(webauthnerr.CodeOriginMismatch, ErrOriginNotParsableAsURL).WithStep(step(5, 9)))
 	}
 
-	if !strings.EqualFold(types.FullyQualifiedOrigin(clientDataOrigin), expected.RelyingPartyOrigin) {
-		return errd.Mismatch(ctx, ErrOriginMismatch, expected.RelyingPartyOrigin, types.FullyQualifiedOrigin(clientDataOrigin))
+	// a nil *origin.Matcher in the interface is not nil, it is replaced the same as a missing matcher
+	origins := expected.Origins
+	if m, ok := origins.(*origin.Matcher); origins == nil || (ok && m == nil) {
+		origins = origin.Exact(expected.RelyingPartyOrigin)
+	}
+
+	if !origins.MatchOrigin(r.Origin) {
+		return errd.Mismatch(ctx, webauthnerr.New(webauthnerr.CodeOriginMismatch, ErrOriginMismatch).WithStep(step(5, 9)), expectedOrigins(origins, expected.RelyingPartyOrigin), types.FullyQualifiedOrigin(clientDataOrigin))
+	}
+
+	// a ceremony embedded in a cross origin iframe is only accepted when its top level page is explicitly
+	// allowed to embed it, client data that is cross origin without naming the top origin never is
+	if r.CrossOrigin || r.TopOrigin != "" {
+		if !origins.MatchTopOrigin(r.TopOrigin) {
+			return errd.Wrap(ctx, webauthnerr.New(webauthnerr.CodeOriginMismatch, ErrTopOriginMismatch).WithStep(step(5, 9)), r.TopOrigin)
+		}
 	}
 
 	// Registration Step 6 and Assertion Step 10. Verify that the value of C.tokenBinding.status
@@ -75,13 +98,22 @@ func Verify(ctx context.Context, expected types.VerifyClientDataArgs) error {
 	// matches the base64url encoding of the Token Binding ID for the connection.
 	if r.TokenBinding != nil {
 		if r.TokenBinding.Status == "" {
-			return errd.Wrap(ctx, ErrTokenMissingStatus)
+			return errd.Wrap(ctx, webauthnerr.New(webauthnerr.CodeTokenBindingInvalid, ErrTokenMissingStatus).WithStep(step(6, 10)))
 		}
 		if r.TokenBinding.Status != types.Present && r.TokenBinding.Status != types.Supported && r.TokenBinding.Status != types.NotSupported {
-			return errd.Wrap(ctx, ErrTokenInvalidStatus)
+			return errd.Wrap(ctx, webauthnerr.New(webauthnerr.CodeTokenBindingInvalid, ErrTokenInvalidStatus).WithStep(step(6, 10)))
 		}
 	}
 	// Not yet fully implemented by the spec, browsers, and me.
 
 	return nil
 }
+
+// expectedOrigins describes what origins accepts, matchers that can not list their origins are described by
+// the relying party origin
+func expectedOrigins(origins types.OriginMatcher, rpOrigin string) string {
+	if s, ok := origins.(fmt.Stringer); ok {
+		return s.String()
+	}
+	return rpOrigin
+}
@@ -7,10 +7,14 @@ import (
 	"testing"
 
 	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/walteh/webauthn/pkg/hex"
 	"github.com/walteh/webauthn/pkg/webauthn/challenge"
 	"github.com/walteh/webauthn/pkg/webauthn/clientdata"
+	"github.com/walteh/webauthn/pkg/webauthn/origin"
 	"github.com/walteh/webauthn/pkg/webauthn/types"
+	"github.com/walteh/webauthn/pkg/webauthnerr"
 )
 
 func setupCollectedClientData(challenge []byte) types.CollectedClientData {
@@ -69,3 +73,117 @@ func TestVerifyCollectedClientDataIncorrectChallenge(t *testing.T) {
 		t.Fatalf("error expected but not received. expected %#v got %#v", (ccd.Challenge), storedChallenge)
 	}
 }
+
+func TestVerifyCollectedClientDataStep(t *testing.T) {
+	ctx := zerolog.New(zerolog.NewConsoleWriter()).Level(zerolog.TraceLevel).With().Caller().Logger().WithContext(context.Background())
+
+	newChallenge, err := challenge.CreateChallenge()
+	require.NoError(t, err)
+
+	for ceremony, step := range map[types.CeremonyType]webauthnerr.Step{
+		types.CreateCeremony: "7.1.5",
+		types.AssertCeremony: "7.2.9",
+	} {
+		ccd := setupCollectedClientData(newChallenge)
+		ccd.Type = ceremony
+		ccd.Origin = "https://evil.xyz"
+
+		err = clientdata.Verify(ctx, types.VerifyClientDataArgs{
+			ClientData:         ccd,
+			StoredChallenge:    newChallenge,
+			CeremonyType:       ceremony,
+			RelyingPartyOrigin: "https://example.com",
+		})
+		require.ErrorIs(t, err, clientdata.ErrOriginMismatch)
+
+		var werr *webauthnerr.Error
+		require.ErrorAs(t, err, &werr)
+		assert.Equal(t, webauthnerr.CodeOriginMismatch, werr.Code)
+		assert.Equal(t, step, werr.Step)
+	}
+}
+
+func TestVerifyCollectedClientDataOrigins(t *testing.T) {
+	ctx := context.Background()
+
+	newChallenge, err := challenge.CreateChallenge()
+	require.NoError(t, err)
+
+	origins, err := origin.NewMatcher("example.com", "https://example.com", "https://*.example.com")
+	require.NoError(t, err)
+
+	top, err := origin.NewMatcher("", "https://partner.com")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		origin      string
+		topOrigin   string
+		crossOrigin bool
+		top         bool
+		want        error
+	}{
+		{name: "subdomain", origin: "https://login.example.com"},
+		{name: "other domain", origin: "https://evil.com", want: clientdata.ErrOriginMismatch},
+		{name: "cross origin without top origins", origin: "https://example.com", crossOrigin: true, want: clientdata.ErrTopOriginMismatch},
+		{name: "top origin without top origins", origin: "https://example.com", topOrigin: "https://partner.com", want: clientdata.ErrTopOriginMismatch},
+		{name: "allowed top origin", origin: "https://example.com", topOrigin: "https://partner.com", crossOrigin: true, top: true},
+		{name: "other top origin", origin: "https://example.com", topOrigin: "https://evil.com", crossOrigin: true, top: true, want: clientdata.ErrTopOriginMismatch},
+		{name: "cross origin without a top origin", origin: "https://example.com", crossOrigin: true, top: true, want: clientdata.ErrTopOriginMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ccd := setupCollectedClientData(newChallenge)
+			ccd.Origin, ccd.TopOrigin, ccd.CrossOrigin = tt.origin, tt.topOrigin, tt.crossOrigin
+
+			matcher := *origins
+			if tt.top {
+				matcher.WithTopOrigins(top)
+			}
+
+			err := clientdata.Verify(ctx, types.VerifyClientDataArgs{
+				ClientData:         ccd,
+				StoredChallenge:    newChallenge,
+				CeremonyType:       ccd.Type,
+				RelyingPartyOrigin: "https://example.com",
+				Origins:            &matcher,
+			})
+			if tt.want == nil {
+				require.NoError(t, err)
+				return
+			}
+
+			require.ErrorIs(t, err, tt.want)
+			assert.Equal(t, webauthnerr.CodeOriginMismatch, webauthnerr.CodeOf(err))
+		})
+	}
+}
+
+func TestVerifyCollectedClientDataNilMatcher(t *testing.T) {
+	ctx := context.Background()
+
+	newChallenge, err := challenge.CreateChallenge()
+	require.NoError(t, err)
+
+	var matcher *origin.Matcher
+
+	for o, want := range map[string]error{"https://example.com": nil, "https://evil.com": clientdata.ErrOriginMismatch} {
+		ccd := setupCollectedClientData(newChallenge)
+		ccd.Origin = o
+
+		// a nil matcher falls back to the relying party origin instead of panicking
+		err := clientdata.Verify(ctx, types.VerifyClientDataArgs{
+			ClientData:         ccd,
+			StoredChallenge:    newChallenge,
+			CeremonyType:       ccd.Type,
+			RelyingPartyOrigin: "https://example.com",
+			Origins:            matcher,
+		})
+		if want == nil {
+			assert.NoError(t, err, o)
+		} else {
+			assert.ErrorIs(t, err, want, o)
+		}
+	}
+}
@@ -14,4 +14,5 @@ var (
 	ErrTokenMissingStatus     = errors.New(reflect.TypeOf(errref).PkgPath() + ":ErrTokenMissingStatus")
 	ErrTokenInvalidStatus     = errors.New(reflect.TypeOf(errref).PkgPath() + ":ErrTokenInvalidStatus")
 	ErrOriginNotParsableAsURL = errors.New(reflect.TypeOf(errref).PkgPath() + ":ErrOriginNotParsableAsURL")
+	ErrTopOriginMismatch      = errors.New(reflect.TypeOf(errref).PkgPath() + ":ErrTopOriginMismatch")
 )
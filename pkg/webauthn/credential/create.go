@@ -13,6 +13,7 @@ import (
 	"github.com/walteh/webauthn/pkg/webauthn/clientdata"
 	"github.com/walteh/webauthn/pkg/webauthn/types"
 	"github.com/walteh/webauthn/pkg/webauthn/webauthncbor"
+	"github.com/walteh/webauthn/pkg/webauthnerr"
 )
 
 // func VerifyAttestationInput(args types.VerifyAttestationInputArgs) (*types.Credential, error) {
@@ -112,7 +113,7 @@ func ParseAttestationInput(ctx context.Context, ccr types.AttestationInput) (*ty
 	err = webauthncbor.Unmarshal(ccr.AttestationObject, &p)
 	if err != nil {
 		zerolog.Ctx(ctx).Error().Err(err).Msg("Error unmarshalling cbor attestation object")
-		return nil, err
+		return nil, webauthnerr.New(webauthnerr.CodeMalformedAttestation, err).WithStep(webauthnerr.RegistrationStep(8))
 	}
 
 	// p.RawAuthData = hex.Hash(p.RawAuthData)
@@ -123,7 +124,7 @@ func ParseAttestationInput(ctx context.Context, ccr types.AttestationInput) (*ty
 	dat, err := authdata.ParseAuthenticatorData(ctx, p.RawAuthData)
 	if err != nil {
 		log.Println("Error unmarshalling cbor auth data", err)
-		return nil, fmt.Errorf("error decoding auth data: %v", err)
+		return nil, webauthnerr.New(webauthnerr.CodeMalformedAttestation, fmt.Errorf("error decoding auth data: %v", err)).WithStep(webauthnerr.RegistrationStep(8))
 	}
 
 	p.AuthData = dat
@@ -131,7 +132,7 @@ func ParseAttestationInput(ctx context.Context, ccr types.AttestationInput) (*ty
 	p.Extensions = ccr.ClientExtensions
 
 	if !p.AuthData.Flags.HasAttestedCredentialData() {
-		return nil, errors.New("Attestation missing attested credential data flag")
+		return nil, webauthnerr.New(webauthnerr.CodeMalformedAttestation, errors.New("Attestation missing attested credential data flag")).WithStep(webauthnerr.RegistrationStep(8))
 	}
 
 	return &p, nil
@@ -153,6 +154,7 @@ func VerifyAttestationInput(ctx context.Context, args types.VerifyAttestationInp
 		StoredChallenge:    args.StoredChallenge,
 		CeremonyType:       types.CreateCeremony,
 		RelyingPartyOrigin: args.RelyingPartyOrigin,
+		Origins:            args.Origins,
 	})
 
 	if verifyError != nil {
@@ -177,7 +179,7 @@ func VerifyAttestationInput(ctx context.Context, args types.VerifyAttestationInp
 		AppId:                   "",
 		RequireUserPresence:     false,
 		RequireUserVerification: args.VerifyUser,
-		LastSignCount:           0,
+		CeremonyType:            types.CreateCeremony,
 	})
 
 	if authDataVerificationError != nil {
@@ -218,7 +220,7 @@ func VerifyAttestationInput(ctx context.Context, args types.VerifyAttestationInp
 		if len(attestationObject.AttStatement) != 0 {
 			err := errors.New("attestation format none with attestation present")
 			zerolog.Ctx(ctx).Error().Err(err).Send()
-			return nil, err
+			return nil, webauthnerr.New(webauthnerr.CodeAttestationInvalid, err).WithStep(webauthnerr.RegistrationStep(14))
 		}
 		return abc, nil
 	}
@@ -237,7 +239,7 @@ func VerifyAttestationInput(ctx context.Context, args types.VerifyAttestationInp
 			Str("attestation_type", attestationType).
 			Any("attestation_object", attestationObject).
 			Msg("Error verifying attestation")
-		return nil, err
+		return nil, webauthnerr.New(webauthnerr.CodeAttestationInvalid, err).WithStep(webauthnerr.RegistrationStep(14))
 	}
 
 	if len(receipt) > 0 {
@@ -252,5 +254,12 @@ func VerifyAttestationInput(ctx context.Context, args types.VerifyAttestationInp
 
 	abc.PublicKey = pk
 
+	if recorder, ok := args.Provider.(types.AttestedCredentialRecorder); ok {
+		if err := recorder.RecordAttestedCredential(*attestationObject, abc); err != nil {
+			zerolog.Ctx(ctx).Error().Err(err).Msg("Error recording attested credential")
+			return nil, err
+		}
+	}
+
 	return abc, nil
 }
@@ -0,0 +1,359 @@
+// Package inspect decodes the raw objects of webauthn and app attest ceremonies, attestation objects,
+// assertion objects, authenticator data and client data, into a report meant to be read by people
+// debugging a failed ceremony.
+package inspect
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/walteh/webauthn/pkg/hex"
+	"github.com/walteh/webauthn/pkg/webauthn/assertion"
+	"github.com/walteh/webauthn/pkg/webauthn/authdata"
+	"github.com/walteh/webauthn/pkg/webauthn/metadata"
+	"github.com/walteh/webauthn/pkg/webauthn/types"
+	"github.com/walteh/webauthn/pkg/webauthn/webauthncbor"
+	"github.com/walteh/webauthn/pkg/webauthn/webauthncose"
+)
+
+var (
+	ErrInvalidEncoding    = errors.New("ErrInvalidEncoding")
+	ErrUnrecognizedObject = errors.New("ErrUnrecognizedObject")
+)
+
+const (
+	KindAttestationObject = "attestation_object"
+	KindAssertionObject   = "assertion_object"
+	KindAuthenticatorData = "authenticator_data"
+	KindClientData        = "client_data"
+)
+
+// the backup flags of level 3, not yet known to types.AuthenticatorFlags
+const (
+	flagBackupEligible types.AuthenticatorFlags = 1 << 3
+	flagBackupState    types.AuthenticatorFlags = 1 << 4
+)
+
+// Report is everything decoded from one input. Only the objects the input carried are set.
+type Report struct {
+	Kind string `json:"kind"`
+	// Source names where the objects came from, such as the header they were carried in
+	Source       string   `json:"source,omitempty"`
+	CredentialID hex.Hash `json:"credential_id,omitempty"`
+
+	ClientData        *ClientData        `json:"client_data,omitempty"`
+	AttestationObject *AttestationObject `json:"attestation_object,omitempty"`
+	AssertionObject   *AssertionObject   `json:"assertion_object,omitempty"`
+	AuthenticatorData *AuthenticatorData `json:"authenticator_data,omitempty"`
+}
+
+type ClientData struct {
+	Type        types.CeremonyType `json:"type"`
+	Challenge   hex.Hash           `json:"challenge"`
+	Origin      string             `json:"origin"`
+	CrossOrigin bool               `json:"cross_origin"`
+	TopOrigin   string             `json:"top_origin,omitempty"`
+	// Hash is the sha256 of the raw client data, the hash the authenticator signed
+	Hash hex.Hash `json:"hash"`
+	Raw  string   `json:"raw"`
+}
+
+type AttestationObject struct {
+	Format            string                 `json:"fmt"`
+	AuthenticatorData *AuthenticatorData     `json:"auth_data"`
+	Statement         map[string]interface{} `json:"att_stmt"`
+	Certificates      []Certificate          `json:"x5c,omitempty"`
+}
+
+type AssertionObject struct {
+	AuthenticatorData *AuthenticatorData `json:"auth_data"`
+	Signature         hex.Hash           `json:"signature"`
+}
+
+type AuthenticatorData struct {
+	RPIDHash hex.Hash `json:"rpid_hash"`
+	Flags    Flags    `json:"flags"`
+	Counter  uint64   `json:"sign_count"`
+
+	AAGUID       *AAGUID    `json:"aaguid,omitempty"`
+	CredentialID hex.Hash   `json:"credential_id,omitempty"`
+	PublicKey    *PublicKey `json:"public_key,omitempty"`
+
+	Extensions hex.Hash `json:"extensions,omitempty"`
+}
+
+type Flags struct {
+	Raw                    types.AuthenticatorFlags `json:"raw"`
+	UserPresent            bool                     `json:"up"`
+	UserVerified           bool                     `json:"uv"`
+	BackupEligible         bool                     `json:"be"`
+	BackupState            bool                     `json:"bs"`
+	AttestedCredentialData bool                     `json:"at"`
+	Extensions             bool                     `json:"ed"`
+}
+
+type AAGUID struct {
+	ID uuid.UUID `json:"id"`
+	// Name is the description of the authenticator in the loaded metadata, or the app attest environment
+	Name string `json:"name,omitempty"`
+}
+
+type PublicKey struct {
+	COSE hex.Hash `json:"cose"`
+	PEM  string   `json:"pem"`
+}
+
+type Certificate struct {
+	Subject            string    `json:"subject"`
+	Issuer             string    `json:"issuer"`
+	SerialNumber       string    `json:"serial_number"`
+	NotBefore          time.Time `json:"not_before"`
+	NotAfter           time.Time `json:"not_after"`
+	PublicKeyAlgorithm string    `json:"public_key_algorithm"`
+	SignatureAlgorithm string    `json:"signature_algorithm"`
+	IsCA               bool      `json:"is_ca"`
+	Fingerprint        hex.Hash  `json:"sha256_fingerprint"`
+	Error              string    `json:"error,omitempty"`
+}
+
+// DecodeInput decodes hex (with or without 0x), standard base64 or base64url, padded or not. Input made
+// only of hex digits is read as hex, a json object is returned as is.
+func DecodeInput(input string) ([]byte, error) {
+	input = strings.TrimSpace(input)
+
+	if strings.HasPrefix(input, "{") {
+		return []byte(input), nil
+	}
+
+	if hexed := strings.TrimPrefix(strings.TrimPrefix(input, "0x"), "0X"); len(hexed)%2 == 0 && isHex(hexed) {
+		return hex.Decode("0x" + hexed)
+	}
+
+	if dec, err := base64.RawURLEncoding.DecodeString(hex.ResolveToRawURLEncoding(input)); err == nil {
+		return dec, nil
+	}
+
+	return nil, ErrInvalidEncoding
+}
+
+// Inspect recognizes a raw attestation object, assertion object, authenticator data or client data json
+// and decodes it
+func Inspect(ctx context.Context, raw []byte) (*Report, error) {
+	if json.Valid(raw) {
+		cd, err := DecodeClientData(raw)
+		if err != nil {
+			return nil, err
+		}
+		return &Report{Kind: KindClientData, ClientData: cd}, nil
+	}
+
+	var obj map[string]interface{}
+	if err := webauthncbor.Unmarshal(raw, &obj); err == nil {
+		if _, ok := obj["fmt"]; ok {
+			att, err := DecodeAttestationObject(ctx, raw)
+			if err != nil {
+				return nil, err
+			}
+			return &Report{Kind: KindAttestationObject, AttestationObject: att}, nil
+		}
+		if _, ok := obj["authenticatorData"]; ok {
+			ass, err := DecodeAssertionObject(ctx, raw)
+			if err != nil {
+				return nil, err
+			}
+			return &Report{Kind: KindAssertionObject, AssertionObject: ass}, nil
+		}
+	}
+
+	if len(raw) >= authdata.MinAuthDataLength {
+		ad, err := DecodeAuthenticatorData(ctx, raw)
+		if err != nil {
+			return nil, err
+		}
+		return &Report{Kind: KindAuthenticatorData, AuthenticatorData: ad}, nil
+	}
+
+	return nil, ErrUnrecognizedObject
+}
+
+func DecodeClientData(raw []byte) (*ClientData, error) {
+	var cd struct {
+		Type        types.CeremonyType `json:"type"`
+		Challenge   string             `json:"challenge"`
+		Origin      string             `json:"origin"`
+		CrossOrigin bool               `json:"crossOrigin"`
+		TopOrigin   string             `json:"topOrigin"`
+	}
+
+	if err := json.Unmarshal(raw, &cd); err != nil {
+		return nil, err
+	}
+
+	if cd.Type == "" || cd.Challenge == "" {
+		return nil, ErrUnrecognizedObject
+	}
+
+	challenge, err := hex.Base64ToHash(cd.Challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha256.Sum256(raw)
+
+	return &ClientData{
+		Type:        cd.Type,
+		Challenge:   challenge,
+		Origin:      cd.Origin,
+		CrossOrigin: cd.CrossOrigin,
+		TopOrigin:   cd.TopOrigin,
+		Hash:        hash[:],
+		Raw:         string(raw),
+	}, nil
+}
+
+func DecodeAttestationObject(ctx context.Context, raw []byte) (*AttestationObject, error) {
+	var obj types.AttestationObject
+	if err := webauthncbor.Unmarshal(raw, &obj); err != nil {
+		return nil, err
+	}
+
+	ad, err := DecodeAuthenticatorData(ctx, obj.RawAuthData)
+	if err != nil {
+		return nil, err
+	}
+
+	me := &AttestationObject{
+		Format:            obj.Format,
+		AuthenticatorData: ad,
+		Statement:         map[string]interface{}{},
+	}
+
+	for k, v := range obj.AttStatement {
+		if k == "x5c" {
+			continue
+		}
+		if b, ok := v.([]byte); ok {
+			v = hex.Hash(b)
+		}
+		me.Statement[k] = v
+	}
+
+	if x5c, ok := obj.AttStatement["x5c"].([]interface{}); ok {
+		for _, c := range x5c {
+			der, _ := c.([]byte)
+			me.Certificates = append(me.Certificates, DecodeCertificate(der))
+		}
+	}
+
+	return me, nil
+}
+
+func DecodeAssertionObject(ctx context.Context, raw []byte) (*AssertionObject, error) {
+	obj, err := assertion.ParseAssertionObject(ctx, raw)
+	if err != nil {
+		return nil, err
+	}
+
+	ad, err := DecodeAuthenticatorData(ctx, obj.RawAuthenticatorData)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AssertionObject{AuthenticatorData: ad, Signature: obj.Signature}, nil
+}
+
+func DecodeAuthenticatorData(ctx context.Context, raw []byte) (*AuthenticatorData, error) {
+	data, err := authdata.ParseAuthenticatorData(ctx, raw)
+	if err != nil {
+		return nil, err
+	}
+
+	me := &AuthenticatorData{
+		RPIDHash: data.RPIDHash,
+		Flags: Flags{
+			Raw:                    data.Flags,
+			UserPresent:            data.Flags.UserPresent(),
+			UserVerified:           data.Flags.UserVerified(),
+			BackupEligible:         data.Flags&flagBackupEligible != 0,
+			BackupState:            data.Flags&flagBackupState != 0,
+			AttestedCredentialData: data.Flags.HasAttestedCredentialData(),
+			Extensions:             data.Flags.HasExtensions(),
+		},
+		Counter:    data.Counter,
+		Extensions: data.ExtData,
+	}
+
+	if data.Flags.HasAttestedCredentialData() {
+		me.AAGUID = DecodeAAGUID(data.AttData.AAGUID)
+		me.CredentialID = data.AttData.CredentialID
+		me.PublicKey = &PublicKey{
+			COSE: data.AttData.CredentialPublicKey,
+			PEM:  webauthncose.DisplayPublicKey(data.AttData.CredentialPublicKey),
+		}
+	}
+
+	return me, nil
+}
+
+// DecodeAAGUID names the aaguid after its entry in metadata.Metadata, or the app attest environment
+func DecodeAAGUID(raw []byte) *AAGUID {
+	id, err := uuid.FromBytes(raw)
+	if err != nil {
+		return nil
+	}
+
+	me := &AAGUID{ID: id}
+
+	switch {
+	case string(raw) == "appattestdevelop":
+		me.Name = "App Attest (development)"
+	case string(raw) == "appattest\x00\x00\x00\x00\x00\x00\x00":
+		me.Name = "App Attest (production)"
+	default:
+		if entry, ok := metadata.Metadata[id]; ok {
+			me.Name = entry.MetadataStatement.Description
+		}
+	}
+
+	return me
+}
+
+func DecodeCertificate(der []byte) Certificate {
+	fingerprint := sha256.Sum256(der)
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return Certificate{Fingerprint: fingerprint[:], Error: err.Error()}
+	}
+
+	return Certificate{
+		Subject:            cert.Subject.String(),
+		Issuer:             cert.Issuer.String(),
+		SerialNumber:       cert.SerialNumber.String(),
+		NotBefore:          cert.NotBefore,
+		NotAfter:           cert.NotAfter,
+		PublicKeyAlgorithm: cert.PublicKeyAlgorithm.String(),
+		SignatureAlgorithm: cert.SignatureAlgorithm.String(),
+		IsCA:               cert.IsCA,
+		Fingerprint:        fingerprint[:],
+	}
+}
+
+func isHex(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,177 @@
+package inspect_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/webauthn/pkg/hex"
+	"github.com/walteh/webauthn/pkg/webauthn/inspect"
+	"github.com/walteh/webauthn/pkg/webauthn/metadata"
+	"github.com/walteh/webauthn/pkg/webauthn/types"
+	"github.com/walteh/webauthn/pkg/webauthn/webauthncbor"
+	"github.com/walteh/webauthn/pkg/webauthn/webauthntest"
+)
+
+var challenge = hex.HexToHash("0x8d0f2b8f7e3b4c5a9e1d2c3b4a5f6e7d")
+
+func TestDecodeInput(t *testing.T) {
+	raw := []byte{0xa1, 0x63, 0x66, 0x6d, 0x74, 0xfb, 0xff, 0xfe}
+
+	tests := []struct {
+		name    string
+		input   string
+		want    []byte
+		wantErr error
+	}{
+		{name: "hex", input: "a163666d74fbfffe", want: raw},
+		{name: "prefixed hex", input: "0xA163666D74FBFFFE", want: raw},
+		{name: "base64", input: base64.StdEncoding.EncodeToString(raw), want: raw},
+		{name: "base64url", input: base64.RawURLEncoding.EncodeToString(raw), want: raw},
+		{name: "surrounding space", input: "\n a163666d74fbfffe \n", want: raw},
+		{name: "json", input: `{"type":"webauthn.get"}`, want: []byte(`{"type":"webauthn.get"}`)},
+		{name: "neither", input: "not*base64", wantErr: inspect.ErrInvalidEncoding},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := inspect.DecodeInput(tt.input)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestInspect(t *testing.T) {
+	ctx := context.Background()
+
+	aaguid := uuid.Must(uuid.FromBytes(webauthntest.AAGUID))
+	metadata.Metadata[aaguid] = metadata.MetadataBLOBPayloadEntry{
+		MetadataStatement: metadata.MetadataStatement{Description: "webauthntest packed authenticator"},
+	}
+	t.Cleanup(func() { delete(metadata.Metadata, aaguid) })
+
+	a := webauthntest.NewAuthenticator(t, webauthntest.FormatPacked, webauthncose.AlgES256)
+
+	t.Run("attestation object", func(t *testing.T) {
+		input := a.Attest(t, challenge, webauthntest.Options{})
+
+		report, err := inspect.Inspect(ctx, input.AttestationObject)
+		require.NoError(t, err)
+
+		assert.Equal(t, inspect.KindAttestationObject, report.Kind)
+
+		att := report.AttestationObject
+		require.NotNil(t, att)
+		assert.Equal(t, "packed", att.Format)
+		assert.Equal(t, int64(webauthncose.AlgES256), att.Statement["alg"])
+		assert.NotContains(t, att.Statement, "x5c")
+		require.Len(t, att.Certificates, 2)
+		assert.Contains(t, att.Certificates[0].Subject, "CN=webauthntest packed attestation")
+		assert.Equal(t, "CN=webauthntest intermediate", att.Certificates[0].Issuer)
+		assert.True(t, att.Certificates[1].IsCA)
+
+		ad := att.AuthenticatorData
+		assert.True(t, ad.Flags.UserPresent)
+		assert.True(t, ad.Flags.UserVerified)
+		assert.True(t, ad.Flags.AttestedCredentialData)
+		assert.False(t, ad.Flags.Extensions)
+		assert.Equal(t, hex.Hash(a.CredentialID), ad.CredentialID)
+		require.NotNil(t, ad.AAGUID)
+		assert.Equal(t, aaguid, ad.AAGUID.ID)
+		assert.Equal(t, "webauthntest packed authenticator", ad.AAGUID.Name)
+		require.NotNil(t, ad.PublicKey)
+		assert.Contains(t, ad.PublicKey.PEM, "-----BEGIN PUBLIC KEY-----")
+
+		var tree bytes.Buffer
+		require.NoError(t, report.WriteTree(&tree))
+		assert.Contains(t, tree.String(), "aaguid: "+aaguid.String()+" (webauthntest packed authenticator)")
+		assert.Contains(t, tree.String(), "attested credential data (AT): true")
+
+		_, err = json.Marshal(report)
+		require.NoError(t, err)
+	})
+
+	t.Run("assertion object", func(t *testing.T) {
+		input := a.Assert(t, challenge, webauthntest.Options{
+			UserNotVerified: true,
+			Counter:         func() *uint32 { c := uint32(7); return &c }(),
+			SetFlags:        1<<3 | 1<<4,
+		})
+
+		report, err := inspect.Inspect(ctx, input.RawAssertionObject)
+		require.NoError(t, err)
+
+		assert.Equal(t, inspect.KindAssertionObject, report.Kind)
+		require.NotNil(t, report.AssertionObject)
+		assert.NotEmpty(t, report.AssertionObject.Signature)
+
+		ad := report.AssertionObject.AuthenticatorData
+		assert.Equal(t, uint64(7), ad.Counter)
+		assert.True(t, ad.Flags.UserPresent)
+		assert.False(t, ad.Flags.UserVerified)
+		assert.True(t, ad.Flags.BackupEligible)
+		assert.True(t, ad.Flags.BackupState)
+		assert.Nil(t, ad.AAGUID)
+		assert.Nil(t, ad.PublicKey)
+	})
+
+	t.Run("client data", func(t *testing.T) {
+		input := a.Assert(t, challenge, webauthntest.Options{TopOrigin: "https://top.nugg.xyz", CrossOrigin: true})
+
+		report, err := inspect.Inspect(ctx, []byte(input.RawClientDataJSON))
+		require.NoError(t, err)
+
+		assert.Equal(t, inspect.KindClientData, report.Kind)
+		require.NotNil(t, report.ClientData)
+		assert.Equal(t, types.AssertCeremony, report.ClientData.Type)
+		assert.Equal(t, challenge, report.ClientData.Challenge)
+		assert.Equal(t, webauthntest.Origin, report.ClientData.Origin)
+		assert.True(t, report.ClientData.CrossOrigin)
+		assert.Equal(t, "https://top.nugg.xyz", report.ClientData.TopOrigin)
+		assert.Equal(t, hex.Hash([]byte(input.RawClientDataJSON)).Sha256(), report.ClientData.Hash)
+	})
+
+	t.Run("authenticator data", func(t *testing.T) {
+		input := a.Attest(t, challenge, webauthntest.Options{})
+
+		att, err := inspect.DecodeAttestationObject(ctx, input.AttestationObject)
+		require.NoError(t, err)
+
+		var obj types.AttestationObject
+		require.NoError(t, webauthncbor.Unmarshal(input.AttestationObject, &obj))
+
+		report, err := inspect.Inspect(ctx, obj.RawAuthData)
+		require.NoError(t, err)
+
+		assert.Equal(t, inspect.KindAuthenticatorData, report.Kind)
+		assert.Equal(t, att.AuthenticatorData, report.AuthenticatorData)
+	})
+
+	t.Run("app attest aaguid", func(t *testing.T) {
+		aa := webauthntest.NewAuthenticator(t, webauthntest.FormatAppleAppAttest, webauthncose.AlgES256)
+
+		report, err := inspect.Inspect(ctx, aa.Attest(t, challenge, webauthntest.Options{}).AttestationObject)
+		require.NoError(t, err)
+
+		assert.Equal(t, "App Attest (development)", report.AttestationObject.AuthenticatorData.AAGUID.Name)
+		assert.Equal(t, hex.Hash(webauthntest.Receipt), report.AttestationObject.Statement["receipt"])
+	})
+
+	t.Run("unrecognized", func(t *testing.T) {
+		_, err := inspect.Inspect(ctx, []byte{0x01, 0x02})
+		require.ErrorIs(t, err, inspect.ErrUnrecognizedObject)
+
+		_, err = inspect.Inspect(ctx, []byte(`{"hello":"world"}`))
+		require.ErrorIs(t, err, inspect.ErrUnrecognizedObject)
+	})
+}
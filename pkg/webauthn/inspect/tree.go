@@ -0,0 +1,159 @@
+package inspect
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// node is a line of the tree view and the lines nested under it
+type node struct {
+	label    string
+	children []*node
+}
+
+func (me *node) add(label string, args ...interface{}) *node {
+	n := &node{label: fmt.Sprintf(label, args...)}
+	me.children = append(me.children, n)
+	return n
+}
+
+func (me *node) write(w io.Writer, prefix string) error {
+	for i, c := range me.children {
+		branch, indent := "├── ", "│   "
+		if i == len(me.children)-1 {
+			branch, indent = "└── ", "    "
+		}
+
+		lines := strings.Split(strings.TrimRight(c.label, "\n"), "\n")
+		if _, err := fmt.Fprintf(w, "%s%s%s\n", prefix, branch, lines[0]); err != nil {
+			return err
+		}
+		for _, l := range lines[1:] {
+			if _, err := fmt.Fprintf(w, "%s%s%s\n", prefix, indent, l); err != nil {
+				return err
+			}
+		}
+
+		if err := c.write(w, prefix+indent); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteTree writes the report as an indented tree
+func (me *Report) WriteTree(w io.Writer) error {
+	root := &node{}
+
+	top := root.add("%s", me.Kind)
+	if me.Source != "" {
+		top.add("source: %s", me.Source)
+	}
+	if me.CredentialID != nil {
+		top.add("credential id: %s", me.CredentialID.Hex())
+	}
+	if me.ClientData != nil {
+		me.ClientData.tree(top.add("client data"))
+	}
+	if me.AttestationObject != nil {
+		me.AttestationObject.tree(top.add("attestation object"))
+	}
+	if me.AssertionObject != nil {
+		me.AssertionObject.tree(top.add("assertion object"))
+	}
+	if me.AuthenticatorData != nil {
+		me.AuthenticatorData.tree(top.add("authenticator data"))
+	}
+
+	return root.write(w, "")
+}
+
+func (me *ClientData) tree(n *node) {
+	n.add("type: %s", me.Type)
+	n.add("challenge: %s", me.Challenge.Hex())
+	n.add("origin: %s", me.Origin)
+	n.add("cross origin: %t", me.CrossOrigin)
+	if me.TopOrigin != "" {
+		n.add("top origin: %s", me.TopOrigin)
+	}
+	n.add("hash: %s", me.Hash.Hex())
+	n.add("raw: %s", me.Raw)
+}
+
+func (me *AttestationObject) tree(n *node) {
+	n.add("fmt: %s", me.Format)
+	me.AuthenticatorData.tree(n.add("auth data"))
+
+	stmt := n.add("att stmt")
+	keys := make([]string, 0, len(me.Statement))
+	for k := range me.Statement {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		stmt.add("%s: %v", k, me.Statement[k])
+	}
+
+	if len(me.Certificates) > 0 {
+		x5c := stmt.add("x5c")
+		for i, c := range me.Certificates {
+			c.tree(x5c.add("[%d]", i))
+		}
+	}
+}
+
+func (me *AssertionObject) tree(n *node) {
+	me.AuthenticatorData.tree(n.add("auth data"))
+	n.add("signature: %s", me.Signature.Hex())
+}
+
+func (me *AuthenticatorData) tree(n *node) {
+	n.add("rpid hash: %s", me.RPIDHash.Hex())
+
+	flags := n.add("flags: 0x%02x", byte(me.Flags.Raw))
+	flags.add("user present (UP): %t", me.Flags.UserPresent)
+	flags.add("user verified (UV): %t", me.Flags.UserVerified)
+	flags.add("backup eligible (BE): %t", me.Flags.BackupEligible)
+	flags.add("backup state (BS): %t", me.Flags.BackupState)
+	flags.add("attested credential data (AT): %t", me.Flags.AttestedCredentialData)
+	flags.add("extension data (ED): %t", me.Flags.Extensions)
+
+	n.add("sign count: %d", me.Counter)
+
+	if me.AAGUID != nil {
+		if me.AAGUID.Name != "" {
+			n.add("aaguid: %s (%s)", me.AAGUID.ID, me.AAGUID.Name)
+		} else {
+			n.add("aaguid: %s", me.AAGUID.ID)
+		}
+	}
+	if me.CredentialID != nil {
+		n.add("credential id: %s", me.CredentialID.Hex())
+	}
+	if me.PublicKey != nil {
+		key := n.add("public key: %s", me.PublicKey.COSE.Hex())
+		key.add("%s", me.PublicKey.PEM)
+	}
+	if me.Extensions != nil {
+		n.add("extensions: %s", me.Extensions.Hex())
+	}
+}
+
+func (me Certificate) tree(n *node) {
+	if me.Error != "" {
+		n.add("error: %s", me.Error)
+		n.add("sha256 fingerprint: %s", me.Fingerprint.Hex())
+		return
+	}
+	n.add("subject: %s", me.Subject)
+	n.add("issuer: %s", me.Issuer)
+	n.add("serial number: %s", me.SerialNumber)
+	n.add("validity: %s - %s", me.NotBefore.Format(time.RFC3339), me.NotAfter.Format(time.RFC3339))
+	n.add("public key algorithm: %s", me.PublicKeyAlgorithm)
+	n.add("signature algorithm: %s", me.SignatureAlgorithm)
+	n.add("ca: %t", me.IsCA)
+	n.add("sha256 fingerprint: %s", me.Fingerprint.Hex())
+}
@@ -0,0 +1,315 @@
+package metadata
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidBLOB   = errors.New("ErrInvalidBLOB")
+	ErrUntrustedBLOB = errors.New("ErrUntrustedBLOB")
+	ErrInvalidRoot   = errors.New("ErrInvalidRoot")
+)
+
+// BLOB is a decoded metadata blob with the certificate chain it was signed with
+type BLOB struct {
+	Payload MetadataBLOBPayload
+	// Algorithm is the jws algorithm the blob is signed with
+	Algorithm string
+	// Chain is the x5c of the jws header, signing certificate first
+	Chain []*x509.Certificate
+}
+
+// ParseRoot reads a metadata trust anchor given as PEM, base64 DER (the form of MDSRoot) or DER
+func ParseRoot(data []byte) (*x509.Certificate, error) {
+	if block, _ := pem.Decode(data); block != nil {
+		data = block.Bytes
+	} else if der, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(data))); err == nil {
+		data = der
+	}
+
+	cert, err := x509.ParseCertificate(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRoot, err)
+	}
+
+	return cert, nil
+}
+
+// DecodeBLOB decodes a metadata blob without checking its signature or chain
+func DecodeBLOB(body []byte) (*BLOB, error) {
+	token, _, err := jwt.NewParser().ParseUnverified(string(bytes.TrimSpace(body)), jwt.MapClaims{})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBLOB, err)
+	}
+
+	return newBLOB(token)
+}
+
+// VerifyBLOB verifies a metadata blob offline: the x5c of the jws header must chain to root at the given
+// time and the jws must be signed by its first certificate. Revocation of the chain is not checked, it
+// needs the crls of the issuers.
+func VerifyBLOB(body []byte, root *x509.Certificate, at time.Time) (*BLOB, error) {
+	var (
+		blob     *BLOB
+		chainErr error
+	)
+
+	parser := jwt.NewParser(
+		jwt.WithValidMethods([]string{"ES256", "ES384", "ES512", "RS256", "RS384", "RS512", "PS256", "PS384", "PS512"}),
+		jwt.WithTimeFunc(func() time.Time { return at }),
+	)
+
+	_, err := parser.Parse(string(bytes.TrimSpace(body)), func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Header["x5u"]; ok {
+			return nil, fmt.Errorf("%w: x5u in the header is not supported", ErrInvalidBLOB)
+		}
+
+		b, err := newBLOB(token)
+		if err != nil {
+			return nil, err
+		}
+
+		// without an x5c the trust anchor is the signing certificate
+		if len(b.Chain) == 0 {
+			b.Chain = []*x509.Certificate{root}
+		}
+
+		roots := x509.NewCertPool()
+		roots.AddCert(root)
+
+		intermediates := x509.NewCertPool()
+		for _, c := range b.Chain[1:] {
+			intermediates.AddCert(c)
+		}
+
+		if _, err := b.Chain[0].Verify(x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: intermediates,
+			CurrentTime:   at,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		}); err != nil {
+			chainErr = fmt.Errorf("%w: %v", ErrUntrustedBLOB, err)
+			return nil, chainErr
+		}
+
+		blob = b
+
+		return b.Chain[0].PublicKey, nil
+	})
+	switch {
+	case chainErr != nil:
+		return nil, chainErr
+	case errors.Is(err, ErrInvalidBLOB):
+		return nil, err
+	case err != nil:
+		return nil, fmt.Errorf("%w: %v", ErrUntrustedBLOB, err)
+	}
+
+	return blob, nil
+}
+
+func newBLOB(token *jwt.Token) (*BLOB, error) {
+	me := &BLOB{Algorithm: token.Method.Alg()}
+
+	if x5c, ok := token.Header["x5c"].([]interface{}); ok {
+		for _, c := range x5c {
+			s, ok := c.(string)
+			if !ok {
+				return nil, fmt.Errorf("%w: x5c holds a non string", ErrInvalidBLOB)
+			}
+
+			der, err := base64.StdEncoding.DecodeString(s)
+			if err != nil {
+				return nil, fmt.Errorf("%w: x5c: %v", ErrInvalidBLOB, err)
+			}
+
+			cert, err := x509.ParseCertificate(der)
+			if err != nil {
+				return nil, fmt.Errorf("%w: x5c: %v", ErrInvalidBLOB, err)
+			}
+
+			me.Chain = append(me.Chain, cert)
+		}
+	}
+
+	claims, err := json.Marshal(token.Claims)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBLOB, err)
+	}
+
+	if err := json.Unmarshal(claims, &me.Payload); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBLOB, err)
+	}
+
+	return me, nil
+}
+
+// ID returns what names the authenticator of the entry: its aaguid, its aaid or its attestation certificate
+// key identifiers
+func (me MetadataBLOBPayloadEntry) ID() string {
+	switch {
+	case me.AaGUID != "":
+		return me.AaGUID
+	case me.Aaid != "":
+		return me.Aaid
+	}
+	return strings.Join(me.AttestationCertificateKeyIdentifiers, ",")
+}
+
+// Status returns the status of the most recent status report of the entry
+func (me MetadataBLOBPayloadEntry) Status() AuthenticatorStatus {
+	var latest *StatusReport
+	for i := range me.StatusReports {
+		// iso 8601 dates order as strings
+		if latest == nil || me.StatusReports[i].EffectiveDate >= latest.EffectiveDate {
+			latest = &me.StatusReports[i]
+		}
+	}
+
+	if latest == nil {
+		return ""
+	}
+
+	return latest.Status
+}
+
+// Query selects blob entries, empty fields match every entry
+type Query struct {
+	// AAGUID matches the aaguid, aaid or an attestation certificate key identifier of the entry
+	AAGUID string
+	// Name matches part of the description of the authenticator, in any language, ignoring case
+	Name string
+	// Status matches the current status of the entry
+	Status AuthenticatorStatus
+}
+
+// Search returns the entries of the payload matching the query
+func (me *MetadataBLOBPayload) Search(q Query) []MetadataBLOBPayloadEntry {
+	res := []MetadataBLOBPayloadEntry{}
+	for _, e := range me.Entries {
+		if q.AAGUID != "" && !e.matchesID(q.AAGUID) {
+			continue
+		}
+		if q.Name != "" && !e.matchesName(q.Name) {
+			continue
+		}
+		if q.Status != "" && !strings.EqualFold(string(e.Status()), string(q.Status)) {
+			continue
+		}
+		res = append(res, e)
+	}
+	return res
+}
+
+func (me MetadataBLOBPayloadEntry) matchesID(id string) bool {
+	if want, err := uuid.Parse(id); err == nil {
+		got, err := uuid.Parse(me.AaGUID)
+		return err == nil && got == want
+	}
+
+	if strings.EqualFold(me.Aaid, id) {
+		return true
+	}
+
+	for _, ski := range me.AttestationCertificateKeyIdentifiers {
+		if strings.EqualFold(ski, id) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (me MetadataBLOBPayloadEntry) matchesName(name string) bool {
+	name = strings.ToLower(name)
+
+	if strings.Contains(strings.ToLower(me.MetadataStatement.Description), name) {
+		return true
+	}
+
+	for _, desc := range me.MetadataStatement.AlternativeDescriptions {
+		if strings.Contains(strings.ToLower(desc), name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+type ChangeKind string
+
+const (
+	// ChangeAdded - the authenticator is only in the newer blob
+	ChangeAdded ChangeKind = "added"
+	// ChangeRemoved - the authenticator is only in the older blob
+	ChangeRemoved ChangeKind = "removed"
+	// ChangeRevoked - the authenticator's status changed to REVOKED
+	ChangeRevoked ChangeKind = "revoked"
+	// ChangeStatus - the authenticator's status changed to anything but REVOKED
+	ChangeStatus ChangeKind = "status"
+)
+
+var changeOrder = map[ChangeKind]int{ChangeRevoked: 0, ChangeStatus: 1, ChangeAdded: 2, ChangeRemoved: 3}
+
+// Change is a difference of one authenticator between two blobs
+type Change struct {
+	Kind        ChangeKind          `json:"kind"`
+	ID          string              `json:"id"`
+	Description string              `json:"description"`
+	From        AuthenticatorStatus `json:"from,omitempty"`
+	To          AuthenticatorStatus `json:"to,omitempty"`
+}
+
+// Diff returns the authenticators added to, removed from or whose status changed in the newer payload,
+// revocations first
+func Diff(older, newer *MetadataBLOBPayload) []Change {
+	before := make(map[string]MetadataBLOBPayloadEntry, len(older.Entries))
+	for _, e := range older.Entries {
+		before[e.ID()] = e
+	}
+
+	changes := []Change{}
+
+	for _, e := range newer.Entries {
+		id := e.ID()
+
+		prev, ok := before[id]
+		delete(before, id)
+
+		switch {
+		case !ok:
+			changes = append(changes, Change{Kind: ChangeAdded, ID: id, Description: e.MetadataStatement.Description, To: e.Status()})
+		case prev.Status() != e.Status():
+			kind := ChangeStatus
+			if e.Status() == Revoked {
+				kind = ChangeRevoked
+			}
+			changes = append(changes, Change{Kind: kind, ID: id, Description: e.MetadataStatement.Description, From: prev.Status(), To: e.Status()})
+		}
+	}
+
+	for id, e := range before {
+		changes = append(changes, Change{Kind: ChangeRemoved, ID: id, Description: e.MetadataStatement.Description, From: e.Status()})
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Kind != changes[j].Kind {
+			return changeOrder[changes[i].Kind] < changeOrder[changes[j].Kind]
+		}
+		return changes[i].ID < changes[j].ID
+	})
+
+	return changes
+}
@@ -0,0 +1,256 @@
+package metadata
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var blobTime = time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+
+type testSigner struct {
+	root    *x509.Certificate
+	leaf    *x509.Certificate
+	leafKey *ecdsa.PrivateKey
+}
+
+func newTestSigner(t *testing.T) *testSigner {
+	t.Helper()
+
+	rootKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	rootTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test mds root"},
+		NotBefore:             blobTime.AddDate(-1, 0, 0),
+		NotAfter:              blobTime.AddDate(10, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	rootDER, err := x509.CreateCertificate(rand.Reader, rootTmpl, rootTmpl, &rootKey.PublicKey, rootKey)
+	require.NoError(t, err)
+	root, err := x509.ParseCertificate(rootDER)
+	require.NoError(t, err)
+
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	leafTmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "test mds signer"},
+		NotBefore:    blobTime.AddDate(0, -1, 0),
+		NotAfter:     blobTime.AddDate(1, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	leafDER, err := x509.CreateCertificate(rand.Reader, leafTmpl, root, &leafKey.PublicKey, rootKey)
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(leafDER)
+	require.NoError(t, err)
+
+	return &testSigner{root: root, leaf: leaf, leafKey: leafKey}
+}
+
+func (me *testSigner) sign(t *testing.T, payload MetadataBLOBPayload) []byte {
+	t.Helper()
+
+	raw, err := json.Marshal(payload)
+	require.NoError(t, err)
+
+	claims := jwt.MapClaims{}
+	require.NoError(t, json.Unmarshal(raw, &claims))
+
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	token.Header["x5c"] = []string{base64.StdEncoding.EncodeToString(me.leaf.Raw)}
+
+	signed, err := token.SignedString(me.leafKey)
+	require.NoError(t, err)
+
+	return []byte(signed)
+}
+
+func entry(aaguid, description string, statuses ...AuthenticatorStatus) MetadataBLOBPayloadEntry {
+	e := MetadataBLOBPayloadEntry{AaGUID: aaguid, MetadataStatement: MetadataStatement{AaGUID: aaguid, Description: description}}
+	for i, s := range statuses {
+		e.StatusReports = append(e.StatusReports, StatusReport{Status: s, EffectiveDate: blobTime.AddDate(0, 0, i).Format("2006-01-02")})
+	}
+	return e
+}
+
+var testPayload = MetadataBLOBPayload{
+	Number:     41,
+	NextUpdate: "2023-07-01",
+	Entries: []MetadataBLOBPayloadEntry{
+		entry("ee882879-721c-4913-9775-3dfcce97072a", "YubiKey 5 Series", FidoCertified, FidoCertifiedL1),
+		entry("08987058-cadc-4b81-b6e1-30de50dcbe96", "Windows Hello Hardware Authenticator", FidoCertified),
+		entry("d41f5a69-b817-4144-a13c-9ebd6d9254d6", "Example Compromised Key", FidoCertified),
+		{Aaid: "4e4e#4005", AttestationCertificateKeyIdentifiers: []string{"7c0903708b87115b0b422def3138c3c864e44573"}, MetadataStatement: MetadataStatement{Description: "Example UAF Authenticator"}},
+	},
+}
+
+func TestVerifyBLOB(t *testing.T) {
+	signer := newTestSigner(t)
+	other := newTestSigner(t)
+
+	body := signer.sign(t, testPayload)
+
+	blob, err := VerifyBLOB(body, signer.root, blobTime)
+	require.NoError(t, err)
+
+	assert.Equal(t, "ES256", blob.Algorithm)
+	assert.Equal(t, 41, blob.Payload.Number)
+	assert.Equal(t, "2023-07-01", blob.Payload.NextUpdate)
+	assert.Len(t, blob.Payload.Entries, 4)
+	require.Len(t, blob.Chain, 1)
+	assert.Equal(t, "test mds signer", blob.Chain[0].Subject.CommonName)
+
+	_, err = VerifyBLOB(body, other.root, blobTime)
+	assert.ErrorIs(t, err, ErrUntrustedBLOB, "other root")
+
+	_, err = VerifyBLOB(body, signer.root, blobTime.AddDate(2, 0, 0))
+	assert.ErrorIs(t, err, ErrUntrustedBLOB, "expired signer")
+
+	forged := other.sign(t, testPayload)
+	token, _, err := jwt.NewParser().ParseUnverified(string(forged), jwt.MapClaims{})
+	require.NoError(t, err)
+	token.Header["x5c"] = []string{base64.StdEncoding.EncodeToString(signer.leaf.Raw)}
+	forgedWithSignerChain, err := token.SignedString(other.leafKey)
+	require.NoError(t, err)
+
+	_, err = VerifyBLOB([]byte(forgedWithSignerChain), signer.root, blobTime)
+	assert.ErrorIs(t, err, ErrUntrustedBLOB, "signed by another key")
+
+	_, err = VerifyBLOB([]byte("not a jwt"), signer.root, blobTime)
+	assert.ErrorIs(t, err, ErrUntrustedBLOB)
+
+	_, err = DecodeBLOB([]byte("not a jwt"))
+	assert.ErrorIs(t, err, ErrInvalidBLOB)
+
+	decoded, err := DecodeBLOB(body)
+	require.NoError(t, err)
+	assert.Equal(t, blob.Payload, decoded.Payload)
+}
+
+func TestVerifyExampleBLOB(t *testing.T) {
+	root, err := ParseRoot([]byte(ExampleMDSRoot))
+	require.NoError(t, err)
+
+	blob, err := VerifyBLOB([]byte(exampleMetadataBLOB), root, blobTime)
+	require.NoError(t, err)
+
+	assert.NotEmpty(t, blob.Payload.Entries)
+	assert.Len(t, blob.Chain, 2)
+}
+
+func TestParseRoot(t *testing.T) {
+	signer := newTestSigner(t)
+
+	for name, data := range map[string][]byte{
+		"der":    signer.root.Raw,
+		"base64": []byte(base64.StdEncoding.EncodeToString(signer.root.Raw)),
+		"pem":    pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: signer.root.Raw}),
+	} {
+		root, err := ParseRoot(data)
+		require.NoError(t, err, name)
+		assert.True(t, root.Equal(signer.root), name)
+	}
+
+	_, err := ParseRoot([]byte("nope"))
+	assert.ErrorIs(t, err, ErrInvalidRoot)
+}
+
+func TestSearch(t *testing.T) {
+	ids := func(entries []MetadataBLOBPayloadEntry) []string {
+		res := []string{}
+		for _, e := range entries {
+			res = append(res, e.ID())
+		}
+		return res
+	}
+
+	tests := []struct {
+		name  string
+		query Query
+		want  []string
+	}{
+		{
+			name:  "aaguid",
+			query: Query{AAGUID: "EE882879-721C-4913-9775-3DFCCE97072A"},
+			want:  []string{"ee882879-721c-4913-9775-3dfcce97072a"},
+		},
+		{
+			name:  "aaid",
+			query: Query{AAGUID: "4e4e#4005"},
+			want:  []string{"4e4e#4005"},
+		},
+		{
+			name:  "attestation certificate key identifier",
+			query: Query{AAGUID: "7C0903708B87115B0B422DEF3138C3C864E44573"},
+			want:  []string{"4e4e#4005"},
+		},
+		{
+			name:  "name",
+			query: Query{Name: "yubikey"},
+			want:  []string{"ee882879-721c-4913-9775-3dfcce97072a"},
+		},
+		{
+			name:  "current status",
+			query: Query{Status: FidoCertified},
+			want:  []string{"08987058-cadc-4b81-b6e1-30de50dcbe96", "d41f5a69-b817-4144-a13c-9ebd6d9254d6"},
+		},
+		{
+			name:  "name and status",
+			query: Query{Name: "example", Status: "fido_certified"},
+			want:  []string{"d41f5a69-b817-4144-a13c-9ebd6d9254d6"},
+		},
+		{
+			name:  "everything",
+			query: Query{},
+			want:  []string{"ee882879-721c-4913-9775-3dfcce97072a", "08987058-cadc-4b81-b6e1-30de50dcbe96", "d41f5a69-b817-4144-a13c-9ebd6d9254d6", "4e4e#4005"},
+		},
+		{
+			name:  "nothing",
+			query: Query{AAGUID: "00000000-0000-0000-0000-000000000000"},
+			want:  []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, ids(testPayload.Search(tt.query)))
+		})
+	}
+}
+
+func TestDiff(t *testing.T) {
+	newer := MetadataBLOBPayload{
+		Number: 42,
+		Entries: []MetadataBLOBPayloadEntry{
+			entry("ee882879-721c-4913-9775-3dfcce97072a", "YubiKey 5 Series", FidoCertified, FidoCertifiedL1, FidoCertifiedL2),
+			entry("d41f5a69-b817-4144-a13c-9ebd6d9254d6", "Example Compromised Key", FidoCertified, Revoked),
+			entry("b93fd961-f2e6-462f-b122-82002247de78", "Android Authenticator", FidoCertifiedL1),
+			testPayload.Entries[3],
+		},
+	}
+
+	assert.Equal(t, []Change{
+		{Kind: ChangeRevoked, ID: "d41f5a69-b817-4144-a13c-9ebd6d9254d6", Description: "Example Compromised Key", From: FidoCertified, To: Revoked},
+		{Kind: ChangeStatus, ID: "ee882879-721c-4913-9775-3dfcce97072a", Description: "YubiKey 5 Series", From: FidoCertifiedL1, To: FidoCertifiedL2},
+		{Kind: ChangeAdded, ID: "b93fd961-f2e6-462f-b122-82002247de78", Description: "Android Authenticator", To: FidoCertifiedL1},
+		{Kind: ChangeRemoved, ID: "08987058-cadc-4b81-b6e1-30de50dcbe96", Description: "Windows Hello Hardware Authenticator", From: FidoCertified},
+	}, Diff(&testPayload, &newer))
+
+	assert.Empty(t, Diff(&testPayload, &testPayload))
+}
@@ -0,0 +1,226 @@
+// Package origin decides which origins a relying party accepts client data from. A Matcher holds exact
+// web origins, wildcard patterns for the subdomains of the rp id and for dev ports, the
+// "android:apk-key-hash:" origins of native Android apps, and the top origins allowed to embed ceremonies
+// in cross origin iframes (https://www.w3.org/TR/webauthn-3/#sctn-validating-origin).
+package origin
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/walteh/webauthn/pkg/webauthn/types"
+)
+
+// APKKeyHashPrefix starts the origin of an Android app, followed by the unpadded base64url sha256 of the
+// certificate its apk is signed with
+const APKKeyHashPrefix = "android:apk-key-hash:"
+
+var (
+	ErrInvalidPattern     = errors.New("ErrInvalidPattern")
+	ErrInvalidFingerprint = errors.New("ErrInvalidFingerprint")
+	ErrWildcardOutsideRP  = errors.New("ErrWildcardOutsideRP")
+)
+
+type pattern struct {
+	scheme string
+	// host is the host of the origin, or for "*." patterns the domain every matching host is a subdomain of
+	host     string
+	port     string
+	wildcard bool
+}
+
+// Matcher is a types.OriginMatcher
+type Matcher struct {
+	exact    map[string]bool
+	android  map[string]bool
+	patterns []pattern
+	top      *Matcher
+}
+
+var _ types.OriginMatcher = (*Matcher)(nil)
+
+// Exact returns a matcher accepting exactly the given origins, compared case insensitively with the
+// scheme and host of the client data origin
+func Exact(origins ...string) *Matcher {
+	me := &Matcher{exact: map[string]bool{}, android: map[string]bool{}}
+	for _, o := range origins {
+		if strings.HasPrefix(o, APKKeyHashPrefix) {
+			me.android[o] = true
+		} else {
+			me.exact[strings.ToLower(o)] = true
+		}
+	}
+	return me
+}
+
+// NewMatcher returns a matcher accepting the origins matched by any of the patterns:
+//   - "https://login.example.com" matches that origin only
+//   - "https://*.example.com" matches every subdomain of example.com, but not example.com itself
+//   - "http://localhost:*" matches the host on any port
+//   - "android:apk-key-hash:<hash>" matches the Android app signed with that certificate, see APKKeyHashOrigin
+//
+// Wildcard hosts have to be the rp id or one of its subdomains, unless rpID is "".
+func NewMatcher(rpID string, patterns ...string) (*Matcher, error) {
+	me := Exact()
+
+	for _, p := range patterns {
+		if strings.HasPrefix(p, APKKeyHashPrefix) {
+			hash, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(p, APKKeyHashPrefix))
+			if err != nil || len(hash) != 32 {
+				return nil, fmt.Errorf("%w: %q is not the base64url sha256 of a certificate", ErrInvalidPattern, p)
+			}
+			me.android[p] = true
+			continue
+		}
+
+		pat, err := parsePattern(p)
+		if err != nil {
+			return nil, err
+		}
+
+		if pat.wildcard && rpID != "" && pat.host != strings.ToLower(rpID) && !strings.HasSuffix(pat.host, "."+strings.ToLower(rpID)) {
+			return nil, fmt.Errorf("%w: %q is not under %q", ErrWildcardOutsideRP, p, rpID)
+		}
+
+		if !pat.wildcard && pat.port != "*" {
+			me.exact[pat.String()] = true
+			continue
+		}
+
+		me.patterns = append(me.patterns, pat)
+	}
+
+	return me, nil
+}
+
+// WithTopOrigins allows ceremonies embedded in cross origin iframes whose top level origin top matches.
+// Without it, client data that is cross origin or names a topOrigin is rejected.
+func (me *Matcher) WithTopOrigins(top *Matcher) *Matcher {
+	me.top = top
+	return me
+}
+
+// MatchOrigin reports whether client data from origin is accepted, a nil Matcher accepts none
+func (me *Matcher) MatchOrigin(origin string) bool {
+	if me == nil {
+		return false
+	}
+
+	if strings.HasPrefix(origin, APKKeyHashPrefix) {
+		return me.android[origin]
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+
+	if me.exact[strings.ToLower(types.FullyQualifiedOrigin(u))] {
+		return true
+	}
+
+	scheme, host, port := strings.ToLower(u.Scheme), strings.ToLower(u.Hostname()), u.Port()
+	if host == "" {
+		return false
+	}
+
+	for _, pat := range me.patterns {
+		if pat.scheme != scheme || (pat.port != "*" && pat.port != port) {
+			continue
+		}
+		if (pat.wildcard && strings.HasSuffix(host, "."+pat.host)) || (!pat.wildcard && host == pat.host) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// MatchTopOrigin reports whether ceremonies may run in a cross origin iframe of a page from topOrigin
+func (me *Matcher) MatchTopOrigin(topOrigin string) bool {
+	return me != nil && me.top != nil && topOrigin != "" && me.top.MatchOrigin(topOrigin)
+}
+
+// String lists the origins and patterns the matcher accepts, for logging what a rejected origin was
+// expected to be
+func (me *Matcher) String() string {
+	if me == nil {
+		return ""
+	}
+
+	accepted := make([]string, 0, len(me.exact)+len(me.android)+len(me.patterns))
+	for o := range me.exact {
+		accepted = append(accepted, o)
+	}
+	for o := range me.android {
+		accepted = append(accepted, o)
+	}
+	for _, pat := range me.patterns {
+		accepted = append(accepted, pat.String())
+	}
+	sort.Strings(accepted)
+
+	return strings.Join(accepted, ",")
+}
+
+// APKKeyHashOrigin returns the origin of the Android apps signed with the certificate of the sha256
+// fingerprint, given as hex with or without colons as in assetlinks.json and keytool output
+func APKKeyHashOrigin(fingerprint string) (string, error) {
+	raw, err := ParseFingerprint(fingerprint)
+	if err != nil {
+		return "", err
+	}
+	return APKKeyHashPrefix + base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// ParseFingerprint decodes a sha256 certificate fingerprint like "14:6D:E9:...", or the same without colons
+func ParseFingerprint(fingerprint string) ([]byte, error) {
+	raw, err := hex.DecodeString(strings.ReplaceAll(fingerprint, ":", ""))
+	if err != nil || len(raw) != 32 {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidFingerprint, fingerprint)
+	}
+	return raw, nil
+}
+
+func parsePattern(p string) (pattern, error) {
+	scheme, rest, ok := strings.Cut(p, "://")
+	rest = strings.TrimSuffix(rest, "/")
+	if !ok || scheme == "" || rest == "" || strings.ContainsAny(rest, "/?#@") {
+		return pattern{}, fmt.Errorf("%w: %q is not an origin", ErrInvalidPattern, p)
+	}
+
+	pat := pattern{scheme: strings.ToLower(scheme), host: strings.ToLower(rest)}
+
+	if i := strings.LastIndexByte(rest, ':'); i >= 0 && !strings.Contains(rest[i:], "]") {
+		pat.host, pat.port = strings.ToLower(rest[:i]), rest[i+1:]
+		if pat.port == "" {
+			return pattern{}, fmt.Errorf("%w: %q has an empty port", ErrInvalidPattern, p)
+		}
+	}
+
+	if strings.HasPrefix(pat.host, "*.") {
+		pat.host, pat.wildcard = strings.TrimPrefix(pat.host, "*."), true
+	}
+
+	if pat.host == "" || strings.Contains(pat.host, "*") {
+		return pattern{}, fmt.Errorf("%w: %q only allows a wildcard as its first label", ErrInvalidPattern, p)
+	}
+
+	return pat, nil
+}
+
+func (me pattern) String() string {
+	host := me.host
+	if me.wildcard {
+		host = "*." + host
+	}
+	if me.port == "" {
+		return me.scheme + "://" + host
+	}
+	return me.scheme + "://" + host + ":" + me.port
+}
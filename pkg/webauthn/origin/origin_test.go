@@ -0,0 +1,127 @@
+package origin_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/webauthn/pkg/webauthn/origin"
+)
+
+// fingerprint is the sha256 fingerprint of a signing certificate as keytool prints it
+const fingerprint = "14:6D:E9:83:C5:73:06:50:D8:EE:B9:95:2F:34:FC:64:16:A0:83:42:E6:1D:BE:A8:8A:04:96:B2:3F:CF:44:E5"
+
+func TestMatcher(t *testing.T) {
+	apk, err := origin.APKKeyHashOrigin(fingerprint)
+	require.NoError(t, err)
+	assert.Equal(t, "android:apk-key-hash:FG3pg8VzBlDY7rmVLzT8ZBagg0LmHb6oigSWsj_PROU", apk)
+
+	matcher, err := origin.NewMatcher("example.com",
+		"https://example.com",
+		"https://*.app.example.com",
+		"http://localhost:*",
+		"https://admin.example.com:8443",
+		apk,
+	)
+	require.NoError(t, err)
+
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		{origin: "https://example.com", want: true},
+		{origin: "HTTPS://Example.COM", want: true},
+		{origin: "http://example.com", want: false},
+		{origin: "https://example.com:8443", want: false},
+		{origin: "https://evil.com", want: false},
+		{origin: "https://example.com.evil.com", want: false},
+		{origin: "https://eu.app.example.com", want: true},
+		{origin: "https://a.b.app.example.com", want: true},
+		{origin: "https://app.example.com", want: false},
+		{origin: "https://evilapp.example.com", want: false},
+		{origin: "http://eu.app.example.com", want: false},
+		{origin: "http://localhost:3000", want: true},
+		{origin: "http://localhost", want: true},
+		{origin: "https://localhost:3000", want: false},
+		{origin: "https://admin.example.com:8443", want: true},
+		{origin: "https://admin.example.com", want: false},
+		{origin: apk, want: true},
+		{origin: "android:apk-key-hash:AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA", want: false},
+		{origin: "", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.origin, func(t *testing.T) {
+			assert.Equal(t, tt.want, matcher.MatchOrigin(tt.origin))
+		})
+	}
+}
+
+func TestNewMatcherInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		want    error
+	}{
+		{name: "no scheme", pattern: "example.com", want: origin.ErrInvalidPattern},
+		{name: "path", pattern: "https://example.com/login", want: origin.ErrInvalidPattern},
+		{name: "inner wildcard", pattern: "https://login.*.example.com", want: origin.ErrInvalidPattern},
+		{name: "bare wildcard", pattern: "https://*", want: origin.ErrInvalidPattern},
+		{name: "empty port", pattern: "https://example.com:", want: origin.ErrInvalidPattern},
+		{name: "apk hash", pattern: "android:apk-key-hash:not-a-hash", want: origin.ErrInvalidPattern},
+		{name: "wildcard outside rp id", pattern: "https://*.evil.com", want: origin.ErrWildcardOutsideRP},
+		{name: "wildcard above rp id", pattern: "https://*.com", want: origin.ErrWildcardOutsideRP},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := origin.NewMatcher("example.com", tt.pattern)
+			assert.ErrorIs(t, err, tt.want)
+		})
+	}
+
+	_, err := origin.NewMatcher("", "https://*.evil.com")
+	assert.NoError(t, err, "wildcards are not scoped without an rp id")
+
+	_, err = origin.APKKeyHashOrigin("14:6D:E9")
+	assert.ErrorIs(t, err, origin.ErrInvalidFingerprint)
+}
+
+func TestMatchTopOrigin(t *testing.T) {
+	matcher, err := origin.NewMatcher("example.com", "https://example.com")
+	require.NoError(t, err)
+
+	assert.False(t, matcher.MatchTopOrigin("https://partner.com"), "no top origin is allowed by default")
+
+	top, err := origin.NewMatcher("", "https://partner.com", "https://*.shop.com")
+	require.NoError(t, err)
+	matcher = matcher.WithTopOrigins(top)
+
+	assert.True(t, matcher.MatchTopOrigin("https://partner.com"))
+	assert.True(t, matcher.MatchTopOrigin("https://eu.shop.com"))
+	assert.False(t, matcher.MatchTopOrigin("https://evil.com"))
+	assert.False(t, matcher.MatchTopOrigin(""))
+
+	// top origins are not origins
+	assert.False(t, matcher.MatchOrigin("https://partner.com"))
+}
+
+func TestExact(t *testing.T) {
+	matcher := origin.Exact("https://Example.com")
+
+	assert.True(t, matcher.MatchOrigin("https://example.com"))
+	assert.False(t, matcher.MatchOrigin("https://login.example.com"))
+	assert.False(t, matcher.MatchTopOrigin("https://example.com"))
+}
+
+func TestMatcherString(t *testing.T) {
+	matcher, err := origin.NewMatcher("example.com", "https://Example.com", "https://*.example.com", "http://localhost:*")
+	require.NoError(t, err)
+
+	assert.Equal(t, "http://localhost:*,https://*.example.com,https://example.com", matcher.String())
+
+	var none *origin.Matcher
+	assert.Equal(t, "", none.String())
+	assert.False(t, none.MatchOrigin("https://example.com"))
+	assert.False(t, none.MatchTopOrigin("https://example.com"))
+}
@@ -10,14 +10,53 @@ import (
 	"github.com/go-webauthn/webauthn/protocol/webauthncose"
 
 	"github.com/pkg/errors"
+	"github.com/walteh/webauthn/pkg/androidkey"
 	"github.com/walteh/webauthn/pkg/hex"
 	"github.com/walteh/webauthn/pkg/webauthn/types"
 )
 
-type AndroidKey struct{}
+type AndroidKey struct {
+	WebAuthnAssertion
 
+	time       *time.Time
+	roots      *x509.CertPool
+	policy     *androidkey.Policy
+	statusList *androidkey.StatusList
+}
+
+// NewAndroidKey returns the provider requiring x5c chains to end in one of androidkey.GoogleRoots, like
+// androidkey.NewVerifier. Without the bundled roots no chain is accepted.
 func NewAndroidKey() *AndroidKey {
-	return &AndroidKey{}
+	roots, err := androidkey.GoogleRoots()
+	if err != nil {
+		roots = x509.NewCertPool()
+	}
+
+	return &AndroidKey{roots: roots}
+}
+
+// WithRoots replaces the roots the x5c chain has to end in
+func (me *AndroidKey) WithRoots(roots *x509.CertPool) *AndroidKey {
+	me.roots = roots
+	return me
+}
+
+// WithPolicy enforces the security level, root of trust and patch level of the policy,
+// and its package names when it has any
+func (me *AndroidKey) WithPolicy(policy androidkey.Policy) *AndroidKey {
+	me.policy = &policy
+	return me
+}
+
+// WithStatusList rejects chains holding a revoked or suspended certificate
+func (me *AndroidKey) WithStatusList(list *androidkey.StatusList) *AndroidKey {
+	me.statusList = list
+	return me
+}
+
+func (me *AndroidKey) WithTime(t time.Time) *AndroidKey {
+	me.time = &t
+	return me
 }
 
 func (me *AndroidKey) ID() string {
@@ -30,7 +69,10 @@ var (
 )
 
 func (me *AndroidKey) Time() time.Time {
-	return time.Now()
+	if me.time == nil {
+		return time.Now()
+	}
+	return *me.time
 }
 
 var _ types.AttestationProvider = (*AndroidKey)(nil)
@@ -108,7 +150,7 @@ func (me *AndroidKey) Attest(att types.AttestationObject, clientDataHash []byte)
 	// attCert.Extensions
 	var attExtBytes []byte
 	for _, ext := range attCert.Extensions {
-		if ext.Id.Equal([]int{1, 3, 6, 1, 4, 1, 11129, 2, 1, 17}) {
+		if ext.Id.Equal(androidkey.KeyDescriptionOID) {
 			attExtBytes = ext.Value
 		}
 	}
@@ -117,7 +159,7 @@ func (me *AndroidKey) Attest(att types.AttestationObject, clientDataHash []byte)
 	}
 	// As noted in §8.4.1 (https://w3c.github.io/webauthn/#key-attstn-cert-requirements) the Android Key Attestation attestation certificate's
 	// android key attestation certificate extension data is identified by the OID "1.3.6.1.4.1.11129.2.1.17".
-	decoded := keyDescription{}
+	decoded := androidkey.KeyDescription{}
 	_, err = asn1.Unmarshal([]byte(attExtBytes), &decoded)
 	if err != nil {
 		return nil, "", nil, errors.Wrap(ErrAndroidKey, "Unable to parse Android key attestation certificate extensions")
@@ -127,21 +169,84 @@ func (me *AndroidKey) Attest(att types.AttestationObject, clientDataHash []byte)
 		return nil, "", nil, errors.Wrap(ErrAndroidKey, "Attestation challenge not equal to clientDataHash")
 	}
 	// The AuthorizationList.allApplications field is not present on either authorization list (softwareEnforced nor teeEnforced), since PublicKeyCredential MUST be scoped to the RP ID.
-	if nil != decoded.SoftwareEnforced.AllApplications || nil != decoded.TeeEnforced.AllApplications {
+	if len(decoded.SoftwareEnforced.AllApplications.FullBytes) > 0 || len(decoded.TeeEnforced.AllApplications.FullBytes) > 0 {
 		return nil, "", nil, errors.Wrap(ErrAndroidKey, "Attestation certificate extensions contains all applications field")
 	}
 	// For the following, use only the teeEnforced authorization list if the RP wants to accept only keys from a trusted execution environment, otherwise use the union of teeEnforced and softwareEnforced.
 	// The value in the AuthorizationList.origin field is equal to KM_ORIGIN_GENERATED.  (which == 0)
-	if KM_ORIGIN_GENERATED != decoded.SoftwareEnforced.Origin || KM_ORIGIN_GENERATED != decoded.TeeEnforced.Origin {
+	softwareOrigin, inSoftware := decoded.SoftwareEnforced.OriginValue()
+	teeOrigin, inTee := decoded.TeeEnforced.OriginValue()
+	if (!inSoftware && !inTee) || (inSoftware && softwareOrigin != KM_ORIGIN_GENERATED) || (inTee && teeOrigin != KM_ORIGIN_GENERATED) {
 		return nil, "", nil, errors.Wrap(ErrAndroidKey, "Attestation certificate extensions contains authorization list with origin not equal KM_ORIGIN_GENERATED")
 	}
 	// The value in the AuthorizationList.purpose field is equal to KM_PURPOSE_SIGN.  (which == 2)
 	if !contains(decoded.SoftwareEnforced.Purpose, KM_PURPOSE_SIGN) && !contains(decoded.TeeEnforced.Purpose, KM_PURPOSE_SIGN) {
 		return nil, "", nil, errors.Wrap(ErrAndroidKey, "Attestation certificate extensions contains authorization list with purpose not equal KM_PURPOSE_SIGN")
 	}
+
+	if err := me.verifyChain(x5c); err != nil {
+		return nil, "", nil, errors.Wrap(ErrAndroidKey, err.Error())
+	}
+
+	if me.policy != nil {
+		if err := me.policy.Check(&decoded); err != nil {
+			return nil, "", nil, errors.Wrap(ErrAndroidKey, err.Error())
+		}
+
+		if len(me.policy.PackageNames) > 0 {
+			appID, err := decoded.ApplicationID()
+			if err != nil {
+				return nil, "", nil, errors.Wrap(ErrAndroidKey, err.Error())
+			}
+
+			if _, err := me.policy.CheckApplicationID(appID); err != nil {
+				return nil, "", nil, errors.Wrap(ErrAndroidKey, err.Error())
+			}
+		}
+	}
+
 	return att.AuthData.AttData.CredentialPublicKey, "", x5c, err
 }
 
+// verifyChain checks the x5c chain against the roots and, when it is set, the status list
+func (me *AndroidKey) verifyChain(x5c []interface{}) error {
+	if me.roots == nil && me.statusList == nil {
+		return nil
+	}
+
+	chain := make([][]byte, 0, len(x5c))
+	for _, c := range x5c {
+		der, ok := c.([]byte)
+		if !ok {
+			return fmt.Errorf("%w: x5c entry is not a certificate", androidkey.ErrInvalidChain)
+		}
+		chain = append(chain, der)
+	}
+
+	var certs []*x509.Certificate
+	if me.roots != nil {
+		verified, err := androidkey.VerifyChain(chain, me.roots, me.Time())
+		if err != nil {
+			return err
+		}
+		certs = verified
+	} else {
+		for _, der := range chain {
+			cert, err := x509.ParseCertificate(der)
+			if err != nil {
+				return fmt.Errorf("%w: %v", androidkey.ErrInvalidChain, err)
+			}
+			certs = append(certs, cert)
+		}
+	}
+
+	if me.statusList != nil {
+		return me.statusList.Check(certs)
+	}
+
+	return nil
+}
+
 func contains(s []int, e int) bool {
 	for _, a := range s {
 		if a == e {
@@ -151,63 +256,6 @@ func contains(s []int, e int) bool {
 	return false
 }
 
-type keyDescription struct {
-	AttestationVersion       int
-	AttestationSecurityLevel asn1.Enumerated
-	KeymasterVersion         int
-	KeymasterSecurityLevel   asn1.Enumerated
-	AttestationChallenge     []byte
-	UniqueID                 []byte
-	SoftwareEnforced         authorizationList
-	TeeEnforced              authorizationList
-}
-
-type authorizationList struct {
-	Purpose                     []int       `asn1:"tag:1,explicit,set,optional"`
-	Algorithm                   int         `asn1:"tag:2,explicit,optional"`
-	KeySize                     int         `asn1:"tag:3,explicit,optional"`
-	Digest                      []int       `asn1:"tag:5,explicit,set,optional"`
-	Padding                     []int       `asn1:"tag:6,explicit,set,optional"`
-	EcCurve                     int         `asn1:"tag:10,explicit,optional"`
-	RsaPublicExponent           int         `asn1:"tag:200,explicit,optional"`
-	RollbackResistance          interface{} `asn1:"tag:303,explicit,optional"`
-	ActiveDateTime              int         `asn1:"tag:400,explicit,optional"`
-	OriginationExpireDateTime   int         `asn1:"tag:401,explicit,optional"`
-	UsageExpireDateTime         int         `asn1:"tag:402,explicit,optional"`
-	NoAuthRequired              interface{} `asn1:"tag:503,explicit,optional"`
-	UserAuthType                int         `asn1:"tag:504,explicit,optional"`
-	AuthTimeout                 int         `asn1:"tag:505,explicit,optional"`
-	AllowWhileOnBody            interface{} `asn1:"tag:506,explicit,optional"`
-	TrustedUserPresenceRequired interface{} `asn1:"tag:507,explicit,optional"`
-	TrustedConfirmationRequired interface{} `asn1:"tag:508,explicit,optional"`
-	UnlockedDeviceRequired      interface{} `asn1:"tag:509,explicit,optional"`
-	AllApplications             interface{} `asn1:"tag:600,explicit,optional"`
-	ApplicationID               interface{} `asn1:"tag:601,explicit,optional"`
-	CreationDateTime            int         `asn1:"tag:701,explicit,optional"`
-	Origin                      int         `asn1:"tag:702,explicit,optional"`
-	RootOfTrust                 rootOfTrust `asn1:"tag:704,explicit,optional"`
-	OsVersion                   int         `asn1:"tag:705,explicit,optional"`
-	OsPatchLevel                int         `asn1:"tag:706,explicit,optional"`
-	AttestationApplicationID    []byte      `asn1:"tag:709,explicit,optional"`
-	AttestationIDBrand          []byte      `asn1:"tag:710,explicit,optional"`
-	AttestationIDDevice         []byte      `asn1:"tag:711,explicit,optional"`
-	AttestationIDProduct        []byte      `asn1:"tag:712,explicit,optional"`
-	AttestationIDSerial         []byte      `asn1:"tag:713,explicit,optional"`
-	AttestationIDImei           []byte      `asn1:"tag:714,explicit,optional"`
-	AttestationIDMeid           []byte      `asn1:"tag:715,explicit,optional"`
-	AttestationIDManufacturer   []byte      `asn1:"tag:716,explicit,optional"`
-	AttestationIDModel          []byte      `asn1:"tag:717,explicit,optional"`
-	VendorPatchLevel            int         `asn1:"tag:718,explicit,optional"`
-	BootPatchLevel              int         `asn1:"tag:719,explicit,optional"`
-}
-
-type rootOfTrust struct {
-	verifiedBootKey   []byte
-	deviceLocked      bool
-	verifiedBootState verifiedBootState
-	verifiedBootHash  []byte
-}
-
 type verifiedBootState int
 
 const (
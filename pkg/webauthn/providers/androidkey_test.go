@@ -0,0 +1,23 @@
+package providers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/walteh/webauthn/pkg/androidkey"
+	"github.com/walteh/webauthn/pkg/androidkey/androidkeytest"
+)
+
+func TestAndroidKeyVerifyChain(t *testing.T) {
+	authority := androidkeytest.NewAuthority(t)
+	_, chain := authority.Issue(t, androidkeytest.KeyOptions{})
+
+	x5c := make([]interface{}, len(chain))
+	for i, c := range chain {
+		x5c[i] = c
+	}
+
+	// the google roots are pinned unless other roots are set
+	assert.ErrorIs(t, NewAndroidKey().verifyChain(x5c), androidkey.ErrInvalidChain)
+	assert.NoError(t, NewAndroidKey().WithRoots(authority.Roots()).verifyChain(x5c))
+}
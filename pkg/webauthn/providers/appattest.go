@@ -41,8 +41,15 @@ type AppAttest struct {
 	production bool
 	time       *time.Time
 	rootCert   string
+	appIDs     []string
 }
 
+// the app attest environments, which are also the aaguids (zero padded) of the credentials attested in them
+const (
+	AppAttestEnvironmentDevelopment = "appattestdevelop"
+	AppAttestEnvironmentProduction  = "appattest"
+)
+
 func NewAppAttestSandbox() *AppAttest {
 	return &AppAttest{
 		production: false,
@@ -59,6 +66,24 @@ func NewAppAttestProduction() *AppAttest {
 	}
 }
 
+// NewAppAttest returns the provider for a recorded environment
+func NewAppAttest(environment string) (*AppAttest, error) {
+	switch environment {
+	case AppAttestEnvironmentDevelopment:
+		return NewAppAttestSandbox(), nil
+	case AppAttestEnvironmentProduction:
+		return NewAppAttestProduction(), nil
+	default:
+		return nil, errors.Wrap(ErrAppleAppAttest, fmt.Sprintf("unknown environment %q", environment))
+	}
+}
+
+// AppAttestEnvironmentFromAAGUID returns the environment a credential was attested in from its aaguid,
+// for credentials stored before the environment was recorded
+func AppAttestEnvironmentFromAAGUID(aaguid []byte) string {
+	return string(bytes.TrimRight(aaguid, "\x00"))
+}
+
 func (me *AppAttest) WithTime(t time.Time) *AppAttest {
 	me.time = &t
 	return me
@@ -69,16 +94,53 @@ func (me *AppAttest) WithRootCert(rootCert string) *AppAttest {
 	return me
 }
 
+// WithAppIDs sets the "TEAMID.bundle.id" app ids whose keys are accepted
+func (me *AppAttest) WithAppIDs(appIDs ...string) *AppAttest {
+	me.appIDs = appIDs
+	return me
+}
+
+func (me *AppAttest) AppIDs() []string {
+	return me.appIDs
+}
+
+// MatchAppID returns the allowed app id whose SHA-256 hash is the rpIdHash of the authenticator data.
+// App attest keys are scoped to the app id the way webauthn credentials are scoped to the relying party id.
+func (me *AppAttest) MatchAppID(rpIDHash []byte) (string, error) {
+	for _, appID := range me.appIDs {
+		hash := sha256.Sum256([]byte(appID))
+		if bytes.Equal(hash[:], rpIDHash) {
+			return appID, nil
+		}
+	}
+	return "", errors.Wrap(ErrAppleAppAttest, fmt.Sprintf("rpIdHash %x does not match an allowed app id", rpIDHash))
+}
+
 func (me *AppAttest) ID() string {
 	return "apple-appattest"
 }
 
+func (me *AppAttest) Environment() string {
+	if me.production {
+		return AppAttestEnvironmentProduction
+	}
+	return AppAttestEnvironmentDevelopment
+}
+
 var (
 	ErrAppleAppAttest = errors.New("ErrAppleAppAttest")
 )
 
 func (me *AppAttest) Attest(att types.AttestationObject, clientDataHash []byte) (hex.Hash, string, []interface{}, error) {
 
+	// 6. Compute the SHA256 hash of your app’s App ID, and verify that it’s the same as the authenticator data’s RP ID hash.
+	// The app id is checked against the allowed ones here, and against the credCert after the chain is verified.
+	if len(me.appIDs) > 0 {
+		if _, err := me.MatchAppID(att.AuthData.RPIDHash); err != nil {
+			return nil, "", nil, err
+		}
+	}
+
 	// 7. Verify that the authenticator data’s counter field equals 0.
 	if att.AuthData.Counter != 0 {
 		return nil, "", nil, errors.Wrap(ErrAppleAppAttest, fmt.Sprintf("Counter was not 0, but %d\n", att.AuthData.Counter))
@@ -87,13 +149,9 @@ func (me *AppAttest) Attest(att types.AttestationObject, clientDataHash []byte)
 	// 8. Verify that the authenticator data’s aaguid field is either appattestdevelop if operating in the development environment,
 	// or appattest followed by seven 0x00 bytes if operating in the production environment.
 	aaguid := make([]byte, 16)
-	if me.production {
-		copy(aaguid, []byte("appattest"))
-	} else {
-		copy(aaguid, []byte("appattestdevelop"))
-	}
+	copy(aaguid, []byte(me.Environment()))
 	if !bytes.Equal(att.AuthData.AttData.AAGUID, aaguid) {
-		return nil, "", nil, errors.Wrap(ErrAppleAppAttest, "AAGUID was not appattestdevelop\n")
+		return nil, "", nil, errors.Wrap(ErrAppleAppAttest, fmt.Sprintf("AAGUID was not %s\n", me.Environment()))
 	}
 
 	roots := x509.NewCertPool()
@@ -200,10 +258,147 @@ func (me *AppAttest) Attest(att types.AttestationObject, clientDataHash []byte)
 		return nil, "", nil, errors.Wrap(ErrAppleAppAttest, "Wrong algorithm")
 	}
 
+	// 6. (continued) the credCert names the app the key was generated for, it has to be the app of the rpIdHash
+	appID, err := AppAttestAppID(credCert)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	appIDHash := sha256.Sum256([]byte(appID))
+	if !bytes.Equal(appIDHash[:], att.AuthData.RPIDHash) {
+		return nil, "", nil, errors.Wrap(ErrAppleAppAttest, fmt.Sprintf("The rpIdHash is not the SHA256 hash of the app id %q", appID))
+	}
+
 	// Return x963-encoded public key and receipt.
 	return hex.BytesToHash(publicKeyBytes), string(aaguid), []interface{}{att.AttStatement["receipt"]}, nil
 }
 
+var _ types.AssertionVerifier = (*AppAttest)(nil)
+
+// App attest assertions are verified as described in
+// https://developer.apple.com/documentation/devicecheck/validating_apps_that_connect_to_your_server#3576644
+
+// DecodeAssertionKey parses the X9.63 encoded P-256 key stored from the attestation, app attest keys
+// are never used with the appid extension
+func (me *AppAttest) DecodeAssertionKey(publicKey []byte, appID string) (interface{}, error) {
+	x, y := elliptic.Unmarshal(elliptic.P256(), publicKey)
+	if x == nil {
+		return nil, errors.Wrap(ErrAssertionKey, "public key is not an X9.63 encoded P-256 point")
+	}
+	return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+}
+
+// AssertionSignedData returns the nonce, the SHA256 hash of the authenticator data and the client data hash.
+// 1. Compute clientDataHash as the SHA256 hash of clientData.
+// 2. Concatenate authenticatorData and clientDataHash, and apply a SHA256 hash over the result to form nonce.
+func (me *AppAttest) AssertionSignedData(authData []byte, clientDataHash []byte) []byte {
+	nonce := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash...))
+	return nonce[:]
+}
+
+// VerifyAssertionSignature checks the DER encoded ECDSA signature, which the secure enclave computes over
+// the SHA256 hash of the nonce.
+// 3. Use the public key that you stored from the attestation object to verify that the assertion’s signature is valid for nonce.
+func (me *AppAttest) VerifyAssertionSignature(key interface{}, signedData []byte, signature []byte) error {
+	pub, ok := key.(*ecdsa.PublicKey)
+	if !ok {
+		return errors.Wrap(ErrAssertionKey, fmt.Sprintf("expected an ecdsa key, got %T", key))
+	}
+
+	nonceHash := sha256.Sum256(signedData)
+
+	if !ecdsa.VerifyASN1(pub, nonceHash[:], signature) {
+		return errors.Wrap(ErrAssertionSignature, "signature does not match")
+	}
+
+	return nil
+}
+
+// VerifyAssertionCounter requires the counter to increase with every assertion, app attest keys always count.
+// 5. Verify that the authenticator data’s counter value is greater than the value from the previous assertion, or greater than 0 on the first assertion.
+func (me *AppAttest) VerifyAssertionCounter(stored uint64, received uint64) error {
+	if received <= stored {
+		return errors.Wrap(ErrAssertionCounter, fmt.Sprintf("counter %d is not greater than stored %d", received, stored))
+	}
+	return nil
+}
+
+var _ types.AttestedCredentialRecorder = (*AppAttest)(nil)
+
+// RecordAttestedCredential records the environment and the app id of an attested credential, so its
+// assertions can be verified against the same environment and app
+func (me *AppAttest) RecordAttestedCredential(att types.AttestationObject, cred *types.Credential) error {
+	x5c, ok := att.AttStatement["x5c"].([]interface{})
+	if !ok || len(x5c) == 0 {
+		return errors.Wrap(ErrAppleAppAttest, "Error retrieving x5c value")
+	}
+
+	credCertBytes, ok := x5c[0].([]byte)
+	if !ok {
+		return errors.Wrap(ErrAppleAppAttest, "Error getting certificate from x5c cert chain")
+	}
+
+	credCert, err := x509.ParseCertificate(credCertBytes)
+	if err != nil {
+		return errors.Wrap(ErrAppleAppAttest, fmt.Sprintf("Error parsing certificate from ASN.1 data: %+v", err))
+	}
+
+	appID, err := AppAttestAppID(credCert)
+	if err != nil {
+		return err
+	}
+
+	cred.Environment = me.Environment()
+	cred.AppID = appID
+
+	return nil
+}
+
+var (
+	appAttestKeyDescriptionOID = asn1.ObjectIdentifier{1, 2, 840, 113635, 100, 8, 5}
+
+	// the key description tag holding the team id and bundle id
+	appAttestAppIDTag = 1204
+)
+
+// AppAttestAppID returns the app id, "TEAMID.bundle.id", from the key description extension of a credCert
+func AppAttestAppID(credCert *x509.Certificate) (string, error) {
+	var ext []byte
+	for _, extension := range credCert.Extensions {
+		if extension.Id.Equal(appAttestKeyDescriptionOID) {
+			ext = extension.Value
+		}
+	}
+
+	if len(ext) == 0 {
+		return "", errors.Wrap(ErrAppleAppAttest, "Certificate did not contain key description extension")
+	}
+
+	var seq asn1.RawValue
+	if _, err := asn1.Unmarshal(ext, &seq); err != nil {
+		return "", errors.Wrap(ErrAppleAppAttest, fmt.Sprintf("Error parsing key description: %+v", err))
+	}
+
+	for rest := seq.Bytes; len(rest) > 0; {
+		var field asn1.RawValue
+		var err error
+		if rest, err = asn1.Unmarshal(rest, &field); err != nil {
+			return "", errors.Wrap(ErrAppleAppAttest, fmt.Sprintf("Error parsing key description: %+v", err))
+		}
+
+		if field.Class != asn1.ClassContextSpecific || field.Tag != appAttestAppIDTag {
+			continue
+		}
+
+		var appID []byte
+		if _, err := asn1.Unmarshal(field.Bytes, &appID); err != nil {
+			return "", errors.Wrap(ErrAppleAppAttest, fmt.Sprintf("Error parsing app id: %+v", err))
+		}
+		return string(appID), nil
+	}
+
+	return "", errors.Wrap(ErrAppleAppAttest, "Key description did not contain an app id")
+}
+
 // // Apple has not yet publish schema for the extension(as of JULY 2021.)
 // type AppleAnonymousAttestation struct {
 // 	Nonce []byte `asn1:"tag:1,explicit"`
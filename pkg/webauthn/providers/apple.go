@@ -16,7 +16,9 @@ import (
 	"github.com/walteh/webauthn/pkg/webauthn/types"
 )
 
-type AppleAttestationProvider struct{}
+type AppleAttestationProvider struct {
+	WebAuthnAssertion
+}
 
 func NewAppleAttestationProvider() *AppleAttestationProvider {
 	return &AppleAttestationProvider{}
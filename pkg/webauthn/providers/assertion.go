@@ -0,0 +1,71 @@
+package providers
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/walteh/webauthn/pkg/webauthn/types"
+
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+)
+
+var (
+	ErrAssertionKey       = errors.New("ErrAssertionKey")
+	ErrAssertionSignature = errors.New("ErrAssertionSignature")
+	ErrAssertionCounter   = errors.New("ErrAssertionCounter")
+)
+
+// WebAuthnAssertion verifies assertions as described in §7.2 (https://www.w3.org/TR/webauthn/#sctn-verifying-assertion),
+// it is embedded by the providers of the standard attestation formats
+type WebAuthnAssertion struct{}
+
+var _ types.AssertionVerifier = (*WebAuthnAssertion)(nil)
+
+func (me WebAuthnAssertion) DecodeAssertionKey(publicKey []byte, appID string) (interface{}, error) {
+	var (
+		key interface{}
+		err error
+	)
+
+	if appID == "" {
+		key, err = webauthncose.ParsePublicKey(publicKey)
+	} else {
+		key, err = webauthncose.ParseFIDOPublicKey(publicKey)
+	}
+
+	if err != nil {
+		return nil, errors.Wrap(ErrAssertionKey, err.Error())
+	}
+
+	return key, nil
+}
+
+// AssertionSignedData returns the binary concatenation of authData and hash
+func (me WebAuthnAssertion) AssertionSignedData(authData []byte, clientDataHash []byte) []byte {
+	signed := make([]byte, 0, len(authData)+len(clientDataHash))
+	signed = append(signed, authData...)
+	return append(signed, clientDataHash...)
+}
+
+func (me WebAuthnAssertion) VerifyAssertionSignature(key interface{}, signedData []byte, signature []byte) error {
+	valid, err := webauthncose.VerifySignature(key, signedData, signature)
+	if err != nil {
+		return errors.Wrap(ErrAssertionSignature, err.Error())
+	}
+	if !valid {
+		return errors.Wrap(ErrAssertionSignature, "signature does not match")
+	}
+	return nil
+}
+
+// VerifyAssertionCounter follows §7.2, authenticators without a counter always report 0 and are accepted,
+// otherwise the counter must have moved past the stored value or the credential may have been cloned
+func (me WebAuthnAssertion) VerifyAssertionCounter(stored uint64, received uint64) error {
+	if stored == 0 && received == 0 {
+		return nil
+	}
+	if received <= stored {
+		return errors.Wrap(ErrAssertionCounter, fmt.Sprintf("counter %d is not greater than stored %d", received, stored))
+	}
+	return nil
+}
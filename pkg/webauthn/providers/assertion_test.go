@@ -0,0 +1,71 @@
+package providers
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/webauthn/pkg/webauthn/types"
+)
+
+func TestVerifyAssertionCounter(t *testing.T) {
+	tests := []struct {
+		name     string
+		verifier types.AssertionVerifier
+		stored   uint64
+		received uint64
+		wantErr  error
+	}{
+		{name: "webauthn without counter", verifier: NewNoneAttestationProvider(), stored: 0, received: 0},
+		{name: "webauthn increased", verifier: NewPackedAttestationProvider(), stored: 4, received: 5},
+		{name: "webauthn repeated", verifier: NewPackedAttestationProvider(), stored: 5, received: 5, wantErr: ErrAssertionCounter},
+		{name: "webauthn went back", verifier: NewPackedAttestationProvider(), stored: 5, received: 0, wantErr: ErrAssertionCounter},
+		{name: "app attest first assertion", verifier: NewAppAttestSandbox(), stored: 0, received: 1},
+		{name: "app attest without counter", verifier: NewAppAttestSandbox(), stored: 0, received: 0, wantErr: ErrAssertionCounter},
+		{name: "app attest repeated", verifier: NewAppAttestProduction(), stored: 3, received: 3, wantErr: ErrAssertionCounter},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.verifier.VerifyAssertionCounter(tt.stored, tt.received)
+			if tt.wantErr == nil {
+				require.NoError(t, err)
+			} else {
+				require.True(t, errors.Is(err, tt.wantErr), "got %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAppAttestAssertionSignature(t *testing.T) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	authData := []byte("authenticator data")
+	clientDataHash := sha256.Sum256([]byte("client data"))
+
+	prov := NewAppAttestSandbox()
+
+	key, err := prov.DecodeAssertionKey(elliptic.Marshal(elliptic.P256(), priv.X, priv.Y), "")
+	require.NoError(t, err)
+
+	nonce := prov.AssertionSignedData(authData, clientDataHash[:])
+
+	expected := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	require.Equal(t, expected[:], nonce)
+
+	nonceHash := sha256.Sum256(nonce)
+	sig, err := ecdsa.SignASN1(rand.Reader, priv, nonceHash[:])
+	require.NoError(t, err)
+
+	require.NoError(t, prov.VerifyAssertionSignature(key, nonce, sig))
+
+	err = prov.VerifyAssertionSignature(key, prov.AssertionSignedData([]byte("other"), clientDataHash[:]), sig)
+	require.True(t, errors.Is(err, ErrAssertionSignature))
+
+	_, err = prov.DecodeAssertionKey([]byte{0x04, 0x01}, "")
+	require.True(t, errors.Is(err, ErrAssertionKey))
+}
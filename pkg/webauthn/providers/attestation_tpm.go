@@ -20,7 +20,9 @@ func init() {
 	googletpm.UseTPM20LengthPrefixSize()
 }
 
-type TpmAttestationProvider struct{}
+type TpmAttestationProvider struct {
+	WebAuthnAssertion
+}
 
 func NewTpmAttestationProvider() *TpmAttestationProvider {
 	return &TpmAttestationProvider{}
@@ -14,7 +14,9 @@ import (
 	"github.com/go-webauthn/webauthn/protocol/webauthncose"
 )
 
-type U2FAttestationProvider struct{}
+type U2FAttestationProvider struct {
+	WebAuthnAssertion
+}
 
 func NewU2FAttestationProvider() *U2FAttestationProvider {
 	return &U2FAttestationProvider{}
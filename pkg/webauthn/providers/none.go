@@ -7,7 +7,9 @@ import (
 	"github.com/walteh/webauthn/pkg/webauthn/types"
 )
 
-type NoneAttestationProvider struct{}
+type NoneAttestationProvider struct {
+	WebAuthnAssertion
+}
 
 func NewNoneAttestationProvider() *NoneAttestationProvider {
 	return &NoneAttestationProvider{}
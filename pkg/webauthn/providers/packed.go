@@ -36,7 +36,9 @@ import (
 //	 	sig: bytes,
 //	 }
 
-type PackedAttestationProvider struct{}
+type PackedAttestationProvider struct {
+	WebAuthnAssertion
+}
 
 func NewPackedAttestationProvider() *PackedAttestationProvider {
 	return &PackedAttestationProvider{}
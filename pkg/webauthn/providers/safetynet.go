@@ -17,7 +17,11 @@ import (
 	"github.com/mitchellh/mapstructure"
 )
 
-type SafetynetAttestationProvider struct{}
+// SafetynetAttestationProvider verifies the android-safetynet attestation format. Google has shut SafetyNet down,
+// apps attesting their devices should send play integrity tokens, see the playintegrity package.
+type SafetynetAttestationProvider struct {
+	WebAuthnAssertion
+}
 
 func (me *SafetynetAttestationProvider) ID() string {
 	return "android-safetynet"
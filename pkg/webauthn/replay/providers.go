@@ -0,0 +1,201 @@
+package replay
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/walteh/webauthn/pkg/androidkey"
+	"github.com/walteh/webauthn/pkg/hex"
+	"github.com/walteh/webauthn/pkg/webauthn/providers"
+	"github.com/walteh/webauthn/pkg/webauthn/types"
+)
+
+var ErrUnknownFormat = errors.New("ErrUnknownFormat")
+
+// formatProvider completes the providers of formats that only attest, verifying their assertions the
+// standard webauthn way
+type formatProvider struct {
+	providers.WebAuthnAssertion
+	id     string
+	attest func(types.AttestationObject, []byte) (hex.Hash, string, []interface{}, error)
+	time   time.Time
+}
+
+var _ types.AttestationProvider = (*formatProvider)(nil)
+
+func (me *formatProvider) ID() string {
+	return me.id
+}
+
+func (me *formatProvider) Time() time.Time {
+	return me.time
+}
+
+func (me *formatProvider) Attest(att types.AttestationObject, clientDataHash []byte) (hex.Hash, string, []interface{}, error) {
+	return me.attest(att, clientDataHash)
+}
+
+// provider returns the attestation provider of the format, set up with the ceremony's time, trust anchors
+// and app ids. environment is the app attest environment of a stored credential.
+func (me *Ceremony) provider(format string, aaguid []byte, environment string) (types.AttestationProvider, error) {
+	at := me.now()
+
+	switch format {
+	case "none", "":
+		return providers.NewNoneAttestationProvider(), nil
+	case "packed":
+		return &formatProvider{id: format, attest: providers.NewPackedAttestationProvider().Attest, time: at}, nil
+	case "fido-u2f":
+		return &formatProvider{id: format, attest: providers.NewU2FAttestationProvider().Handler, time: at}, nil
+	case "tpm":
+		return &formatProvider{id: format, attest: providers.NewTpmAttestationProvider().Handler, time: at}, nil
+	case "apple":
+		return &formatProvider{id: format, attest: providers.NewAppleAttestationProvider().Handler, time: at}, nil
+	case "android-safetynet":
+		return &formatProvider{id: format, attest: providers.NewSafetynetAttestationProvider().Handler, time: at}, nil
+	case "android-key":
+		prov := providers.NewAndroidKey().WithTime(at)
+		if len(me.RootCerts) > 0 {
+			roots, err := me.roots()
+			if err != nil {
+				return nil, err
+			}
+			prov = prov.WithRoots(roots)
+		}
+		return prov, nil
+	case "apple-appattest":
+		if environment == "" {
+			environment = providers.AppAttestEnvironmentFromAAGUID(aaguid)
+		}
+		prov, err := providers.NewAppAttest(environment)
+		if err != nil {
+			return nil, err
+		}
+		prov = prov.WithTime(at).WithAppIDs(me.AppIDs...)
+		if len(me.RootCerts) > 0 {
+			prov = prov.WithRootCert(strings.Join(me.RootCerts, "\n"))
+		}
+		return prov, nil
+	}
+
+	return nil, fmt.Errorf("%w: %q", ErrUnknownFormat, format)
+}
+
+func (me *Ceremony) roots() (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	for _, pem := range me.RootCerts {
+		if !pool.AppendCertsFromPEM([]byte(pem)) {
+			return nil, fmt.Errorf("%w: root_certs holds no certificate", ErrInvalidCeremony)
+		}
+	}
+	return pool, nil
+}
+
+// defaultRoots returns the trust anchors a format is known to chain to when the ceremony names none
+func defaultRoots(format string) (*x509.CertPool, error) {
+	switch format {
+	case "apple-appattest":
+		pool := x509.NewCertPool()
+		pool.AppendCertsFromPEM([]byte(providers.Apple_App_Attestation_Root_CA____EXP_LATER))
+		return pool, nil
+	case "android-key":
+		roots, err := androidkey.GoogleRoots()
+		if errors.Is(err, androidkey.ErrNoRoots) {
+			return nil, nil
+		}
+		return roots, err
+	}
+	return nil, nil
+}
+
+// checkTrustChain verifies the x5c of the attestation statement chains to the ceremony's or the format's
+// trust anchors at the ceremony's time
+func (me *Ceremony) checkTrustChain(report *Report, format string, attStmt map[string]interface{}) {
+	x5c, ok := attStmt["x5c"].([]interface{})
+	if !ok || len(x5c) == 0 {
+		report.skip(StepTrustChain, "no x5c in the attestation statement")
+		return
+	}
+
+	var (
+		roots *x509.CertPool
+		err   error
+	)
+
+	if len(me.RootCerts) > 0 {
+		roots, err = me.roots()
+	} else {
+		roots, err = defaultRoots(format)
+	}
+	if err != nil {
+		report.check(StepTrustChain, err, "loading the trust anchors")
+		return
+	}
+	if roots == nil {
+		report.skip(StepTrustChain, "no trust anchors for %s, set root_certs", format)
+		return
+	}
+
+	chain := make([][]byte, 0, len(x5c))
+	for _, c := range x5c {
+		der, ok := c.([]byte)
+		if !ok {
+			report.check(StepTrustChain, errors.New("x5c holds a non byte string"), "%d certificates", len(x5c))
+			return
+		}
+		chain = append(chain, der)
+	}
+
+	certs, err := verifyChain(format, chain, roots, me.now())
+	if err != nil {
+		report.check(StepTrustChain, err, "%d certificates at %s", len(chain), me.now().Format(time.RFC3339))
+		return
+	}
+
+	report.pass(StepTrustChain, "%s, issued by %s, at %s", certs[0].Subject, certs[len(certs)-1].Issuer, me.now().Format(time.RFC3339))
+}
+
+// oidSubjectAltName is marked critical on tpm attestation identity keys, whose subject is empty
+var oidSubjectAltName = asn1.ObjectIdentifier{2, 5, 29, 17}
+
+func verifyChain(format string, chain [][]byte, roots *x509.CertPool, at time.Time) ([]*x509.Certificate, error) {
+	certs := make([]*x509.Certificate, 0, len(chain))
+	for _, der := range chain {
+		c, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", androidkey.ErrInvalidChain, err)
+		}
+		certs = append(certs, c)
+	}
+
+	// the tpm provider already checked the tpm specific subject alternative name of the aik certificate
+	if format == "tpm" {
+		unhandled := certs[0].UnhandledCriticalExtensions[:0]
+		for _, ext := range certs[0].UnhandledCriticalExtensions {
+			if !ext.Equal(oidSubjectAltName) {
+				unhandled = append(unhandled, ext)
+			}
+		}
+		certs[0].UnhandledCriticalExtensions = unhandled
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, c := range certs[1:] {
+		intermediates.AddCert(c)
+	}
+
+	if _, err := certs[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   at,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		return nil, fmt.Errorf("%w: %v", androidkey.ErrInvalidChain, err)
+	}
+
+	return certs, nil
+}
@@ -0,0 +1,340 @@
+// Package replay verifies a recorded registration or assertion offline, step by step, so a ceremony
+// captured from a user can be run on a laptop against the same checks production runs.
+package replay
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/walteh/webauthn/pkg/hex"
+	"github.com/walteh/webauthn/pkg/webauthn/assertion"
+	"github.com/walteh/webauthn/pkg/webauthn/authdata"
+	"github.com/walteh/webauthn/pkg/webauthn/clientdata"
+	"github.com/walteh/webauthn/pkg/webauthn/credential"
+	"github.com/walteh/webauthn/pkg/webauthn/extensions"
+	"github.com/walteh/webauthn/pkg/webauthn/types"
+)
+
+var (
+	ErrInvalidCeremony = errors.New("ErrInvalidCeremony")
+	ErrStepFailed      = errors.New("ErrStepFailed")
+)
+
+// the steps of a replay, in the order they run
+const (
+	StepParse       = "parse"
+	StepClientData  = "client data"
+	StepRPIDHash    = "rp id hash"
+	StepFlags       = "flags"
+	StepCounter     = "counter"
+	StepSignature   = "signature"
+	StepAttestation = "attestation"
+	StepTrustChain  = "trust chain"
+	StepCeremony    = "ceremony"
+)
+
+type Status string
+
+const (
+	StatusPass Status = "pass"
+	StatusFail Status = "fail"
+	StatusSkip Status = "skip"
+)
+
+// Ceremony is a recorded registration (Attestation is set) or assertion (Assertion and the stored Credential
+// are set) with what the relying party expected of it. Binary fields are 0x prefixed hex.
+type Ceremony struct {
+	Type               types.CeremonyType `json:"type,omitempty"`
+	Challenge          hex.Hash           `json:"challenge"`
+	RelyingPartyID     string             `json:"rp_id"`
+	RelyingPartyOrigin string             `json:"origin"`
+	VerifyUser         bool               `json:"verify_user"`
+
+	// AppIDs are the app ids app attest keys may be scoped to
+	AppIDs []string `json:"app_ids,omitempty"`
+	// Time is when the ceremony happened, certificates are checked against it instead of the current time
+	Time *time.Time `json:"time,omitempty"`
+	// RootCerts are PEM encoded trust anchors replacing the format's own
+	RootCerts []string `json:"root_certs,omitempty"`
+
+	Attestation *types.AttestationInput `json:"attestation,omitempty"`
+	Assertion   *types.AssertionInput   `json:"assertion,omitempty"`
+
+	// SignedData is the data whose hash the client signed when it is not the client data json, as with
+	// app attest requests
+	SignedData hex.Hash `json:"signed_data,omitempty"`
+
+	// Credential is the stored credential an assertion is verified against
+	Credential *types.Credential `json:"credential,omitempty"`
+}
+
+// Load reads a ceremony from a json file
+func Load(path string) (*Ceremony, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var me Ceremony
+	if err := json.Unmarshal(data, &me); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCeremony, err)
+	}
+
+	return &me, me.Validate()
+}
+
+// Validate fills in the ceremony type and checks the ceremony holds what its type needs
+func (me *Ceremony) Validate() error {
+	if me.Type == "" {
+		switch {
+		case me.Attestation != nil && me.Assertion == nil:
+			me.Type = types.CreateCeremony
+		case me.Assertion != nil && me.Attestation == nil:
+			me.Type = types.AssertCeremony
+		default:
+			return fmt.Errorf("%w: exactly one of attestation and assertion must be set", ErrInvalidCeremony)
+		}
+	}
+
+	switch me.Type {
+	case types.CreateCeremony:
+		if me.Attestation == nil {
+			return fmt.Errorf("%w: %s ceremony without an attestation", ErrInvalidCeremony, me.Type)
+		}
+	case types.AssertCeremony:
+		if me.Assertion == nil || me.Credential == nil {
+			return fmt.Errorf("%w: %s ceremony needs an assertion and the stored credential", ErrInvalidCeremony, me.Type)
+		}
+	default:
+		return fmt.Errorf("%w: unknown ceremony type %q", ErrInvalidCeremony, me.Type)
+	}
+
+	return nil
+}
+
+func (me *Ceremony) now() time.Time {
+	if me.Time == nil {
+		return time.Now()
+	}
+	return *me.Time
+}
+
+// Step is the result of one check
+type Step struct {
+	Name   string `json:"name"`
+	Status Status `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	Error  string `json:"error,omitempty"`
+
+	err error
+}
+
+type Report struct {
+	Type   types.CeremonyType `json:"type"`
+	Format string             `json:"format,omitempty"`
+	Steps  []*Step            `json:"steps"`
+}
+
+// Failed returns the first failing step, or nil when the ceremony verified
+func (me *Report) Failed() *Step {
+	for _, s := range me.Steps {
+		if s.Status == StatusFail {
+			return s
+		}
+	}
+	return nil
+}
+
+// Err returns an ErrStepFailed naming the first failing step, wrapping its error
+func (me *Report) Err() error {
+	s := me.Failed()
+	if s == nil {
+		return nil
+	}
+	return fmt.Errorf("%w: %s: %w", ErrStepFailed, s.Name, s.err)
+}
+
+func (me *Report) pass(name, detail string, args ...interface{}) {
+	me.Steps = append(me.Steps, &Step{Name: name, Status: StatusPass, Detail: fmt.Sprintf(detail, args...)})
+}
+
+func (me *Report) skip(name, detail string, args ...interface{}) {
+	me.Steps = append(me.Steps, &Step{Name: name, Status: StatusSkip, Detail: fmt.Sprintf(detail, args...)})
+}
+
+func (me *Report) check(name string, err error, detail string, args ...interface{}) bool {
+	if err == nil {
+		me.pass(name, detail, args...)
+		return true
+	}
+	me.Steps = append(me.Steps, &Step{Name: name, Status: StatusFail, Detail: fmt.Sprintf(detail, args...), Error: err.Error(), err: err})
+	return false
+}
+
+// Replay runs every step of the ceremony, a failing step does not stop the ones after it. The last step runs
+// the whole ceremony through credential.VerifyAttestationInput or assertion.VerifyAssertionInput, the way the
+// app flows do.
+func Replay(ctx context.Context, c *Ceremony) (*Report, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	if c.Type == types.CreateCeremony {
+		return c.replayAttestation(ctx), nil
+	}
+	return c.replayAssertion(ctx), nil
+}
+
+func (me *Ceremony) replayAttestation(ctx context.Context) *Report {
+	report := &Report{Type: types.CreateCeremony}
+
+	att, err := credential.ParseAttestationInput(ctx, *me.Attestation)
+	if !report.check(StepParse, err, "attestation object and client data") {
+		return report
+	}
+
+	report.Format = att.Format
+
+	me.checkClientData(ctx, report, att.ClientData, types.CreateCeremony)
+	me.checkRPIDHash(report, att.AuthData.RPIDHash)
+	me.checkFlags(report, att.AuthData.Flags)
+	report.pass(StepCounter, "sign count %d", att.AuthData.Counter)
+
+	provider, err := me.provider(att.Format, att.AuthData.AttData.AAGUID, "")
+	if err != nil {
+		report.check(StepAttestation, err, "format %s", att.Format)
+		return report
+	}
+
+	clientDataHash := sha256.Sum256([]byte(me.Attestation.UTF8ClientDataJSON))
+
+	_, attestationType, _, err := provider.Attest(*att, clientDataHash[:])
+	if report.check(StepAttestation, err, "format %s", att.Format) && attestationType != "" {
+		report.Steps[len(report.Steps)-1].Detail += ", attestation type " + attestationType
+	}
+
+	me.checkTrustChain(report, att.Format, att.AttStatement)
+
+	cred, err := credential.VerifyAttestationInput(ctx, types.VerifyAttestationInputArgs{
+		Provider:           provider,
+		Input:              *me.Attestation,
+		StoredChallenge:    me.Challenge,
+		VerifyUser:         me.VerifyUser,
+		RelyingPartyID:     me.RelyingPartyID,
+		RelyingPartyOrigin: me.RelyingPartyOrigin,
+	})
+	if err != nil {
+		report.check(StepCeremony, err, "credential.VerifyAttestationInput")
+	} else {
+		report.pass(StepCeremony, "credential %s registered", cred.RawID.Hex())
+	}
+
+	return report
+}
+
+func (me *Ceremony) replayAssertion(ctx context.Context) *Report {
+	report := &Report{Type: types.AssertCeremony, Format: me.Credential.AttestationType}
+
+	obj := me.Assertion.AssertionObject
+	if obj == nil {
+		parsed, err := assertion.ParseAssertionObject(ctx, me.Assertion.RawAssertionObject)
+		if !report.check(StepParse, err, "assertion object") {
+			return report
+		}
+		obj = &parsed
+	}
+
+	data, err := authdata.ParseAuthenticatorDataSavedAttestedCredential(ctx, obj.RawAuthenticatorData, true)
+	if !report.check(StepParse, err, "authenticator data") {
+		return report
+	}
+
+	cd, err := clientdata.ParseClientData(me.Assertion.RawClientDataJSON)
+	if !report.check(StepParse, err, "client data") {
+		return report
+	}
+
+	me.checkClientData(ctx, report, cd, types.AssertCeremony)
+	me.checkRPIDHash(report, data.RPIDHash)
+	me.checkFlags(report, data.Flags)
+
+	provider, err := me.provider(me.Credential.AttestationType, me.Credential.AAGUID, me.Credential.Environment)
+	if err != nil {
+		report.check(StepSignature, err, "format %s", me.Credential.AttestationType)
+		return report
+	}
+
+	signedData := me.SignedData
+	if signedData == nil {
+		signedData = hex.Hash(me.Assertion.RawClientDataJSON)
+	}
+
+	clientDataHash := sha256.Sum256(signedData)
+
+	key, err := provider.DecodeAssertionKey(me.Credential.PublicKey, "")
+	if err == nil {
+		err = provider.VerifyAssertionSignature(key, provider.AssertionSignedData(obj.RawAuthenticatorData, clientDataHash[:]), obj.Signature)
+	}
+	report.check(StepSignature, err, "%s signature by the stored public key", provider.ID())
+
+	report.check(StepCounter, provider.VerifyAssertionCounter(me.Credential.SignCount, data.Counter),
+		"sign count %d, stored %d", data.Counter, me.Credential.SignCount)
+
+	attestationType := types.NotFidoAttestationType
+	if me.Credential.AttestationType == string(types.FidoAttestationType) {
+		attestationType = types.FidoAttestationType
+	}
+
+	err = assertion.VerifyAssertionInput(ctx, types.VerifyAssertionInputArgs{
+		Input:                          *me.Assertion,
+		StoredChallenge:                me.Challenge,
+		CredentialAttestationType:      attestationType,
+		AttestationProvider:            provider,
+		VerifyUser:                     me.VerifyUser,
+		AAGUID:                         me.Credential.AAGUID,
+		CredentialPublicKey:            me.Credential.PublicKey,
+		Extensions:                     extensions.ClientInputs{},
+		LastSignCount:                  me.Credential.SignCount,
+		RelyingPartyID:                 me.RelyingPartyID,
+		RelyingPartyOrigin:             me.RelyingPartyOrigin,
+		DataSignedByClient:             signedData,
+		UseSavedAttestedCredentialData: true,
+	})
+	report.check(StepCeremony, err, "assertion.VerifyAssertionInput")
+
+	return report
+}
+
+func (me *Ceremony) checkClientData(ctx context.Context, report *Report, cd types.CollectedClientData, ceremony types.CeremonyType) {
+	err := clientdata.Verify(ctx, types.VerifyClientDataArgs{
+		ClientData:         cd,
+		StoredChallenge:    me.Challenge,
+		CeremonyType:       ceremony,
+		RelyingPartyOrigin: me.RelyingPartyOrigin,
+	})
+	report.check(StepClientData, err, "type %s, origin %s, challenge %s", cd.Type, cd.Origin, cd.Challenge.Hex())
+}
+
+func (me *Ceremony) checkRPIDHash(report *Report, rpIDHash hex.Hash) {
+	expected := sha256.Sum256([]byte(me.RelyingPartyID))
+
+	var err error
+	if !bytes.Equal(rpIDHash, expected[:]) {
+		err = fmt.Errorf("rp hash mismatch: %s is not the hash of %q", rpIDHash.Hex(), me.RelyingPartyID)
+	}
+	report.check(StepRPIDHash, err, "rp id %s", me.RelyingPartyID)
+}
+
+func (me *Ceremony) checkFlags(report *Report, flags types.AuthenticatorFlags) {
+	var err error
+	if me.VerifyUser && !flags.UserVerified() {
+		err = errors.New("user verification required but flag not set by authenticator")
+	}
+	report.check(StepFlags, err, "0x%02x, user present %t, user verified %t", byte(flags), flags.UserPresent(), flags.UserVerified())
+}
@@ -0,0 +1,299 @@
+package replay_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/webauthn/pkg/hex"
+	"github.com/walteh/webauthn/pkg/webauthn/clientdata"
+	"github.com/walteh/webauthn/pkg/webauthn/providers"
+	"github.com/walteh/webauthn/pkg/webauthn/replay"
+	"github.com/walteh/webauthn/pkg/webauthn/types"
+	"github.com/walteh/webauthn/pkg/webauthn/webauthntest"
+)
+
+var challenge = hex.HexToHash("0x5e2b7c1d9a4f3e8b6c0d2a1f4e7b9c3d")
+
+func registration(t *testing.T, a *webauthntest.Authenticator, opts webauthntest.Options) *replay.Ceremony {
+	input := a.Attest(t, challenge, opts)
+	return &replay.Ceremony{
+		Challenge:          challenge,
+		RelyingPartyID:     a.RPID,
+		RelyingPartyOrigin: webauthntest.Origin,
+		VerifyUser:         true,
+		RootCerts:          []string{a.Authority.RootPEM()},
+		Attestation:        &input,
+	}
+}
+
+func statuses(r *replay.Report) map[string]replay.Status {
+	res := map[string]replay.Status{}
+	for _, s := range r.Steps {
+		res[s.Name] = s.Status
+	}
+	return res
+}
+
+func TestReplayAttestation(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name       string
+		format     webauthntest.Format
+		opts       webauthntest.Options
+		edit       func(*replay.Ceremony)
+		wantFormat string
+		wantFailed string
+		wantErr    error
+		wantSteps  map[string]replay.Status
+	}{
+		{
+			name:       "packed",
+			format:     webauthntest.FormatPacked,
+			wantFormat: "packed",
+			wantSteps: map[string]replay.Status{
+				replay.StepParse:       replay.StatusPass,
+				replay.StepClientData:  replay.StatusPass,
+				replay.StepRPIDHash:    replay.StatusPass,
+				replay.StepFlags:       replay.StatusPass,
+				replay.StepCounter:     replay.StatusPass,
+				replay.StepAttestation: replay.StatusPass,
+				replay.StepTrustChain:  replay.StatusPass,
+				replay.StepCeremony:    replay.StatusPass,
+			},
+		},
+		{
+			name:       "none",
+			format:     webauthntest.FormatNone,
+			wantFormat: "none",
+			wantSteps:  map[string]replay.Status{replay.StepTrustChain: replay.StatusSkip, replay.StepCeremony: replay.StatusPass},
+		},
+		{
+			name:       "tpm",
+			format:     webauthntest.FormatTPM,
+			wantFormat: "tpm",
+			wantSteps:  map[string]replay.Status{replay.StepTrustChain: replay.StatusPass, replay.StepCeremony: replay.StatusPass},
+		},
+		{
+			name:       "apple app attest",
+			format:     webauthntest.FormatAppleAppAttest,
+			edit:       func(c *replay.Ceremony) { c.AppIDs = []string{webauthntest.AppID} },
+			wantFormat: "apple-appattest",
+			wantSteps:  map[string]replay.Status{replay.StepTrustChain: replay.StatusPass, replay.StepCeremony: replay.StatusPass},
+		},
+		{
+			name:       "packed without trust anchors",
+			format:     webauthntest.FormatPacked,
+			edit:       func(c *replay.Ceremony) { c.RootCerts = nil },
+			wantFormat: "packed",
+			wantSteps:  map[string]replay.Status{replay.StepTrustChain: replay.StatusSkip, replay.StepCeremony: replay.StatusPass},
+		},
+		{
+			name:       "other origin",
+			format:     webauthntest.FormatNone,
+			opts:       webauthntest.Options{Origin: "https://evil.xyz"},
+			wantFailed: replay.StepClientData,
+			wantErr:    clientdata.ErrOriginMismatch,
+			wantSteps:  map[string]replay.Status{replay.StepRPIDHash: replay.StatusPass, replay.StepCeremony: replay.StatusFail},
+		},
+		{
+			name:       "other relying party",
+			format:     webauthntest.FormatNone,
+			opts:       webauthntest.Options{RPID: "evil.xyz"},
+			wantFailed: replay.StepRPIDHash,
+		},
+		{
+			name:       "user not verified",
+			format:     webauthntest.FormatPackedSelf,
+			opts:       webauthntest.Options{UserNotVerified: true},
+			wantFailed: replay.StepFlags,
+		},
+		{
+			name:       "attestation signature",
+			format:     webauthntest.FormatPackedSelf,
+			opts:       webauthntest.Options{SignedData: []byte("other")},
+			wantFailed: replay.StepAttestation,
+			wantErr:    providers.ErrPacked,
+		},
+		{
+			name:   "expired chain",
+			format: webauthntest.FormatPacked,
+			edit: func(c *replay.Ceremony) {
+				at := time.Now().AddDate(20, 0, 0)
+				c.Time = &at
+			},
+			wantFailed: replay.StepTrustChain,
+			wantSteps:  map[string]replay.Status{replay.StepAttestation: replay.StatusPass},
+		},
+		{
+			name:       "app attest of other app",
+			format:     webauthntest.FormatAppleAppAttest,
+			edit:       func(c *replay.Ceremony) { c.AppIDs = []string{"4497QJSAD3.xyz.nugg.other"} },
+			wantFailed: replay.StepAttestation,
+			wantErr:    providers.ErrAppleAppAttest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := webauthntest.NewAuthenticator(t, tt.format, webauthncose.AlgES256)
+
+			c := registration(t, a, tt.opts)
+			if tt.edit != nil {
+				tt.edit(c)
+			}
+
+			report, err := replay.Replay(ctx, c)
+			require.NoError(t, err)
+
+			assert.Equal(t, types.CreateCeremony, report.Type)
+			if tt.wantFormat != "" {
+				assert.Equal(t, tt.wantFormat, report.Format)
+			}
+
+			got := statuses(report)
+			for name, status := range tt.wantSteps {
+				assert.Equal(t, status, got[name], name)
+			}
+
+			if tt.wantFailed == "" {
+				assert.Nil(t, report.Failed())
+				assert.NoError(t, report.Err())
+				return
+			}
+
+			require.NotNil(t, report.Failed())
+			assert.Equal(t, tt.wantFailed, report.Failed().Name)
+			require.ErrorIs(t, report.Err(), replay.ErrStepFailed)
+			assert.ErrorContains(t, report.Err(), tt.wantFailed)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, report.Err(), tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestReplayAssertion(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name       string
+		format     webauthntest.Format
+		stored     uint64
+		opts       webauthntest.Options
+		wantFailed string
+		wantErr    error
+	}{
+		{name: "packed", format: webauthntest.FormatPackedSelf},
+		{name: "apple app attest", format: webauthntest.FormatAppleAppAttest},
+		{
+			name:       "counter regression",
+			format:     webauthntest.FormatPackedSelf,
+			stored:     9,
+			wantFailed: replay.StepCounter,
+			wantErr:    providers.ErrAssertionCounter,
+		},
+		{
+			name:       "signature of other data",
+			format:     webauthntest.FormatPackedSelf,
+			opts:       webauthntest.Options{SignedData: []byte("other")},
+			wantFailed: replay.StepSignature,
+			wantErr:    providers.ErrAssertionSignature,
+		},
+		{
+			name:       "attestation client data",
+			format:     webauthntest.FormatNone,
+			opts:       webauthntest.Options{Type: types.CreateCeremony},
+			wantFailed: replay.StepClientData,
+			wantErr:    clientdata.ErrInvalidCeremonyType,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := webauthntest.NewAuthenticator(t, tt.format, webauthncose.AlgES256)
+
+			reg := registration(t, a, webauthntest.Options{})
+			reg.AppIDs = []string{webauthntest.AppID}
+
+			report, err := replay.Replay(ctx, reg)
+			require.NoError(t, err)
+			require.NoError(t, report.Err())
+
+			input := a.Assert(t, challenge, tt.opts)
+
+			c := &replay.Ceremony{
+				Challenge:          challenge,
+				RelyingPartyID:     a.RPID,
+				RelyingPartyOrigin: webauthntest.Origin,
+				AppIDs:             []string{webauthntest.AppID},
+				Assertion:          &input,
+				Credential: &types.Credential{
+					RawID:           a.CredentialID,
+					PublicKey:       a.CredentialPublicKey(t),
+					AttestationType: report.Format,
+					AAGUID:          a.AAGUID,
+					SignCount:       tt.stored,
+				},
+			}
+
+			report, err = replay.Replay(ctx, c)
+			require.NoError(t, err)
+
+			assert.Equal(t, types.AssertCeremony, report.Type)
+
+			if tt.wantFailed == "" {
+				assert.NoError(t, report.Err())
+				return
+			}
+
+			require.NotNil(t, report.Failed())
+			assert.Equal(t, tt.wantFailed, report.Failed().Name)
+			assert.ErrorIs(t, report.Err(), tt.wantErr)
+			assert.Equal(t, replay.StatusFail, statuses(report)[replay.StepCeremony])
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	a := webauthntest.NewAuthenticator(t, webauthntest.FormatPacked, webauthncose.AlgRS256)
+
+	c := registration(t, a, webauthntest.Options{})
+
+	raw, err := json.Marshal(c)
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "ceremony.json")
+	require.NoError(t, os.WriteFile(path, raw, 0o600))
+
+	loaded, err := replay.Load(path)
+	require.NoError(t, err)
+
+	assert.Equal(t, types.CreateCeremony, loaded.Type)
+	assert.Equal(t, challenge, loaded.Challenge)
+
+	report, err := replay.Replay(context.Background(), loaded)
+	require.NoError(t, err)
+	assert.NoError(t, report.Err())
+
+	t.Run("invalid", func(t *testing.T) {
+		for name, body := range map[string]string{
+			"neither":            `{"challenge":"0x01"}`,
+			"assertion only":     `{"type":"webauthn.get","assertion":{}}`,
+			"unknown type":       `{"type":"webauthn.other","attestation":{}}`,
+			"malformed":          `{"challenge":1`,
+			"wrong field format": `{"challenge":"not hex"}`,
+		} {
+			path := filepath.Join(t.TempDir(), "ceremony.json")
+			require.NoError(t, os.WriteFile(path, []byte(body), 0o600))
+
+			_, err := replay.Load(path)
+			assert.ErrorIs(t, err, replay.ErrInvalidCeremony, name)
+		}
+	})
+}
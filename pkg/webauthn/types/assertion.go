@@ -19,6 +19,7 @@ type VerifyAssertionInputArgs struct {
 	LastSignCount                  uint64
 	RelyingPartyID                 string
 	RelyingPartyOrigin             string
+	Origins                        OriginMatcher
 	DataSignedByClient             hex.Hash
 	UseSavedAttestedCredentialData bool
 }
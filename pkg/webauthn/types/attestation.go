@@ -32,6 +32,7 @@ type VerifyAttestationInputArgs struct {
 	VerifyUser         bool
 	RelyingPartyID     string
 	RelyingPartyOrigin string
+	Origins            OriginMatcher
 }
 
 // From §5.2.1 (https://www.w3.org/TR/webauthn/#authenticatorattestationresponse)
@@ -96,6 +97,30 @@ type AttestationProvider interface {
 	Attest(AttestationObject, []byte) (hex.Hash, string, []interface{}, error)
 	ID() string
 	Time() time.Time
+	AssertionVerifier
+}
+
+// AssertionVerifier verifies the assertions of credentials attested with a provider. Formats differ in how the
+// credential public key is stored, what the authenticator signs and how its signature counter moves.
+type AssertionVerifier interface {
+	// DecodeAssertionKey parses a stored credential public key, appID is set when a fido-u2f credential
+	// is used with the appid extension
+	DecodeAssertionKey(publicKey []byte, appID string) (interface{}, error)
+
+	// AssertionSignedData returns the data the authenticator signed, given the raw authenticator data
+	// and the hash of the client data
+	AssertionSignedData(authData []byte, clientDataHash []byte) []byte
+
+	VerifyAssertionSignature(key interface{}, signedData []byte, signature []byte) error
+
+	// VerifyAssertionCounter checks the signature counter of an assertion against the one stored with the credential
+	VerifyAssertionCounter(stored uint64, received uint64) error
+}
+
+// AttestedCredentialRecorder is implemented by attestation providers that keep format specific details
+// of a verified attestation on the new credential
+type AttestedCredentialRecorder interface {
+	RecordAttestedCredential(AttestationObject, *Credential) error
 }
 
 func (me CredentialIdentifier) Verify() error {
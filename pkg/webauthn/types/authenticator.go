@@ -10,9 +10,11 @@ type VerifyAuenticatorDataArgs struct {
 	RelyingPartyID                 string
 	RequireUserVerification        bool
 	RequireUserPresence            bool
-	LastSignCount                  uint64
 	OptionalAttestedCredentialData AttestedCredentialData
 	UseSavedAttestedCredentialData bool
+
+	// CeremonyType is the ceremony the data is verified for, it names the failing step
+	CeremonyType CeremonyType
 }
 
 // Authenticators respond to Relying Party requests by returning an object derived from the
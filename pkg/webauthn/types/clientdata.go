@@ -14,6 +14,16 @@ type VerifyClientDataArgs struct {
 	StoredChallenge    hex.Hash
 	CeremonyType       CeremonyType
 	RelyingPartyOrigin string
+
+	// Origins replaces the exact RelyingPartyOrigin check when set
+	Origins OriginMatcher
+}
+
+// OriginMatcher decides which origins a relying party accepts client data from
+type OriginMatcher interface {
+	MatchOrigin(origin string) bool
+	// MatchTopOrigin reports whether ceremonies may run in a cross origin iframe of a page from topOrigin
+	MatchTopOrigin(topOrigin string) bool
 }
 
 // CollectedClientData represents the contextual bindings of both the WebAuthn Relying Party
@@ -29,6 +39,10 @@ type CollectedClientData struct {
 	Challenge    hex.Hash      `json:"challenge"`
 	Origin       string        `json:"origin"`
 	TokenBinding *TokenBinding `json:"tokenBinding,omitempty"`
+	// TopOrigin is the origin of the top level page when the ceremony ran in an iframe that is not same
+	// origin with its ancestors, CrossOrigin is set in that case (WebAuthn Level 3)
+	TopOrigin   string `json:"topOrigin,omitempty"`
+	CrossOrigin bool   `json:"crossOrigin,omitempty"`
 	// Chromium (Chrome) returns a hint sometimes about how to handle clientDataJSON in a safe manner
 	Hint string `json:"new_keys_may_be_added_here,omitempty"`
 }
@@ -37,6 +37,12 @@ type Credential struct {
 	// The AAGUID of the authenticator. An AAGUID is defined as an array containing the globally unique
 	// identifier of the authenticator model being sought.
 	AAGUID hex.Hash `dynamodbav:"aaguid" json:"aaguid"`
+	// Environment is the app attest environment the credential was attested in, "appattestdevelop" or "appattest".
+	// It is empty for other attestation formats.
+	Environment string `dynamodbav:"environment" json:"environment"`
+	// AppID is the team id and bundle id ("TEAMID.bundle.id") of the app that attested the credential, read from
+	// the app attest credCert, or the package name of the android app a KeyStore key was attested by.
+	AppID string `dynamodbav:"app_id" json:"app_id"`
 	// SignCount -Upon a new login operation, the Relying Party compares the stored signature counter value
 	// with the new signCount value returned in the assertion’s authenticator data. If this new
 	// signCount value is less than or equal to the stored value, a cloned authenticator may
@@ -67,6 +73,8 @@ func (s Credential) MarshalDynamoDBAttributeValue() (*types.AttributeValueMember
 	av.Value["attestation_type"] = &types.AttributeValueMemberS{Value: s.AttestationType}
 	av.Value["receipt"] = &types.AttributeValueMemberS{Value: s.Receipt.Hex()}
 	av.Value["aaguid"] = &types.AttributeValueMemberS{Value: s.AAGUID.Hex()}
+	av.Value["environment"] = &types.AttributeValueMemberS{Value: s.Environment}
+	av.Value["app_id"] = &types.AttributeValueMemberS{Value: s.AppID}
 	av.Value["sign_count"] = &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", s.SignCount)}
 	av.Value["clone_warning"] = &types.AttributeValueMemberBOOL{Value: s.CloneWarning}
 	av.Value["created_at"] = &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", s.CreatedAt)}
@@ -106,6 +114,10 @@ func (s *Credential) UnmarshalDynamoDBAttributeValue(m *types.AttributeValueMemb
 		return err
 	}
 
+	// recorded since app attest environments were tracked, older credentials leave them empty
+	s.Environment = GetSOptional(m, "environment")
+	s.AppID = GetSOptional(m, "app_id")
+
 	if s.SignCount, err = GetNUint64(m, "sign_count"); err != nil {
 		return err
 	}
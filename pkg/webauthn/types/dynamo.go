@@ -53,6 +53,14 @@ func GetS(av *types.AttributeValueMemberM, key string) (string, error) {
 	return "", ErrUnmarshaling
 }
 
+// GetSOptional returns the string at key, or an empty string when it is not set
+func GetSOptional(av *types.AttributeValueMemberM, key string) string {
+	if x, ok := av.Value[key].(*types.AttributeValueMemberS); ok {
+		return x.Value
+	}
+	return ""
+}
+
 func GetSHash(av *types.AttributeValueMemberM, key string) (hex.Hash, error) {
 	h, err := GetS(av, key)
 	if err != nil {
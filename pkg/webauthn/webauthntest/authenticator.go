@@ -0,0 +1,298 @@
+package webauthntest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/webauthn/pkg/hex"
+	"github.com/walteh/webauthn/pkg/webauthn/types"
+	"github.com/walteh/webauthn/pkg/webauthn/webauthncbor"
+)
+
+// the relying party authenticators are created for unless changed
+const (
+	RPID   = "nugg.xyz"
+	Origin = "https://nugg.xyz"
+
+	// AppID is the relying party id of app attest authenticators
+	AppID = "4497QJSAD3.xyz.nugg.app"
+)
+
+// AAGUID is the aaguid of packed and tpm authenticators
+var AAGUID = []byte("webauthntest\x00\x00\x00\x00")
+
+// Format is the attestation statement format an authenticator attests its credential with
+type Format string
+
+const (
+	FormatNone           Format = "none"
+	FormatPackedSelf     Format = "packed-self"
+	FormatPacked         Format = "packed"
+	FormatFIDOU2F        Format = "fido-u2f"
+	FormatTPM            Format = "tpm"
+	FormatAppleAppAttest Format = "apple-appattest"
+)
+
+// Authenticator is a virtual authenticator holding a single credential. Its fields are the state a real
+// authenticator keeps and may be changed between ceremonies.
+type Authenticator struct {
+	Format Format
+	Key    *Key
+
+	RPID         string
+	Origin       string
+	AAGUID       []byte
+	CredentialID []byte
+
+	// Counter is the signature counter, incremented before every assertion
+	Counter uint32
+
+	// Authority issues the attestation certificates of the packed, fido-u2f, tpm and app attest formats
+	Authority *Authority
+}
+
+// NewAuthenticator creates an authenticator of the format holding a fresh credential key. Credentials of the
+// fido-u2f and app attest formats are always ES256.
+func NewAuthenticator(t testing.TB, format Format, alg webauthncose.COSEAlgorithmIdentifier) *Authenticator {
+	if format == FormatFIDOU2F || format == FormatAppleAppAttest {
+		require.Equal(t, webauthncose.AlgES256, alg, "webauthntest: %s credentials are ES256", format)
+	}
+
+	me := &Authenticator{
+		Format:    format,
+		Key:       NewKey(t, alg),
+		RPID:      RPID,
+		Origin:    Origin,
+		AAGUID:    make([]byte, 16),
+		Authority: NewAuthority(t),
+	}
+
+	me.CredentialID = make([]byte, 32)
+	_, err := rand.Read(me.CredentialID)
+	require.NoError(t, err)
+
+	switch format {
+	case FormatPacked, FormatPackedSelf, FormatTPM:
+		me.AAGUID = append([]byte{}, AAGUID...)
+	case FormatAppleAppAttest:
+		// app attest keys are identified by the hash of their public key and scoped to an app id
+		copy(me.AAGUID, "appattestdevelop")
+		me.RPID = AppID
+		me.CredentialID = sha256Sum(me.CredentialPublicKey(t))
+	}
+
+	return me
+}
+
+// CredentialPublicKey returns the public key the way it is stored with the credential, the COSE_Key of
+// webauthn credentials or the X9.63 encoded point of app attest keys
+func (me *Authenticator) CredentialPublicKey(t testing.TB) hex.Hash {
+	if me.Format == FormatAppleAppAttest {
+		pub, ok := me.Key.Public().(*ecdsa.PublicKey)
+		require.True(t, ok, "webauthntest: app attest keys are ES256")
+		return elliptic.Marshal(pub.Curve, pub.X, pub.Y)
+	}
+	return me.Key.COSE(t)
+}
+
+// Options are the knobs of a single ceremony. The zero value is what a well behaved client and authenticator
+// send: the user was present and verified, and the client data names the authenticator's origin.
+type Options struct {
+	// Type, Origin, CrossOrigin and TopOrigin set the fields of the client data
+	Type        types.CeremonyType
+	Origin      string
+	CrossOrigin bool
+	TopOrigin   string
+
+	// SignedData replaces the client data json as the data whose hash the authenticator signs, the way
+	// app attest clients sign the hash of a request
+	SignedData []byte
+
+	// RPID is the relying party id whose hash starts the authenticator data
+	RPID string
+
+	UserNotPresent  bool
+	UserNotVerified bool
+
+	// SetFlags and ClearFlags force flag bits on and off after the authenticator computed them
+	SetFlags   types.AuthenticatorFlags
+	ClearFlags types.AuthenticatorFlags
+
+	// Counter replaces the signature counter, the authenticator's counter is left untouched
+	Counter *uint32
+
+	// Extensions are the authenticator extension outputs, the extension data flag is set when present
+	Extensions map[string]interface{}
+
+	// EditAttStmt changes the attestation statement before it is encoded
+	EditAttStmt func(attStmt map[string]interface{})
+}
+
+// Attest creates the attestation of the authenticator's credential for the challenge
+func (me *Authenticator) Attest(t testing.TB, challenge []byte, opts Options) types.AttestationInput {
+	if opts.Type == "" {
+		opts.Type = types.CreateCeremony
+	}
+
+	clientDataJSON := me.clientDataJSON(t, challenge, opts)
+
+	counter := me.Counter
+	if opts.Counter != nil {
+		counter = *opts.Counter
+	}
+
+	authData := me.authenticatorData(t, opts, counter, true)
+
+	clientDataHash := sha256Sum(me.signedData(clientDataJSON, opts))
+
+	format, attStmt := me.attestationStatement(t, authData, clientDataHash)
+	if opts.EditAttStmt != nil {
+		opts.EditAttStmt(attStmt)
+	}
+
+	attestationObject, err := webauthncbor.Marshal(struct {
+		Format   string                 `cbor:"fmt"`
+		AttStmt  map[string]interface{} `cbor:"attStmt"`
+		AuthData []byte                 `cbor:"authData"`
+	}{format, attStmt, authData})
+	require.NoError(t, err)
+
+	return types.AttestationInput{
+		UTF8ClientDataJSON: string(clientDataJSON),
+		AttestationObject:  attestationObject,
+		CredentialID:       me.CredentialID,
+		CredentialType:     types.PublicKeyCredentialType,
+	}
+}
+
+// Assert creates an assertion of the authenticator's credential for the challenge, counting the signature counter
+// up unless Options.Counter is set
+func (me *Authenticator) Assert(t testing.TB, challenge []byte, opts Options) types.AssertionInput {
+	if opts.Type == "" {
+		opts.Type = types.AssertCeremony
+	}
+
+	clientDataJSON := me.clientDataJSON(t, challenge, opts)
+
+	counter := me.Counter + 1
+	if opts.Counter != nil {
+		counter = *opts.Counter
+	} else {
+		me.Counter = counter
+	}
+
+	authData := me.authenticatorData(t, opts, counter, false)
+
+	clientDataHash := sha256Sum(me.signedData(clientDataJSON, opts))
+
+	signed := append(append([]byte{}, authData...), clientDataHash...)
+
+	var sig []byte
+	if me.Format == FormatAppleAppAttest {
+		// the secure enclave signs the hash of the nonce, the nonce being the hash of the signed data
+		nonce := sha256Sum(signed)
+		sig = me.Key.Sign(t, nonce)
+	} else {
+		sig = me.Key.Sign(t, signed)
+	}
+
+	assertionObject, err := webauthncbor.Marshal(map[string][]byte{
+		"authenticatorData": authData,
+		"signature":         sig,
+	})
+	require.NoError(t, err)
+
+	return types.AssertionInput{
+		CredentialID:       me.CredentialID,
+		RawClientDataJSON:  string(clientDataJSON),
+		RawAssertionObject: assertionObject,
+	}
+}
+
+type clientData struct {
+	Type        types.CeremonyType `json:"type"`
+	Challenge   string             `json:"challenge"`
+	Origin      string             `json:"origin"`
+	CrossOrigin bool               `json:"crossOrigin"`
+	TopOrigin   string             `json:"topOrigin,omitempty"`
+}
+
+func (me *Authenticator) clientDataJSON(t testing.TB, challenge []byte, opts Options) []byte {
+	origin := opts.Origin
+	if origin == "" {
+		origin = me.Origin
+	}
+
+	raw, err := json.Marshal(clientData{
+		Type:        opts.Type,
+		Challenge:   base64.RawURLEncoding.EncodeToString(challenge),
+		Origin:      origin,
+		CrossOrigin: opts.CrossOrigin,
+		TopOrigin:   opts.TopOrigin,
+	})
+	require.NoError(t, err)
+
+	return raw
+}
+
+func (me *Authenticator) signedData(clientDataJSON []byte, opts Options) []byte {
+	if opts.SignedData != nil {
+		return opts.SignedData
+	}
+	return clientDataJSON
+}
+
+// authenticatorData encodes rpIdHash | flags | counter | attested credential data | extensions
+func (me *Authenticator) authenticatorData(t testing.TB, opts Options, counter uint32, attested bool) []byte {
+	rpID := opts.RPID
+	if rpID == "" {
+		rpID = me.RPID
+	}
+
+	var flags types.AuthenticatorFlags
+	if !opts.UserNotPresent {
+		flags |= types.FlagUserPresent
+	}
+	if !opts.UserNotVerified {
+		flags |= types.FlagUserVerified
+	}
+	if attested {
+		flags |= types.FlagAttestedCredentialData
+	}
+	if len(opts.Extensions) > 0 {
+		flags |= types.FlagHasExtensions
+	}
+	flags = (flags | opts.SetFlags) &^ opts.ClearFlags
+
+	data := sha256Sum([]byte(rpID))
+	data = append(data, byte(flags))
+	data = binary.BigEndian.AppendUint32(data, counter)
+
+	if attested {
+		data = append(data, me.AAGUID...)
+		data = binary.BigEndian.AppendUint16(data, uint16(len(me.CredentialID)))
+		data = append(data, me.CredentialID...)
+		data = append(data, me.Key.COSE(t)...)
+	}
+
+	if len(opts.Extensions) > 0 {
+		ext, err := webauthncbor.Marshal(opts.Extensions)
+		require.NoError(t, err)
+		data = append(data, ext...)
+	}
+
+	return data
+}
+
+func sha256Sum(data []byte) []byte {
+	sum := sha256.Sum256(data)
+	return sum[:]
+}
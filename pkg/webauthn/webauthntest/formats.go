@@ -0,0 +1,250 @@
+package webauthntest
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"testing"
+
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/webauthn/pkg/webauthn/googletpm"
+)
+
+var (
+	// id-fido-gen-ce-aaguid, https://www.w3.org/TR/webauthn/#packed-attestation-cert-requirements
+	fidoAAGUIDOID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 45724, 1, 1, 4}
+
+	tcgKpAIKCertificate  = asn1.ObjectIdentifier{2, 23, 133, 8, 3}
+	tcgAtTpmManufacturer = asn1.ObjectIdentifier{2, 23, 133, 2, 1}
+	tcgAtTpmModel        = asn1.ObjectIdentifier{2, 23, 133, 2, 2}
+	tcgAtTpmVersion      = asn1.ObjectIdentifier{2, 23, 133, 2, 3}
+	subjectAltNameOID    = asn1.ObjectIdentifier{2, 5, 29, 17}
+
+	appAttestNonceOID          = asn1.ObjectIdentifier{1, 2, 840, 113635, 100, 8, 2}
+	appAttestKeyDescriptionOID = asn1.ObjectIdentifier{1, 2, 840, 113635, 100, 8, 5}
+)
+
+// Receipt is the receipt of app attest attestations
+var Receipt = []byte("webauthntest receipt")
+
+// attestationStatement returns the fmt and attStmt of the attestation object
+func (me *Authenticator) attestationStatement(t testing.TB, authData, clientDataHash []byte) (string, map[string]interface{}) {
+	signed := append(append([]byte{}, authData...), clientDataHash...)
+
+	switch me.Format {
+	case FormatNone:
+		return "none", map[string]interface{}{}
+	case FormatPackedSelf:
+		return "packed", map[string]interface{}{
+			"alg": int64(me.Key.Algorithm),
+			"sig": me.Key.Sign(t, signed),
+		}
+	case FormatPacked:
+		return "packed", me.packedStatement(t, signed)
+	case FormatFIDOU2F:
+		return "fido-u2f", me.u2fStatement(t, authData, clientDataHash)
+	case FormatTPM:
+		return "tpm", me.tpmStatement(t, signed)
+	case FormatAppleAppAttest:
+		return "apple-appattest", me.appAttestStatement(t, signed)
+	}
+
+	require.FailNowf(t, "webauthntest: unsupported format", "%q", me.Format)
+	return "", nil
+}
+
+// packedStatement is a basic attestation by a certificate carrying the authenticator's aaguid
+func (me *Authenticator) packedStatement(t testing.TB, signed []byte) map[string]interface{} {
+	attKey := NewKey(t, webauthncose.AlgES256)
+
+	aaguid, err := asn1.Marshal(me.AAGUID)
+	require.NoError(t, err)
+
+	x5c := me.Authority.Issue(t, &x509.Certificate{
+		Subject: pkix.Name{
+			Country:            []string{"US"},
+			Organization:       []string{"webauthntest"},
+			OrganizationalUnit: []string{"Authenticator Attestation"},
+			CommonName:         "webauthntest packed attestation",
+		},
+		BasicConstraintsValid: true,
+		ExtraExtensions:       []pkix.Extension{{Id: fidoAAGUIDOID, Value: aaguid}},
+	}, attKey.Public())
+
+	return map[string]interface{}{
+		"alg": int64(attKey.Algorithm),
+		"sig": attKey.Sign(t, signed),
+		"x5c": certificates(x5c),
+	}
+}
+
+// u2fStatement signs the registration response message of a U2F token,
+// 0x00 || rpIdHash || clientDataHash || credentialId || publicKeyU2F
+func (me *Authenticator) u2fStatement(t testing.TB, authData, clientDataHash []byte) map[string]interface{} {
+	attKey := NewKey(t, webauthncose.AlgES256)
+
+	x5c := me.Authority.Issue(t, &x509.Certificate{
+		Subject: pkix.Name{CommonName: "webauthntest u2f attestation"},
+	}, attKey.Public())
+
+	pub, ok := me.Key.Public().(*ecdsa.PublicKey)
+	require.True(t, ok, "webauthntest: fido-u2f credentials are ES256")
+
+	var message bytes.Buffer
+	message.WriteByte(0x00)
+	message.Write(authData[:32])
+	message.Write(clientDataHash)
+	message.Write(me.CredentialID)
+	message.WriteByte(0x04)
+	message.Write(pub.X.FillBytes(make([]byte, 32)))
+	message.Write(pub.Y.FillBytes(make([]byte, 32)))
+
+	return map[string]interface{}{
+		"sig": attKey.Sign(t, message.Bytes()),
+		"x5c": certificates(x5c[:1]),
+	}
+}
+
+// tpmStatement certifies the credential key with an attestation identity key, the way a TPM 2.0 does
+func (me *Authenticator) tpmStatement(t testing.TB, signed []byte) map[string]interface{} {
+	aik := NewKey(t, webauthncose.AlgES256)
+
+	pubArea := tpmPublicArea(t, me.Key)
+	certInfo := tpmCertifyInfo(pubArea, sha256Sum(signed))
+
+	// the subject of an aik certificate is empty, the TPM is named in the subject alternative name
+	dn, err := asn1.Marshal(pkix.RDNSequence{
+		{{Type: tcgAtTpmManufacturer, Value: "id:FFFFF1D0"}},
+		{{Type: tcgAtTpmModel, Value: "webauthntest"}},
+		{{Type: tcgAtTpmVersion, Value: "id:13"}},
+	})
+	require.NoError(t, err)
+
+	san, err := asn1.Marshal([]asn1.RawValue{{Class: asn1.ClassContextSpecific, Tag: 4, IsCompound: true, Bytes: dn}})
+	require.NoError(t, err)
+
+	x5c := me.Authority.Issue(t, &x509.Certificate{
+		BasicConstraintsValid: true,
+		UnknownExtKeyUsage:    []asn1.ObjectIdentifier{tcgKpAIKCertificate},
+		ExtraExtensions:       []pkix.Extension{{Id: subjectAltNameOID, Critical: true, Value: san}},
+	}, aik.Public())
+
+	return map[string]interface{}{
+		"ver":      "2.0",
+		"alg":      int64(aik.Algorithm),
+		"x5c":      certificates(x5c),
+		"sig":      aik.Sign(t, certInfo),
+		"certInfo": certInfo,
+		"pubArea":  pubArea,
+	}
+}
+
+// tpmPublicArea encodes the TPMT_PUBLIC of a signing key
+func tpmPublicArea(t testing.TB, key *Key) []byte {
+	var b bytes.Buffer
+
+	write := func(v interface{}) { require.NoError(t, binary.Write(&b, binary.BigEndian, v)) }
+	writeSized := func(v []byte) {
+		write(uint16(len(v)))
+		b.Write(v)
+	}
+
+	attributes := googletpm.FlagSign | googletpm.FlagFixedTPM | googletpm.FlagFixedParent |
+		googletpm.FlagSensitiveDataOrigin | googletpm.FlagUserWithAuth
+
+	switch pub := key.Public().(type) {
+	case *ecdsa.PublicKey:
+		write(googletpm.AlgECC)
+		write(googletpm.AlgSHA256)
+		write(attributes)
+		writeSized(nil)
+		write(googletpm.AlgNull) // symmetric
+		write(googletpm.AlgNull) // scheme
+		write(googletpm.CurveNISTP256)
+		write(googletpm.AlgNull) // kdf
+		writeSized(pub.X.FillBytes(make([]byte, 32)))
+		writeSized(pub.Y.FillBytes(make([]byte, 32)))
+	case *rsa.PublicKey:
+		write(googletpm.AlgRSA)
+		write(googletpm.AlgSHA256)
+		write(attributes)
+		writeSized(nil)
+		write(googletpm.AlgNull) // symmetric
+		write(googletpm.AlgNull) // scheme
+		write(uint16(pub.N.BitLen()))
+		write(uint32(0)) // the default exponent, 65537
+		writeSized(pub.N.Bytes())
+	default:
+		require.FailNowf(t, "webauthntest: tpm keys are ES256 or RS256", "%T", pub)
+	}
+
+	return b.Bytes()
+}
+
+// tpmCertifyInfo encodes the TPMS_ATTEST of a TPM2_Certify of pubArea, extraData being the hash of the
+// attested data
+func tpmCertifyInfo(pubArea, extraData []byte) []byte {
+	var b bytes.Buffer
+
+	write := func(v interface{}) { _ = binary.Write(&b, binary.BigEndian, v) }
+	writeSized := func(v []byte) {
+		write(uint16(len(v)))
+		b.Write(v)
+	}
+
+	name := sha256.Sum256(pubArea)
+
+	write(uint32(0xff544347)) // TPM_GENERATED_VALUE
+	write(googletpm.TagAttestCertify)
+	writeSized(nil) // qualifiedSigner
+	writeSized(extraData)
+	write(googletpm.ClockInfo{Clock: 1, Safe: 1})
+	write(uint64(0)) // firmwareVersion
+	writeSized(append([]byte{0x00, byte(googletpm.AlgSHA256)}, name[:]...))
+	writeSized(nil) // qualifiedName
+
+	return b.Bytes()
+}
+
+// appAttestStatement is the attestation of a secure enclave key, the credential certificate holds the key,
+// the nonce and the app id
+func (me *Authenticator) appAttestStatement(t testing.TB, signed []byte) map[string]interface{} {
+	nonce, err := asn1.Marshal(sha256Sum(signed))
+	require.NoError(t, err)
+
+	nonceExt, err := asn1.Marshal([]asn1.RawValue{{Class: asn1.ClassContextSpecific, Tag: 1, IsCompound: true, Bytes: nonce}})
+	require.NoError(t, err)
+
+	appID, err := asn1.Marshal([]byte(me.RPID))
+	require.NoError(t, err)
+
+	keyDescription, err := asn1.Marshal([]asn1.RawValue{{Class: asn1.ClassContextSpecific, Tag: 1204, IsCompound: true, Bytes: appID}})
+	require.NoError(t, err)
+
+	x5c := me.Authority.Issue(t, &x509.Certificate{
+		Subject: pkix.Name{CommonName: "webauthntest app attest"},
+		ExtraExtensions: []pkix.Extension{
+			{Id: appAttestNonceOID, Value: nonceExt},
+			{Id: appAttestKeyDescriptionOID, Value: keyDescription},
+		},
+	}, me.Key.Public())
+
+	return map[string]interface{}{
+		"x5c":     certificates(x5c),
+		"receipt": Receipt,
+	}
+}
+
+func certificates(x5c [][]byte) []interface{} {
+	certs := make([]interface{}, len(x5c))
+	for i, c := range x5c {
+		certs[i] = c
+	}
+	return certs
+}
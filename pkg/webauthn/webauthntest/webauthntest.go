@@ -0,0 +1,191 @@
+// Package webauthntest is a virtual authenticator for tests of code verifying webauthn ceremonies. It holds
+// credential keys and emits the authenticator data, client data and attestation objects of every supported
+// attestation format, and the matching assertions, with knobs for every flag and field.
+package webauthntest
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/webauthn/pkg/webauthn/webauthncbor"
+)
+
+// Key is a credential or attestation key
+type Key struct {
+	Algorithm webauthncose.COSEAlgorithmIdentifier
+	signer    crypto.Signer
+}
+
+// NewKey generates a key for ES256, RS256 or EdDSA
+func NewKey(t testing.TB, alg webauthncose.COSEAlgorithmIdentifier) *Key {
+	var (
+		signer crypto.Signer
+		err    error
+	)
+
+	switch alg {
+	case webauthncose.AlgES256:
+		signer, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case webauthncose.AlgRS256:
+		signer, err = rsa.GenerateKey(rand.Reader, 2048)
+	case webauthncose.AlgEdDSA:
+		_, signer, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		require.FailNowf(t, "webauthntest: unsupported algorithm", "%d", alg)
+	}
+	require.NoError(t, err)
+
+	return &Key{Algorithm: alg, signer: signer}
+}
+
+func (me *Key) Public() crypto.PublicKey {
+	return me.signer.Public()
+}
+
+// COSE returns the COSE_Key encoding of the public key, as it appears in the attested credential data
+func (me *Key) COSE(t testing.TB) []byte {
+	var key map[int]interface{}
+
+	switch pub := me.Public().(type) {
+	case *ecdsa.PublicKey:
+		key = map[int]interface{}{
+			1:  int64(webauthncose.EllipticKey),
+			3:  int64(me.Algorithm),
+			-1: int64(webauthncose.P256),
+			-2: pub.X.FillBytes(make([]byte, 32)),
+			-3: pub.Y.FillBytes(make([]byte, 32)),
+		}
+	case *rsa.PublicKey:
+		key = map[int]interface{}{
+			1:  int64(webauthncose.RSAKey),
+			3:  int64(me.Algorithm),
+			-1: pub.N.Bytes(),
+			-2: big.NewInt(int64(pub.E)).Bytes(),
+		}
+	case ed25519.PublicKey:
+		key = map[int]interface{}{
+			1:  int64(webauthncose.OctetKey),
+			3:  int64(me.Algorithm),
+			-1: int64(webauthncose.Ed25519),
+			-2: []byte(pub),
+		}
+	}
+
+	// the canonical encoding matters, authenticator data is parsed by re-encoding the key
+	raw, err := webauthncbor.Marshal(key)
+	require.NoError(t, err)
+
+	return raw
+}
+
+// Sign signs data the way an authenticator does for the key's algorithm: a DER encoded ECDSA signature over the
+// SHA-256 digest, a PKCS #1 v1.5 signature over the SHA-256 digest, or a plain ed25519 signature
+func (me *Key) Sign(t testing.TB, data []byte) []byte {
+	var (
+		sig []byte
+		err error
+	)
+
+	switch me.Algorithm {
+	case webauthncose.AlgEdDSA:
+		sig, err = me.signer.Sign(rand.Reader, data, crypto.Hash(0))
+	default:
+		digest := sha256.Sum256(data)
+		sig, err = me.signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	}
+	require.NoError(t, err)
+
+	return sig
+}
+
+// Authority is a root and an intermediate standing in for the certificate authority of an attestation format
+type Authority struct {
+	rootCert  *x509.Certificate
+	rootKey   *ecdsa.PrivateKey
+	interCert *x509.Certificate
+	interKey  *ecdsa.PrivateKey
+	serial    int64
+}
+
+func NewAuthority(t testing.TB) *Authority {
+	me := &Authority{}
+
+	me.rootKey = newECDSAKey(t)
+	me.rootCert = me.issue(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "webauthntest root"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, &me.rootKey.PublicKey, nil, me.rootKey)
+
+	me.interKey = newECDSAKey(t)
+	me.interCert = me.issue(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "webauthntest intermediate"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, &me.interKey.PublicKey, me.rootCert, me.rootKey)
+
+	return me
+}
+
+// Roots returns a pool holding the authority's root
+func (me *Authority) Roots() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(me.rootCert)
+	return pool
+}
+
+// RootPEM returns the PEM encoding of the authority's root, as accepted by the app attest provider
+func (me *Authority) RootPEM() string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: me.rootCert.Raw}))
+}
+
+// Issue signs a leaf certificate for pub with the intermediate and returns the DER encoded chain, leaf first,
+// without the root
+func (me *Authority) Issue(t testing.TB, tmpl *x509.Certificate, pub crypto.PublicKey) [][]byte {
+	leaf := me.issue(t, tmpl, pub, me.interCert, me.interKey)
+	return [][]byte{leaf.Raw, me.interCert.Raw}
+}
+
+func (me *Authority) issue(t testing.TB, tmpl *x509.Certificate, pub crypto.PublicKey, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) *x509.Certificate {
+	me.serial++
+	tmpl.SerialNumber = big.NewInt(me.serial)
+	if tmpl.NotBefore.IsZero() {
+		tmpl.NotBefore = time.Now().Add(-time.Hour)
+	}
+	if tmpl.NotAfter.IsZero() {
+		tmpl.NotAfter = tmpl.NotBefore.Add(10 * 365 * 24 * time.Hour)
+	}
+
+	if parent == nil {
+		parent = tmpl
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, pub, parentKey)
+	require.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return cert
+}
+
+func newECDSAKey(t testing.TB) *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	return key
+}
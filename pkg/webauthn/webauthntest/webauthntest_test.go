@@ -0,0 +1,317 @@
+package webauthntest_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/webauthn/pkg/hex"
+	"github.com/walteh/webauthn/pkg/webauthn/assertion"
+	"github.com/walteh/webauthn/pkg/webauthn/clientdata"
+	"github.com/walteh/webauthn/pkg/webauthn/credential"
+	"github.com/walteh/webauthn/pkg/webauthn/extensions"
+	"github.com/walteh/webauthn/pkg/webauthn/providers"
+	"github.com/walteh/webauthn/pkg/webauthn/types"
+	"github.com/walteh/webauthn/pkg/webauthn/webauthntest"
+)
+
+var challenge = hex.HexToHash("0x1dd5d0ab4a2e1b06b4a7d7f2c3e4b9a1e8ee2b1cfb5a3c0a9d4a3bc2e5f60718")
+
+func counter(v uint32) *uint32 {
+	return &v
+}
+
+// attest verifies an attestation with the provider of the authenticator's format
+func attest(ctx context.Context, t *testing.T, a *webauthntest.Authenticator, input types.AttestationInput, verifyUser bool) (hex.Hash, error) {
+	switch a.Format {
+	case webauthntest.FormatNone, webauthntest.FormatAppleAppAttest:
+		var prov types.AttestationProvider = providers.NewNoneAttestationProvider()
+		if a.Format == webauthntest.FormatAppleAppAttest {
+			prov = providers.NewAppAttestSandbox().WithRootCert(a.Authority.RootPEM()).WithAppIDs(webauthntest.AppID)
+		}
+
+		cred, err := credential.VerifyAttestationInput(ctx, types.VerifyAttestationInputArgs{
+			Provider:           prov,
+			Input:              input,
+			StoredChallenge:    challenge,
+			VerifyUser:         verifyUser,
+			RelyingPartyID:     a.RPID,
+			RelyingPartyOrigin: a.Origin,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return cred.PublicKey, nil
+	}
+
+	att, err := credential.ParseAttestationInput(ctx, input)
+	require.NoError(t, err)
+
+	clientDataHash := sha256.Sum256([]byte(input.UTF8ClientDataJSON))
+
+	var pk hex.Hash
+	switch a.Format {
+	case webauthntest.FormatPacked, webauthntest.FormatPackedSelf:
+		pk, _, _, err = providers.NewPackedAttestationProvider().Attest(*att, clientDataHash[:])
+	case webauthntest.FormatFIDOU2F:
+		pk, _, _, err = providers.NewU2FAttestationProvider().Handler(*att, clientDataHash[:])
+	case webauthntest.FormatTPM:
+		pk, _, _, err = providers.NewTpmAttestationProvider().Handler(*att, clientDataHash[:])
+	}
+	return pk, err
+}
+
+func TestAttest(t *testing.T) {
+	tests := []struct {
+		name       string
+		format     webauthntest.Format
+		alg        webauthncose.COSEAlgorithmIdentifier
+		opts       webauthntest.Options
+		verifyUser bool
+		edit       func(*webauthntest.Authenticator)
+		wantErr    error
+		wantErrMsg string
+	}{
+		{name: "none ES256", format: webauthntest.FormatNone, alg: webauthncose.AlgES256},
+		{name: "none RS256", format: webauthntest.FormatNone, alg: webauthncose.AlgRS256},
+		{name: "none EdDSA", format: webauthntest.FormatNone, alg: webauthncose.AlgEdDSA},
+		{name: "packed self ES256", format: webauthntest.FormatPackedSelf, alg: webauthncose.AlgES256},
+		{name: "packed self RS256", format: webauthntest.FormatPackedSelf, alg: webauthncose.AlgRS256},
+		{name: "packed self EdDSA", format: webauthntest.FormatPackedSelf, alg: webauthncose.AlgEdDSA},
+		{name: "packed x5c ES256", format: webauthntest.FormatPacked, alg: webauthncose.AlgES256},
+		{name: "packed x5c RS256", format: webauthntest.FormatPacked, alg: webauthncose.AlgRS256},
+		{name: "fido-u2f", format: webauthntest.FormatFIDOU2F, alg: webauthncose.AlgES256},
+		{name: "tpm ES256", format: webauthntest.FormatTPM, alg: webauthncose.AlgES256},
+		{name: "tpm RS256", format: webauthntest.FormatTPM, alg: webauthncose.AlgRS256},
+		{name: "apple app attest", format: webauthntest.FormatAppleAppAttest, alg: webauthncose.AlgES256},
+		{
+			name:   "unknown extensions",
+			format: webauthntest.FormatPackedSelf,
+			alg:    webauthncose.AlgES256,
+			opts:   webauthntest.Options{Extensions: map[string]interface{}{"nuggUnknown": "abc"}},
+		},
+		{
+			name:       "user not verified",
+			format:     webauthntest.FormatNone,
+			alg:        webauthncose.AlgES256,
+			opts:       webauthntest.Options{UserNotVerified: true},
+			verifyUser: true,
+			wantErrMsg: "user verification required",
+		},
+		{
+			name:    "other origin",
+			format:  webauthntest.FormatNone,
+			alg:     webauthncose.AlgES256,
+			opts:    webauthntest.Options{Origin: "https://evil.xyz"},
+			wantErr: clientdata.ErrOriginMismatch,
+		},
+		{
+			name:    "assertion client data",
+			format:  webauthntest.FormatNone,
+			alg:     webauthncose.AlgES256,
+			opts:    webauthntest.Options{Type: types.AssertCeremony},
+			wantErr: clientdata.ErrInvalidCeremonyType,
+		},
+		{
+			name:       "other relying party",
+			format:     webauthntest.FormatNone,
+			alg:        webauthncose.AlgES256,
+			opts:       webauthntest.Options{RPID: "evil.xyz"},
+			wantErrMsg: "rp hash mismatch",
+		},
+		{
+			name:    "packed signature of other data",
+			format:  webauthntest.FormatPackedSelf,
+			alg:     webauthncose.AlgES256,
+			opts:    webauthntest.Options{SignedData: []byte("other")},
+			wantErr: providers.ErrPacked,
+		},
+		{
+			name:    "packed malformed signature",
+			format:  webauthntest.FormatPacked,
+			alg:     webauthncose.AlgES256,
+			opts:    webauthntest.Options{EditAttStmt: func(s map[string]interface{}) { s["sig"] = []byte{0x30, 0x00} }},
+			wantErr: providers.ErrPacked,
+		},
+		{
+			name:    "fido-u2f with aaguid",
+			format:  webauthntest.FormatFIDOU2F,
+			alg:     webauthncose.AlgES256,
+			edit:    func(a *webauthntest.Authenticator) { a.AAGUID = webauthntest.AAGUID },
+			wantErr: providers.ErrU2F,
+		},
+		{
+			name:    "tpm statement of other version",
+			format:  webauthntest.FormatTPM,
+			alg:     webauthncose.AlgES256,
+			opts:    webauthntest.Options{EditAttStmt: func(s map[string]interface{}) { s["ver"] = "1.2" }},
+			wantErr: providers.ErrTPM,
+		},
+		{
+			name:    "app attest counter not zero",
+			format:  webauthntest.FormatAppleAppAttest,
+			alg:     webauthncose.AlgES256,
+			opts:    webauthntest.Options{Counter: counter(1)},
+			wantErr: providers.ErrAppleAppAttest,
+		},
+		{
+			name:    "app attest of other app",
+			format:  webauthntest.FormatAppleAppAttest,
+			alg:     webauthncose.AlgES256,
+			edit:    func(a *webauthntest.Authenticator) { a.RPID = "4497QJSAD3.xyz.nugg.other" },
+			wantErr: providers.ErrAppleAppAttest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := zerolog.New(zerolog.NewConsoleWriter()).With().Caller().Logger().WithContext(context.Background())
+
+			a := webauthntest.NewAuthenticator(t, tt.format, tt.alg)
+			if tt.edit != nil {
+				tt.edit(a)
+			}
+
+			input := a.Attest(t, challenge, tt.opts)
+
+			pk, err := attest(ctx, t, a, input, tt.verifyUser)
+			switch {
+			case tt.wantErr != nil:
+				require.ErrorIs(t, err, tt.wantErr)
+			case tt.wantErrMsg != "":
+				require.ErrorContains(t, err, tt.wantErrMsg)
+			default:
+				require.NoError(t, err)
+				if tt.format != webauthntest.FormatPacked {
+					// basic packed attestations do not return the credential key
+					assert.Equal(t, a.CredentialPublicKey(t), pk)
+				}
+			}
+		})
+	}
+}
+
+func TestAssert(t *testing.T) {
+	tests := []struct {
+		name       string
+		format     webauthntest.Format
+		alg        webauthncose.COSEAlgorithmIdentifier
+		stored     uint32
+		opts       webauthntest.Options
+		verifyUser bool
+		wantErr    error
+		wantErrMsg string
+	}{
+		{name: "ES256", format: webauthntest.FormatNone, alg: webauthncose.AlgES256},
+		{name: "RS256", format: webauthntest.FormatNone, alg: webauthncose.AlgRS256},
+		{name: "EdDSA", format: webauthntest.FormatNone, alg: webauthncose.AlgEdDSA},
+		{name: "fido-u2f", format: webauthntest.FormatFIDOU2F, alg: webauthncose.AlgES256},
+		{name: "tpm", format: webauthntest.FormatTPM, alg: webauthncose.AlgRS256},
+		{name: "apple app attest", format: webauthntest.FormatAppleAppAttest, alg: webauthncose.AlgES256},
+		{
+			name:   "without counter",
+			format: webauthntest.FormatNone,
+			alg:    webauthncose.AlgES256,
+			opts:   webauthntest.Options{Counter: counter(0)},
+		},
+		{
+			name:    "counter regression",
+			format:  webauthntest.FormatNone,
+			alg:     webauthncose.AlgES256,
+			stored:  5,
+			opts:    webauthntest.Options{Counter: counter(3)},
+			wantErr: providers.ErrAssertionCounter,
+		},
+		{
+			name:    "app attest counter replayed",
+			format:  webauthntest.FormatAppleAppAttest,
+			alg:     webauthncose.AlgES256,
+			stored:  1,
+			opts:    webauthntest.Options{Counter: counter(1)},
+			wantErr: providers.ErrAssertionCounter,
+		},
+		{
+			name:   "unknown extensions",
+			format: webauthntest.FormatNone,
+			alg:    webauthncose.AlgES256,
+			opts:   webauthntest.Options{Extensions: map[string]interface{}{"nuggUnknown": 1}},
+		},
+		{
+			name:       "user verification not required",
+			format:     webauthntest.FormatNone,
+			alg:        webauthncose.AlgES256,
+			opts:       webauthntest.Options{UserNotVerified: true, UserNotPresent: true},
+			verifyUser: false,
+		},
+		{
+			name:       "user not verified",
+			format:     webauthntest.FormatNone,
+			alg:        webauthncose.AlgES256,
+			opts:       webauthntest.Options{UserNotVerified: true},
+			verifyUser: true,
+			wantErrMsg: "user verification required",
+		},
+		{
+			name:    "signature of other data",
+			format:  webauthntest.FormatNone,
+			alg:     webauthncose.AlgEdDSA,
+			opts:    webauthntest.Options{SignedData: []byte("other")},
+			wantErr: providers.ErrAssertionSignature,
+		},
+		{
+			name:    "attestation client data",
+			format:  webauthntest.FormatNone,
+			alg:     webauthncose.AlgES256,
+			opts:    webauthntest.Options{Type: types.CreateCeremony},
+			wantErr: clientdata.ErrInvalidCeremonyType,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := zerolog.New(zerolog.NewConsoleWriter()).With().Caller().Logger().WithContext(context.Background())
+
+			a := webauthntest.NewAuthenticator(t, tt.format, tt.alg)
+
+			pk, err := attest(ctx, t, a, a.Attest(t, challenge, webauthntest.Options{}), false)
+			require.NoError(t, err)
+			if pk.IsZero() {
+				pk = a.CredentialPublicKey(t)
+			}
+
+			a.Counter = tt.stored
+
+			input := a.Assert(t, challenge, tt.opts)
+
+			var prov types.AttestationProvider = providers.NewNoneAttestationProvider()
+			if tt.format == webauthntest.FormatAppleAppAttest {
+				prov = providers.NewAppAttestSandbox()
+			}
+
+			err = assertion.VerifyAssertionInput(ctx, types.VerifyAssertionInputArgs{
+				Input:                     input,
+				StoredChallenge:           challenge,
+				CredentialAttestationType: types.NotFidoAttestationType,
+				AttestationProvider:       prov,
+				VerifyUser:                tt.verifyUser,
+				AAGUID:                    a.AAGUID,
+				CredentialPublicKey:       pk,
+				Extensions:                extensions.ClientInputs{},
+				LastSignCount:             uint64(tt.stored),
+				RelyingPartyID:            a.RPID,
+				RelyingPartyOrigin:        a.Origin,
+				DataSignedByClient:        hex.Hash(input.RawClientDataJSON),
+			})
+			switch {
+			case tt.wantErr != nil:
+				require.ErrorIs(t, err, tt.wantErr)
+			case tt.wantErrMsg != "":
+				require.ErrorContains(t, err, tt.wantErrMsg)
+			default:
+				require.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package webauthnerr
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+const ProblemContentType = "application/problem+json"
+
+// ProblemTypeBase prefixes the code to form the type uri of a problem
+const ProblemTypeBase = "urn:webauthn:error:"
+
+// Problem is an RFC 7807 problem details document. Code and Step are extension members, Detail is the safe
+// message of the error; its details and wrapped error never leave the server.
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	Code     Code   `json:"code"`
+	Step     Step   `json:"step,omitempty"`
+}
+
+// NewProblem describes err to a client, instance identifies the request and may be empty
+func NewProblem(err error, instance string) Problem {
+	code := CodeOf(err)
+	if code == "" {
+		code = CodeInternal
+	}
+
+	p := Problem{
+		Type:     ProblemTypeBase + string(code),
+		Title:    code.Title(),
+		Status:   code.HTTPStatus(),
+		Instance: instance,
+		Code:     code,
+	}
+
+	var werr *Error
+	if errors.As(err, &werr) {
+		p.Step = werr.Step
+		if werr.Message != "" {
+			p.Detail = werr.Message
+		}
+	}
+
+	return p
+}
+
+// MarshalProblem returns the problem+json body describing err
+func MarshalProblem(err error, instance string) ([]byte, error) {
+	return json.Marshal(NewProblem(err, instance))
+}
+
+// WriteProblem answers an http request with the problem+json document describing err
+func WriteProblem(w http.ResponseWriter, r *http.Request, err error) {
+	p := NewProblem(err, r.URL.Path)
+
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.WriteHeader(p.Status)
+	_ = json.NewEncoder(w).Encode(p)
+}
@@ -0,0 +1,241 @@
+// Package webauthnerr is the error type every flow reports failures with. An *Error carries a stable
+// code clients can branch on, the step of the WebAuthn verification procedure that failed, a message that
+// is safe to show to the client and details that are only ever logged.
+package webauthnerr
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Code is the stable, snake_case name of a failure, it is sent to clients and never changes meaning
+type Code string
+
+const (
+	CodeInternal Code = "internal"
+
+	CodeInvalidInput          Code = "invalid_input"
+	CodeMalformedClientData   Code = "malformed_client_data"
+	CodeMalformedAttestation  Code = "malformed_attestation"
+	CodeMalformedAssertion    Code = "malformed_assertion"
+	CodeUnsupportedCredential Code = "unsupported_credential"
+
+	CodeCeremonyTypeMismatch Code = "ceremony_type_mismatch"
+	CodeChallengeMismatch    Code = "challenge_mismatch"
+	CodeOriginMismatch       Code = "origin_mismatch"
+	CodeTokenBindingInvalid  Code = "token_binding_invalid"
+	CodeRPIDMismatch         Code = "rp_id_mismatch"
+	CodeUserNotPresent       Code = "user_not_present"
+	CodeUserNotVerified      Code = "user_not_verified"
+	CodeAttestationInvalid   Code = "attestation_invalid"
+	CodeSignatureInvalid     Code = "signature_invalid"
+	CodeCounterRegression    Code = "counter_regression"
+	CodeCredentialMismatch   Code = "credential_mismatch"
+	CodeSessionMismatch      Code = "session_mismatch"
+	CodeAppIDMismatch        Code = "app_id_mismatch"
+
+	CodeAccessTokenInvalid Code = "access_token_invalid"
+
+	CodeCredentialNotFound  Code = "credential_not_found"
+	CodeUnknownRelyingParty Code = "unknown_relying_party"
+	CodeCredentialNotOwned  Code = "credential_not_owned"
+
+	CodeRateLimited Code = "rate_limited"
+	CodeLockedOut   Code = "locked_out"
+
+	CodeStorageUnavailable Code = "storage_unavailable"
+	CodeTokenIssuance      Code = "token_issuance_failed"
+)
+
+// grpc status codes, numbered as in google.golang.org/grpc/codes and connectrpc.com/connect
+const (
+	grpcInvalidArgument   uint32 = 3
+	grpcNotFound          uint32 = 5
+	grpcPermissionDenied  uint32 = 7
+	grpcResourceExhausted uint32 = 8
+	grpcInternal          uint32 = 13
+	grpcUnavailable       uint32 = 14
+	grpcUnauthenticated   uint32 = 16
+)
+
+type definition struct {
+	status int
+	grpc   uint32
+	title  string
+}
+
+var definitions = map[Code]definition{
+	CodeInternal: {http.StatusInternalServerError, grpcInternal, "internal error"},
+
+	CodeInvalidInput:          {http.StatusBadRequest, grpcInvalidArgument, "the request is missing required fields"},
+	CodeMalformedClientData:   {http.StatusBadRequest, grpcInvalidArgument, "the client data could not be decoded"},
+	CodeMalformedAttestation:  {http.StatusBadRequest, grpcInvalidArgument, "the attestation object could not be decoded"},
+	CodeMalformedAssertion:    {http.StatusBadRequest, grpcInvalidArgument, "the assertion could not be decoded"},
+	CodeUnsupportedCredential: {http.StatusBadRequest, grpcInvalidArgument, "the credential type is not supported"},
+
+	CodeCeremonyTypeMismatch: {http.StatusUnauthorized, grpcUnauthenticated, "the client data is for another ceremony"},
+	CodeChallengeMismatch:    {http.StatusUnauthorized, grpcUnauthenticated, "the challenge does not match the ceremony"},
+	CodeOriginMismatch:       {http.StatusUnauthorized, grpcUnauthenticated, "the origin is not allowed"},
+	CodeTokenBindingInvalid:  {http.StatusUnauthorized, grpcUnauthenticated, "the token binding is invalid"},
+	CodeRPIDMismatch:         {http.StatusUnauthorized, grpcUnauthenticated, "the credential is scoped to another relying party"},
+	CodeUserNotPresent:       {http.StatusUnauthorized, grpcUnauthenticated, "the user was not present"},
+	CodeUserNotVerified:      {http.StatusUnauthorized, grpcUnauthenticated, "the user was not verified"},
+	CodeAttestationInvalid:   {http.StatusUnauthorized, grpcUnauthenticated, "the attestation could not be verified"},
+	CodeSignatureInvalid:     {http.StatusUnauthorized, grpcUnauthenticated, "the signature could not be verified"},
+	CodeCounterRegression:    {http.StatusUnauthorized, grpcUnauthenticated, "the signature counter did not increase"},
+	CodeCredentialMismatch:   {http.StatusUnauthorized, grpcUnauthenticated, "the credential does not match the ceremony"},
+	CodeSessionMismatch:      {http.StatusUnauthorized, grpcUnauthenticated, "the session does not match the ceremony"},
+	CodeAppIDMismatch:        {http.StatusUnauthorized, grpcUnauthenticated, "the app is not allowed"},
+
+	CodeAccessTokenInvalid: {http.StatusUnauthorized, grpcUnauthenticated, "the access token could not be verified"},
+
+	CodeCredentialNotFound:  {http.StatusNotFound, grpcNotFound, "the credential does not exist"},
+	CodeUnknownRelyingParty: {http.StatusNotFound, grpcNotFound, "the relying party is not served here"},
+	CodeCredentialNotOwned:  {http.StatusForbidden, grpcPermissionDenied, "the credential belongs to another session"},
+
+	CodeRateLimited: {http.StatusTooManyRequests, grpcResourceExhausted, "too many requests, try again later"},
+	CodeLockedOut:   {http.StatusTooManyRequests, grpcResourceExhausted, "too many failed attempts, the credential is locked"},
+
+	CodeStorageUnavailable: {http.StatusBadGateway, grpcUnavailable, "the credential store is unavailable"},
+	CodeTokenIssuance:      {http.StatusBadGateway, grpcUnavailable, "the access token could not be issued"},
+}
+
+func (me Code) definition() definition {
+	if def, ok := definitions[me]; ok {
+		return def
+	}
+	return definitions[CodeInternal]
+}
+
+// HTTPStatus returns the http status code failures with the code are answered with
+func (me Code) HTTPStatus() int {
+	return me.definition().status
+}
+
+// GRPCCode returns the grpc status code failures with the code are answered with
+func (me Code) GRPCCode() uint32 {
+	return me.definition().grpc
+}
+
+// Title returns the default client message of the code
+func (me Code) Title() string {
+	return me.definition().title
+}
+
+// Step names the step of the verification procedures that failed, "7.1.5" is step 5 of §7.1 Registering a
+// New Credential and "7.2.9" step 9 of §7.2 Verifying an Authentication Assertion
+// (https://www.w3.org/TR/webauthn/#sctn-rp-operations)
+type Step string
+
+func RegistrationStep(n int) Step {
+	return Step(fmt.Sprintf("7.1.%d", n))
+}
+
+func AuthenticationStep(n int) Step {
+	return Step(fmt.Sprintf("7.2.%d", n))
+}
+
+// Error is a failure of a flow. Err is the sentinel it wraps, so errors.Is keeps matching the package
+// errors; Message is shown to clients, Details and Err are not.
+type Error struct {
+	Code    Code
+	Step    Step
+	Message string
+	Details string
+	Err     error
+}
+
+// New returns an error with the code wrapping err, which may be nil
+func New(code Code, err error) *Error {
+	return &Error{Code: code, Err: err}
+}
+
+// Wrap returns the *Error err already is or wraps, or else wraps err in a new one with the code. Lower
+// layers know better what failed, so their code and step win over the one of the caller.
+func Wrap(err error, code Code) *Error {
+	var werr *Error
+	if errors.As(err, &werr) {
+		return werr
+	}
+	return New(code, err)
+}
+
+func (me *Error) WithStep(step Step) *Error {
+	me.Step = step
+	return me
+}
+
+func (me *Error) WithMessage(message string) *Error {
+	me.Message = message
+	return me
+}
+
+func (me *Error) WithDetails(format string, args ...interface{}) *Error {
+	me.Details = fmt.Sprintf(format, args...)
+	return me
+}
+
+func (me *Error) Error() string {
+	var sb strings.Builder
+	sb.WriteString(string(me.Code))
+	if me.Step != "" {
+		sb.WriteString(" (step " + string(me.Step) + ")")
+	}
+	if me.Err != nil {
+		sb.WriteString(": " + me.Err.Error())
+	}
+	if me.Details != "" {
+		sb.WriteString(": " + me.Details)
+	}
+	return sb.String()
+}
+
+func (me *Error) Unwrap() error {
+	return me.Err
+}
+
+// Is matches any *Error with the same code, so errors.Is(err, webauthnerr.New(code, nil)) tests for a code
+func (me *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == me.Code
+}
+
+// SafeMessage returns the message the client may see
+func (me *Error) SafeMessage() string {
+	if me.Message != "" {
+		return me.Message
+	}
+	return me.Code.Title()
+}
+
+// CodeOf returns the code of err, CodeInternal when err is not an *Error and "" when it is nil
+func CodeOf(err error) Code {
+	if err == nil {
+		return ""
+	}
+
+	var werr *Error
+	if errors.As(err, &werr) {
+		return werr.Code
+	}
+
+	return CodeInternal
+}
+
+// HTTPStatus returns the http status code err is answered with
+func HTTPStatus(err error) int {
+	if err == nil {
+		return http.StatusOK
+	}
+	return CodeOf(err).HTTPStatus()
+}
+
+// GRPCCode returns the grpc status code err is answered with
+func GRPCCode(err error) uint32 {
+	if err == nil {
+		return 0
+	}
+	return CodeOf(err).GRPCCode()
+}
@@ -0,0 +1,101 @@
+package webauthnerr_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/webauthn/pkg/webauthnerr"
+)
+
+var errSentinel = errors.New("ErrSentinel")
+
+func TestError(t *testing.T) {
+	err := webauthnerr.New(webauthnerr.CodeOriginMismatch, errSentinel).
+		WithStep(webauthnerr.AuthenticationStep(9)).
+		WithDetails("expected %s got %s", "https://nugg.xyz", "https://evil.xyz")
+
+	assert.Equal(t, "origin_mismatch (step 7.2.9): ErrSentinel: expected https://nugg.xyz got https://evil.xyz", err.Error())
+	assert.ErrorIs(t, err, errSentinel)
+	assert.ErrorIs(t, err, webauthnerr.New(webauthnerr.CodeOriginMismatch, nil))
+	assert.NotErrorIs(t, err, webauthnerr.New(webauthnerr.CodeChallengeMismatch, nil))
+
+	assert.Equal(t, "the origin is not allowed", err.SafeMessage())
+	assert.Equal(t, "use the app", err.WithMessage("use the app").SafeMessage())
+
+	wrapped := fmt.Errorf("finishing: %w", err)
+	assert.Equal(t, webauthnerr.CodeOriginMismatch, webauthnerr.CodeOf(wrapped))
+	assert.Same(t, err, webauthnerr.Wrap(wrapped, webauthnerr.CodeSignatureInvalid), "the code of the lower layer wins")
+
+	other := webauthnerr.Wrap(errSentinel, webauthnerr.CodeSignatureInvalid)
+	assert.Equal(t, webauthnerr.CodeSignatureInvalid, other.Code)
+	assert.ErrorIs(t, other, errSentinel)
+}
+
+func TestStatus(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantCode   webauthnerr.Code
+		wantStatus int
+		wantGRPC   uint32
+	}{
+		{"nil", nil, "", 200, 0},
+		{"plain error", errSentinel, webauthnerr.CodeInternal, 500, 13},
+		{"invalid input", webauthnerr.New(webauthnerr.CodeInvalidInput, nil), webauthnerr.CodeInvalidInput, 400, 3},
+		{"verification", webauthnerr.New(webauthnerr.CodeCounterRegression, nil), webauthnerr.CodeCounterRegression, 401, 16},
+		{"not found", webauthnerr.New(webauthnerr.CodeCredentialNotFound, nil), webauthnerr.CodeCredentialNotFound, 404, 5},
+		{"not owned", webauthnerr.New(webauthnerr.CodeCredentialNotOwned, nil), webauthnerr.CodeCredentialNotOwned, 403, 7},
+		{"unknown relying party", webauthnerr.New(webauthnerr.CodeUnknownRelyingParty, nil), webauthnerr.CodeUnknownRelyingParty, 404, 5},
+		{"rate limited", webauthnerr.New(webauthnerr.CodeRateLimited, nil), webauthnerr.CodeRateLimited, 429, 8},
+		{"locked out", webauthnerr.New(webauthnerr.CodeLockedOut, nil), webauthnerr.CodeLockedOut, 429, 8},
+		{"storage", webauthnerr.New(webauthnerr.CodeStorageUnavailable, nil), webauthnerr.CodeStorageUnavailable, 502, 14},
+		{"unknown code", webauthnerr.New("other", nil), "other", 500, 13},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.wantCode, webauthnerr.CodeOf(tt.err))
+			assert.Equal(t, tt.wantStatus, webauthnerr.HTTPStatus(tt.err))
+			assert.Equal(t, tt.wantGRPC, webauthnerr.GRPCCode(tt.err))
+		})
+	}
+}
+
+func TestProblem(t *testing.T) {
+	err := webauthnerr.New(webauthnerr.CodeChallengeMismatch, errSentinel).
+		WithStep(webauthnerr.RegistrationStep(4)).
+		WithDetails("stored 0x01")
+
+	rec := httptest.NewRecorder()
+	webauthnerr.WriteProblem(rec, httptest.NewRequest(http.MethodPost, "/auth/apple/passkey/register", nil), err)
+
+	assert.Equal(t, 401, rec.Code)
+	assert.Equal(t, webauthnerr.ProblemContentType, rec.Header().Get("Content-Type"))
+	assert.NotContains(t, rec.Body.String(), "ErrSentinel")
+	assert.NotContains(t, rec.Body.String(), "stored 0x01")
+
+	var got webauthnerr.Problem
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+	assert.Equal(t, webauthnerr.Problem{
+		Type:     "urn:webauthn:error:challenge_mismatch",
+		Title:    "the challenge does not match the ceremony",
+		Status:   401,
+		Instance: "/auth/apple/passkey/register",
+		Code:     webauthnerr.CodeChallengeMismatch,
+		Step:     "7.1.4",
+	}, got)
+
+	assert.Equal(t, webauthnerr.Problem{
+		Type:   "urn:webauthn:error:internal",
+		Title:  "internal error",
+		Status: 500,
+		Code:   webauthnerr.CodeInternal,
+	}, webauthnerr.NewProblem(errSentinel, ""))
+
+	assert.Equal(t, "use the app", webauthnerr.NewProblem(err.WithMessage("use the app"), "").Detail)
+}
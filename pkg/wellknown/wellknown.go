@@ -0,0 +1,199 @@
+// Package wellknown generates the association files that let native apps and related web origins use the
+// passkeys of a relying party: the related origins of /.well-known/webauthn, the webcredentials of
+// /.well-known/apple-app-site-association and the get_login_creds statements of /.well-known/assetlinks.json.
+// They are built from the same tenant configuration as its origin.Matcher, so every origin, app id and apk
+// certificate a tenant publishes is one its ceremonies are accepted from, and the other way around. Wildcard
+// and dev port origins can not be listed, a Registry refuses them unless the tenant opts in with
+// Tenant.WithUnpublishedOrigins; Unpublished returns what such a tenant accepts without publishing.
+package wellknown
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/walteh/webauthn/pkg/relyingparty"
+	"github.com/walteh/webauthn/pkg/webauthn/origin"
+	"github.com/walteh/webauthn/pkg/webauthnerr"
+)
+
+const (
+	WebAuthnPath                = "/.well-known/webauthn"
+	AppleAppSiteAssociationPath = "/.well-known/apple-app-site-association"
+	AssetLinksPath              = "/.well-known/assetlinks.json"
+)
+
+// ContentType is the content type of every document, apple and google both require json
+const ContentType = "application/json"
+
+// GetLoginCreds is the asset links relation letting an Android app use the credentials of a site
+const GetLoginCreds = "delegate_permission/common.get_login_creds"
+
+// RelatedOrigins is the /.well-known/webauthn document of a Related Origin Request
+// (https://www.w3.org/TR/webauthn-3/#sctn-related-origins)
+type RelatedOrigins struct {
+	Origins []string `json:"origins"`
+}
+
+// AppleAppSiteAssociation is the apple-app-site-association document, only its webcredentials service
+type AppleAppSiteAssociation struct {
+	WebCredentials WebCredentials `json:"webcredentials"`
+}
+
+type WebCredentials struct {
+	Apps []string `json:"apps"`
+}
+
+// Statement is one statement of an assetlinks.json document
+type Statement struct {
+	Relation []string `json:"relation"`
+	Target   Target   `json:"target"`
+}
+
+type Target struct {
+	Namespace              string   `json:"namespace"`
+	PackageName            string   `json:"package_name"`
+	SHA256CertFingerprints []string `json:"sha256_cert_fingerprints"`
+}
+
+// RelatedOriginsOf returns the web origins of the tenant, leaving out the Unpublished ones
+func RelatedOriginsOf(t *relyingparty.Tenant) RelatedOrigins {
+	unpublished := Unpublished(t)
+
+	res := RelatedOrigins{Origins: []string{}}
+	for _, o := range t.Origins() {
+		if strings.HasPrefix(o, origin.APKKeyHashPrefix) || contains(unpublished, o) {
+			continue
+		}
+		res.Origins = append(res.Origins, o)
+	}
+	return res
+}
+
+// Unpublished returns the origins the tenant accepts that no document lists, for a Registry tenant empty
+// unless it was built WithUnpublishedOrigins
+func Unpublished(t *relyingparty.Tenant) []string {
+	return t.UnpublishedOrigins()
+}
+
+// AppleAppSiteAssociationOf returns the apple app ids of the tenant's policy
+func AppleAppSiteAssociationOf(t *relyingparty.Tenant) AppleAppSiteAssociation {
+	return AppleAppSiteAssociation{WebCredentials: WebCredentials{Apps: append([]string{}, t.Policy().AppIDs...)}}
+}
+
+// AssetLinksOf returns a statement for every android package name of the tenant's policy, each signed with
+// any of its apk certificates. Without certificates there is nothing an app could be verified with.
+func AssetLinksOf(t *relyingparty.Tenant) ([]Statement, error) {
+	fingerprints := []string{}
+	for _, fp := range t.Policy().APKCertificateFingerprints {
+		raw, err := origin.ParseFingerprint(fp)
+		if err != nil {
+			return nil, err
+		}
+		fingerprints = append(fingerprints, formatFingerprint(raw))
+	}
+
+	res := []Statement{}
+	if len(fingerprints) == 0 {
+		return res, nil
+	}
+
+	for _, id := range t.PackageNames() {
+		res = append(res, Statement{
+			Relation: []string{GetLoginCreds},
+			Target: Target{
+				Namespace:              "android_app",
+				PackageName:            id,
+				SHA256CertFingerprints: fingerprints,
+			},
+		})
+	}
+
+	return res, nil
+}
+
+// Document returns the json served at path for the tenant, false when path is not one of this package
+func Document(t *relyingparty.Tenant, path string) ([]byte, bool, error) {
+	var doc interface{}
+
+	switch strings.TrimSuffix(path, "/") {
+	case WebAuthnPath:
+		doc = RelatedOriginsOf(t)
+	case AppleAppSiteAssociationPath:
+		doc = AppleAppSiteAssociationOf(t)
+	case AssetLinksPath:
+		links, err := AssetLinksOf(t)
+		if err != nil {
+			return nil, true, err
+		}
+		doc = links
+	default:
+		return nil, false, nil
+	}
+
+	body, err := json.Marshal(doc)
+	if err != nil {
+		return nil, true, err
+	}
+
+	return body, true, nil
+}
+
+// Handler serves the documents of the tenant a request is for. Multi tenant servers put their registry on
+// the request context with relyingparty.WithResolver, the tenant is then picked by the Host of the request.
+type Handler struct {
+	rp relyingparty.Provider
+}
+
+var _ http.Handler = (*Handler)(nil)
+
+func NewHandler(rp relyingparty.Provider) *Handler {
+	return &Handler{rp: rp}
+}
+
+func (me *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	hint := relyingparty.HintOf(ctx)
+	if hint.Host == "" {
+		hint.Host = r.Host
+		ctx = relyingparty.WithHint(ctx, hint)
+	}
+
+	tenant, err := relyingparty.Resolve(ctx, me.rp, nil)
+	if err != nil {
+		webauthnerr.WriteProblem(w, r, err)
+		return
+	}
+
+	body, ok, err := Document(tenant, r.URL.Path)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		webauthnerr.WriteProblem(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", ContentType)
+	_, _ = w.Write(body)
+}
+
+func contains(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+func formatFingerprint(raw []byte) string {
+	parts := make([]string, len(raw))
+	for i, b := range raw {
+		parts[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(parts, ":")
+}
@@ -0,0 +1,128 @@
+package wellknown_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/webauthn/gen/mockery"
+	"github.com/walteh/webauthn/pkg/relyingparty"
+	"github.com/walteh/webauthn/pkg/storage"
+	"github.com/walteh/webauthn/pkg/wellknown"
+)
+
+const fingerprint = "14:6d:e9:83:c5:73:06:50:d8:ee:b9:95:2f:34:fc:64:16:a0:83:42:e6:1d:be:a8:8a:04:96:b2:3f:cf:44:e5"
+
+func newRegistry(t *testing.T) *relyingparty.Registry {
+	t.Helper()
+
+	reg, err := relyingparty.NewRegistry(func(string) storage.Provider { return mockery.NewMockProvider_storage(t) },
+		relyingparty.NewTenant("acme", relyingparty.NewSimpleRelyingParty("Acme", "acme.com", "https://acme.com")).
+			WithOrigins("https://acme.com", "https://acme.co.uk", "https://*.acme.com", "http://localhost:*").
+			WithUnpublishedOrigins().
+			WithPolicy(relyingparty.Policy{
+				AppIDs:                     []string{"ABCDE12345.com.acme.app"},
+				PackageNames:               []string{"com.acme.app"},
+				APKCertificateFingerprints: []string{fingerprint},
+			}),
+		relyingparty.NewTenant("globex", relyingparty.NewSimpleRelyingParty("Globex", "globex.io", "https://globex.io")).
+			WithPolicy(relyingparty.Policy{PackageNames: []string{"io.globex.app"}}),
+	)
+	require.NoError(t, err)
+
+	return reg
+}
+
+func TestDocuments(t *testing.T) {
+	reg := newRegistry(t)
+
+	acme, _ := reg.Tenant("acme")
+	globex, _ := reg.Tenant("globex")
+
+	assert.Equal(t, []string{"https://acme.com", "https://acme.co.uk"}, wellknown.RelatedOriginsOf(acme).Origins)
+	assert.Equal(t, []string{"https://globex.io"}, wellknown.RelatedOriginsOf(globex).Origins)
+
+	assert.Equal(t, []string{"ABCDE12345.com.acme.app"}, wellknown.AppleAppSiteAssociationOf(acme).WebCredentials.Apps)
+	assert.Empty(t, wellknown.AppleAppSiteAssociationOf(globex).WebCredentials.Apps)
+
+	links, err := wellknown.AssetLinksOf(acme)
+	require.NoError(t, err)
+	assert.Equal(t, []wellknown.Statement{{
+		Relation: []string{wellknown.GetLoginCreds},
+		Target: wellknown.Target{
+			Namespace:              "android_app",
+			PackageName:            "com.acme.app",
+			SHA256CertFingerprints: []string{"14:6D:E9:83:C5:73:06:50:D8:EE:B9:95:2F:34:FC:64:16:A0:83:42:E6:1D:BE:A8:8A:04:96:B2:3F:CF:44:E5"},
+		},
+	}}, links)
+
+	// an android app without certificates can not be associated
+	links, err = wellknown.AssetLinksOf(globex)
+	require.NoError(t, err)
+	assert.Empty(t, links)
+
+	// the published origins are the ones the tenant accepts
+	matcher := acme.OriginMatcher()
+	for _, o := range wellknown.RelatedOriginsOf(acme).Origins {
+		assert.True(t, matcher.MatchOrigin(o), o)
+	}
+	assert.True(t, matcher.MatchOrigin("android:apk-key-hash:FG3pg8VzBlDY7rmVLzT8ZBagg0LmHb6oigSWsj_PROU"))
+
+	// and the ones it accepts without publishing are the ones it opted in to
+	assert.Equal(t, []string{"https://*.acme.com", "http://localhost:*"}, wellknown.Unpublished(acme))
+	assert.Empty(t, wellknown.Unpublished(globex))
+
+	body, ok, err := wellknown.Document(acme, wellknown.AppleAppSiteAssociationPath)
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.JSONEq(t, `{"webcredentials":{"apps":["ABCDE12345.com.acme.app"]}}`, string(body))
+
+	_, ok, _ = wellknown.Document(acme, "/.well-known/security.txt")
+	assert.False(t, ok)
+}
+
+func TestHandler(t *testing.T) {
+	reg := newRegistry(t)
+	handler := wellknown.NewHandler(relyingparty.NewSimpleRelyingParty("Nugg", "nugg.xyz", "https://nugg.xyz"))
+
+	serve := func(ctx context.Context, host, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil).WithContext(ctx)
+		req.Host = host
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("single relying party", func(t *testing.T) {
+		rec := serve(context.Background(), "nugg.xyz", wellknown.WebAuthnPath)
+		require.Equal(t, 200, rec.Code)
+		assert.Equal(t, wellknown.ContentType, rec.Header().Get("Content-Type"))
+		assert.JSONEq(t, `{"origins":["https://nugg.xyz"]}`, rec.Body.String())
+	})
+
+	t.Run("tenant by host", func(t *testing.T) {
+		ctx := relyingparty.WithResolver(context.Background(), reg)
+
+		rec := serve(ctx, "globex.io:443", wellknown.WebAuthnPath)
+		require.Equal(t, 200, rec.Code)
+		assert.JSONEq(t, `{"origins":["https://globex.io"]}`, rec.Body.String())
+
+		rec = serve(ctx, "acme.com", wellknown.AssetLinksPath)
+		require.Equal(t, 200, rec.Code)
+		var links []wellknown.Statement
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &links))
+		require.Len(t, links, 1)
+		assert.Equal(t, "com.acme.app", links[0].Target.PackageName)
+
+		rec = serve(ctx, "initech.com", wellknown.WebAuthnPath)
+		assert.Equal(t, 404, rec.Code)
+	})
+
+	t.Run("unknown path", func(t *testing.T) {
+		assert.Equal(t, 404, serve(context.Background(), "nugg.xyz", "/.well-known/other").Code)
+	})
+}
@@ -1,5 +1,12 @@
 package version
 
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
 var (
 	// Package is filled at linking time
 	Package = "local"
@@ -11,3 +18,20 @@ var (
 	// the program at linking time.
 	Revision = ""
 )
+
+// Build returns the version subcommand, printing what was filled in at linking time
+func Build(ctx context.Context) *cobra.Command {
+	return &cobra.Command{
+		Use:   "version",
+		Short: "print the version the binary was built from",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			out := fmt.Sprintf("%s %s", Package, Version)
+			if Revision != "" {
+				out += " " + Revision
+			}
+			_, err := fmt.Fprintln(cmd.OutOrStdout(), out)
+			return err
+		},
+	}
+}